@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tlog "pmdt.org/ttylog"
+)
+
+// Bind and unbind PCI devices using the sysfs driver_override and
+// drivers_probe files, the same way dpdk-devbind.py binds devices.
+
+// DefaultSysfs is the mount point of sysfs
+const DefaultSysfs = "/sys"
+
+// modprobe loads a kernel module, a variable to allow testing without modprobe
+var modprobe = func(module string) error {
+
+	if out, err := exec.Command("modprobe", module).CombinedOutput(); err != nil {
+		return fmt.Errorf("modprobe %s: %v %s", module, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SetSysfs sets the root of the sysfs tree, used to test with a fake sysfs
+func (db *BindInfo) SetSysfs(root string) {
+	db.sysfs = root
+}
+
+// sysPath returns the path of the file or directory in sysfs
+func (db *BindInfo) sysPath(elem ...string) string {
+
+	root := db.sysfs
+	if len(root) == 0 {
+		root = DefaultSysfs
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// pciPath returns the path in sysfs of a PCI device file
+func (db *BindInfo) pciPath(slot string, elem ...string) string {
+
+	return db.sysPath(append([]string{"bus", "pci", "devices", slot}, elem...)...)
+}
+
+// writeSysfs writes the value to the sysfs file, replaced in the tests.
+var writeSysfs = func(file, value string) error {
+
+	if err := ioutil.WriteFile(file, []byte(value), 0200); err != nil {
+		return fmt.Errorf("write %q to %s: %v", strings.TrimSpace(value), file, err)
+	}
+	return nil
+}
+
+// IsUioModule returns true if the driver is a DPDK compatible driver
+func IsUioModule(driver string) bool {
+
+	for _, m := range UioModules {
+		if m == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// ModuleLoaded returns true if the kernel module is loaded or built in
+func (db *BindInfo) ModuleLoaded(module string) bool {
+
+	name := strings.Replace(module, "-", "_", -1)
+	if _, err := os.Stat(db.sysPath("module", name)); err == nil {
+		return true
+	}
+	// Built in drivers only show up in the drivers directory
+	if _, err := os.Stat(db.sysPath("bus", "pci", "drivers", module)); err == nil {
+		return true
+	}
+	return false
+}
+
+// LoadModule loads the kernel module if it is not loaded
+func (db *BindInfo) LoadModule(module string) error {
+
+	if db.ModuleLoaded(module) {
+		return nil
+	}
+
+	tlog.InfoPrintf("Load kernel module %s\n", module)
+	if err := modprobe(module); err != nil {
+		return err
+	}
+	if !db.ModuleLoaded(module) {
+		return fmt.Errorf("module %s not loaded", module)
+	}
+	return nil
+}
+
+// CurrentDriver returns the driver the device is bound to from sysfs
+func (db *BindInfo) CurrentDriver(slot string) string {
+
+	link, err := os.Readlink(db.pciPath(slot, "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// KernelDriver returns the kernel driver of the device, which is the bound
+// driver unless it is a DPDK driver, then the first kernel module listed.
+func (d *DeviceClass) KernelDriver() string {
+
+	if len(d.Driver) > 0 && !IsUioModule(d.Driver) {
+		return d.Driver
+	}
+	for _, m := range strings.Split(d.Module, ",") {
+		m = strings.TrimSpace(m)
+		if len(m) > 0 && !IsUioModule(m) {
+			return m
+		}
+	}
+	return ""
+}
+
+// device returns the device for the slot if it can be changed
+func (db *BindInfo) device(slot string) (*DeviceClass, error) {
+
+	dev, ok := db.Devices[slot]
+	if !ok {
+		return nil, fmt.Errorf("device %s not found", slot)
+	}
+	if dev.Active {
+		return nil, fmt.Errorf("device %s is active, interface %s has a route", slot, dev.Interface)
+	}
+	return dev, nil
+}
+
+// Unbind the device from its driver and clear the driver override
+func (db *BindInfo) Unbind(slot string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.unbindSlot(slot)
+}
+
+func (db *BindInfo) unbindSlot(slot string) error {
+
+	dev, err := db.device(slot)
+	if err != nil {
+		return err
+	}
+	return db.unbind(dev)
+}
+
+func (db *BindInfo) unbind(dev *DeviceClass) error {
+
+	if driver := db.CurrentDriver(dev.Slot); len(driver) > 0 {
+		tlog.InfoPrintf("Unbind %s from %s\n", dev.Slot, driver)
+		if err := writeSysfs(db.pciPath(dev.Slot, "driver", "unbind"), dev.Slot); err != nil {
+			return err
+		}
+	}
+
+	// Writing a newline clears the override, kernels without driver_override
+	// do not have the file.
+	override := db.pciPath(dev.Slot, "driver_override")
+	if _, err := os.Stat(override); err == nil {
+		if err := writeSysfs(override, "\n"); err != nil {
+			return err
+		}
+	}
+	dev.Driver = ""
+
+	return nil
+}
+
+// Bind the device to the driver, the device is unbound from the current
+// driver first. The kernel module of a DPDK driver is loaded if needed.
+func (db *BindInfo) Bind(slot, driver string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.bind(slot, driver)
+}
+
+func (db *BindInfo) bind(slot, driver string) error {
+
+	dev, err := db.device(slot)
+	if err != nil {
+		return err
+	}
+	if len(driver) == 0 {
+		return fmt.Errorf("no driver given for %s", slot)
+	}
+	if db.CurrentDriver(slot) == driver {
+		dev.Driver = driver
+		return nil
+	}
+
+	if IsUioModule(driver) {
+		if err := db.LoadModule(driver); err != nil {
+			return err
+		}
+	}
+
+	override := db.pciPath(slot, "driver_override")
+	if _, err := os.Stat(override); err != nil {
+		return fmt.Errorf("device %s has no driver_override: %v", slot, err)
+	}
+
+	if err := db.unbind(dev); err != nil {
+		return err
+	}
+
+	tlog.InfoPrintf("Bind %s to %s\n", slot, driver)
+	if err := writeSysfs(override, driver); err != nil {
+		return err
+	}
+	if err := writeSysfs(db.sysPath("bus", "pci", "drivers_probe"), slot); err != nil {
+		return err
+	}
+
+	dev.Driver = db.CurrentDriver(slot)
+	if dev.Driver != driver {
+		tlog.WarnPrintf("Device %s bound to %q not %s\n", slot, dev.Driver, driver)
+	}
+
+	return nil
+}
@@ -0,0 +1,376 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// The device catalog is compiled in and can be extended or changed by the
+// user device files. Entries in a later file replace the entries with the
+// same name in the catalog or an earlier file.
+
+// DefaultDevices is the compiled in device catalog in TOML format.
+//
+// Each device maps to a GO structure called devbind.DeviceConfig
+//
+//	[IOAT-Bdw]                        # Device Name
+//	  group = "DMAGroup"              # Group for this device
+//	  desc = "Intel IOAT Broadwell"   # Device Description
+//	  vendor_id = "8086"              # Vendor ID
+//	  device_id = "6f20:6f21"         # List of device IDs
+//	  svendor_id = ""                 # Sub Vendor ID
+//	  sdevice_id = ""                 # Sub Device ID
+//	  selector = ""                   # Selector expression, see ParseSelector
+//	  [IOAT-Bdw.class]                # Device Class and SubClass
+//	    devclass = "08"               # Device Class
+//	    subclass = "00"               # Device SubClass
+//
+// All IDs are in hex values without leading '0x' prefix, empty values match
+// any device. The selector is combined with the ID fields, a key can not be
+// set in both. Groups: NetworkGroup, CryptoGroup, DMAGroup, EventdevGroup,
+// MempoolGroup, CompressGroup
+const DefaultDevices = `
+# =============== Network Group ===============
+[Network]
+  group = "NetworkGroup"
+  desc = "Network Controller"
+  selector = "class=02"
+
+[AVP-vNic]
+  group = "NetworkGroup"
+  desc = "AVP NIC"
+  vendor_id = "1af4"
+  device_id = "1110"
+  [AVP-vNic.class]
+    devclass = "05"
+
+[CaviumPKX]
+  group = "NetworkGroup"
+  desc = "Cavium PKX"
+  vendor_id = "177d"
+  device_id = "a0dd:a049"
+  [CaviumPKX.class]
+    devclass = "08"
+
+[IFPGA]
+  group = "NetworkGroup"
+  desc = "Intel FPGA Controller"
+  vendor_id = "8086"
+  device_id = "0b30"
+  [IFPGA.class]
+    devclass = "12"
+
+# =============== Crypto Group ===============
+[Encryption]
+  group = "CryptoGroup"
+  desc = "Encryption Controller"
+  [Encryption.class]
+    devclass = "10"
+
+[IntelProcessor]
+  group = "CryptoGroup"
+  desc = "Intel Processor"
+  [IntelProcessor.class]
+    devclass = "0b"
+
+[QAT]
+  group = "CryptoGroup"
+  desc = "Intel QuickAssist Technology"
+  vendor_id = "8086"
+  device_id = "0435:37c8:19e2:18ee:4940:4942:4944"
+  [QAT.class]
+    devclass = "0b"
+
+[QAT-VF]
+  group = "CryptoGroup"
+  desc = "Intel QuickAssist Technology VF"
+  vendor_id = "8086"
+  device_id = "0443:37c9:19e3:18ef:4941:4943:4945"
+  [QAT-VF.class]
+    devclass = "0b"
+
+# =============== DMA Group ===============
+[IOAT-Bdw]
+  group = "DMAGroup"
+  desc = "Intel IOAT Broadwell"
+  vendor_id = "8086"
+  device_id = "6f20:6f21:6f22:6f23:6f24:6f25:6f26:6f27:6f2e:6f2f"
+  [IOAT-Bdw.class]
+    devclass = "08"
+
+[IOAT-Skx]
+  group = "DMAGroup"
+  desc = "Intel IOAT Skylake"
+  vendor_id = "8086"
+  device_id = "2021"
+  [IOAT-Skx.class]
+    devclass = "08"
+
+[IOAT-Icx]
+  group = "DMAGroup"
+  desc = "Intel IOAT Icelake"
+  vendor_id = "8086"
+  device_id = "0b00"
+  [IOAT-Icx.class]
+    devclass = "08"
+
+[DSA-Spr]
+  group = "DMAGroup"
+  desc = "Intel Data Streaming Accelerator"
+  vendor_id = "8086"
+  device_id = "0b25"
+  [DSA-Spr.class]
+    devclass = "08"
+
+[Octeontx2DMA]
+  group = "DMAGroup"
+  desc = "Octeontx2 DMA"
+  vendor_id = "177d"
+  device_id = "a081"
+  [Octeontx2DMA.class]
+    devclass = "08"
+
+# =============== Eventdev Group ===============
+[CaviumSSO]
+  group = "EventdevGroup"
+  desc = "Cavium SSO"
+  vendor_id = "177d"
+  device_id = "a04b:a04d"
+  [CaviumSSO.class]
+    devclass = "08"
+
+[CaviumTIM]
+  group = "EventdevGroup"
+  desc = "Cavium TIM"
+  vendor_id = "177d"
+  device_id = "a051"
+  [CaviumTIM.class]
+    devclass = "08"
+
+[Octeontx2SSO]
+  group = "EventdevGroup"
+  desc = "Octeontx2 SSO"
+  vendor_id = "177d"
+  device_id = "a0f9:a0fa"
+  [Octeontx2SSO.class]
+    devclass = "08"
+
+[IntelDLB]
+  group = "EventdevGroup"
+  desc = "Intel Dynamic Load Balancer"
+  vendor_id = "8086"
+  device_id = "270b:2710:2714"
+  [IntelDLB.class]
+    devclass = "0b"
+
+# =============== Mempool Group ===============
+[CaviumFPA]
+  group = "MempoolGroup"
+  desc = "Cavium FPA"
+  vendor_id = "177d"
+  device_id = "a053"
+  [CaviumFPA.class]
+    devclass = "08"
+
+[Octeontx2NPA]
+  group = "MempoolGroup"
+  desc = "Octeontx2 NPA"
+  vendor_id = "177d"
+  device_id = "a0fb:a0fc"
+  [Octeontx2NPA.class]
+    devclass = "08"
+
+# =============== Compress Group ===============
+[IAA-Spr]
+  group = "CompressGroup"
+  desc = "Intel In-Memory Analytics Accelerator"
+  vendor_id = "8086"
+  device_id = "0cfe"
+  [IAA-Spr.class]
+    devclass = "08"
+
+[CaviumZIP]
+  group = "CompressGroup"
+  desc = "Cavium ZIP"
+  vendor_id = "177d"
+  device_id = "a037"
+  [CaviumZIP.class]
+    devclass = "12"
+`
+
+const (
+	devicesFile string = "devices.toml"
+	pmdtDir     string = "pmdt"
+	etcPmdtDir  string = "/etc/pmdt"
+)
+
+// DeviceFileSearchPath returns the user device files loaded after the
+// catalog, /etc/pmdt/devices.toml then $XDG_CONFIG_HOME/pmdt/devices.toml.
+func DeviceFileSearchPath() []string {
+
+	files := []string{filepath.Join(etcPmdtDir, devicesFile)}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if len(dir) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if len(dir) > 0 {
+		files = append(files, filepath.Join(dir, pmdtDir, devicesFile))
+	}
+
+	return files
+}
+
+func isHexID(s string, width int) bool {
+
+	return len(s) == width && isHex(s)
+}
+
+// validateConfig returns the errors found in a device entry
+func validateConfig(name string, cfg *DeviceConfig) []error {
+
+	errs := []error{}
+	bad := func(field, value, msg string) {
+		errs = append(errs, fmt.Errorf("[%s] %s %q %s", name, field, value, msg))
+	}
+
+	if !isGroup(cfg.Group) {
+		bad("group", cfg.Group, fmt.Sprintf("is not one of %v", ValidGroups))
+	}
+	if c := string(cfg.Class.ID); len(c) > 0 && !isHexID(c, 2) {
+		bad("devclass", c, "is not a 2 digit hex value")
+	}
+	if c := string(cfg.Class.Sub); len(c) > 0 && !isHexID(c, 2) {
+		bad("subclass", c, "is not a 2 digit hex value")
+	}
+	if v := string(cfg.Vendor); len(v) > 0 && !isHexID(v, 4) {
+		bad("vendor_id", v, "is not a 4 digit hex value")
+	}
+	if v := string(cfg.SVendor); len(v) > 0 && !isHexID(v, 4) {
+		bad("svendor_id", v, "is not a 4 digit hex value")
+	}
+	for field, list := range map[string]string{
+		"device_id": string(cfg.Device), "sdevice_id": string(cfg.SDevice)} {
+		if len(list) == 0 {
+			continue
+		}
+		for _, id := range strings.Split(list, ":") {
+			if !isHexID(id, 4) {
+				bad(field, list, "is not a ':' separated list of 4 digit hex values")
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	sel, err := cfg.Selector()
+	if err != nil {
+		bad("selector", cfg.Select, err.Error())
+	} else if len(sel.Classes) == 0 && len(sel.Vendors) == 0 && len(sel.Devices) == 0 {
+		errs = append(errs, fmt.Errorf("[%s] needs a devclass, vendor_id, device_id or selector to match devices", name))
+	}
+
+	return errs
+}
+
+// decodeDevices decodes and validates the TOML data, only the valid entries
+// are returned with the errors of the invalid entries.
+func decodeDevices(source, data string) (DevConfigs, []error) {
+
+	cfgs := make(DevConfigs)
+
+	md, err := toml.Decode(data, &cfgs)
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %v", source, err)}
+	}
+
+	errs := []error{}
+	for _, key := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("%s: unknown key %s", source, key))
+	}
+
+	names := []string{}
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := cfgs[name]
+		cfg.Name = name
+		if e := validateConfig(name, cfg); len(e) > 0 {
+			for _, err := range e {
+				errs = append(errs, fmt.Errorf("%s: %v", source, err))
+			}
+			delete(cfgs, name)
+			continue
+		}
+		cfg.sel, _ = cfg.Selector()
+	}
+
+	return cfgs, errs
+}
+
+// groupDevices creates the groups from the device configurations
+func groupDevices(cfgs DevConfigs) DevGroups {
+
+	grps := make(DevGroups)
+
+	names := []string{}
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := cfgs[name]
+		grps[v.Group] = append(grps[v.Group], v)
+	}
+	return grps
+}
+
+// LoadDevices loads the compiled in catalog merged with the device files in
+// the search path and the given files. Missing files in the search path are
+// skipped, the given files must exist. Invalid entries are skipped and
+// returned as errors.
+func LoadDevices(files ...string) (DevConfigs, DevGroups, []error) {
+
+	cfgs, errs := decodeDevices("default catalog", DefaultDevices)
+
+	merge := func(file string, required bool) {
+		dat, err := ioutil.ReadFile(file)
+		if err != nil {
+			if required || !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			return
+		}
+		c, e := decodeDevices(file, string(dat))
+		errs = append(errs, e...)
+		for name, cfg := range c {
+			cfgs[name] = cfg
+		}
+	}
+
+	for _, file := range DeviceFileSearchPath() {
+		merge(file, false)
+	}
+	for _, file := range files {
+		merge(file, true)
+	}
+
+	return cfgs, groupDevices(cfgs), errs
+}
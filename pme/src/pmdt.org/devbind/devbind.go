@@ -4,21 +4,23 @@
 package devbind
 
 import (
-	"fmt"
-	"log"
-	"os/exec"
-	"path/filepath"
-	"strings"
+	"sync"
 
 	"github.com/davecgh/go-spew/spew"
 	tlog "pmdt.org/ttylog"
 )
 
-// BindInfo - Device Binding information
+// BindInfo - Device Binding information. Binding, the VF changes and Refresh
+// change the devices, other goroutines read them with DeviceList and Device.
 type BindInfo struct {
 	Devices    DeviceList
 	CfgDevices DevConfigs
 	Groups     DevGroups
+	sysfs      string // Root of sysfs, empty for DefaultSysfs
+	procfs     string // Root of procfs, empty for DefaultProcfs
+	ids        *PCIIDs
+	loadErrors []error
+	lock       sync.RWMutex // Protects Devices and the devices in it
 }
 
 // UioModules supported
@@ -28,206 +30,91 @@ func init() {
 	tlog.Register("devBindLog")
 }
 
-// New - create a new DevBindInfo structure
-func New(devFile ...string) *BindInfo {
+// New - create a new DevBindInfo structure, the device catalog is merged
+// with the device files in the search path and the given device files.
+func New(devFiles ...string) *BindInfo {
 
 	db := &BindInfo{}
-	file := ""
-	if len(devFile) == 0 {
-		file = "devices.toml"
-	} else {
-		if len(devFile) > 1 {
-			return nil
-		}
-		file = devFile[0]
-	}
-
-	tlog.InfoPrintf("Process TOML device file (%s)\n", file)
 
 	db.Devices = make(DeviceList)
-	db.CfgDevices = make(DevConfigs)
-	db.Groups = make(DevGroups)
-
-	db.getDetails(db.CfgDevices)
-
-	for k, d := range db.Devices {
-		tlog.DebugPrintf("Slot: %s = %+v\n", k, d)
-	}
 
-	if cfgs, grps, err := LoadDeviceFile(file); err != nil {
-		log.Fatal(err)
-	} else {
-		db.CfgDevices = cfgs
-		db.Groups = grps
+	db.CfgDevices, db.Groups, db.loadErrors = LoadDevices(devFiles...)
+	for _, err := range db.loadErrors {
+		tlog.ErrorPrintf("Device file: %v\n", err)
 	}
 	tlog.DebugPrintf("===== CfgDevices:\n%s\n", spew.Sdump(db.CfgDevices))
 	tlog.DebugPrintf("===== Groups:\n%s\n", spew.Sdump(db.Groups))
 
 	db.getDetails(db.CfgDevices)
 
+	for k, d := range db.Devices {
+		tlog.DebugPrintf("Slot: %s = %+v\n", k, d)
+	}
+
 	return db
 }
 
-func checkOutput(args ...string) (string, error) {
-
-	baseCmd := args[0]
-	cmdArgs := args[1:]
-
-	cmd := exec.Command(baseCmd, cmdArgs...)
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	return string(out), nil
+// LoadErrors returns the errors found loading the device files
+func (db *BindInfo) LoadErrors() []error {
+	return db.loadErrors
 }
 
-func (db *BindInfo) getDeviceDetails(dev *DeviceClass) {
-
-	paths, err := filepath.Glob(fmt.Sprintf("/sys/bus/pci/devices/%s/net", dev.Slot))
-	if err != nil {
-		return
-	}
-
-	for _, path := range paths {
-		files := []string{}
+// Refresh the device list from sysfs
+func (db *BindInfo) Refresh() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 
-		ifaces, err := filepath.Glob(path + "/*")
+	db.refresh()
+}
 
-		if err != nil {
-			continue
-		}
+func (db *BindInfo) refresh() {
 
-		tlog.DebugPrintf("Interfaces: %s\n", ifaces)
+	db.Devices = make(DeviceList)
+	db.getDetails(db.CfgDevices)
+}
 
-		for _, iface := range ifaces {
-			files = append(files, filepath.Base(iface))
-		}
-		dev.Interface = strings.Join(files, ",")
-	}
-	dev.SSHIf = ""
-	dev.Active = false
+// DeviceList returns a copy of the devices, a refresh or bind on another
+// goroutine does not change the copy
+func (db *BindInfo) DeviceList() DeviceList {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 
-	out, err := checkOutput("ip", "-o", "route")
-	if err != nil {
-		return
+	list := make(DeviceList, len(db.Devices))
+	for slot, d := range db.Devices {
+		dev := *d
+		list[slot] = &dev
 	}
-	devLines := strings.Split(out, "\n")
+	return list
+}
 
-	for _, route := range devLines {
-		words := strings.Split(route, " ")
+// Device returns a copy of the device in the slot
+func (db *BindInfo) Device(slot string) (*DeviceClass, bool) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
 
-		if strings.Contains(words[0], "169.254.") {
-			continue
-		}
-		for i, word := range words {
-			if word == "dev" {
-				iface := words[i+1]
-				for _, dev := range db.Devices {
-					if dev.Interface == iface {
-						dev.Active = true
-					}
-				}
-			}
-		}
+	d, ok := db.Devices[slot]
+	if !ok {
+		return nil, false
 	}
+	dev := *d
+	return &dev, true
 }
 
+// getDetails of the devices in sysfs matching the device configurations
 func (db *BindInfo) getDetails(devicesType DevConfigs) {
 
-	out, err := checkOutput("lspci", "-Dvmmnnk")
-	if err != nil {
-		return
-	}
-	devLines := strings.Split(out, "\n")
-
-	dev := &DeviceClass{}
-	for _, devLine := range devLines {
-		if len(devLine) == 0 {
-			for _, d := range devicesType {
-				if len(dev.Slot) == 0 {
-					break
-				}
-				if compareDevices(d, dev) {
-					db.Devices[dev.Slot] = dev
-					tlog.DebugPrintf("Add: Slot %s, Class: %v, Vendor %s, Device %s, SVendor %s, SDevice %s\n",
-						dev.Slot, dev.Class.ID, dev.Vendor.ID, dev.Device.ID, dev.SVendor.ID, dev.SDevice.ID)
-					break
-				}
-			}
-			dev = &DeviceClass{}
-		} else {
-			vals := strings.Split(devLine, "\t")
-			name := strings.TrimRight(vals[0], ":")
-			value := vals[1]
-
-			switch name {
-			case "Slot":
-				dev.Slot = value
-				tlog.DebugPrintf("\nSlot   : %s\n", dev.Slot)
-			case "Class":
-				id, _, desc := devClassID(value)
-				dev.Class.ID = id
-				dev.Class.Str = desc
-				tlog.DebugPrintf("Class  : [%02x] %s\n", dev.Class.ID, dev.Class.Str)
-			case "Vendor":
-				id, desc := getDeviceID(value)
-				dev.Vendor.ID = VendorID(id)
-				dev.Vendor.Str = desc
-				tlog.DebugPrintf("Vendor : [%s] %s\n", dev.Vendor.ID, dev.Vendor.Str)
-			case "Device":
-				id, desc := getDeviceID(value)
-				dev.Device.ID = DeviceID(id)
-				dev.Device.Str = desc
-				tlog.DebugPrintf("Device : [%s] %s\n", dev.Device.ID, dev.Device.Str)
-			case "SVendor":
-				id, desc := getDeviceID(value)
-				dev.SVendor.ID = SVendorID(id)
-				dev.SVendor.Str = desc
-				tlog.DebugPrintf("SVendor: [%s] %s\n", dev.SVendor.ID, dev.SVendor.Str)
-			case "SDevice":
-				id, desc := getDeviceID(value)
-				dev.SDevice.ID = SDeviceID(id)
-				dev.SDevice.Str = desc
-				tlog.DebugPrintf("SDevice: [%s] %s\n", dev.SDevice.ID, dev.SDevice.Str)
-			case "Rev":
-				dev.Rev = value
-			case "Driver":
-				dev.Driver = value
-			case "Module":
-				dev.Module = value
-			case "NUMANode":
-				dev.NumaNode = value
+	for _, dev := range db.scanDevices() {
+		for _, d := range devicesType {
+			if compareDevices(d, dev) {
+				db.Devices[dev.Slot] = dev
+				tlog.DebugPrintf("Add: Slot %s, Class: %v, Vendor %s, Device %s, SVendor %s, SDevice %s\n",
+					dev.Slot, dev.Class.ID, dev.Vendor.ID, dev.Device.ID, dev.SVendor.ID, dev.SDevice.ID)
+				break
 			}
 		}
 	}
-	delete(db.Devices, "")
 
-	for _, dev := range db.Devices {
-		db.getDeviceDetails(dev)
-	}
-}
-
-func devClassID(str string) (DevClassID, DevSubClassID, string) {
-
-	start := strings.Index(str, "[")
-
-	if start == -1 {
-		return "FF", "FF", ""
-	}
-	devClass := str[start+1 : start+3]
-	subClass := str[start+2 : start+5]
-
-	return DevClassID(devClass), DevSubClassID(subClass), str[:start-1]
-}
-
-func getDeviceID(str string) (string, string) {
-	start := strings.Index(str, "[")
-	end := strings.Index(str, "]")
-
-	if start == -1 || end == -1 {
-		return "", ""
-	}
-	return str[start+1 : end], str[:start-1]
+	db.setActive(db.RouteInterfaces())
 }
 
 // FindDevicesByDeviceClass all devices matching the given device class
@@ -237,7 +124,8 @@ func (db *BindInfo) FindDevicesByDeviceClass(name string, devClasses []*DeviceCo
 
 	devices := make(map[string]*DeviceClass)
 
-	if len(db.Devices) == 0 {
+	list := db.DeviceList()
+	if len(list) == 0 {
 		tlog.WarnPrintf("Devices list is empty\n")
 		return nil
 	}
@@ -246,7 +134,7 @@ func (db *BindInfo) FindDevicesByDeviceClass(name string, devClasses []*DeviceCo
 		tlog.DebugPrintf("Search for: Class %v, Vendor %s, Device %s\n",
 			d.Class.ID, d.Vendor, d.Device)
 	}
-	for k, dev := range db.Devices {
+	for k, dev := range list {
 		for _, dc := range devClasses {
 			if compareDevices(dc, dev) {
 				tlog.DebugPrintf("dev: %v, %v, %v  **Found**\n",
@@ -258,22 +146,12 @@ func (db *BindInfo) FindDevicesByDeviceClass(name string, devClasses []*DeviceCo
 	return devices
 }
 
+// compareDevices returns true if the device matches the configuration
 func compareDevices(d1 *DeviceConfig, d2 *DeviceClass) bool {
 
-	cmpSDevice := func(d1 *DeviceConfig, d2 *DeviceClass) bool {
-		if len(d1.SDevice) >= 0 && len(d2.SDevice.ID) > 0 {
-			if len(d1.SDevice) == 0 || strings.Contains(string(d1.Device), string(d2.SDevice.ID)) {
-				return true
-			}
-		}
+	sel, err := d1.Selector()
+	if err != nil {
 		return false
 	}
-
-	if (len(d1.Class.ID) == 0 || d1.Class.ID == d2.Class.ID) &&
-		(len(d1.Vendor) == 0 || d2.Vendor.ID == d1.Vendor) &&
-		(len(d1.Device) == 0 || strings.Contains(string(d1.Device), string(d2.Device.ID))) &&
-		cmpSDevice(d1, d2) {
-		return true
-	}
-	return false
+	return sel.Match(d2)
 }
@@ -4,7 +4,13 @@
 package devbind
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"testing"
 )
@@ -17,3 +23,1071 @@ func TestClose(t *testing.T) {
 	fmt.Printf("Close Devbind\n")
 
 }
+
+// fakeSysfs creates a sysfs tree with a device bound to ixgbe and an active
+// device bound to i40e.
+func fakeSysfs(t *testing.T) (string, *BindInfo) {
+
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := []string{
+		"bus/pci/drivers/ixgbe",
+		"bus/pci/drivers/i40e",
+		"bus/pci/devices/0000:01:00.0",
+		"bus/pci/devices/0000:02:00.0",
+		"module/vfio_pci",
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{
+		"bus/pci/drivers_probe",
+		"bus/pci/drivers/ixgbe/unbind",
+		"bus/pci/drivers/i40e/unbind",
+		"bus/pci/devices/0000:01:00.0/driver_override",
+		"bus/pci/devices/0000:02:00.0/driver_override",
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, f), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"bus/pci/devices/0000:01:00.0/driver": "../../drivers/ixgbe",
+		"bus/pci/devices/0000:02:00.0/driver": "../../drivers/i40e",
+	}
+	for l, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := &BindInfo{Devices: make(DeviceList)}
+	db.SetSysfs(root)
+	db.Devices["0000:01:00.0"] = &DeviceClass{Slot: "0000:01:00.0", Driver: "ixgbe",
+		Module: "ixgbe", Interface: "eth1"}
+	db.Devices["0000:02:00.0"] = &DeviceClass{Slot: "0000:02:00.0", Driver: "i40e",
+		Module: "i40e", Interface: "eth0", Active: true}
+
+	return root, db
+}
+
+func readFile(t *testing.T, root, file string) string {
+
+	dat, err := ioutil.ReadFile(filepath.Join(root, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(dat)
+}
+
+func TestBind(t *testing.T) {
+
+	root, db := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	slot := "0000:01:00.0"
+	if d := db.CurrentDriver(slot); d != "ixgbe" {
+		t.Errorf("CurrentDriver = %q", d)
+	}
+
+	if err := db.Bind(slot, "vfio-pci"); err != nil {
+		t.Fatal(err)
+	}
+	if s := readFile(t, root, "bus/pci/drivers/ixgbe/unbind"); s != slot {
+		t.Errorf("unbind = %q", s)
+	}
+	if s := readFile(t, root, "bus/pci/devices/"+slot+"/driver_override"); s != "vfio-pci" {
+		t.Errorf("driver_override = %q", s)
+	}
+	if s := readFile(t, root, "bus/pci/drivers_probe"); s != slot {
+		t.Errorf("drivers_probe = %q", s)
+	}
+
+	if d := db.Devices[slot].KernelDriver(); d != "ixgbe" {
+		t.Errorf("KernelDriver = %q", d)
+	}
+
+	if err := db.Unbind(slot); err != nil {
+		t.Fatal(err)
+	}
+	if s := readFile(t, root, "bus/pci/devices/"+slot+"/driver_override"); s != "\n" {
+		t.Errorf("driver_override not cleared %q", s)
+	}
+}
+
+func TestBindRefused(t *testing.T) {
+
+	root, db := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	// Devices with a route must not be touched
+	if err := db.Bind("0000:02:00.0", "vfio-pci"); err == nil {
+		t.Errorf("Bind of an active device should fail")
+	}
+	if err := db.Unbind("0000:02:00.0"); err == nil {
+		t.Errorf("Unbind of an active device should fail")
+	}
+	if s := readFile(t, root, "bus/pci/drivers/i40e/unbind"); s != "" {
+		t.Errorf("active device was unbound %q", s)
+	}
+
+	if err := db.Bind("0000:09:00.0", "vfio-pci"); err == nil {
+		t.Errorf("Bind of a missing device should fail")
+	}
+}
+
+func TestLoadModule(t *testing.T) {
+
+	root, db := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	saved := modprobe
+	defer func() { modprobe = saved }()
+
+	modprobe = func(module string) error {
+		return fmt.Errorf("modprobe %s failed", module)
+	}
+	if err := db.Bind("0000:01:00.0", "igb_uio"); err == nil {
+		t.Errorf("Bind with a module that does not load should fail")
+	}
+
+	loaded := ""
+	modprobe = func(module string) error {
+		loaded = module
+		return os.MkdirAll(filepath.Join(root, "module", module), 0755)
+	}
+	if err := db.LoadModule("igb_uio"); err != nil || loaded != "igb_uio" {
+		t.Errorf("LoadModule = %v, loaded %q", err, loaded)
+	}
+	if !db.ModuleLoaded("vfio-pci") || db.ModuleLoaded("uio_pci_generic") {
+		t.Errorf("ModuleLoaded wrong")
+	}
+}
+
+const testPCIIDs = `# pci.ids test data
+8086  Intel Corporation
+	1572  Ethernet Controller X710 for 10GbE SFP+
+		8086 0001  Ethernet Converged Network Adapter X710-4
+	37c8  C62x Chipset QuickAssist Technology
+1af4  Red Hat, Inc.
+	1000  Virtio network device
+
+# List of known device classes
+C 02  Network controller
+	00  Ethernet controller
+C 0b  Processor
+	40  Co-processor
+`
+
+// writeTree writes the files of a fake file system under root
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParsePCIIDs(t *testing.T) {
+
+	ids, err := ParsePCIIDs(strings.NewReader(testPCIIDs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := ids.Vendor("8086"); s != "Intel Corporation" {
+		t.Errorf("Vendor = %q", s)
+	}
+	if s := ids.Device("8086", "37c8"); s != "C62x Chipset QuickAssist Technology" {
+		t.Errorf("Device = %q", s)
+	}
+	if s := ids.SubDevice("8086", "1572", "8086", "0001"); s != "Ethernet Converged Network Adapter X710-4" {
+		t.Errorf("SubDevice = %q", s)
+	}
+	if s := ids.Class("02"); s != "Network controller" {
+		t.Errorf("Class = %q", s)
+	}
+	if s := ids.SubClass("0b", "40"); s != "Co-processor" {
+		t.Errorf("SubClass = %q", s)
+	}
+	if s := ids.Device("1af4", "ffff"); s != "" {
+		t.Errorf("missing device = %q", s)
+	}
+
+	var none *PCIIDs
+	if s := none.Vendor("8086"); s != "" {
+		t.Errorf("nil database = %q", s)
+	}
+}
+
+func TestScanDevices(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "devbind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	dev := "sys/bus/pci/devices/0000:18:00.0/"
+	qat := "sys/bus/pci/devices/0000:3d:00.0/"
+	writeTree(t, root, map[string]string{
+		dev + "class":                     "0x020000\n",
+		dev + "vendor":                    "0x8086\n",
+		dev + "device":                    "0x1572\n",
+		dev + "subsystem_vendor":          "0x8086\n",
+		dev + "subsystem_device":          "0x0001\n",
+		dev + "revision":                  "0x02\n",
+		dev + "numa_node":                 "1\n",
+		dev + "modalias":                  "pci:v00008086d00001572sv00008086sd00000001bc02sc00i00\n",
+		dev + "net/ens1f1/type":           "1\n",
+		dev + "net/ens1f0/type":           "1\n",
+		qat + "class":                     "0x0b4000\n",
+		qat + "vendor":                    "0x8086\n",
+		qat + "device":                    "0x37c8\n",
+		qat + "subsystem_vendor":          "0x8086\n",
+		qat + "subsystem_device":          "0x0000\n",
+		qat + "numa_node":                 "-1\n",
+		qat + "modalias":                  "pci:v00008086d000037C8sv00008086sd00000000bc0Bsc40i00\n",
+		"sys/bus/pci/drivers/i40e/unbind": "",
+		"proc/sys/kernel/osrelease":       "5.15.0-test\n",
+		"proc/net/route": "Iface\tDestination\tGateway\tFlags\n" +
+			"ens1f1\t00000000\t0101A8C0\t0003\n" +
+			"eno1\t0000FEA9\t00000000\t0001\n",
+		"proc/net/ipv6_route": "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eno2\n" +
+			"fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eno3\n" +
+			"ff000000000000000000000000000000 08 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000004 00000000 00000001     eno3\n" +
+			"00000000000000000000000000000001 80 00000000000000000000000000000000 00 00000000000000000000000000000000 00000000 00000002 00000000 80200001       lo\n",
+		"lib/modules/5.15.0-test/modules.alias": "alias pci:v00008086d00001572sv*sd*bc*sc*i* i40e\n" +
+			"alias pci:v00008086d000037C8sv*sd*bc*sc*i* qat_c62x\n",
+	})
+	if err := os.Symlink("../../drivers/i40e", filepath.Join(root, dev, "driver")); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := modulesDir
+	defer func() { modulesDir = saved }()
+	modulesDir = filepath.Join(root, "lib/modules")
+
+	db := &BindInfo{Devices: make(DeviceList)}
+	db.SetSysfs(filepath.Join(root, "sys"))
+	db.SetProcfs(filepath.Join(root, "proc"))
+	if db.ids, err = ParsePCIIDs(strings.NewReader(testPCIIDs)); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &DeviceConfig{}
+	cfg.Class.ID = NetworkController
+	db.getDetails(DevConfigs{"Network": cfg})
+
+	if len(db.Devices) != 1 {
+		t.Fatalf("found %d network devices, want 1", len(db.Devices))
+	}
+	d := db.Devices["0000:18:00.0"]
+	if d == nil {
+		t.Fatalf("device 0000:18:00.0 not found")
+	}
+	if d.Class.ID != "02" || d.Class.Sub != "00" || d.Class.Str != "Ethernet controller" {
+		t.Errorf("class %+v", d.Class)
+	}
+	if d.Vendor.Str != "Intel Corporation" || d.Device.ID != "1572" || d.Rev != "02" {
+		t.Errorf("vendor/device %+v %+v rev %s", d.Vendor, d.Device, d.Rev)
+	}
+	if d.SDevice.Str != "Ethernet Converged Network Adapter X710-4" {
+		t.Errorf("subsystem %+v", d.SDevice)
+	}
+	if d.Driver != "i40e" || d.Module != "i40e" || d.NumaNode != "1" {
+		t.Errorf("driver %q module %q numa %q", d.Driver, d.Module, d.NumaNode)
+	}
+	if d.Interface != "ens1f0,ens1f1" || !d.Active {
+		t.Errorf("interface %q active %v", d.Interface, d.Active)
+	}
+
+	// The QAT device has no driver, no NUMA node and the module from the alias
+	devs := db.scanDevices()
+	if len(devs) != 2 {
+		t.Fatalf("scanned %d devices, want 2", len(devs))
+	}
+	for _, q := range devs {
+		if q.Slot != "0000:3d:00.0" {
+			continue
+		}
+		if q.Module != "qat_c62x" || q.NumaNode != "" || q.Driver != "" || q.Active {
+			t.Errorf("qat %+v", q)
+		}
+		if q.SDevice.Str != "C62x Chipset QuickAssist Technology" {
+			t.Errorf("qat description %q", q.SDevice.Str)
+		}
+	}
+
+	routes := db.RouteInterfaces()
+	if !routes["ens1f1"] || routes["eno1"] || !routes["eno2"] || routes["eno3"] || routes["lo"] {
+		t.Errorf("routes %v", routes)
+	}
+}
+
+func TestLoadDevices(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	saved := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", saved)
+	os.Setenv("XDG_CONFIG_HOME", root)
+
+	// The compiled in catalog alone must be valid
+	cfgs, grps, errs := LoadDevices()
+	if len(errs) != 0 {
+		t.Fatalf("default catalog errors %v", errs)
+	}
+	if cfgs["Network"] == nil || len(grps[NetworkGroup]) == 0 || len(grps[DMAGroup]) == 0 {
+		t.Errorf("default catalog missing groups %v", grps)
+	}
+
+	writeTree(t, root, map[string]string{
+		"pmdt/devices.toml": `
+[Network]
+  group = "NetworkGroup"
+  desc = "Only Intel NICs"
+  vendor_id = "8086"
+  [Network.class]
+    devclass = "02"
+
+[BadGroup]
+  group = "NoGroup"
+  vendor_id = "8086"
+
+[BadIDs]
+  group = "DMAGroup"
+  vendor_id = "80861"
+  device_id = "0b25:xyz"
+`,
+		"extra.toml": `
+[MyAccel]
+  group = "DMAGroup"
+  desc = "My accelerator"
+  vendor_id = "1234"
+  device_id = "0001"
+`,
+	})
+
+	cfgs, grps, errs = LoadDevices(filepath.Join(root, "extra.toml"))
+	if cfgs["Network"].Vendor != "8086" || cfgs["Network"].Desc != "Only Intel NICs" {
+		t.Errorf("user file did not replace Network %+v", cfgs["Network"])
+	}
+	if cfgs["MyAccel"] == nil || cfgs["MyAccel"].Name != "MyAccel" {
+		t.Errorf("--devices file not merged")
+	}
+	if cfgs["BadGroup"] != nil || cfgs["BadIDs"] != nil {
+		t.Errorf("invalid entries were loaded")
+	}
+	// BadGroup has a bad group, BadIDs has a bad vendor and device list
+	if len(errs) != 3 {
+		t.Errorf("errors %d, want 3: %v", len(errs), errs)
+	}
+	for _, e := range errs {
+		if !strings.Contains(e.Error(), "devices.toml") {
+			t.Errorf("error does not name the file: %v", e)
+		}
+	}
+	found := false
+	for _, c := range grps[DMAGroup] {
+		if c.Name == "MyAccel" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("MyAccel not in the DMA group")
+	}
+
+	if _, _, errs = LoadDevices(filepath.Join(root, "missing.toml")); len(errs) != 4 {
+		t.Errorf("missing --devices file errors %v", errs)
+	}
+	if _, _, err := ValidateDeviceFile(filepath.Join(root, "pmdt/devices.toml")); err == nil {
+		t.Errorf("ValidateDeviceFile should fail")
+	}
+}
+
+// sriovSysfs creates a PF with two of four VFs enabled, the second VF is
+// bound to vfio-pci.
+func sriovSysfs(t *testing.T) (string, *BindInfo) {
+
+	root, err := ioutil.TempDir("", "sriov")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pf := "bus/pci/devices/0000:18:00.0/"
+	files := map[string]string{
+		pf + "class":                      "0x020000\n",
+		pf + "sriov_totalvfs":             "4\n",
+		pf + "sriov_numvfs":               "2\n",
+		pf + "net/ens1f0/type":            "1\n",
+		"class/net/ens1f0/ifindex":        "5\n",
+		"bus/pci/drivers/i40e/unbind":     "",
+		"bus/pci/drivers/iavf/unbind":     "",
+		"bus/pci/drivers/vfio-pci/unbind": "",
+	}
+	// The device configurations match the devices with a subsystem device
+	files[pf+"vendor"] = "0x8086\n"
+	files[pf+"device"] = "0x1572\n"
+	files[pf+"driver_override"] = ""
+	files["bus/pci/drivers_probe"] = ""
+	for _, vf := range []string{"0000:18:02.0", "0000:18:02.1"} {
+		files["bus/pci/devices/"+vf+"/class"] = "0x020000\n"
+		files["bus/pci/devices/"+vf+"/vendor"] = "0x8086\n"
+		files["bus/pci/devices/"+vf+"/device"] = "0x154c\n"
+		files["bus/pci/devices/"+vf+"/driver_override"] = ""
+	}
+	writeTree(t, root, files)
+
+	links := map[string]string{
+		pf + "driver":                         "../../drivers/i40e",
+		pf + "virtfn0":                        "../0000:18:02.0",
+		pf + "virtfn1":                        "../0000:18:02.1",
+		"bus/pci/devices/0000:18:02.0/physfn": "../0000:18:00.0",
+		"bus/pci/devices/0000:18:02.0/driver": "../../drivers/iavf",
+		"bus/pci/devices/0000:18:02.1/physfn": "../0000:18:00.0",
+		"bus/pci/devices/0000:18:02.1/driver": "../../drivers/vfio-pci",
+	}
+	for l, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &DeviceConfig{}
+	cfg.Class.ID = NetworkController
+
+	db := &BindInfo{Devices: make(DeviceList), ids: &PCIIDs{},
+		CfgDevices: DevConfigs{"Network": cfg}}
+	db.SetSysfs(root)
+	db.SetProcfs(filepath.Join(root, "proc"))
+	for _, slot := range []string{"0000:18:00.0", "0000:18:02.0", "0000:18:02.1"} {
+		db.Devices[slot] = db.readDevice(slot, nil)
+	}
+
+	return root, db
+}
+
+func TestSRIOV(t *testing.T) {
+
+	root, db := sriovSysfs(t)
+	defer os.RemoveAll(root)
+
+	pf := db.Devices["0000:18:00.0"]
+	if !pf.IsPF() || pf.IsVF() || pf.TotalVFs != 4 || pf.NumVFs != 2 {
+		t.Errorf("PF %+v", pf)
+	}
+	if strings.Join(pf.VFs, " ") != "0000:18:02.0 0000:18:02.1" {
+		t.Errorf("VFs %v", pf.VFs)
+	}
+	vf := db.Devices["0000:18:02.1"]
+	if !vf.IsVF() || vf.PhysFn != pf.Slot || vf.VFIndex != 1 || vf.Driver != "vfio-pci" {
+		t.Errorf("VF %+v", vf)
+	}
+
+	// A VF bound to a DPDK driver blocks changing the number of VFs
+	if err := db.SetNumVFs(pf.Slot, 3); err == nil {
+		t.Errorf("SetNumVFs with a VF bound to vfio-pci should fail")
+	}
+	if err := db.SetNumVFs(pf.Slot, 5); err == nil {
+		t.Errorf("SetNumVFs above sriov_totalvfs should fail")
+	}
+	if err := db.SetNumVFs("0000:18:02.0", 1); err == nil {
+		t.Errorf("SetNumVFs on a VF should fail")
+	}
+
+	if err := os.Remove(filepath.Join(root, "bus/pci/devices/0000:18:02.1/driver")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetNumVFs(pf.Slot, 3); err != nil {
+		t.Fatal(err)
+	}
+	if s := readFile(t, root, "bus/pci/devices/0000:18:00.0/sriov_numvfs"); s != "3" {
+		t.Errorf("sriov_numvfs = %q", s)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+
+	root, db := sriovSysfs(t)
+	defer os.RemoveAll(root)
+
+	// The devices are read on the timer while the UI refreshes them, run with
+	// -race to check the lock
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 50; i++ {
+			db.Refresh()
+		}
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		for _, d := range db.FindDevicesByDeviceClass("Network", []*DeviceConfig{db.CfgDevices["Network"]}) {
+			_ = d.Driver
+		}
+		db.VfioReadiness("0000:18:00.0")
+	}
+
+	// The copies are not the devices of the list
+	list := db.DeviceList()
+	if len(list) != 3 {
+		t.Fatalf("found %d devices, want 3", len(list))
+	}
+	list["0000:18:00.0"].Driver = "changed"
+	if d, ok := db.Device("0000:18:00.0"); !ok || d.Driver != "i40e" {
+		t.Errorf("device %+v changed by its copy", d)
+	}
+}
+
+func TestSetVF(t *testing.T) {
+
+	root, db := sriovSysfs(t)
+	defer os.RemoveAll(root)
+
+	saved := netlinkRequest
+	defer func() { netlinkRequest = saved }()
+
+	var sent []byte
+	netlinkRequest = func(msg []byte) error {
+		sent = msg
+		return nil
+	}
+
+	db.Devices["0000:18:00.0"].Interface = "ens1f0"
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	if err := db.SetVFMac("0000:18:02.1", mac); err != nil {
+		t.Fatal(err)
+	}
+	// nlmsghdr, ifinfomsg, IFLA_VFINFO_LIST, IFLA_VF_INFO, IFLA_VF_MAC
+	want := []byte{
+		80, 0, 0, 0, 19, 0, 5, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		48, 0, 22, 0x80, 44, 0, 1, 0x80, 40, 0, 1, 0,
+		1, 0, 0, 0, 2, 0, 0, 0, 0, 1,
+	}
+	want = append(want, make([]byte, 80-len(want))...)
+	if !bytes.Equal(sent, want) {
+		t.Errorf("VF MAC message\n%v\nwant\n%v", sent, want)
+	}
+
+	if err := db.SetVFVlan("0000:18:02.0", 100, 3); err != nil {
+		t.Fatal(err)
+	}
+	want = []byte{
+		56, 0, 0, 0, 19, 0, 5, 0, 1, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		24, 0, 22, 0x80, 20, 0, 1, 0x80, 16, 0, 2, 0,
+		0, 0, 0, 0, 100, 0, 0, 0, 3, 0, 0, 0,
+	}
+	if !bytes.Equal(sent, want) {
+		t.Errorf("VF VLAN message\n%v\nwant\n%v", sent, want)
+	}
+
+	if err := db.SetVFVlan("0000:18:02.0", 4096, 0); err == nil {
+		t.Errorf("SetVFVlan with VLAN 4096 should fail")
+	}
+	if err := db.SetVFMac("0000:18:00.0", mac); err == nil {
+		t.Errorf("SetVFMac on a PF should fail")
+	}
+}
+
+func TestVfioReadiness(t *testing.T) {
+
+	root, db := fakeSysfs(t)
+	defer os.RemoveAll(root)
+
+	proc, err := ioutil.TempDir("", "procfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proc)
+	db.SetProcfs(proc)
+
+	// Without groups the device can not use vfio
+	if r := db.VfioReadiness("0000:01:00.0"); r.Ready || r.Group != "" {
+		t.Errorf("no IOMMU readiness %+v", r)
+	}
+	writeTree(t, root, map[string]string{
+		"module/vfio/parameters/enable_unsafe_noiommu_mode": "Y\n",
+	})
+	if r := db.VfioReadiness("0000:01:00.0"); !r.Ready {
+		t.Errorf("no-IOMMU mode readiness %+v", r)
+	}
+
+	writeTree(t, proc, map[string]string{
+		"cmdline": "BOOT_IMAGE=/vmlinuz intel_iommu=on iommu=pt quiet\n",
+	})
+	writeTree(t, root, map[string]string{
+		"module/vfio/parameters/enable_unsafe_noiommu_mode": "N\n",
+	})
+	for _, d := range []string{"kernel/iommu_groups/12/devices", "kernel/iommu_groups/13/devices"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"bus/pci/devices/0000:01:00.0/iommu_group":    "../../../kernel/iommu_groups/12",
+		"bus/pci/devices/0000:02:00.0/iommu_group":    "../../../kernel/iommu_groups/12",
+		"kernel/iommu_groups/12/devices/0000:01:00.0": "../../../../bus/pci/devices/0000:01:00.0",
+		"kernel/iommu_groups/12/devices/0000:02:00.0": "../../../../bus/pci/devices/0000:02:00.0",
+	}
+	for l, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := db.IOMMU()
+	if !st.Enabled || !st.CmdlineOn || !st.Passthrough || st.NoIOMMU || st.Groups != 2 {
+		t.Errorf("IOMMU status %+v", st)
+	}
+	if strings.Join(st.Cmdline, " ") != "intel_iommu=on iommu=pt" {
+		t.Errorf("IOMMU cmdline %v", st.Cmdline)
+	}
+
+	writeTree(t, proc, map[string]string{
+		"cmdline": "BOOT_IMAGE=/vmlinuz intel_iommu=on,sm_on quiet\n",
+	})
+	if st := db.IOMMU(); !st.CmdlineOn || st.Passthrough {
+		t.Errorf("IOMMU option list status %+v", st)
+	}
+	writeTree(t, proc, map[string]string{
+		"cmdline": "BOOT_IMAGE=/vmlinuz intel_iommu=sm_on iommu=pt quiet\n",
+	})
+	if st := db.IOMMU(); st.CmdlineOn || !st.Passthrough {
+		t.Errorf("IOMMU without on status %+v", st)
+	}
+
+	// The other device in the group is still on i40e
+	r := db.VfioReadiness("0000:01:00.0")
+	if r.Ready || r.Group != "12" || len(r.Members) != 1 || r.Members[0].Driver != "i40e" {
+		t.Errorf("shared group readiness %+v", r)
+	}
+
+	if err := os.Remove(filepath.Join(root, "bus/pci/devices/0000:02:00.0/driver")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../drivers/vfio-pci", filepath.Join(root, "bus/pci/devices/0000:02:00.0/driver")); err != nil {
+		t.Fatal(err)
+	}
+	if r := db.VfioReadiness("0000:01:00.0"); !r.Ready || r.Group != "12" {
+		t.Errorf("readiness %+v", r)
+	}
+
+	// Active devices are never ready
+	if r := db.VfioReadiness("0000:02:00.0"); r.Ready {
+		t.Errorf("active device readiness %+v", r)
+	}
+}
+
+const testProfile = `
+[[device]]
+  slot = "0000:18:00.0"
+  num_vfs = 3
+[[device]]
+  selector = "8086:154c"
+  driver = "vfio-pci"
+`
+
+func TestProfile(t *testing.T) {
+
+	root, db := sriovSysfs(t)
+	defer os.RemoveAll(root)
+
+	saved := modprobe
+	defer func() { modprobe = saved }()
+	modprobe = func(module string) error {
+		return os.MkdirAll(filepath.Join(root, "module", module), 0755)
+	}
+
+	bad := []string{
+		"[[device]]\n  driver = \"vfio-pci\"\n",
+		"[[device]]\n  slot = \"0000:18:00.0\"\n",
+		"[[device]]\n  selector = \"8086\"\n  driver = \"vfio-pci\"\n",
+		"[[device]]\n  slot = \"0000:18:00.0\"\n  num_vfs = -1\n",
+		"[[device]]\n  slot = \"0000:18:00.0\"\n  vfs = 1\n",
+	}
+	for _, data := range bad {
+		if _, err := ParseProfile("bad", data); err == nil {
+			t.Errorf("ParseProfile(%q) should fail", data)
+		}
+	}
+
+	p, err := ParseProfile("test", testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, errs := db.Plan(p)
+	if len(errs) != 0 {
+		t.Errorf("Plan errors %v", errs)
+	}
+	diff := []string{}
+	for _, c := range changes {
+		diff = append(diff, c.String())
+	}
+	want := "0000:18:00.0  VFs 2 -> 3|0000:18:02.0  iavf -> vfio-pci"
+	if strings.Join(diff, "|") != want {
+		t.Errorf("Plan\n%s\nwant\n%s", strings.Join(diff, "|"), want)
+	}
+
+	// The VF on vfio-pci blocks the VF change, the binding is still applied
+	done, errs := db.Apply(p)
+	if len(errs) != 1 || len(done) != 1 || done[0].Slot != "0000:18:02.0" {
+		t.Errorf("Apply done %v errors %v", done, errs)
+	}
+	if s := readFile(t, root, "bus/pci/devices/0000:18:02.0/driver_override"); s != "vfio-pci" {
+		t.Errorf("driver_override = %q", s)
+	}
+
+	// The saved profile of the current state loads back the same
+	file := filepath.Join(root, "profiles", "current.toml")
+	cur := db.CurrentProfile("current")
+	if err := cur.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	p, err = LoadProfile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "current" || len(p.Devices) != 2 || p.Devices[0].NumVFs == nil ||
+		*p.Devices[0].NumVFs != 2 || p.Devices[1].Slot != "0000:18:02.1" || p.Devices[1].Driver != "vfio-pci" {
+		t.Errorf("saved profile %+v", p)
+	}
+}
+
+func testDevice(class, sub, vendor, device, svendor, sdevice, driver, numa string) *DeviceClass {
+
+	d := &DeviceClass{Driver: driver, NumaNode: numa}
+	d.Class.ID = DevClassID(class)
+	d.Class.Sub = DevSubClassID(sub)
+	d.Vendor.ID = VendorID(vendor)
+	d.Device.ID = DeviceID(device)
+	d.SVendor.ID = SVendorID(svendor)
+	d.SDevice.ID = SDeviceID(sdevice)
+	return d
+}
+
+func TestSelector(t *testing.T) {
+
+	x710 := testDevice("02", "00", "8086", "1572", "8086", "0001", "i40e", "1")
+	vf := testDevice("02", "00", "8086", "154c", "", "", "vfio-pci", "")
+	dev157 := testDevice("02", "00", "8086", "157", "8086", "0000", "", "0")
+
+	tests := []struct {
+		expr  string
+		dev   *DeviceClass
+		match bool
+	}{
+		{"", x710, true},
+		{"class=02", x710, true},
+		{"class=02 subclass=00", x710, true},
+		{"class=* subclass=*", vf, true},
+		{"class=0b", x710, false},
+		{"vendor=8086 device=1572,158b", x710, true},
+		{"vendor=8086 device=158b", x710, false},
+		{"device=1572", dev157, false},
+		{"8086:1572", x710, true},
+		{"8086:*", vf, true},
+		{"svendor=8086 sdevice=0001", x710, true},
+		{"sdevice=0001", vf, false},
+		{"driver=vfio-pci,igb_uio", vf, true},
+		{"driver=vfio-pci", x710, false},
+		{"numa=1", x710, true},
+		{"numa=0", vf, false},
+		{"VENDOR=0x8086 device=154C", vf, true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tt.expr, err)
+			continue
+		}
+		if m := sel.Match(tt.dev); m != tt.match {
+			t.Errorf("%q Match(%s) = %v, want %v", tt.expr, tt.dev.Device.ID, m, tt.match)
+		}
+	}
+
+	for _, expr := range []string{"class=2", "vendor=80861", "foo=1", "device=", "device=1572,,158b", "8086"} {
+		if _, err := ParseSelector(expr); err == nil {
+			t.Errorf("ParseSelector(%q) should fail", expr)
+		}
+	}
+
+	sel, _ := ParseSelector("device=1572 8086:158b class=02")
+	if s := sel.String(); s != "class=02 vendor=8086 device=1572,158b" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestCompareDevices(t *testing.T) {
+
+	x710 := testDevice("02", "00", "8086", "1572", "8086", "0001", "i40e", "1")
+	noSub := testDevice("02", "00", "8086", "1572", "", "", "", "")
+	dev157 := testDevice("02", "00", "8086", "157", "", "", "", "")
+
+	cfg := func(class, vendor, device, sdevice, sel string) *DeviceConfig {
+		c := &DeviceConfig{Vendor: VendorID(vendor), Device: DeviceID(device),
+			SDevice: SDeviceID(sdevice), Select: sel}
+		c.Class.ID = DevClassID(class)
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		cfg   *DeviceConfig
+		dev   *DeviceClass
+		match bool
+	}{
+		{"class", cfg("02", "", "", "", ""), x710, true},
+		{"no subsystem", cfg("02", "", "", "", ""), noSub, true},
+		{"device list", cfg("", "8086", "158b:1572", "", ""), x710, true},
+		{"device prefix", cfg("", "8086", "1572", "", ""), dev157, false},
+		{"sdevice", cfg("", "8086", "1572", "0001", ""), x710, true},
+		{"sdevice mismatch", cfg("", "8086", "1572", "0002", ""), x710, false},
+		{"sdevice is not the device", cfg("", "8086", "1572", "1572", ""), x710, false},
+		{"selector", cfg("", "", "", "", "class=02 driver=i40e"), x710, true},
+		{"selector and ids", cfg("02", "", "", "", "numa=0"), x710, false},
+		{"both set", cfg("02", "", "", "", "class=02"), x710, false},
+	}
+	for _, tt := range tests {
+		if m := compareDevices(tt.cfg, tt.dev); m != tt.match {
+			t.Errorf("%s: compareDevices = %v, want %v", tt.name, m, tt.match)
+		}
+	}
+}
+
+// dsaSysfs creates an idxd tree with dsa0 on 0000:6a:01.0, 4 engines, 4
+// groups and 8 WQs, WQ wq0.5 is configured.
+func dsaSysfs(t *testing.T) (string, *BindInfo) {
+
+	root, err := ioutil.TempDir("", "dsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := "devices/pci0000:6a/0000:6a:01.0/dsa0/"
+	files := map[string]string{
+		dev + "state":                 "enabled\n",
+		dev + "numa_node":             "0\n",
+		dev + "max_groups":            "4\n",
+		dev + "max_engines":           "4\n",
+		dev + "max_work_queues":       "8\n",
+		dev + "max_work_queues_size":  "128\n",
+		"bus/dsa/drivers/idxd/bind":   "",
+		"bus/dsa/drivers/idxd/unbind": "",
+		"bus/dsa/drivers/user/bind":   "",
+	}
+	bus := "bus/dsa/devices/"
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("%sengine0.%d/group_id", bus, i)] = "-1\n"
+		files[fmt.Sprintf("%sgroup0.%d/engines", bus, i)] = "\n"
+		files[fmt.Sprintf("%sgroup0.%d/work_queues", bus, i)] = "\n"
+	}
+	files[bus+"group0.0/engines"] = "engine0.0 engine0.1\n"
+	for i := 0; i < 8; i++ {
+		wq := fmt.Sprintf("%swq0.%d/", bus, i)
+		for _, f := range []string{"name", "mode", "type", "priority", "group_id"} {
+			files[wq+f] = "\n"
+		}
+		files[wq+"state"] = "disabled\n"
+		files[wq+"size"] = "0\n"
+	}
+	files[bus+"wq0.5/size"] = "16\n"
+	files[bus+"wq0.5/mode"] = "shared\n"
+	writeTree(t, root, files)
+
+	if err := os.Symlink("../../../"+strings.TrimSuffix(dev, "/"), filepath.Join(root, bus, "dsa0")); err != nil {
+		t.Fatal(err)
+	}
+
+	db := &BindInfo{Devices: make(DeviceList)}
+	db.SetSysfs(root)
+
+	return root, db
+}
+
+func TestIdxd(t *testing.T) {
+
+	root, db := dsaSysfs(t)
+	defer os.RemoveAll(root)
+
+	devs := db.IdxdDevices()
+	if len(devs) != 1 {
+		t.Fatalf("found %d idxd devices, want 1", len(devs))
+	}
+	d := devs[0]
+	if d.Name != "dsa0" || d.Type != "dsa" || d.Slot != "0000:6a:01.0" || d.State != "enabled" ||
+		d.MaxWQs != 8 || d.MaxWQSize != 128 || len(d.Engines) != 4 || len(d.Groups) != 4 || len(d.WQs) != 8 {
+		t.Errorf("device %+v", d)
+	}
+	if strings.Join(d.Groups[0].Engines, " ") != "engine0.0 engine0.1" {
+		t.Errorf("group %+v", d.Groups[0])
+	}
+	if wq := d.WQs[5]; wq.Name != "wq0.5" || wq.Size != 16 || wq.Mode != "shared" {
+		t.Errorf("wq %+v", wq)
+	}
+
+	bad := []WQConfig{
+		{Device: "dsa1", NumWQs: 1},
+		{Device: "dsa0", NumWQs: 9},
+		{Device: "dsa0", NumWQs: 2, Size: 100},
+		{Device: "dsa0", NumWQs: 2, Mode: "batch"},
+	}
+	for _, cfg := range bad {
+		if err := db.ConfigureWQs(cfg); err == nil {
+			t.Errorf("ConfigureWQs(%+v) should fail", cfg)
+		}
+	}
+
+	// Record the order of the writes, the unused WQ must give back its space
+	// before the new WQs are sized
+	saved := writeSysfs
+	defer func() { writeSysfs = saved }()
+	writes := []string{}
+	writeSysfs = func(file, value string) error {
+		rel, _ := filepath.Rel(root, file)
+		writes = append(writes, rel+"="+value)
+		return saved(file, value)
+	}
+
+	if err := db.ConfigureWQs(WQConfig{Device: "dsa0", NumWQs: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	order := func(write string) int {
+		for i, w := range writes {
+			if w == write {
+				return i
+			}
+		}
+		t.Errorf("%s not written", write)
+		return -1
+	}
+	zero := order("bus/dsa/devices/wq0.5/size=0")
+	for _, w := range []string{"bus/dsa/devices/wq0.0/size=64", "bus/dsa/devices/wq0.1/size=64"} {
+		if i := order(w); i < zero {
+			t.Errorf("%s written before the unused WQ size, writes %v", w, writes)
+		}
+	}
+
+	bus := "bus/dsa/devices/"
+	want := map[string]string{
+		"bus/dsa/drivers/idxd/unbind": "dsa0",
+		"bus/dsa/drivers/idxd/bind":   "dsa0",
+		"bus/dsa/drivers/user/bind":   "wq0.1",
+		bus + "engine0.3/group_id":    "1",
+		bus + "wq0.1/group_id":        "1",
+		bus + "wq0.1/type":            "user",
+		bus + "wq0.1/mode":            "dedicated",
+		bus + "wq0.1/name":            "dpdk_wq0.1",
+		bus + "wq0.1/size":            "64",
+		bus + "wq0.1/priority":        "1",
+		bus + "wq0.5/size":            "0",
+	}
+	for file, value := range want {
+		if s := readFile(t, root, file); s != value {
+			t.Errorf("%s = %q, want %q", file, s, value)
+		}
+	}
+
+	// The threshold of a shared WQ is its size
+	if err := db.ConfigureWQs(WQConfig{Device: "dsa0", NumWQs: 4, Mode: "shared"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, wq := range []string{"wq0.0", "wq0.3"} {
+		if s := readFile(t, root, bus+wq+"/threshold"); s != "32" {
+			t.Errorf("%s threshold = %q, want 32", wq, s)
+		}
+	}
+
+	// A failure after the device is disabled says the device is disabled
+	writeSysfs = func(file, value string) error {
+		if strings.HasSuffix(file, "/size") {
+			return fmt.Errorf("write %s: invalid argument", file)
+		}
+		return saved(file, value)
+	}
+	err := db.ConfigureWQs(WQConfig{Device: "dsa0", NumWQs: 2})
+	if err == nil || !strings.Contains(err.Error(), "dsa0 is left disabled") {
+		t.Errorf("ConfigureWQs error %v, want the device left disabled", err)
+	}
+}
+
+func TestQATVFs(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "qat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	pf := "bus/pci/devices/0000:3d:00.0/"
+	writeTree(t, root, map[string]string{
+		pf + "class":                      "0x0b4000\n",
+		pf + "vendor":                     "0x8086\n",
+		pf + "device":                     "0x37c8\n",
+		pf + "sriov_totalvfs":             "16\n",
+		pf + "sriov_numvfs":               "0\n",
+		"bus/pci/drivers/qat_c62x/unbind": "",
+	})
+
+	cfg := &DeviceConfig{}
+	cfg.Class.ID = ProcessorClass
+
+	db := &BindInfo{Devices: make(DeviceList), ids: &PCIIDs{},
+		CfgDevices: DevConfigs{"QAT": cfg}}
+	db.SetSysfs(root)
+	db.SetProcfs(filepath.Join(root, "proc"))
+	db.Devices["0000:3d:00.0"] = db.readDevice("0000:3d:00.0", nil)
+
+	// The kernel driver creates the VFs, a PF without it is refused
+	if err := db.EnableQATVFs("0000:3d:00.0"); err == nil {
+		t.Errorf("EnableQATVFs without the qat driver should fail")
+	}
+	if err := db.EnableQATVFs("0000:3d:01.0"); err == nil {
+		t.Errorf("EnableQATVFs of a missing device should fail")
+	}
+
+	if err := os.Symlink("../../drivers/qat_c62x", filepath.Join(root, pf, "driver")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EnableQATVFs("0000:3d:00.0"); err != nil {
+		t.Fatal(err)
+	}
+	if s := readFile(t, root, pf+"sriov_numvfs"); s != "16" {
+		t.Errorf("sriov_numvfs = %q, want 16", s)
+	}
+
+	// The catalog has the PF and VF device IDs
+	cfgs, errs := decodeDevices("default catalog", DefaultDevices)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for name, id := range map[string]string{"QAT": "37c8", "QAT-VF": "37c9"} {
+		if c := cfgs[name]; c == nil || c.Group != "CryptoGroup" || !strings.Contains(string(c.Device), id) {
+			t.Errorf("catalog %s %+v", name, c)
+		}
+	}
+}
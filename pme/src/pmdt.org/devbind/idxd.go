@@ -0,0 +1,340 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	tlog "pmdt.org/ttylog"
+)
+
+// The Intel DSA and IAA accelerators are configured through the idxd driver
+// in /sys/bus/dsa. A device has groups, each group has engines and work
+// queues (WQs), the WQs are enabled with the user driver for DPDK dmadev the
+// same way the dpdk_idxd_cfg.py script does it.
+
+// IdxdGroup of engines and WQs on an idxd device
+type IdxdGroup struct {
+	Name    string
+	Engines []string
+	WQs     []string
+}
+
+// IdxdWQ is a work queue of an idxd device
+type IdxdWQ struct {
+	Name     string // wqD.Q
+	WQName   string // Name of the WQ, DPDK uses WQs named dpdk_*
+	Mode     string // dedicated or shared
+	Type     string // kernel, user or none
+	State    string // enabled or disabled
+	Size     int
+	Priority int
+	Group    int
+}
+
+// IdxdDevice is a DSA or IAA device
+type IdxdDevice struct {
+	Name       string // dsaN or iaxN
+	Type       string // dsa or iax
+	Slot       string // PCI slot of the device
+	State      string
+	NumaNode   string
+	MaxGroups  int
+	MaxEngines int
+	MaxWQs     int
+	MaxWQSize  int
+	Groups     []IdxdGroup
+	Engines    map[string]int // Engine name to group id, -1 not in a group
+	WQs        []IdxdWQ
+}
+
+// WQConfig is a simple work queue configuration applied to an idxd device,
+// the engines are spread over the groups and each WQ is in its own group
+// until all groups are used.
+type WQConfig struct {
+	Device   string // dsaN or iaxN
+	NumWQs   int    // Number of WQs to enable
+	Mode     string // dedicated or shared, default dedicated
+	Size     int    // Size of each WQ, default the WQ space divided by NumWQs
+	Priority int    // Priority of the WQs, default 1
+	Prefix   string // WQ name prefix, default dpdk
+}
+
+// idxdPath returns the path of the file in /sys/bus/dsa
+func (db *BindInfo) idxdPath(elem ...string) string {
+
+	return db.sysPath(append([]string{"bus", "dsa"}, elem...)...)
+}
+
+// readString reads a sysfs file and removes the newline
+func readString(file string) string {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(dat))
+}
+
+// idxdNumber returns the device and instance numbers of an idxd name like
+// wq1.3 or dsa2
+func idxdNumber(name string) (int, int) {
+
+	name = strings.TrimLeft(name, "abcdefghijklmnopqrstuvwxyz")
+	w := strings.SplitN(name, ".", 2)
+
+	dev, _ := strconv.Atoi(w[0])
+	inst := 0
+	if len(w) > 1 {
+		inst, _ = strconv.Atoi(w[1])
+	}
+	return dev, inst
+}
+
+// sortIdxd sorts idxd names by device and instance number
+func sortIdxd(names []string) {
+
+	sort.Slice(names, func(i, j int) bool {
+		di, ii := idxdNumber(names[i])
+		dj, ij := idxdNumber(names[j])
+		if di != dj {
+			return di < dj
+		}
+		return ii < ij
+	})
+}
+
+// IdxdDevices returns the DSA and IAA devices with their groups, engines and
+// WQs, no devices are returned when the idxd driver is not loaded.
+func (db *BindInfo) IdxdDevices() []*IdxdDevice {
+
+	entries, err := ioutil.ReadDir(db.idxdPath("devices"))
+	if err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sortIdxd(names)
+
+	devs := []*IdxdDevice{}
+	for _, name := range names {
+		if strings.HasPrefix(name, "dsa") || strings.HasPrefix(name, "iax") {
+			devs = append(devs, db.readIdxd(name, names))
+		}
+	}
+
+	return devs
+}
+
+// readIdxd reads the device, the names are all of the entries in the bus
+func (db *BindInfo) readIdxd(name string, names []string) *IdxdDevice {
+
+	path := func(elem ...string) string {
+		return db.idxdPath(append([]string{"devices"}, elem...)...)
+	}
+	readInt := func(elem ...string) int {
+		v, _ := strconv.Atoi(readString(path(elem...)))
+		return v
+	}
+
+	d := &IdxdDevice{Name: name, Type: name[:3], Engines: make(map[string]int)}
+
+	// The device is a child of the PCI device in the sysfs device tree
+	if target, err := filepath.EvalSymlinks(path(name)); err == nil {
+		d.Slot = filepath.Base(filepath.Dir(target))
+	}
+	d.State = readString(path(name, "state"))
+	d.NumaNode = readString(path(name, "numa_node"))
+	d.MaxGroups = readInt(name, "max_groups")
+	d.MaxEngines = readInt(name, "max_engines")
+	d.MaxWQs = readInt(name, "max_work_queues")
+	d.MaxWQSize = readInt(name, "max_work_queues_size")
+
+	num, _ := idxdNumber(name)
+	suffix := fmt.Sprintf("%d.", num)
+
+	for _, n := range names {
+		switch {
+		case strings.HasPrefix(n, "group"+suffix):
+			d.Groups = append(d.Groups, IdxdGroup{
+				Name:    n,
+				Engines: strings.Fields(readString(path(n, "engines"))),
+				WQs:     strings.Fields(readString(path(n, "work_queues"))),
+			})
+		case strings.HasPrefix(n, "engine"+suffix):
+			d.Engines[n] = readInt(n, "group_id")
+		case strings.HasPrefix(n, "wq"+suffix):
+			d.WQs = append(d.WQs, IdxdWQ{
+				Name:     n,
+				WQName:   readString(path(n, "name")),
+				Mode:     readString(path(n, "mode")),
+				Type:     readString(path(n, "type")),
+				State:    readString(path(n, "state")),
+				Size:     readInt(n, "size"),
+				Priority: readInt(n, "priority"),
+				Group:    readInt(n, "group_id"),
+			})
+		}
+	}
+
+	return d
+}
+
+// IdxdDevice returns the named DSA or IAA device
+func (db *BindInfo) IdxdDevice(name string) (*IdxdDevice, error) {
+
+	for _, d := range db.IdxdDevices() {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("idxd device %s not found", name)
+}
+
+// idxdDriver returns the first of the drivers found in /sys/bus/dsa/drivers,
+// the driver names changed in newer kernels.
+func (db *BindInfo) idxdDriver(drivers ...string) (string, error) {
+
+	for _, drv := range drivers {
+		if _, err := os.Stat(db.idxdPath("drivers", drv)); err == nil {
+			return drv, nil
+		}
+	}
+	return "", fmt.Errorf("idxd driver %s not loaded", strings.Join(drivers, " or "))
+}
+
+// ConfigureWQs applies the WQ configuration to the device, the device is
+// disabled, the engines and WQs are assigned to groups and the device and
+// WQs are enabled again. The device stays disabled when the configuration
+// fails after it is disabled.
+func (db *BindInfo) ConfigureWQs(cfg WQConfig) error {
+
+	d, err := db.IdxdDevice(cfg.Device)
+	if err != nil {
+		return err
+	}
+	if cfg.NumWQs < 1 || cfg.NumWQs > d.MaxWQs {
+		return fmt.Errorf("%s: number of WQs %d not in range 1-%d", d.Name, cfg.NumWQs, d.MaxWQs)
+	}
+	if len(cfg.Mode) == 0 {
+		cfg.Mode = "dedicated"
+	}
+	if cfg.Mode != "dedicated" && cfg.Mode != "shared" {
+		return fmt.Errorf("%s: WQ mode %q is not dedicated or shared", d.Name, cfg.Mode)
+	}
+	if cfg.Size == 0 {
+		cfg.Size = d.MaxWQSize / cfg.NumWQs
+	}
+	if cfg.Size < 1 || cfg.Size*cfg.NumWQs > d.MaxWQSize {
+		return fmt.Errorf("%s: %d WQs of size %d do not fit in %d", d.Name, cfg.NumWQs, cfg.Size, d.MaxWQSize)
+	}
+	if cfg.Priority == 0 {
+		cfg.Priority = 1
+	}
+	if len(cfg.Prefix) == 0 {
+		cfg.Prefix = "dpdk"
+	}
+
+	devDriver, err := db.idxdDriver("idxd", "dsa")
+	if err != nil {
+		return err
+	}
+	wqDriver, err := db.idxdDriver("user", "dsa")
+	if err != nil {
+		return err
+	}
+
+	if d.State == "enabled" {
+		tlog.InfoPrintf("Disable %s\n", d.Name)
+		if err := writeSysfs(db.idxdPath("drivers", devDriver, "unbind"), d.Name); err != nil {
+			return err
+		}
+	}
+
+	if err := db.configureWQs(d, cfg, devDriver); err != nil {
+		return fmt.Errorf("%v, %s is left disabled", err, d.Name)
+	}
+
+	num, _ := idxdNumber(d.Name)
+	for q := 0; q < cfg.NumWQs; q++ {
+		if err := writeSysfs(db.idxdPath("drivers", wqDriver, "bind"), fmt.Sprintf("wq%d.%d", num, q)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configureWQs assigns the engines and WQs of the disabled device to groups
+// and enables the device
+func (db *BindInfo) configureWQs(d *IdxdDevice, cfg WQConfig, devDriver string) error {
+
+	write := func(value string, elem ...string) error {
+		return writeSysfs(db.idxdPath(append([]string{"devices"}, elem...)...), value)
+	}
+
+	num, _ := idxdNumber(d.Name)
+	groups := d.MaxGroups
+	if groups > cfg.NumWQs {
+		groups = cfg.NumWQs
+	}
+	if groups < 1 {
+		return fmt.Errorf("%s: device has no groups", d.Name)
+	}
+
+	for e := 0; e < d.MaxEngines; e++ {
+		if err := write(strconv.Itoa(e%groups), fmt.Sprintf("engine%d.%d", num, e), "group_id"); err != nil {
+			return err
+		}
+	}
+
+	// The WQs not used give their space back to the device first, the
+	// kernel refuses a WQ size larger than the space left on the device
+	for _, wq := range d.WQs {
+		if _, q := idxdNumber(wq.Name); q >= cfg.NumWQs && wq.Size > 0 {
+			if err := write("0", wq.Name, "size"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for q := 0; q < cfg.NumWQs; q++ {
+		wq := fmt.Sprintf("wq%d.%d", num, q)
+		attrs := []struct {
+			file, value string
+		}{
+			{"group_id", strconv.Itoa(q % groups)},
+			{"type", "user"},
+			{"mode", cfg.Mode},
+			{"name", fmt.Sprintf("%s_%s", cfg.Prefix, wq)},
+			{"priority", strconv.Itoa(cfg.Priority)},
+			{"size", strconv.Itoa(cfg.Size)},
+		}
+		for _, a := range attrs {
+			if err := write(a.value, wq, a.file); err != nil {
+				return err
+			}
+		}
+
+		// A shared WQ accepts work up to the threshold, the size of the WQ
+		if cfg.Mode == "shared" {
+			if err := write(strconv.Itoa(cfg.Size), wq, "threshold"); err != nil {
+				return err
+			}
+		}
+	}
+
+	tlog.InfoPrintf("Enable %s with %d %s WQs of size %d\n", d.Name, cfg.NumWQs, cfg.Mode, cfg.Size)
+
+	return writeSysfs(db.idxdPath("drivers", devDriver, "bind"), d.Name)
+}
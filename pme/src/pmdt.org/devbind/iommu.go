@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IOMMU groups and the checks done before binding a device to vfio-pci, vfio
+// needs every device of the IOMMU group to be unbound or on a vfio safe driver.
+
+// IOMMUStatus of the system from sysfs and the kernel command line
+type IOMMUStatus struct {
+	Enabled     bool     // IOMMU groups exist in sysfs
+	CmdlineOn   bool     // intel_iommu=on or amd_iommu=on on the kernel command line
+	Passthrough bool     // iommu=pt on the kernel command line
+	NoIOMMU     bool     // vfio enable_unsafe_noiommu_mode is set
+	Groups      int      // Number of IOMMU groups
+	Cmdline     []string // IOMMU options from the kernel command line
+}
+
+// GroupMember is a device in the same IOMMU group
+type GroupMember struct {
+	Slot   string
+	Driver string
+}
+
+// Readiness of a device to be bound to vfio-pci
+type Readiness struct {
+	Ready   bool
+	Verdict string
+	Group   string
+	Members []GroupMember // Other devices in the IOMMU group
+}
+
+// vfioSafeDrivers can own the other devices of an IOMMU group
+var vfioSafeDrivers = []string{"vfio-pci", "pci-stub", "pcieport"}
+
+// KernelCmdline returns the options of the kernel command line
+func (db *BindInfo) KernelCmdline() []string {
+
+	dat, err := ioutil.ReadFile(db.procPath("cmdline"))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(dat))
+}
+
+// IOMMU returns the IOMMU status of the system
+func (db *BindInfo) IOMMU() *IOMMUStatus {
+
+	st := &IOMMUStatus{}
+
+	if groups, err := ioutil.ReadDir(db.sysPath("kernel", "iommu_groups")); err == nil {
+		st.Groups = len(groups)
+		st.Enabled = st.Groups > 0
+	}
+
+	for _, opt := range db.KernelCmdline() {
+		if !strings.HasPrefix(opt, "intel_iommu=") && !strings.HasPrefix(opt, "amd_iommu=") &&
+			!strings.HasPrefix(opt, "iommu=") && !strings.HasPrefix(opt, "vfio") {
+			continue
+		}
+		st.Cmdline = append(st.Cmdline, opt)
+
+		// The options are a comma separated list, e.g. intel_iommu=on,sm_on
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		for _, v := range strings.Split(kv[1], ",") {
+			switch {
+			case v == "on" && (kv[0] == "intel_iommu" || kv[0] == "amd_iommu"):
+				st.CmdlineOn = true
+			case v == "pt" && kv[0] == "iommu":
+				st.Passthrough = true
+			}
+		}
+	}
+
+	file := db.sysPath("module", "vfio", "parameters", "enable_unsafe_noiommu_mode")
+	if dat, err := ioutil.ReadFile(file); err == nil {
+		v := strings.TrimSpace(string(dat))
+		st.NoIOMMU = v == "Y" || v == "1"
+	}
+
+	return st
+}
+
+// String returns a one line summary of the IOMMU status
+func (st *IOMMUStatus) String() string {
+
+	s := "IOMMU disabled"
+	if st.Enabled {
+		s = fmt.Sprintf("IOMMU enabled, %d groups", st.Groups)
+	}
+	if len(st.Cmdline) > 0 {
+		s += ", cmdline " + strings.Join(st.Cmdline, " ")
+	} else {
+		s += ", no IOMMU options on the cmdline"
+	}
+	if st.Enabled && !st.Passthrough {
+		s += ", iommu=pt not set"
+	}
+	if st.NoIOMMU {
+		s += ", vfio no-IOMMU mode"
+	}
+	return s
+}
+
+// IOMMUGroup returns the IOMMU group of the device or an empty string
+func (db *BindInfo) IOMMUGroup(slot string) string {
+
+	target, err := os.Readlink(db.pciPath(slot, "iommu_group"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// IOMMUGroupDevices returns the slots of the devices in the IOMMU group
+func (db *BindInfo) IOMMUGroupDevices(group string) []string {
+
+	entries, err := ioutil.ReadDir(db.sysPath("kernel", "iommu_groups", group, "devices"))
+	if err != nil {
+		return nil
+	}
+
+	slots := []string{}
+	for _, e := range entries {
+		slots = append(slots, e.Name())
+	}
+	sort.Strings(slots)
+
+	return slots
+}
+
+// VfioReadiness checks if the device can be bound to vfio-pci
+func (db *BindInfo) VfioReadiness(slot string) *Readiness {
+
+	r := &Readiness{Group: db.IOMMUGroup(slot)}
+
+	if dev, ok := db.Device(slot); ok && dev.Active {
+		r.Verdict = "active, has a route"
+		return r
+	}
+
+	if len(r.Group) == 0 {
+		if db.IOMMU().NoIOMMU {
+			r.Ready = true
+			r.Verdict = "no-IOMMU mode, unsafe"
+		} else {
+			r.Verdict = "no IOMMU group, enable intel_iommu=on"
+		}
+		return r
+	}
+
+	blocked := []string{}
+	for _, s := range db.IOMMUGroupDevices(r.Group) {
+		if s == slot {
+			continue
+		}
+		m := GroupMember{Slot: s, Driver: db.CurrentDriver(s)}
+		r.Members = append(r.Members, m)
+
+		if len(m.Driver) == 0 {
+			continue
+		}
+		safe := false
+		for _, d := range vfioSafeDrivers {
+			if m.Driver == d {
+				safe = true
+			}
+		}
+		if !safe {
+			blocked = append(blocked, fmt.Sprintf("%s(%s)", m.Slot, m.Driver))
+		}
+	}
+
+	if len(blocked) > 0 {
+		r.Verdict = fmt.Sprintf("group %s shared with %s", r.Group, strings.Join(blocked, ","))
+		return r
+	}
+
+	r.Ready = true
+	r.Verdict = fmt.Sprintf("ready, group %s", r.Group)
+	if len(r.Members) > 0 {
+		r.Verdict += fmt.Sprintf(" +%d", len(r.Members))
+	}
+	return r
+}
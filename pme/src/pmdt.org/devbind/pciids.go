@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Names of the PCI vendors, devices and classes from the pci.ids file, the
+// same database lspci uses.
+
+// PCIIDsFiles are the locations searched for the pci.ids file
+var PCIIDsFiles = []string{
+	"/usr/share/hwdata/pci.ids",
+	"/usr/share/misc/pci.ids",
+	"/usr/share/pci.ids",
+}
+
+// PCIIDs database of names
+type PCIIDs struct {
+	vendors map[VendorID]*pciVendor
+	classes map[DevClassID]*pciClass
+}
+
+type pciVendor struct {
+	name    string
+	devices map[DeviceID]*pciDevice
+}
+
+type pciDevice struct {
+	name   string
+	subsys map[string]string // Key is "svendor sdevice"
+}
+
+type pciClass struct {
+	name string
+	sub  map[DevSubClassID]string
+}
+
+// FindPCIIDs loads the first pci.ids file found in PCIIDsFiles
+func FindPCIIDs() (*PCIIDs, error) {
+
+	for _, file := range PCIIDsFiles {
+		if _, err := os.Stat(file); err == nil {
+			return LoadPCIIDs(file)
+		}
+	}
+	return nil, fmt.Errorf("pci.ids not found in %v", PCIIDsFiles)
+}
+
+// LoadPCIIDs loads the pci.ids file
+func LoadPCIIDs(file string) (*PCIIDs, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParsePCIIDs(f)
+}
+
+// ParsePCIIDs data in the pci.ids format, vendors and devices are indented
+// with tabs, the classes start with a 'C ' line.
+func ParsePCIIDs(r io.Reader) (*PCIIDs, error) {
+
+	ids := &PCIIDs{
+		vendors: make(map[VendorID]*pciVendor),
+		classes: make(map[DevClassID]*pciClass),
+	}
+
+	var vendor *pciVendor
+	var device *pciDevice
+	var class *pciClass
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "C "):
+			id, name := splitID(line[2:])
+			class = &pciClass{name: name, sub: make(map[DevSubClassID]string)}
+			ids.classes[DevClassID(id)] = class
+			vendor, device = nil, nil
+
+		case strings.HasPrefix(line, "\t\t"):
+			// Subsystem of a device or programming interface of a class
+			if device != nil {
+				f := strings.Fields(line)
+				if len(f) >= 2 {
+					key := f[0] + " " + f[1]
+					device.subsys[key] = strings.TrimSpace(strings.TrimPrefix(
+						strings.TrimSpace(line), f[0]+" "+f[1]))
+				}
+			}
+
+		case strings.HasPrefix(line, "\t"):
+			id, name := splitID(line[1:])
+			if vendor != nil {
+				device = &pciDevice{name: name, subsys: make(map[string]string)}
+				vendor.devices[DeviceID(id)] = device
+			} else if class != nil {
+				class.sub[DevSubClassID(id)] = name
+			}
+
+		default:
+			// Other sections like the known device classes end the vendors
+			if len(line) > 4 && isHex(line[:4]) {
+				id, name := splitID(line)
+				vendor = &pciVendor{name: name, devices: make(map[DeviceID]*pciDevice)}
+				ids.vendors[VendorID(id)] = vendor
+			} else {
+				vendor = nil
+			}
+			device, class = nil, nil
+		}
+	}
+
+	return ids, scanner.Err()
+}
+
+func isHex(s string) bool {
+
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitID splits a "<id>  <name>" line
+func splitID(s string) (string, string) {
+
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i == -1 {
+		return strings.ToLower(s), ""
+	}
+	return strings.ToLower(s[:i]), strings.TrimSpace(s[i:])
+}
+
+// Vendor name
+func (ids *PCIIDs) Vendor(v VendorID) string {
+
+	if ids == nil {
+		return ""
+	}
+	if vendor, ok := ids.vendors[v]; ok {
+		return vendor.name
+	}
+	return ""
+}
+
+func (ids *PCIIDs) device(v VendorID, d DeviceID) *pciDevice {
+
+	if ids == nil {
+		return nil
+	}
+	if vendor, ok := ids.vendors[v]; ok {
+		return vendor.devices[d]
+	}
+	return nil
+}
+
+// Device name
+func (ids *PCIIDs) Device(v VendorID, d DeviceID) string {
+
+	if dev := ids.device(v, d); dev != nil {
+		return dev.name
+	}
+	return ""
+}
+
+// SubDevice name of the subsystem
+func (ids *PCIIDs) SubDevice(v VendorID, d DeviceID, sv SVendorID, sd SDeviceID) string {
+
+	if dev := ids.device(v, d); dev != nil {
+		return dev.subsys[string(sv)+" "+string(sd)]
+	}
+	return ""
+}
+
+// Class name
+func (ids *PCIIDs) Class(c DevClassID) string {
+
+	if ids == nil {
+		return ""
+	}
+	if class, ok := ids.classes[c]; ok {
+		return class.name
+	}
+	return ""
+}
+
+// SubClass name
+func (ids *PCIIDs) SubClass(c DevClassID, s DevSubClassID) string {
+
+	if ids == nil {
+		return ""
+	}
+	if class, ok := ids.classes[c]; ok {
+		return class.sub[s]
+	}
+	return ""
+}
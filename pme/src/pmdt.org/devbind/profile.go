@@ -0,0 +1,391 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	tlog "pmdt.org/ttylog"
+)
+
+// Binding profiles are TOML files listing devices by PCI slot or selector
+// with the driver to bind and the number of VFs to create, applied at boot
+// with 'pme devbind apply <profile>'.
+//
+//	[[device]]
+//	  slot = "0000:18:00.0"   # PCI slot of the device
+//	  num_vfs = 4             # Number of SR-IOV VFs to create
+//	[[device]]
+//	  selector = "8086:154c"  # vendor:device or a selector expression
+//	  driver = "vfio-pci"     # Driver, "kernel" or "none" to unbind
+
+const (
+	profilesDir string = "profiles"
+
+	// KernelDriverName binds the device to its kernel driver
+	KernelDriverName string = "kernel"
+	// NoDriverName unbinds the device
+	NoDriverName string = "none"
+)
+
+// ProfileEntry is a device or set of devices in a binding profile
+type ProfileEntry struct {
+	Slot     string `toml:"slot,omitempty"`
+	Selector string `toml:"selector,omitempty"`
+	Driver   string `toml:"driver,omitempty"`
+	NumVFs   *int   `toml:"num_vfs,omitempty"`
+}
+
+// Profile is a named list of device bindings
+type Profile struct {
+	Name    string         `toml:"-"`
+	Devices []ProfileEntry `toml:"device"`
+}
+
+// Change actions in a profile plan
+const (
+	ChangeVFs    = "vfs"
+	ChangeBind   = "bind"
+	ChangeUnbind = "unbind"
+)
+
+// Change needed to apply a profile to a device
+type Change struct {
+	Slot   string
+	Action string
+	From   string
+	To     string
+	numVFs int
+}
+
+// String returns the change as a diff line
+func (c Change) String() string {
+
+	from, to := c.From, c.To
+	if len(from) == 0 {
+		from = NoDriverName
+	}
+	if len(to) == 0 {
+		to = NoDriverName
+	}
+	if c.Action == ChangeVFs {
+		return fmt.Sprintf("%s  VFs %s -> %s", c.Slot, from, to)
+	}
+	return fmt.Sprintf("%s  %s -> %s", c.Slot, from, to)
+}
+
+// ProfileDirs returns the directories searched for profiles, the later
+// directories take precedence.
+func ProfileDirs() []string {
+
+	dirs := []string{filepath.Join(etcPmdtDir, profilesDir)}
+	for _, file := range DeviceFileSearchPath()[1:] {
+		dirs = append(dirs, filepath.Join(filepath.Dir(file), profilesDir))
+	}
+	return dirs
+}
+
+// ProfileFile returns the file a profile is saved to, /etc/pmdt/profiles
+// for root so the profile can be applied at boot.
+func ProfileFile(name string) string {
+
+	dirs := ProfileDirs()
+	dir := dirs[len(dirs)-1]
+	if os.Geteuid() == 0 {
+		dir = dirs[0]
+	}
+	return filepath.Join(dir, name+".toml")
+}
+
+// ProfileNames returns the names of the profiles in the profile directories
+func ProfileNames() []string {
+
+	found := make(map[string]bool)
+	for _, dir := range ProfileDirs() {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+		for _, f := range files {
+			found[strings.TrimSuffix(filepath.Base(f), ".toml")] = true
+		}
+	}
+
+	names := []string{}
+	for n := range found {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// findProfile returns the file of the named profile or the name when it is
+// a path to a file.
+func findProfile(name string) (string, error) {
+
+	if strings.ContainsRune(name, os.PathSeparator) || strings.HasSuffix(name, ".toml") {
+		return name, nil
+	}
+
+	dirs := ProfileDirs()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		file := filepath.Join(dirs[i], name+".toml")
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("profile %s not found in %s", name, strings.Join(dirs, ", "))
+}
+
+// ParseProfile decodes and validates the TOML profile data
+func ParseProfile(name, data string) (*Profile, error) {
+
+	p := &Profile{Name: name}
+
+	md, err := toml.Decode(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %v", name, err)
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		return nil, fmt.Errorf("profile %s: unknown key %s", name, keys[0])
+	}
+
+	for i, e := range p.Devices {
+		if (len(e.Slot) == 0) == (len(e.Selector) == 0) {
+			return nil, fmt.Errorf("profile %s: device %d needs one of slot or selector", name, i+1)
+		}
+		if len(e.Selector) > 0 {
+			sel, err := ParseSelector(e.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: device %d: %v", name, i+1, err)
+			}
+			if sel.Empty() {
+				return nil, fmt.Errorf("profile %s: device %d: selector %q matches all devices", name, i+1, e.Selector)
+			}
+		}
+		if len(e.Driver) == 0 && e.NumVFs == nil {
+			return nil, fmt.Errorf("profile %s: device %d needs a driver or num_vfs", name, i+1)
+		}
+		if e.NumVFs != nil && *e.NumVFs < 0 {
+			return nil, fmt.Errorf("profile %s: device %d num_vfs %d is negative", name, i+1, *e.NumVFs)
+		}
+	}
+
+	return p, nil
+}
+
+// LoadProfile loads the named profile or the profile file
+func LoadProfile(name string) (*Profile, error) {
+
+	file, err := findProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseProfile(strings.TrimSuffix(filepath.Base(file), ".toml"), string(dat))
+}
+
+// Save writes the profile to the file, the directory is created if needed
+func (p *Profile) Save(file string) error {
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# Device binding profile %s, apply with 'pme devbind apply %s'\n", p.Name, p.Name)
+	if err := toml.NewEncoder(&buf).Encode(p); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// matchEntry returns the slots of the devices matching the profile entry
+func (db *BindInfo) matchEntry(e ProfileEntry) []string {
+
+	if len(e.Slot) > 0 {
+		if _, ok := db.Devices[e.Slot]; ok {
+			return []string{e.Slot}
+		}
+		return nil
+	}
+
+	sel, err := ParseSelector(e.Selector)
+	if err != nil {
+		return nil
+	}
+
+	slots := []string{}
+	for slot, d := range db.Devices {
+		if sel.Match(d) {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Strings(slots)
+
+	return slots
+}
+
+// Plan returns the changes needed to apply the profile to the devices, the
+// VF changes come first as the driver of new VFs is set after they exist.
+func (db *BindInfo) Plan(p *Profile) ([]Change, []error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.plan(p)
+}
+
+func (db *BindInfo) plan(p *Profile) ([]Change, []error) {
+
+	vfs := []Change{}
+	binds := []Change{}
+	errs := []error{}
+
+	for i, e := range p.Devices {
+		slots := db.matchEntry(e)
+		if len(slots) == 0 {
+			name := e.Slot
+			if len(name) == 0 {
+				name = e.Selector
+			}
+			errs = append(errs, fmt.Errorf("device %d: no device matches %s", i+1, name))
+			continue
+		}
+
+		for _, slot := range slots {
+			d := db.Devices[slot]
+
+			if e.NumVFs != nil && *e.NumVFs != d.NumVFs {
+				if !d.IsPF() {
+					errs = append(errs, fmt.Errorf("device %s does not support SR-IOV", slot))
+				} else {
+					vfs = append(vfs, Change{Slot: slot, Action: ChangeVFs, numVFs: *e.NumVFs,
+						From: fmt.Sprint(d.NumVFs), To: fmt.Sprint(*e.NumVFs)})
+				}
+			}
+
+			if len(e.Driver) == 0 {
+				continue
+			}
+			driver := e.Driver
+			switch driver {
+			case KernelDriverName:
+				if driver = d.KernelDriver(); len(driver) == 0 {
+					errs = append(errs, fmt.Errorf("device %s has no kernel driver", slot))
+					continue
+				}
+			case NoDriverName:
+				driver = ""
+			}
+			if driver == d.Driver {
+				continue
+			}
+			if d.Active {
+				errs = append(errs, fmt.Errorf("device %s is active, interface %s has a route", slot, d.Interface))
+				continue
+			}
+
+			c := Change{Slot: slot, Action: ChangeBind, From: d.Driver, To: driver}
+			if len(driver) == 0 {
+				c.Action = ChangeUnbind
+			}
+			binds = append(binds, c)
+		}
+	}
+
+	return append(vfs, binds...), errs
+}
+
+// Apply the profile, the VFs are created first then the devices are found
+// again to bind the new VFs. All changes are tried and the errors returned.
+func (db *BindInfo) Apply(p *Profile) ([]Change, []error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	done := []Change{}
+
+	changes, errs := db.plan(p)
+
+	vfs := false
+	vfErrs := []error{}
+	for _, c := range changes {
+		if c.Action != ChangeVFs {
+			continue
+		}
+		vfs = true
+		if err := db.setNumVFs(c.Slot, c.numVFs); err != nil {
+			vfErrs = append(vfErrs, err)
+			continue
+		}
+		done = append(done, c)
+	}
+
+	if vfs {
+		// New VFs are only in the device list after a refresh
+		db.refresh()
+		changes, errs = db.plan(p)
+		errs = append(vfErrs, errs...)
+	}
+
+	for _, c := range changes {
+		var err error
+
+		switch c.Action {
+		case ChangeBind:
+			err = db.bind(c.Slot, c.To)
+		case ChangeUnbind:
+			err = db.unbindSlot(c.Slot)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tlog.InfoPrintf("Profile %s: %s\n", p.Name, c)
+		done = append(done, c)
+	}
+
+	return done, errs
+}
+
+// CurrentProfile returns a profile of the current VFs and the devices bound
+// to a DPDK driver.
+func (db *BindInfo) CurrentProfile(name string) *Profile {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	p := &Profile{Name: name}
+
+	slots := []string{}
+	for slot := range db.Devices {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+
+	for _, slot := range slots {
+		if d := db.Devices[slot]; d.IsPF() && d.NumVFs > 0 {
+			num := d.NumVFs
+			p.Devices = append(p.Devices, ProfileEntry{Slot: slot, NumVFs: &num})
+		}
+	}
+	for _, slot := range slots {
+		if d := db.Devices[slot]; IsUioModule(d.Driver) {
+			p.Devices = append(p.Devices, ProfileEntry{Slot: slot, Driver: d.Driver})
+		}
+	}
+
+	return p
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selectors match devices on exact id lists, an empty list or '*' matches
+// any value. The syntax is a space separated list of key=value terms with
+// ',' separated values, all terms must match:
+//
+//	class=02 vendor=8086 device=1572,158b
+//	class=0b subclass=40 driver=vfio-pci numa=1
+//
+// The keys are class, subclass, vendor, device, svendor, sdevice, driver and
+// numa. A vendor:device term like 8086:1572 is the same as vendor=8086
+// device=1572.
+
+// Selector of devices, each non empty list must contain the device value
+type Selector struct {
+	Classes    []DevClassID
+	SubClasses []DevSubClassID
+	Vendors    []VendorID
+	Devices    []DeviceID
+	SVendors   []SVendorID
+	SDevices   []SDeviceID
+	Drivers    []string
+	NumaNodes  []string
+}
+
+// selectorKeys in the order printed by String
+var selectorKeys = []string{"class", "subclass", "vendor", "device", "svendor", "sdevice", "driver", "numa"}
+
+// hexWidth of the id keys of a selector
+var hexWidth = map[string]int{
+	"class": 2, "subclass": 2, "vendor": 4, "device": 4, "svendor": 4, "sdevice": 4,
+}
+
+// ParseSelector parses the selector expression
+func ParseSelector(expr string) (*Selector, error) {
+
+	s := &Selector{}
+
+	for _, term := range strings.Fields(expr) {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) == 1 {
+			// vendor:device shorthand, the device may be '*'
+			w := strings.Split(term, ":")
+			if len(w) != 2 {
+				return nil, fmt.Errorf("selector term %q is not key=value or vendor:device", term)
+			}
+			kv = []string{"vendor", w[0]}
+			if err := s.add(kv[0], kv[1]); err != nil {
+				return nil, err
+			}
+			kv = []string{"device", w[1]}
+		}
+		if err := s.add(strings.ToLower(kv[0]), kv[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// add the ',' separated values of the key to the selector
+func (s *Selector) add(key, value string) error {
+
+	width, isID := hexWidth[key]
+	if !isID && key != "driver" && key != "numa" {
+		return fmt.Errorf("unknown selector key %q, want one of %s", key, strings.Join(selectorKeys, ","))
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("selector key %s has no value", key)
+	}
+	if value == "*" {
+		return nil
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		if isID {
+			v = strings.ToLower(strings.TrimPrefix(v, "0x"))
+			if !isHexID(v, width) {
+				return fmt.Errorf("selector %s=%s: %q is not a %d digit hex value", key, value, v, width)
+			}
+		} else if len(v) == 0 {
+			return fmt.Errorf("selector %s=%s has an empty value", key, value)
+		}
+
+		switch key {
+		case "class":
+			s.Classes = append(s.Classes, DevClassID(v))
+		case "subclass":
+			s.SubClasses = append(s.SubClasses, DevSubClassID(v))
+		case "vendor":
+			s.Vendors = append(s.Vendors, VendorID(v))
+		case "device":
+			s.Devices = append(s.Devices, DeviceID(v))
+		case "svendor":
+			s.SVendors = append(s.SVendors, SVendorID(v))
+		case "sdevice":
+			s.SDevices = append(s.SDevices, SDeviceID(v))
+		case "driver":
+			s.Drivers = append(s.Drivers, v)
+		case "numa":
+			s.NumaNodes = append(s.NumaNodes, v)
+		}
+	}
+	return nil
+}
+
+// values returns the selector values of the key as strings
+func (s *Selector) values(key string) []string {
+
+	vals := []string{}
+	switch key {
+	case "class":
+		for _, v := range s.Classes {
+			vals = append(vals, string(v))
+		}
+	case "subclass":
+		for _, v := range s.SubClasses {
+			vals = append(vals, string(v))
+		}
+	case "vendor":
+		for _, v := range s.Vendors {
+			vals = append(vals, string(v))
+		}
+	case "device":
+		for _, v := range s.Devices {
+			vals = append(vals, string(v))
+		}
+	case "svendor":
+		for _, v := range s.SVendors {
+			vals = append(vals, string(v))
+		}
+	case "sdevice":
+		for _, v := range s.SDevices {
+			vals = append(vals, string(v))
+		}
+	case "driver":
+		vals = append(vals, s.Drivers...)
+	case "numa":
+		vals = append(vals, s.NumaNodes...)
+	}
+	return vals
+}
+
+// deviceValue returns the value of the key for the device
+func deviceValue(key string, d *DeviceClass) string {
+
+	switch key {
+	case "class":
+		return string(d.Class.ID)
+	case "subclass":
+		return string(d.Class.Sub)
+	case "vendor":
+		return string(d.Vendor.ID)
+	case "device":
+		return string(d.Device.ID)
+	case "svendor":
+		return string(d.SVendor.ID)
+	case "sdevice":
+		return string(d.SDevice.ID)
+	case "driver":
+		return d.Driver
+	case "numa":
+		return d.NumaNode
+	}
+	return ""
+}
+
+// Match returns true if the device matches all of the selector terms, a
+// device without a value for a term never matches the term.
+func (s *Selector) Match(d *DeviceClass) bool {
+
+	for _, key := range selectorKeys {
+		vals := s.values(key)
+		if len(vals) == 0 {
+			continue
+		}
+		dv := deviceValue(key, d)
+
+		found := false
+		for _, v := range vals {
+			if len(dv) > 0 && strings.EqualFold(v, dv) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns true if the selector matches all devices
+func (s *Selector) Empty() bool {
+
+	for _, key := range selectorKeys {
+		if len(s.values(key)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector expression
+func (s *Selector) String() string {
+
+	terms := []string{}
+	for _, key := range selectorKeys {
+		if vals := s.values(key); len(vals) > 0 {
+			terms = append(terms, key+"="+strings.Join(vals, ","))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// Selector returns the selector of the device configuration, the id fields
+// and the selector expression are combined.
+func (cfg *DeviceConfig) Selector() (*Selector, error) {
+
+	if cfg.sel != nil {
+		return cfg.sel, nil
+	}
+
+	s, err := ParseSelector(cfg.Select)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []struct {
+		key, value string
+	}{
+		{"class", string(cfg.Class.ID)},
+		{"subclass", string(cfg.Class.Sub)},
+		{"vendor", string(cfg.Vendor)},
+		{"device", strings.Replace(string(cfg.Device), ":", ",", -1)},
+		{"svendor", string(cfg.SVendor)},
+		{"sdevice", strings.Replace(string(cfg.SDevice), ":", ",", -1)},
+	}
+	for _, f := range fields {
+		if len(f.value) == 0 {
+			continue
+		}
+		if len(s.values(f.key)) > 0 {
+			return nil, fmt.Errorf("%s is set in both the id fields and the selector", f.key)
+		}
+		if err := s.add(f.key, f.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	tlog "pmdt.org/ttylog"
+)
+
+// SR-IOV physical and virtual functions. The PF to VF relationship comes from
+// the sriov_* files and the virtfn*/physfn links in sysfs, the VF MAC and
+// VLAN are set with netlink on the kernel interface of the PF.
+
+func readInt(file string) (int, error) {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(dat)))
+}
+
+// readSRIOV reads the PF and VF information of the device
+func (db *BindInfo) readSRIOV(dev *DeviceClass) {
+
+	dev.TotalVFs, _ = readInt(db.pciPath(dev.Slot, "sriov_totalvfs"))
+	dev.NumVFs, _ = readInt(db.pciPath(dev.Slot, "sriov_numvfs"))
+
+	links, _ := filepath.Glob(db.pciPath(dev.Slot, "virtfn*"))
+
+	vfs := make(map[int]string)
+	for _, l := range links {
+		idx, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(l), "virtfn"))
+		if err != nil {
+			continue
+		}
+		if target, err := os.Readlink(l); err == nil {
+			vfs[idx] = filepath.Base(target)
+		}
+	}
+	idxs := []int{}
+	for i := range vfs {
+		idxs = append(idxs, i)
+	}
+	sort.Ints(idxs)
+
+	dev.VFs = nil
+	for _, i := range idxs {
+		dev.VFs = append(dev.VFs, vfs[i])
+	}
+
+	dev.PhysFn = ""
+	dev.VFIndex = 0
+	if target, err := os.Readlink(db.pciPath(dev.Slot, "physfn")); err == nil {
+		dev.PhysFn = filepath.Base(target)
+
+		if links, err := filepath.Glob(db.pciPath(dev.PhysFn, "virtfn*")); err == nil {
+			for _, l := range links {
+				if t, err := os.Readlink(l); err == nil && filepath.Base(t) == dev.Slot {
+					dev.VFIndex, _ = strconv.Atoi(strings.TrimPrefix(filepath.Base(l), "virtfn"))
+				}
+			}
+		}
+	}
+}
+
+// IsPF returns true if the device is a SR-IOV physical function
+func (d *DeviceClass) IsPF() bool {
+	return d.TotalVFs > 0
+}
+
+// IsVF returns true if the device is a SR-IOV virtual function
+func (d *DeviceClass) IsVF() bool {
+	return len(d.PhysFn) > 0
+}
+
+// SetNumVFs creates or removes the VFs of the PF, the VFs must not be in use
+// by a DPDK driver or have a route.
+func (db *BindInfo) SetNumVFs(slot string, num int) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.setNumVFs(slot, num)
+}
+
+func (db *BindInfo) setNumVFs(slot string, num int) error {
+
+	pf, ok := db.Devices[slot]
+	if !ok {
+		return fmt.Errorf("device %s not found", slot)
+	}
+	db.readSRIOV(pf)
+
+	if !pf.IsPF() {
+		return fmt.Errorf("device %s does not support SR-IOV", slot)
+	}
+	if num < 0 || num > pf.TotalVFs {
+		return fmt.Errorf("number of VFs %d not in range 0-%d", num, pf.TotalVFs)
+	}
+	if num == pf.NumVFs {
+		return nil
+	}
+
+	// The current VFs are removed when the number of VFs changes
+	for _, vf := range pf.VFs {
+		if dev, ok := db.Devices[vf]; ok {
+			if dev.Active {
+				return fmt.Errorf("VF %s is active, interface %s has a route", vf, dev.Interface)
+			}
+		}
+		if driver := db.CurrentDriver(vf); IsUioModule(driver) {
+			return fmt.Errorf("VF %s is bound to %s, unbind it first", vf, driver)
+		}
+	}
+
+	file := db.pciPath(slot, "sriov_numvfs")
+
+	// The kernel requires the VFs to be removed before changing the number
+	if pf.NumVFs != 0 && num != 0 {
+		if err := writeSysfs(file, "0"); err != nil {
+			return err
+		}
+	}
+
+	tlog.InfoPrintf("Set %d VFs on %s\n", num, slot)
+	if err := writeSysfs(file, strconv.Itoa(num)); err != nil {
+		return err
+	}
+
+	db.refresh()
+
+	return nil
+}
+
+// EnableQATVFs creates all of the VFs of a QAT PF, DPDK uses the VFs for
+// crypto and compression. The PF must stay bound to its qat_* kernel driver,
+// the kernel driver creates the VFs.
+func (db *BindInfo) EnableQATVFs(slot string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	pf, ok := db.Devices[slot]
+	if !ok {
+		return fmt.Errorf("device %s not found", slot)
+	}
+	if driver := db.CurrentDriver(slot); !strings.HasPrefix(driver, "qat_") {
+		return fmt.Errorf("QAT device %s must be bound to its qat kernel driver, driver %q", slot, driver)
+	}
+	db.readSRIOV(pf)
+
+	return db.setNumVFs(slot, pf.TotalVFs)
+}
+
+// vfParent returns the PF and the netdev ifindex of the PF for the VF
+func (db *BindInfo) vfParent(vfSlot string) (*DeviceClass, int, int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	vf, ok := db.Devices[vfSlot]
+	if !ok {
+		return nil, 0, 0, fmt.Errorf("device %s not found", vfSlot)
+	}
+	db.readSRIOV(vf)
+	if !vf.IsVF() {
+		return nil, 0, 0, fmt.Errorf("device %s is not a VF", vfSlot)
+	}
+
+	// The PF may not be in the device list when it is not a network device
+	pf := db.readDevice(vf.PhysFn, nil)
+	if pf == nil {
+		return nil, 0, 0, fmt.Errorf("PF %s of VF %s not found", vf.PhysFn, vfSlot)
+	}
+
+	iface := strings.Split(pf.Interface, ",")[0]
+	if len(iface) == 0 {
+		return nil, 0, 0, fmt.Errorf("PF %s has no kernel interface, driver %q", pf.Slot, pf.Driver)
+	}
+	ifindex, err := readInt(db.sysPath("class", "net", iface, "ifindex"))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("PF interface %s: %v", iface, err)
+	}
+
+	return pf, ifindex, vf.VFIndex, nil
+}
+
+// SetVFMac sets the MAC address of the VF
+func (db *BindInfo) SetVFMac(vfSlot string, mac net.HardwareAddr) error {
+
+	if len(mac) != 6 {
+		return fmt.Errorf("invalid MAC address %s", mac)
+	}
+	pf, ifindex, vf, err := db.vfParent(vfSlot)
+	if err != nil {
+		return err
+	}
+
+	tlog.InfoPrintf("Set VF %d MAC %s on %s\n", vf, mac, pf.Interface)
+	return netlinkRequest(vfMacMessage(ifindex, vf, mac))
+}
+
+// SetVFVlan sets the VLAN and priority of the VF, VLAN 0 removes the VLAN
+func (db *BindInfo) SetVFVlan(vfSlot string, vlan, qos int) error {
+
+	if vlan < 0 || vlan > 4095 {
+		return fmt.Errorf("invalid VLAN %d", vlan)
+	}
+	if qos < 0 || qos > 7 {
+		return fmt.Errorf("invalid VLAN priority %d", qos)
+	}
+	pf, ifindex, vf, err := db.vfParent(vfSlot)
+	if err != nil {
+		return err
+	}
+
+	tlog.InfoPrintf("Set VF %d VLAN %d QoS %d on %s\n", vf, vlan, qos, pf.Interface)
+	return netlinkRequest(vfVlanMessage(ifindex, vf, vlan, qos))
+}
+
+// Netlink message types and attributes used to configure a VF, see
+// linux/rtnetlink.h and linux/if_link.h
+const (
+	nlmsgHdrLen    = 16
+	ifInfoMsgLen   = 16
+	rtmSetLink     = 19
+	nlmFRequest    = 0x1
+	nlmFAck        = 0x4
+	nlmsgError     = 0x2
+	iflaVFInfoList = 22
+	iflaVFInfo     = 1
+	iflaVFMac      = 1
+	iflaVFVlan     = 2
+	nlaFNested     = 0x8000
+)
+
+func nlAlign(n int) int {
+	return (n + 3) &^ 3
+}
+
+// nlAttr returns a netlink attribute with the data padded to 4 bytes
+func nlAttr(typ uint16, data []byte) []byte {
+
+	b := make([]byte, nlAlign(4+len(data)))
+	binary.LittleEndian.PutUint16(b[0:], uint16(4+len(data)))
+	binary.LittleEndian.PutUint16(b[2:], typ)
+	copy(b[4:], data)
+	return b
+}
+
+// setLinkMessage returns a RTM_SETLINK request for the interface with the VF
+// attribute nested in IFLA_VFINFO_LIST/IFLA_VF_INFO.
+func setLinkMessage(ifindex int, vfAttr []byte) []byte {
+
+	info := nlAttr(iflaVFInfo|nlaFNested, vfAttr)
+	list := nlAttr(iflaVFInfoList|nlaFNested, info)
+
+	msg := make([]byte, nlmsgHdrLen+ifInfoMsgLen, nlmsgHdrLen+ifInfoMsgLen+len(list))
+	msg = append(msg, list...)
+
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.LittleEndian.PutUint16(msg[4:], rtmSetLink)
+	binary.LittleEndian.PutUint16(msg[6:], nlmFRequest|nlmFAck)
+	binary.LittleEndian.PutUint32(msg[8:], 1) // Sequence number
+
+	// ifinfomsg: family, pad, type, index, flags, change
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen+4:], uint32(ifindex))
+
+	return msg
+}
+
+// vfMacMessage returns the request to set the MAC address of a VF, the
+// struct ifla_vf_mac has a 32 byte address field.
+func vfMacMessage(ifindex, vf int, mac net.HardwareAddr) []byte {
+
+	data := make([]byte, 4+32)
+	binary.LittleEndian.PutUint32(data, uint32(vf))
+	copy(data[4:], mac)
+
+	return setLinkMessage(ifindex, nlAttr(iflaVFMac, data))
+}
+
+// vfVlanMessage returns the request to set the VLAN and priority of a VF
+func vfVlanMessage(ifindex, vf, vlan, qos int) []byte {
+
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data[0:], uint32(vf))
+	binary.LittleEndian.PutUint32(data[4:], uint32(vlan))
+	binary.LittleEndian.PutUint32(data[8:], uint32(qos))
+
+	return setLinkMessage(ifindex, nlAttr(iflaVFVlan, data))
+}
+
+// netlinkRequest sends the route netlink request and waits for the ack,
+// replaced in the tests.
+var netlinkRequest = func(msg []byte) error {
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("netlink socket: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Sendto(fd, msg, 0, sa); err != nil {
+		return fmt.Errorf("netlink send: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return fmt.Errorf("netlink receive: %v", err)
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return fmt.Errorf("netlink parse: %v", err)
+	}
+	for _, m := range msgs {
+		if m.Header.Type != nlmsgError || len(m.Data) < 4 {
+			continue
+		}
+		// The ack is an error message with an error code of zero
+		if errno := int32(binary.LittleEndian.Uint32(m.Data)); errno != 0 {
+			return fmt.Errorf("netlink: %v", syscall.Errno(-errno))
+		}
+		return nil
+	}
+	return fmt.Errorf("netlink: no ack received")
+}
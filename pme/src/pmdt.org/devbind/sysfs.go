@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package devbind
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	tlog "pmdt.org/ttylog"
+)
+
+// Enumerate the PCI devices from sysfs and the routes from procfs instead of
+// running lspci and ip.
+
+// DefaultProcfs is the mount point of procfs
+const DefaultProcfs = "/proc"
+
+// modulesDir holds the modules.alias file of each kernel release
+var modulesDir = "/lib/modules"
+
+// SetProcfs sets the root of the procfs tree, used to test with a fake procfs
+func (db *BindInfo) SetProcfs(root string) {
+	db.procfs = root
+}
+
+// procPath returns the path of the file in procfs
+func (db *BindInfo) procPath(elem ...string) string {
+
+	root := db.procfs
+	if len(root) == 0 {
+		root = DefaultProcfs
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// readID reads a hex id file like vendor or class and removes the 0x prefix
+func readID(file string) string {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(string(dat)), "0x"))
+}
+
+// modAlias is a kernel module alias pattern from modules.alias
+type modAlias struct {
+	pattern string
+	module  string
+}
+
+// loadModAliases reads the PCI aliases of the running kernel modules.alias
+func (db *BindInfo) loadModAliases() []modAlias {
+
+	dat, err := ioutil.ReadFile(db.procPath("sys", "kernel", "osrelease"))
+	if err != nil {
+		return nil
+	}
+	file := filepath.Join(modulesDir, strings.TrimSpace(string(dat)), "modules.alias")
+
+	f, err := os.Open(file)
+	if err != nil {
+		tlog.DebugPrintf("modules.alias: %v\n", err)
+		return nil
+	}
+	defer f.Close()
+
+	aliases := []modAlias{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.Fields(scanner.Text())
+		if len(w) == 3 && w[0] == "alias" && strings.HasPrefix(w[1], "pci:") {
+			aliases = append(aliases, modAlias{pattern: w[1], module: w[2]})
+		}
+	}
+	return aliases
+}
+
+// kernelModules returns the modules able to drive the device with the modalias
+func kernelModules(aliases []modAlias, alias string) string {
+
+	mods := []string{}
+	seen := make(map[string]bool)
+	for _, a := range aliases {
+		if ok, _ := path.Match(a.pattern, alias); ok && !seen[a.module] {
+			seen[a.module] = true
+			mods = append(mods, a.module)
+		}
+	}
+	return strings.Join(mods, ",")
+}
+
+// readDevice reads the PCI device information from sysfs
+func (db *BindInfo) readDevice(slot string, aliases []modAlias) *DeviceClass {
+
+	dev := &DeviceClass{Slot: slot}
+
+	// The class is 0xCCSSPP: class, subclass and programming interface
+	class := readID(db.pciPath(slot, "class"))
+	if len(class) < 4 {
+		return nil
+	}
+	class = fmt.Sprintf("%06s", class)
+	dev.Class.ID = DevClassID(class[0:2])
+	dev.Class.Sub = DevSubClassID(class[2:4])
+	dev.Class.Str = db.ids.SubClass(dev.Class.ID, dev.Class.Sub)
+	if len(dev.Class.Str) == 0 {
+		dev.Class.Str = db.ids.Class(dev.Class.ID)
+	}
+
+	dev.Vendor.ID = VendorID(readID(db.pciPath(slot, "vendor")))
+	dev.Vendor.Str = db.ids.Vendor(dev.Vendor.ID)
+	dev.Device.ID = DeviceID(readID(db.pciPath(slot, "device")))
+	dev.Device.Str = db.ids.Device(dev.Vendor.ID, dev.Device.ID)
+	dev.SVendor.ID = SVendorID(readID(db.pciPath(slot, "subsystem_vendor")))
+	dev.SVendor.Str = db.ids.Vendor(VendorID(dev.SVendor.ID))
+	dev.SDevice.ID = SDeviceID(readID(db.pciPath(slot, "subsystem_device")))
+	dev.SDevice.Str = db.ids.SubDevice(dev.Vendor.ID, dev.Device.ID, dev.SVendor.ID, dev.SDevice.ID)
+	if len(dev.SDevice.Str) == 0 {
+		dev.SDevice.Str = dev.Device.Str
+	}
+	dev.Rev = readID(db.pciPath(slot, "revision"))
+
+	dev.Driver = db.CurrentDriver(slot)
+
+	if alias, err := ioutil.ReadFile(db.pciPath(slot, "modalias")); err == nil {
+		dev.Module = kernelModules(aliases, strings.TrimSpace(string(alias)))
+	}
+	if len(dev.Module) == 0 && len(dev.Driver) > 0 && !IsUioModule(dev.Driver) {
+		dev.Module = dev.Driver
+	}
+
+	// lspci does not report a NUMA node for devices without one
+	if dat, err := ioutil.ReadFile(db.pciPath(slot, "numa_node")); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(dat))); err == nil && n >= 0 {
+			dev.NumaNode = strconv.Itoa(n)
+		}
+	}
+
+	db.readSRIOV(dev)
+	dev.IOMMUGroup = db.IOMMUGroup(slot)
+
+	if ifaces, err := ioutil.ReadDir(db.pciPath(slot, "net")); err == nil {
+		names := []string{}
+		for _, i := range ifaces {
+			names = append(names, i.Name())
+		}
+		sort.Strings(names)
+		dev.Interface = strings.Join(names, ",")
+	}
+
+	return dev
+}
+
+// scanDevices reads all of the PCI devices in sysfs
+func (db *BindInfo) scanDevices() []*DeviceClass {
+
+	entries, err := ioutil.ReadDir(db.sysPath("bus", "pci", "devices"))
+	if err != nil {
+		tlog.ErrorPrintf("PCI devices: %v\n", err)
+		return nil
+	}
+
+	if db.ids == nil {
+		if db.ids, err = FindPCIIDs(); err != nil {
+			tlog.WarnPrintf("%v\n", err)
+		}
+	}
+	aliases := db.loadModAliases()
+
+	devs := []*DeviceClass{}
+	for _, e := range entries {
+		if dev := db.readDevice(e.Name(), aliases); dev != nil {
+			devs = append(devs, dev)
+		}
+	}
+	return devs
+}
+
+// RouteInterfaces returns the interfaces with an IPv4 route from
+// /proc/net/route or an IPv6 route from /proc/net/ipv6_route, link local
+// routes are skipped.
+func (db *BindInfo) RouteInterfaces() map[string]bool {
+
+	ifaces := make(map[string]bool)
+
+	if f, err := os.Open(db.procPath("net", "route")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			w := strings.Fields(scanner.Text())
+			if len(w) < 2 || w[0] == "Iface" {
+				continue
+			}
+			// The destination is in network byte order printed as a host
+			// integer, 169.254.0.0/16 has the low 16 bits 0xfea9 on x86.
+			dest, err := strconv.ParseUint(w[1], 16, 32)
+			if err == nil && dest&0xffff == 0xfea9 {
+				continue
+			}
+			ifaces[w[0]] = true
+		}
+		f.Close()
+	}
+
+	// The IPv6 routes of all the tables have the destination in the first
+	// field and the interface in the last, the local table has the loopback
+	// and multicast routes.
+	if f, err := os.Open(db.procPath("net", "ipv6_route")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			w := strings.Fields(scanner.Text())
+			if len(w) != 10 || len(w[0]) != 32 || w[9] == "lo" {
+				continue
+			}
+			// Skip the link local fe80::/10 and the multicast ff00::/8 routes
+			prefix, err := strconv.ParseUint(w[0][:4], 16, 16)
+			if err != nil || prefix&0xffc0 == 0xfe80 || prefix&0xff00 == 0xff00 {
+				continue
+			}
+			ifaces[w[9]] = true
+		}
+		f.Close()
+	}
+
+	return ifaces
+}
+
+// setActive marks the devices with an interface that has a route
+func (db *BindInfo) setActive(routes map[string]bool) {
+
+	for _, dev := range db.Devices {
+		dev.SSHIf = ""
+		dev.Active = false
+		for _, iface := range strings.Split(dev.Interface, ",") {
+			if len(iface) > 0 && routes[iface] {
+				dev.Active = true
+			}
+		}
+	}
+}
@@ -5,7 +5,8 @@ package devbind
 
 import (
 	"fmt"
-	"github.com/BurntSushi/toml"
+	"io/ioutil"
+	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 	tlog "pmdt.org/ttylog"
@@ -138,10 +139,20 @@ type DeviceClass struct {
 	NumaNode  string
 	SSHIf     string
 	Active    bool
+
+	// SR-IOV information, a PF has TotalVFs > 0 and a VF has a PhysFn
+	TotalVFs int      // Number of VFs the PF supports
+	NumVFs   int      // Number of VFs enabled on the PF
+	VFs      []string // Slots of the VFs of a PF in VF index order
+	PhysFn   string   // Slot of the PF of a VF
+	VFIndex  int      // Index of a VF on its PF
+
+	IOMMUGroup string // IOMMU group of the device, empty without an IOMMU
 }
 
 // DeviceConfig - Network Class information
 type DeviceConfig struct {
+	Name  string `toml:"-"` // Name of the TOML section
 	Group string `toml:"group"`
 	Desc  string `toml:"desc"`
 	Class struct {
@@ -152,6 +163,9 @@ type DeviceConfig struct {
 	Device  DeviceID  `toml:"device_id"`
 	SVendor SVendorID `toml:"svendor_id"`
 	SDevice SDeviceID `toml:"sdevice_id"`
+	Select  string    `toml:"selector"` // Selector expression, see ParseSelector
+
+	sel *Selector // Selector of the validated configuration
 }
 
 // DeviceList is a list of all devices found in system
@@ -176,24 +190,22 @@ func isGroup(group string) bool {
 // ValidateDeviceFile is a valid TOML file for devbind
 func ValidateDeviceFile(file string) (DevConfigs, DevGroups, error) {
 
-	cfgs := make(DevConfigs)
-	grps := make(DevGroups)
-
-	if _, err := toml.DecodeFile(file, &cfgs); err != nil {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	// Create the device class grouping from the device list
-	for _, v := range cfgs {
-		grps[v.Group] = append(grps[v.Group], v)
-		if !isGroup(v.Group) {
-			return nil, nil, fmt.Errorf("group (%s) is not valid %v",
-				v.Group, ValidGroups)
+	cfgs, errs := decodeDevices(file, string(dat))
+	if len(errs) > 0 {
+		msgs := []string{}
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
 		}
+		return nil, nil, fmt.Errorf("%s", strings.Join(msgs, "\n"))
 	}
-	tlog.DebugPrintf("Groups:\n%s\n", spew.Sdump(grps))
+	tlog.DebugPrintf("Groups:\n%s\n", spew.Sdump(cfgs))
 
-	return cfgs, grps, nil
+	return cfgs, groupDevices(cfgs), nil
 }
 
 // LoadDeviceFile and create the config and groups
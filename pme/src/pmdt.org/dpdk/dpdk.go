@@ -124,6 +124,18 @@ type EthdevPidList struct {
 	Pids []uint16 `json:"/ethdev/list"`
 }
 
+// EthdevPortInfo - port information, the name is the PCI address for
+// PCI based ports
+type EthdevPortInfo struct {
+	Name     string `json:"name"`
+	NumaNode int    `json:"numa_node"`
+}
+
+// EthdevInfo holds the port information
+type EthdevInfo struct {
+	Info EthdevPortInfo `json:"/ethdev/info"`
+}
+
 // EALParams is the data structure to hold EAL Parameters
 type EALParams struct {
 	Params []string `json:"/eal/params"`
@@ -146,6 +158,7 @@ type Information struct {
 	Params      EALParams // Holds the EAL parameter data
 	AppParams   AppParams // Holds the EAL parameter data
 	PidList     EthdevPidList
+	PortInfo    map[uint16]EthdevPortInfo
 	EthdevStats []*EthdevStats
 	PrevStats   [MaxPortCount]EthdevStats
 }
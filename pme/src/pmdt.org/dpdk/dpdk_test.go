@@ -17,3 +17,117 @@ func TestClose(t *testing.T) {
 	fmt.Printf("Close DPDK\n")
 
 }
+
+func TestLCores(t *testing.T) {
+
+	d := ParseCmdLine("app -l 1-3,8 -n 4 -- -p 0x3")
+	got := fmt.Sprint(d.LCores())
+	if got != "[1 2 3 8]" {
+		t.Errorf("LCores() = %s, want [1 2 3 8]", got)
+	}
+}
+
+func TestMainLCore(t *testing.T) {
+
+	tests := []struct {
+		cmdline string
+		want    int
+	}{
+		{"app -l 4-7 -n 4", 4},
+		{"app -l 8,2-3", 2},
+		{"app -l 1-3 --main-lcore 3", 3},
+		{"app -l 1-3 --main-lcore=2", 2},
+		{"app -c 0x6 --master-lcore 2", 2},
+		{"app -n 4", -1},
+	}
+	for _, tt := range tests {
+		if got := ParseCmdLine(tt.cmdline).MainLCore(); got != tt.want {
+			t.Errorf("%s: MainLCore() = %d, want %d", tt.cmdline, got, tt.want)
+		}
+	}
+}
+
+func TestSocketMem(t *testing.T) {
+
+	tests := []struct {
+		cmdline string
+		want    string
+	}{
+		{"app -l 1-2 --socket-mem 1024,0", "[1024 0]"},
+		{"app -l 1-2 --socket-mem=512,512", "[512 512]"},
+		{"app -l 1-2", "[]"},
+	}
+	for _, tt := range tests {
+		mem, err := ParseCmdLine(tt.cmdline).SocketMem()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.cmdline, err)
+		}
+		if got := fmt.Sprint(mem); got != tt.want {
+			t.Errorf("%s: SocketMem() = %s, want %s", tt.cmdline, got, tt.want)
+		}
+	}
+
+	if _, err := ParseCmdLine("app --socket-mem 1G").SocketMem(); err == nil {
+		t.Errorf("SocketMem() accepted an invalid size")
+	}
+}
+
+func TestNumaAudit(t *testing.T) {
+
+	nodes := map[int]int{1: 0, 2: 0, 9: 1, 10: 1}
+	tests := []struct {
+		name string
+		cfg  NumaConfig
+		want []Severity
+	}{
+		{"local", NumaConfig{
+			LCores: []int{1, 2}, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Slot: "0000:18:00.0", Node: 0}},
+			SocketMem:   []uint64{1024, 0},
+			HugepagesMB: map[int]uint64{0: 2048, 1: 2048},
+		}, []Severity{}},
+		{"remote port", NumaConfig{
+			LCores: []int{9, 10}, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Slot: "0000:18:00.0", Node: 0}},
+			SocketMem:   []uint64{1024, 1024},
+			HugepagesMB: map[int]uint64{0: 2048, 1: 2048},
+		}, []Severity{Critical, Warning}},
+		{"no socket memory", NumaConfig{
+			LCores: []int{1, 9}, LCoreNode: nodes,
+			Ports:     []NumaPort{{ID: 0, Node: 0}, {ID: 1, Node: 1}},
+			SocketMem: []uint64{1024},
+		}, []Severity{Critical}},
+		{"no hugepages", NumaConfig{
+			LCores: []int{1, 2}, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Node: 0}, {ID: 1, Node: -1}},
+			HugepagesMB: map[int]uint64{0: 0, 1: 2048},
+		}, []Severity{Critical, Info}},
+		{"remote main lcore", NumaConfig{
+			LCores: []int{1, 9, 10}, MainLCore: 1, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Node: 1}},
+			HugepagesMB: map[int]uint64{0: 2048, 1: 2048},
+		}, []Severity{}},
+		{"only the main lcore", NumaConfig{
+			LCores: []int{9}, MainLCore: 9, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Node: 0}},
+			HugepagesMB: map[int]uint64{0: 2048, 1: 2048},
+		}, []Severity{Critical, Warning}},
+		{"too much socket memory", NumaConfig{
+			LCores: []int{1}, LCoreNode: nodes,
+			Ports:       []NumaPort{{ID: 0, Node: 0}},
+			SocketMem:   []uint64{4096},
+			HugepagesMB: map[int]uint64{0: 2048},
+		}, []Severity{Warning}},
+	}
+
+	for _, tt := range tests {
+		findings := NumaAudit(tt.cfg)
+		got := []Severity{}
+		for _, f := range findings {
+			got = append(got, f.Severity)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: NumaAudit() = %v, want severities %v", tt.name, findings, tt.want)
+		}
+	}
+}
@@ -57,6 +57,7 @@ func init() {
 		{[]string{"--iova-mode"}, true},
 		{[]string{"--iova-mode"}, true},
 		{[]string{"--log-level"}, true},
+		{[]string{"--main-lcore"}, true},
 		{[]string{"--master-lcore"}, true},
 		{[]string{"--mbuf-pool-opts-name"}, true},
 		{[]string{"--no-hpet"}, false},
@@ -254,7 +255,7 @@ func (d *CmdLineData) LCores() []int {
 				dash := strings.Split(c, "-")
 				lo, _ := strconv.Atoi(dash[0])
 				hi, _ := strconv.Atoi(dash[1])
-				for ; lo < hi; lo++ {
+				for ; lo <= hi; lo++ {
 					lcores = append(lcores, lo)
 				}
 			} else {
@@ -279,6 +280,38 @@ func (d *CmdLineData) LCores() []int {
 	return lcores
 }
 
+// MainLCore of the application from --main-lcore or the older
+// --master-lcore, the EAL uses the lowest lcore when neither is given.
+// Returns -1 if the application has no lcores.
+func (d *CmdLineData) MainLCore() int {
+
+	if d == nil {
+		return -1
+	}
+
+	for _, opt := range []string{"--main-lcore", "--master-lcore"} {
+		v := d.FindOption(opt, true)
+		for _, o := range d.dpdkOpts {
+			if strings.HasPrefix(o.flg, opt+"=") {
+				v = append(v, strings.TrimPrefix(o.flg, opt+"="))
+			}
+		}
+		if len(v) > 0 {
+			if c, err := strconv.Atoi(strings.TrimSpace(v[0])); err == nil {
+				return c
+			}
+		}
+	}
+
+	main := -1
+	for _, c := range d.LCores() {
+		if main < 0 || c < main {
+			main = c
+		}
+	}
+	return main
+}
+
 // IsLCoreUsed in this DPDK application
 func IsLCoreUsed(cpu int, lcores []int) bool {
 
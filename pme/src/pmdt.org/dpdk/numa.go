@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package dpdk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The NUMA audit looks at the lcores, ports and memory of a DPDK application
+// and reports the places where the data crosses between NUMA nodes. DPDK
+// numbers its sockets by NUMA node, the nodes are used for all of the checks.
+
+// Severity of a NUMA finding
+type Severity int
+
+// Severities of the findings, the most severe first
+const (
+	Critical Severity = iota
+	Warning
+	Info
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+
+	switch s {
+	case Critical:
+		return "Critical"
+	case Warning:
+		return "Warning"
+	}
+	return "Info"
+}
+
+// NumaFinding of the NUMA audit
+type NumaFinding struct {
+	Severity Severity
+	Message  string
+}
+
+// NumaPort is a port of the application and the NUMA node of its device,
+// the node is -1 if unknown.
+type NumaPort struct {
+	ID   uint16
+	Slot string
+	Node int
+}
+
+// NumaConfig of the application to audit
+type NumaConfig struct {
+	LCores      []int
+	MainLCore   int         // EAL main lcore, it does not poll ports, -1 if not known
+	LCoreNode   map[int]int // lcore to NUMA node
+	Ports       []NumaPort
+	SocketMem   []uint64       // MB per node from --socket-mem, nil if not given
+	HugepagesMB map[int]uint64 // MB of hugepages on each node
+}
+
+// SocketMem returns the MB of memory per NUMA node from --socket-mem or nil
+// if the option is not given.
+func (d *CmdLineData) SocketMem() ([]uint64, error) {
+
+	if d == nil {
+		return nil, nil
+	}
+
+	v := d.FindOption("--socket-mem", true)
+	if len(v) == 0 {
+		// The --socket-mem=1024,1024 form is one option
+		for _, o := range d.dpdkOpts {
+			if strings.HasPrefix(o.flg, "--socket-mem=") {
+				v = append(v, strings.TrimPrefix(o.flg, "--socket-mem="))
+			}
+		}
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	mem := []uint64{}
+	for _, s := range strings.Split(v[0], ",") {
+		mb, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --socket-mem %q", v[0])
+		}
+		mem = append(mem, mb)
+	}
+	return mem, nil
+}
+
+// socketMem returns the MB given to the node by --socket-mem
+func (cfg *NumaConfig) socketMem(node int) uint64 {
+
+	if node < 0 || node >= len(cfg.SocketMem) {
+		return 0
+	}
+	return cfg.SocketMem[node]
+}
+
+// NumaAudit returns the findings of the application sorted by severity
+func NumaAudit(cfg NumaConfig) []NumaFinding {
+
+	findings := []NumaFinding{}
+	add := func(s Severity, format string, a ...interface{}) {
+		findings = append(findings, NumaFinding{Severity: s, Message: fmt.Sprintf(format, a...)})
+	}
+
+	// The lcores of each node, the main lcore of the EAL runs the control
+	// path and polls the ports only when it is the only lcore
+	lcores := make(map[int][]int)
+	for _, c := range cfg.LCores {
+		if c == cfg.MainLCore && len(cfg.LCores) > 1 {
+			continue
+		}
+		if n, ok := cfg.LCoreNode[c]; ok && n >= 0 {
+			lcores[n] = append(lcores[n], c)
+		}
+	}
+
+	// The nodes of the ports, the ports without a node are only reported
+	ports := make(map[int][]uint16)
+	for _, p := range cfg.Ports {
+		if p.Node < 0 {
+			add(Info, "Port %d (%s) has no NUMA node, locality not checked", p.ID, p.Slot)
+			continue
+		}
+		ports[p.Node] = append(ports[p.Node], p.ID)
+
+		if len(lcores[p.Node]) == 0 && len(lcores) > 0 {
+			add(Critical, "Port %d (%s) is on node %d and no lcore is on node %d, every packet crosses nodes",
+				p.ID, p.Slot, p.Node, p.Node)
+		}
+	}
+
+	for _, n := range lcoreNodes(lcores) {
+		if len(ports) > 0 && len(ports[n]) == 0 {
+			add(Warning, "Lcores %s are on node %d with no ports, they poll ports on a remote node",
+				intList(lcores[n]), n)
+		}
+	}
+
+	// The memory of the nodes used by the lcores and the ports
+	nodes := lcoreNodes(lcores)
+	for n := range ports {
+		if len(lcores[n]) == 0 {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Ints(nodes)
+
+	for _, n := range nodes {
+		portNode := len(ports[n]) > 0
+		huge, known := cfg.HugepagesMB[n]
+
+		switch {
+		case cfg.SocketMem != nil && cfg.socketMem(n) == 0 && portNode:
+			add(Critical, "--socket-mem gives node %d no memory, the buffers of ports %s come from a remote node",
+				n, uint16List(ports[n]))
+		case cfg.SocketMem != nil && cfg.socketMem(n) == 0:
+			add(Warning, "--socket-mem gives node %d no memory, lcores %s use memory from a remote node",
+				n, intList(lcores[n]))
+		case cfg.HugepagesMB != nil && known && huge == 0 && portNode:
+			add(Critical, "Node %d has no hugepages, the buffers of ports %s come from a remote node",
+				n, uint16List(ports[n]))
+		case cfg.HugepagesMB != nil && known && huge == 0:
+			add(Warning, "Node %d has no hugepages, lcores %s use memory from a remote node",
+				n, intList(lcores[n]))
+		case known && cfg.socketMem(n) > huge:
+			add(Warning, "--socket-mem asks for %d MB on node %d, the node has %d MB of hugepages",
+				cfg.socketMem(n), n, huge)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity < findings[j].Severity
+	})
+
+	return findings
+}
+
+// lcoreNodes returns the sorted nodes of the lcores
+func lcoreNodes(lcores map[int][]int) []int {
+
+	nodes := []int{}
+	for n := range lcores {
+		nodes = append(nodes, n)
+	}
+	sort.Ints(nodes)
+
+	return nodes
+}
+
+func intList(v []int) string {
+
+	s := make([]string, len(v))
+	for i, n := range v {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+func uint16List(v []uint16) string {
+
+	s := make([]string, len(v))
+	for i, n := range v {
+		s[i] = strconv.Itoa(int(n))
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,3 @@
+module pmdt.org/hugepages
+
+go 1.14
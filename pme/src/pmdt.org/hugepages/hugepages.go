@@ -0,0 +1,393 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package hugepages
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Read the hugepage pools of each NUMA node and page size from sysfs, the
+// hugetlbfs mounts from procfs and the processes holding hugepage files. DPDK
+// names the hugepage files <file-prefix>map_<n>, the prefix tells which DPDK
+// process owns the pages.
+
+// Hugepages information from sysfs and procfs
+type Hugepages struct {
+	root string
+}
+
+// Pool of hugepages of one size on a NUMA node
+type Pool struct {
+	Node    int
+	SizeKB  uint64
+	Total   uint64
+	Free    uint64
+	Surplus uint64
+}
+
+// Mount of a hugetlbfs file system
+type Mount struct {
+	Path     string
+	SizeKB   uint64 // Page size of the mount
+	Options  string
+	Files    int    // Number of files in the mount
+	Prefixes []string
+}
+
+// Holder of hugepage files, a process or the files left by a process that
+// exited, the PID is 0 for files no process has mapped.
+type Holder struct {
+	PID    int
+	Comm   string
+	Prefix string // DPDK --file-prefix of the files
+	Mount  string
+	Files  int
+	Bytes  uint64
+}
+
+// New hugepages object, root is the optional root of the file system used
+// to find sys, proc and the mounts.
+func New(root ...string) *Hugepages {
+
+	h := &Hugepages{root: "/"}
+	if len(root) > 0 && len(root[0]) > 0 {
+		h.root = root[0]
+	}
+	return h
+}
+
+// path returns the path of the file under the root
+func (h *Hugepages) path(elem ...string) string {
+	return filepath.Join(append([]string{h.root}, elem...)...)
+}
+
+func readUint(file string) (uint64, error) {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(dat)), 10, 64)
+}
+
+// pageSizeKB returns the size of a hugepages-<size>kB directory
+func pageSizeKB(dir string) (uint64, bool) {
+
+	name := filepath.Base(dir)
+	if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+		return 0, false
+	}
+	size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "hugepages-"), "kB"), 10, 64)
+	return size, err == nil
+}
+
+// nodeDir returns the hugepages directory of the node and page size
+func (h *Hugepages) nodeDir(node int, sizeKB uint64) string {
+
+	return h.path("sys", "devices", "system", "node", fmt.Sprintf("node%d", node),
+		"hugepages", fmt.Sprintf("hugepages-%dkB", sizeKB))
+}
+
+// Pools returns the hugepage pools of each NUMA node and page size sorted by
+// node and size.
+func (h *Hugepages) Pools() ([]Pool, error) {
+
+	dirs, err := filepath.Glob(h.path("sys", "devices", "system", "node", "node*", "hugepages", "hugepages-*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no NUMA node hugepages found in %s", h.path("sys", "devices", "system", "node"))
+	}
+
+	pools := []Pool{}
+	for _, dir := range dirs {
+		size, ok := pageSizeKB(dir)
+		if !ok {
+			continue
+		}
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(filepath.Dir(dir))), "node"))
+		if err != nil {
+			continue
+		}
+
+		p := Pool{Node: node, SizeKB: size}
+		p.Total, _ = readUint(filepath.Join(dir, "nr_hugepages"))
+		p.Free, _ = readUint(filepath.Join(dir, "free_hugepages"))
+		p.Surplus, _ = readUint(filepath.Join(dir, "surplus_hugepages"))
+
+		pools = append(pools, p)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		if pools[i].Node != pools[j].Node {
+			return pools[i].Node < pools[j].Node
+		}
+		return pools[i].SizeKB < pools[j].SizeKB
+	})
+
+	return pools, nil
+}
+
+// SetPages resizes the pool of the node and page size, the kernel may not
+// find enough free memory and allocate fewer pages, which is an error.
+func (h *Hugepages) SetPages(node int, sizeKB, pages uint64) error {
+
+	file := filepath.Join(h.nodeDir(node, sizeKB), "nr_hugepages")
+	if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("node %d has no %d kB hugepages: %v", node, sizeKB, err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(strconv.FormatUint(pages, 10)), 0200); err != nil {
+		return fmt.Errorf("write %d to %s: %v", pages, file, err)
+	}
+
+	if n, err := readUint(file); err == nil && n != pages {
+		return fmt.Errorf("node %d allocated %d of %d %d kB hugepages", node, n, pages, sizeKB)
+	}
+	return nil
+}
+
+// DefaultSizeKB returns the default hugepage size from /proc/meminfo
+func (h *Hugepages) DefaultSizeKB() uint64 {
+
+	f, err := os.Open(h.path("proc", "meminfo"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.Fields(scanner.Text())
+		if len(w) >= 2 && w[0] == "Hugepagesize:" {
+			size, _ := strconv.ParseUint(w[1], 10, 64)
+			return size
+		}
+	}
+	return 0
+}
+
+// ParseSize converts a page size like 2M, 1G or 2048kB to kB
+func ParseSize(s string) (uint64, error) {
+
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I")
+
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(str, "K"):
+		str = strings.TrimSuffix(str, "K")
+	case strings.HasSuffix(str, "M"):
+		str, mult = strings.TrimSuffix(str, "M"), 1024
+	case strings.HasSuffix(str, "G"):
+		str, mult = strings.TrimSuffix(str, "G"), 1024*1024
+	}
+
+	v, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid page size %q", s)
+	}
+	return v * mult, nil
+}
+
+// FormatSize returns the page size in kB as 2M or 1G
+func FormatSize(sizeKB uint64) string {
+
+	switch {
+	case sizeKB >= 1024*1024 && sizeKB%(1024*1024) == 0:
+		return fmt.Sprintf("%dG", sizeKB/(1024*1024))
+	case sizeKB >= 1024 && sizeKB%1024 == 0:
+		return fmt.Sprintf("%dM", sizeKB/1024)
+	}
+	return fmt.Sprintf("%dK", sizeKB)
+}
+
+// FilePrefix returns the DPDK file prefix of a hugepage file name, names not
+// made by DPDK are returned as is.
+func FilePrefix(name string) string {
+
+	if i := strings.LastIndex(name, "map_"); i >= 0 {
+		if _, err := strconv.Atoi(name[i+4:]); err == nil {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// Mounts returns the hugetlbfs mounts from /proc/mounts
+func (h *Hugepages) Mounts() ([]Mount, error) {
+
+	f, err := os.Open(h.path("proc", "mounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	def := h.DefaultSizeKB()
+
+	mounts := []Mount{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		w := strings.Fields(scanner.Text())
+		if len(w) < 4 || w[2] != "hugetlbfs" {
+			continue
+		}
+		m := Mount{Path: w[1], Options: w[3], SizeKB: def}
+		for _, opt := range strings.Split(w[3], ",") {
+			if strings.HasPrefix(opt, "pagesize=") {
+				if size, err := ParseSize(strings.TrimPrefix(opt, "pagesize=")); err == nil {
+					m.SizeKB = size
+				}
+			}
+		}
+
+		prefixes := make(map[string]bool)
+		if files, err := ioutil.ReadDir(h.path(m.Path)); err == nil {
+			for _, fi := range files {
+				if fi.Mode().IsRegular() {
+					m.Files++
+					prefixes[FilePrefix(fi.Name())] = true
+				}
+			}
+		}
+		for p := range prefixes {
+			m.Prefixes = append(m.Prefixes, p)
+		}
+		sort.Strings(m.Prefixes)
+
+		mounts = append(mounts, m)
+	}
+
+	return mounts, nil
+}
+
+// mountOf returns the mount holding the file or an empty string
+func mountOf(mounts []Mount, file string) string {
+
+	for _, m := range mounts {
+		if strings.HasPrefix(file, strings.TrimSuffix(m.Path, "/")+"/") {
+			return m.Path
+		}
+	}
+	return ""
+}
+
+// Holders returns the processes with hugepage files mapped and the files in
+// the mounts not mapped by any process, grouped by file prefix.
+func (h *Hugepages) Holders() ([]Holder, error) {
+
+	mounts, err := h.Mounts()
+	if err != nil {
+		return nil, err
+	}
+
+	procs, err := ioutil.ReadDir(h.path("proc"))
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		pid    int
+		prefix string
+		mount  string
+	}
+	holders := make(map[key]*Holder)
+	mapped := make(map[string]bool)
+
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(h.path("proc", p.Name(), "maps"))
+		if err != nil {
+			continue
+		}
+		comm, _ := ioutil.ReadFile(h.path("proc", p.Name(), "comm"))
+
+		seen := make(map[string]bool)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// address perms offset dev inode path
+			w := strings.Fields(scanner.Text())
+			if len(w) < 6 {
+				continue
+			}
+			file := w[5]
+			mnt := mountOf(mounts, file)
+			if len(mnt) == 0 {
+				continue
+			}
+
+			var start, end uint64
+			if r := strings.SplitN(w[0], "-", 2); len(r) == 2 {
+				start, _ = strconv.ParseUint(r[0], 16, 64)
+				end, _ = strconv.ParseUint(r[1], 16, 64)
+			}
+
+			k := key{pid: pid, prefix: FilePrefix(filepath.Base(file)), mount: mnt}
+			hd, ok := holders[k]
+			if !ok {
+				hd = &Holder{PID: pid, Comm: strings.TrimSpace(string(comm)), Prefix: k.prefix, Mount: mnt}
+				holders[k] = hd
+			}
+			// A file mapped more than once holds the same pages
+			if !seen[file] {
+				seen[file] = true
+				hd.Files++
+				if end > start {
+					hd.Bytes += end - start
+				}
+			}
+			mapped[file] = true
+		}
+		f.Close()
+	}
+
+	// Files left in the mounts by processes that exited still hold pages
+	for _, m := range mounts {
+		files, err := ioutil.ReadDir(h.path(m.Path))
+		if err != nil {
+			continue
+		}
+		for _, fi := range files {
+			file := filepath.Join(m.Path, fi.Name())
+			if !fi.Mode().IsRegular() || mapped[file] {
+				continue
+			}
+			k := key{prefix: FilePrefix(fi.Name()), mount: m.Path}
+			hd, ok := holders[k]
+			if !ok {
+				hd = &Holder{Prefix: k.prefix, Mount: m.Path}
+				holders[k] = hd
+			}
+			hd.Files++
+			hd.Bytes += m.SizeKB * 1024
+		}
+	}
+
+	list := []Holder{}
+	for _, hd := range holders {
+		list = append(list, *hd)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Prefix != list[j].Prefix {
+			return list[i].Prefix < list[j].Prefix
+		}
+		if list[i].PID != list[j].PID {
+			return list[i].PID < list[j].PID
+		}
+		return list[i].Mount < list[j].Mount
+	})
+
+	return list, nil
+}
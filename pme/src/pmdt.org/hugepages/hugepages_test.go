@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package hugepages
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTree creates a fake root with two nodes, a 2M and a 1G mount, a DPDK
+// process with the rte prefix and files left by a process with prefix app1.
+func makeTree(t *testing.T) string {
+
+	root, err := ioutil.TempDir("", "hugepages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := "sys/devices/system/node/"
+	files := map[string]string{
+		node + "node0/hugepages/hugepages-2048kB/nr_hugepages":         "1024",
+		node + "node0/hugepages/hugepages-2048kB/free_hugepages":       "1000",
+		node + "node0/hugepages/hugepages-2048kB/surplus_hugepages":    "0",
+		node + "node0/hugepages/hugepages-1048576kB/nr_hugepages":      "4",
+		node + "node0/hugepages/hugepages-1048576kB/free_hugepages":    "2",
+		node + "node0/hugepages/hugepages-1048576kB/surplus_hugepages": "0",
+		node + "node1/hugepages/hugepages-2048kB/nr_hugepages":         "512",
+		node + "node1/hugepages/hugepages-2048kB/free_hugepages":       "512",
+		node + "node1/hugepages/hugepages-2048kB/surplus_hugepages":    "3",
+		"proc/meminfo": "MemTotal:       65536000 kB\nHugepagesize:       2048 kB\n",
+		"proc/mounts": "sysfs /sys sysfs rw 0 0\n" +
+			"hugetlbfs /dev/hugepages hugetlbfs rw,relatime,pagesize=2M 0 0\n" +
+			"nodev /mnt/huge1G hugetlbfs rw,relatime,pagesize=1024M 0 0\n",
+		"proc/100/comm": "dpdk-testpmd",
+		"proc/100/maps": "7f0000000000-7f0000200000 rw-s 00000000 00:2f 1 /dev/hugepages/rtemap_0\n" +
+			"7f0000200000-7f0000400000 rw-s 00000000 00:2f 2 /dev/hugepages/rtemap_1\n" +
+			"7f0000400000-7f0000600000 rw-s 00000000 00:2f 2 /dev/hugepages/rtemap_1\n" +
+			"7f1000000000-7f1040000000 rw-s 00000000 00:30 3 /mnt/huge1G/rtemap_2\n" +
+			"7f2000000000-7f2000001000 r-xp 00000000 08:01 4 /usr/bin/dpdk-testpmd\n",
+		"proc/200/comm":           "bash",
+		"proc/200/maps":           "55d000000000-55d000001000 r-xp 00000000 08:01 5 /usr/bin/bash\n",
+		"dev/hugepages/rtemap_0":  "",
+		"dev/hugepages/rtemap_1":  "",
+		"dev/hugepages/app1map_0": "",
+		"dev/hugepages/app1map_1": "",
+		"mnt/huge1G/rtemap_2":     "",
+	}
+	writeTree(t, root, files)
+
+	return root
+}
+
+// writeTree writes the files of a fake file system under root, the file data
+// ends with a newline as in sysfs
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPools(t *testing.T) {
+
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	h := New(root)
+
+	pools, err := h.Pools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Pool{
+		{Node: 0, SizeKB: 2048, Total: 1024, Free: 1000},
+		{Node: 0, SizeKB: 1048576, Total: 4, Free: 2},
+		{Node: 1, SizeKB: 2048, Total: 512, Free: 512, Surplus: 3},
+	}
+	if len(pools) != len(want) {
+		t.Fatalf("pools %+v", pools)
+	}
+	for i := range want {
+		if pools[i] != want[i] {
+			t.Errorf("pool %d = %+v, want %+v", i, pools[i], want[i])
+		}
+	}
+
+	if err := h.SetPages(1, 2048, 256); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := readUint(filepath.Join(h.nodeDir(1, 2048), "nr_hugepages")); n != 256 {
+		t.Errorf("nr_hugepages = %d", n)
+	}
+	if err := h.SetPages(1, 1048576, 2); err == nil {
+		t.Errorf("SetPages of a missing pool should fail")
+	}
+
+	if _, err := New(filepath.Join(root, "none")).Pools(); err == nil {
+		t.Errorf("Pools without nodes should fail")
+	}
+}
+
+func TestSizes(t *testing.T) {
+
+	tests := []struct {
+		str  string
+		kb   uint64
+		name string
+	}{
+		{"2M", 2048, "2M"},
+		{"1G", 1048576, "1G"},
+		{"2048kB", 2048, "2M"},
+		{"1024M", 1048576, "1G"},
+		{"64K", 64, "64K"},
+	}
+	for _, tt := range tests {
+		kb, err := ParseSize(tt.str)
+		if err != nil || kb != tt.kb {
+			t.Errorf("ParseSize(%q) = %d, %v", tt.str, kb, err)
+		}
+		if s := FormatSize(kb); s != tt.name {
+			t.Errorf("FormatSize(%d) = %q", kb, s)
+		}
+	}
+
+	for name, prefix := range map[string]string{
+		"rtemap_0": "rte", "app1map_12": "app1", "map_3": "", "hugefile": "hugefile", "rtemap_x": "rtemap_x"} {
+		if p := FilePrefix(name); p != prefix {
+			t.Errorf("FilePrefix(%q) = %q, want %q", name, p, prefix)
+		}
+	}
+}
+
+func TestHolders(t *testing.T) {
+
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	h := New(root)
+
+	mounts, err := h.Mounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 2 || mounts[0].Path != "/dev/hugepages" || mounts[0].SizeKB != 2048 ||
+		mounts[0].Files != 4 || mounts[1].SizeKB != 1048576 || mounts[1].Files != 1 {
+		t.Errorf("mounts %+v", mounts)
+	}
+
+	holders, err := h.Holders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Holder{
+		{PID: 0, Prefix: "app1", Mount: "/dev/hugepages", Files: 2, Bytes: 2 * 2048 * 1024},
+		{PID: 100, Comm: "dpdk-testpmd", Prefix: "rte", Mount: "/dev/hugepages", Files: 2, Bytes: 2 * 2048 * 1024},
+		{PID: 100, Comm: "dpdk-testpmd", Prefix: "rte", Mount: "/mnt/huge1G", Files: 1, Bytes: 1 << 30},
+	}
+	if len(holders) != len(want) {
+		t.Fatalf("holders %+v", holders)
+	}
+	for i := range want {
+		if holders[i] != want[i] {
+			t.Errorf("holder %d = %+v, want %+v", i, holders[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Setters for the cpufreq governor, the scaling frequency range and the
+// cpuidle states of each CPU. The settings of the CPUs are saved before they
+// are changed so they can be restored when the tool exits.
+
+// CPUSettings of a CPU that are changed by the setters
+type CPUSettings struct {
+	CPU      int
+	Governor string
+	MinKHz   int64  // Scaling min frequency as read, -1 if not readable
+	MaxKHz   int64  // Scaling max frequency as read, -1 if not readable
+	Disabled []bool // Disable flag of each cpuidle state
+}
+
+// cpuidleFile returns the file of the cpuidle state of the CPU
+func cpuidleFile(cpu, state int, name string) string {
+	return filepath.Join(sysCPUDir, fmt.Sprintf("cpu%d", cpu), "cpuidle", fmt.Sprintf("state%d", state), name)
+}
+
+// readFile reads a sysfs file and removes the newline
+func readFile(file string) (string, error) {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(dat)), nil
+}
+
+// AvailableGovernors returns the governors of the CPU
+func AvailableGovernors(cpu int) []string {
+
+	str, err := readFile(cpufreqFile(cpu, "scaling_available_governors"))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(str)
+}
+
+// SetGovernor sets the cpufreq governor of the CPU
+func SetGovernor(cpu int, governor string) error {
+
+	found := false
+	for _, g := range AvailableGovernors(cpu) {
+		if g == governor {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("cpu %d: governor %s is not one of %s", cpu, governor,
+			strings.Join(AvailableGovernors(cpu), ","))
+	}
+
+	if err := ioutil.WriteFile(cpufreqFile(cpu, "scaling_governor"), []byte(governor), 0644); err != nil {
+		return fmt.Errorf("cpu %d: set governor %s: %v", cpu, governor, err)
+	}
+	return nil
+}
+
+// PinMinToMax sets the min frequency of the CPU to the max frequency
+func PinMinToMax(cpu int) error {
+
+	maxKHz := readRawKHz(cpufreqFile(cpu, "scaling_max_freq"))
+	if maxKHz < 0 {
+		return fmt.Errorf("cpu %d: scaling_max_freq not readable", cpu)
+	}
+	return setFrequencyRangeKHz(cpu, maxKHz, maxKHz)
+}
+
+// NumCStates returns the number of cpuidle states of the CPU
+func NumCStates(cpu int) int {
+
+	dirs, _ := filepath.Glob(filepath.Join(sysCPUDir, fmt.Sprintf("cpu%d", cpu), "cpuidle", "state*"))
+	return len(dirs)
+}
+
+// CStateName returns the name of the cpuidle state of the CPU
+func CStateName(cpu, state int) string {
+
+	name, _ := readFile(cpuidleFile(cpu, state, "name"))
+	return name
+}
+
+// SetCStateDisabled disables or enables the cpuidle state of the CPU
+func SetCStateDisabled(cpu, state int, disable bool) error {
+
+	val := "0"
+	if disable {
+		val = "1"
+	}
+	if err := ioutil.WriteFile(cpuidleFile(cpu, state, "disable"), []byte(val), 0644); err != nil {
+		return fmt.Errorf("cpu %d: set state%d disable to %s: %v", cpu, state, val, err)
+	}
+	return nil
+}
+
+// DisableDeepCStates disables the cpuidle states of the CPU from the state
+// on and enables the states before it
+func DisableDeepCStates(cpu, from int) error {
+
+	for state := 0; state < NumCStates(cpu); state++ {
+		if err := SetCStateDisabled(cpu, state, state >= from); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCPUSettings reads the settings of the CPU
+func ReadCPUSettings(cpu int) (CPUSettings, error) {
+
+	s := CPUSettings{CPU: cpu}
+
+	gov, err := readFile(cpufreqFile(cpu, "scaling_governor"))
+	if err != nil {
+		return s, fmt.Errorf("cpu %d: %v", cpu, err)
+	}
+	s.Governor = gov
+	s.MinKHz = readRawKHz(cpufreqFile(cpu, "scaling_min_freq"))
+	s.MaxKHz = readRawKHz(cpufreqFile(cpu, "scaling_max_freq"))
+
+	for state := 0; state < NumCStates(cpu); state++ {
+		v, _ := readFile(cpuidleFile(cpu, state, "disable"))
+		s.Disabled = append(s.Disabled, v == "1")
+	}
+
+	return s, nil
+}
+
+// Restore the settings of the CPU, all settings are tried and the first
+// error is returned
+func (s CPUSettings) Restore() error {
+
+	errs := []error{}
+
+	if err := SetGovernor(s.CPU, s.Governor); err != nil {
+		errs = append(errs, err)
+	}
+	// The saved values are written back as read, MHz would lose the kHz
+	if s.MinKHz >= 0 && s.MaxKHz >= 0 {
+		if err := setFrequencyRangeKHz(s.CPU, s.MinKHz, s.MaxKHz); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for state, disabled := range s.Disabled {
+		if err := SetCStateDisabled(s.CPU, state, disabled); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
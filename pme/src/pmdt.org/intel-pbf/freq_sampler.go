@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"sync"
+	"time"
+)
+
+// The effective frequency of a CPU is computed from the difference of the
+// APERF, MPERF and TSC counters over an interval the same way turbostat does:
+//
+//	Avg MHz  = APERF delta / interval
+//	C0 %     = MPERF delta / TSC delta * 100
+//	Busy MHz = TSC delta / interval * APERF delta / MPERF delta
+//
+// A single read of the counters has no meaning.
+
+// FreqSample of the counters of a CPU
+type FreqSample struct {
+	APerf uint64
+	MPerf uint64
+	TSC   uint64
+	Time  time.Time
+}
+
+// EffFreq is the effective frequency of a CPU over an interval
+type EffFreq struct {
+	BusyMHz   float64 // Average frequency while in C0
+	AvgMHz    float64 // Average frequency over the interval including idle
+	C0Percent float64 // Percent of the interval in C0
+	Valid     bool    // False until two samples are taken
+}
+
+// FreqSampler keeps the last sample of each CPU to compute the effective
+// frequency of the next interval
+type FreqSampler struct {
+	lock sync.Mutex
+	prev map[int]FreqSample
+	freq map[int]EffFreq
+}
+
+// ReadFreqSample reads the APERF, MPERF and TSC counters of the CPU
+func ReadFreqSample(cpu int) (FreqSample, error) {
+
+	s := FreqSample{}
+
+	// Read the counters back to back to keep them close in time
+	regs := []struct {
+		r   *Register
+		val *uint64
+	}{
+		{IA32MPerf, &s.MPerf},
+		{IA32APerf, &s.APerf},
+		{IA32TimeStampCounter, &s.TSC},
+	}
+	for _, reg := range regs {
+		v, err := reg.r.Read(cpu)
+		if err != nil {
+			return FreqSample{}, err
+		}
+		*reg.val = v
+	}
+	s.Time = time.Now()
+
+	return s, nil
+}
+
+// ComputeEffFreq returns the effective frequency between the two samples,
+// the counters may wrap between the samples.
+func ComputeEffFreq(prev, cur FreqSample) EffFreq {
+
+	secs := cur.Time.Sub(prev.Time).Seconds()
+	aperf := cur.APerf - prev.APerf
+	mperf := cur.MPerf - prev.MPerf
+	tsc := cur.TSC - prev.TSC
+
+	if secs <= 0 || tsc == 0 {
+		return EffFreq{}
+	}
+
+	f := EffFreq{Valid: true}
+	f.AvgMHz = float64(aperf) / secs / 1e6
+	f.C0Percent = float64(mperf) * 100.0 / float64(tsc)
+	if f.C0Percent > 100.0 {
+		f.C0Percent = 100.0
+	}
+	if mperf > 0 {
+		f.BusyMHz = float64(tsc) / secs / 1e6 * float64(aperf) / float64(mperf)
+	}
+
+	return f
+}
+
+// NewFreqSampler creates a sampler with no samples
+func NewFreqSampler() *FreqSampler {
+
+	return &FreqSampler{
+		prev: make(map[int]FreqSample),
+		freq: make(map[int]EffFreq),
+	}
+}
+
+// Sample the counters of the CPUs and compute the effective frequency since
+// the last sample, the first error is returned and the CPU is skipped
+func (fs *FreqSampler) Sample(cpus []int) error {
+
+	var first error
+
+	for _, cpu := range cpus {
+		cur, err := ReadFreqSample(cpu)
+
+		fs.lock.Lock()
+		if err != nil {
+			delete(fs.prev, cpu)
+			fs.freq[cpu] = EffFreq{}
+			if first == nil {
+				first = err
+			}
+		} else {
+			if prev, ok := fs.prev[cpu]; ok {
+				fs.freq[cpu] = ComputeEffFreq(prev, cur)
+			}
+			fs.prev[cpu] = cur
+		}
+		fs.lock.Unlock()
+	}
+
+	return first
+}
+
+// Get the effective frequency of the CPU for the last interval
+func (fs *FreqSampler) Get(cpu int) EffFreq {
+
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	return fs.freq[cpu]
+}
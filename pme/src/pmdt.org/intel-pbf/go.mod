@@ -2,6 +2,11 @@ module pmdt.org/inter-pbf
 
 replace pmdt.org/ttylog => ../ttylog
 
+replace pmdt.org/topology => ../topology
+
 go 1.13
 
-require pmdt.org/ttylog v0.0.0-00010101000000-000000000000
+require (
+	pmdt.org/topology v0.0.0-00010101000000-000000000000
+	pmdt.org/ttylog v0.0.0-00010101000000-000000000000
+)
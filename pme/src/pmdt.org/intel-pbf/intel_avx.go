@@ -11,11 +11,11 @@ import tlog "pmdt.org/ttylog"
 
 // AVXInfo per CPU
 type AVXInfo struct {
-	MPerf          int32
-	APerf          int32
-	ThermStatus    int32
-	PkgThermStatus int32
-	Turbo1         int32
+	MPerf          uint64
+	APerf          uint64
+	ThermStatus    ThermStatus
+	PkgThermStatus ThermStatus
+	Turbo1         int32 // Max turbo MHz with 1 active core group
 	Turbo2         int32
 	Turbo3         int32
 }
@@ -48,88 +48,93 @@ var (
 )
 */
 
-// Read the MSR register for the given core and return the values read
-func getCPUTurbo1(core int) int32 {
+// readRegister reads the register of the CPU and logs an error on failure,
+// the MSR unavailable state is not logged for each read
+func readRegister(cpu int, r *Register) (uint64, bool) {
 
-	val, err := ReadMsr(0, 0x28) //0x28
+	val, err := r.Read(cpu)
 	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+		if MsrAvailable() == nil {
+			tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+		}
+		return 0, false
 	}
-	val = ((val >> 8) & 0xff) * 100
-
-	return int32(val)
+	return val, true
 }
 
-// Read the MSR register for the given core and return the values read
-func getCPUTurbo2(core int) int32 {
+// getCPUTurbo returns the max turbo frequency in MHz of the group of active
+// cores of the given core, the group 0 is one active core
+func getCPUTurbo(core, group int) int32 {
 
-	val, err := ReadMsr(0, 0x28)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+	val, ok := readRegister(core, MsrTurboRatioLimit)
+	if !ok {
+		return 0
 	}
-	val = ((val >> 8) & 0xff) * 100
+	return DecodeTurboRatioLimit(val)[group]
+}
 
-	return int32(val)
+// Read the MSR register for the given core and return the values read
+func getCPUTurbo1(core int) int32 {
+	return getCPUTurbo(core, 0)
+}
+
+// Read the MSR register for the given core and return the values read
+func getCPUTurbo2(core int) int32 {
+	return getCPUTurbo(core, 1)
 }
 
 // Read the MSR register for the given core and return the values read
 func getCPUTurbo3(core int) int32 {
+	return getCPUTurbo(core, 2)
+}
 
-	val, err := ReadMsr(0, 0x28)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
-	}
-	val = ((val >> 8) & 0xff) * 100
+// ReadMPerf Read the MSR register for the given core and return the MPERF
+// counter, only the difference of two reads has a meaning
+func ReadMPerf(core int) uint64 {
 
-	return int32(val)
+	val, _ := readRegister(core, IA32MPerf)
+	return val
 }
 
-// ReadMPerf Read the MSR register for the given core and return the busy core freq
-func ReadMPerf(core int) int32 {
+// ReadAPerf Read the MSR register for the given core and return the APERF
+// counter, only the difference of two reads has a meaning
+func ReadAPerf(core int) uint64 {
 
-	val, err := ReadMsr(0, 0xE7)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
-	}
-	val = ((val >> 8) & 0xFF) * 100
-
-	return int32(val)
+	val, _ := readRegister(core, IA32APerf)
+	return val
 }
 
-// ReadAPerf Read the MSR register for the given core and return the avg core freq
-func ReadAPerf(core int) int32 {
+// ReadPerfStatus Read the MSR register for the given core and return the
+// current frequency in MHz
+func ReadPerfStatus(core int) int32 {
 
-	val, err := ReadMsr(0, 0xE8)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+	val, ok := readRegister(core, IA32PerfStatus)
+	if !ok {
+		return 0
 	}
-	val = ((val >> 8) & 0xFF) * 100
-
-	return int32(val)
+	return DecodePerfStatus(val)
 }
 
-// ReadThermStatus Read the MSR register for the given core and return the busy core freq
-func ReadThermStatus(core int) int32 {
+// ReadThermStatus Read the MSR register for the given core and return the
+// decoded core thermal status
+func ReadThermStatus(core int) ThermStatus {
 
-	val, err := ReadMsr(0, 0x19C)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+	val, ok := readRegister(core, IA32ThermStatus)
+	if !ok {
+		return ThermStatus{}
 	}
-	val = ((val >> 8) & 0xFF) * 100
-
-	return int32(val)
+	return DecodeThermStatus(IA32ThermStatus, val)
 }
 
-// ReadPkgThermStatus Read the MSR register for the given core and return the busy core freq
-func ReadPkgThermStatus(core int) int32 {
+// ReadPkgThermStatus Read the MSR register for the given core and return the
+// decoded thermal status of the package of the core
+func ReadPkgThermStatus(core int) ThermStatus {
 
-	val, err := ReadMsr(0, 0x1B1)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+	val, ok := readRegister(core, IA32PackageThermStatus)
+	if !ok {
+		return ThermStatus{}
 	}
-	val = ((val >> 8) & 0xFF) * 100
-
-	return int32(val)
+	return DecodeThermStatus(IA32PackageThermStatus, val)
 }
 
 // AVXInfoPerCPU using the given cpu number
@@ -152,16 +157,6 @@ func AVXInfoPerCPU(cpu int) *AVXInfo {
 		avx.CurFreq = ReadCurFrequency(cpu)
 		avx.Governor = ReadGovernor(cpu)
 	*/
-	/*
-		SetCell(pg.avxStats, 0, 0, cz.Orange("CPU", 4))
-		SetCell(pg.avxStats, 0, 1, cz.Orange("128BLight", 6))
-		SetCell(pg.avxStats, 0, 2, cz.Orange("128BHeavy", 6))
-		SetCell(pg.avxStats, 0, 3, cz.Orange("256BLight", 6))
-		SetCell(pg.avxStats, 0, 4, cz.Orange("256BHeavy", 6))
-		SetCell(pg.avxStats, 0, 3, cz.Orange("512BLight", 6))
-		SetCell(pg.avxStats, 0, 4, cz.Orange("512BHeavy", 6))
-	*/
-
 	//avx.CStateNames = CStates()
 	/*
 		for i := range CStates() {
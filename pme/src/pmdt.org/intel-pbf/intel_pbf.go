@@ -5,12 +5,14 @@
 package intelpbf
 
 import (
-	"fmt"
 	"io/ioutil"
-	tlog "pmdt.org/ttylog"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+
+	"pmdt.org/topology"
+	tlog "pmdt.org/ttylog"
 )
 
 // Access the MSR for each CPU and retrive the Power Base Frequency values and
@@ -48,32 +50,68 @@ var (
 	Freqs   []int32
 )
 
+var (
+	cpuTopo     *topology.Topology
+	cpuTopoOnce sync.Once
+)
+
+// SetTopology sets the CPU topology used to find the online CPUs, without it
+// the topology is read from sysfs the first time it is needed.
+func SetTopology(t *topology.Topology) {
+	cpuTopoOnce.Do(func() {
+		cpuTopo = t
+	})
+}
+
+// firstCPU returns the lowest online CPU, the system wide settings are read
+// from it as CPU 0 is not always online. The CPUs of a hybrid CPU have
+// different frequencies, the first CPU is a performance core.
+func firstCPU() int {
+
+	cpuTopoOnce.Do(func() {
+		t, err := topology.New()
+		if err != nil {
+			tlog.ErrorPrintf("Unable to read the CPU topology: %v\n", err)
+			return
+		}
+		cpuTopo = t
+	})
+
+	if cpuTopo == nil {
+		return 0
+	}
+	online := cpuTopo.Online()
+	if len(online) == 0 {
+		return 0
+	}
+	return online[0]
+}
+
 // Read the MSR register for the given core and return the values read
 func getCPUBaseFrequency(core int) int32 {
 
-	val, err := ReadMsr(0, 0xCE)
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read MSR: %s\n", err)
+	val, ok := readRegister(core, MsrPlatformInfo)
+	if !ok {
+		return 0
 	}
-	val = ((val >> 8) & 0xFF) * 100
-
-	return int32(val)
+	return DecodePlatformInfo(val).BaseMHz
 }
 
 // CheckForDrivers are installed
 func CheckForDrivers() bool {
 
-	Driver := ReadString(DrvFile)
+	cpu := firstCPU()
+	Driver := ReadString(cpufreqFile(cpu, "scaling_driver"))
 
 	if Driver == "acpi-cpufreq" {
 		return true
 	} else if Driver == "intel_pstate" {
-		if !fileExists(MsrFile) {
-			tlog.ErrorPrintf("Unable to read (%s) does not exist\n", MsrFile)
+		if err := MsrAvailable(); err != nil {
+			tlog.ErrorPrintf("%v\n", err)
 			return false
 		}
 
-		FreqP1 = getCPUBaseFrequency(11)
+		FreqP1 = getCPUBaseFrequency(cpu)
 	}
 	return true
 }
@@ -86,9 +124,9 @@ func getPStates() []int32 {
 	if Driver == "acpi-cpufreq" {
 		freqs = ReadFrequencies()
 	} else {
-		FreqP1n = ReadMinFrequency(0)
+		FreqP1n = ReadMinFrequency(firstCPU())
 
-		FreqP0 = ReadMaxFrequency(0)
+		FreqP0 = ReadMaxFrequency(firstCPU())
 
 		for i := FreqP1n; i < (FreqP0 + 1); i += 100 {
 			freqs = append(freqs, int32(i))
@@ -110,21 +148,20 @@ func PStates() []int32 {
 	return Freqs
 }
 
-// Get the CStates from the /sys/devices/ files for each CPU in the system
+// Get the CStates from the /sys/devices/ files of the first online CPU
 func getCStates() []string {
 
-	stateList := []string{}
+	cpu := firstCPU()
 
-	states, err := ioutil.ReadDir("/sys/devices/system/cpu/cpu0/cpuidle")
-	if err != nil {
-		tlog.ErrorPrintf("Unable to read states %s", err)
+	num := NumCStates(cpu)
+	if num == 0 {
+		tlog.ErrorPrintf("Unable to read states of cpu %d\n", cpu)
 		return nil
 	}
 
-	for _, state := range states {
-		stateFile := fmt.Sprintf("/sys/devices/system/cpu/cpu0/cpuidle/%s/name", state.Name())
-
-		stateList = append(stateList, ReadString(stateFile))
+	stateList := []string{}
+	for state := 0; state < num; state++ {
+		stateList = append(stateList, CStateName(cpu, state))
 	}
 
 	return stateList
@@ -137,7 +174,7 @@ func CStates() []string {
 
 // Governors values, return a slice of strings for each Governor found
 func Governors() []string {
-	govs := ReadString(GovFile)
+	govs := ReadString(cpufreqFile(firstCPU(), "scaling_available_governors"))
 
 	return strings.Split(govs, " ")
 }
@@ -168,14 +205,14 @@ func ReadInt32(cpu int, file string) int32 {
 // ReadFrequency and normalize the value
 // Read the frequency
 func ReadFrequency(cpu int, freq string) int32 {
-	file := fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/%s", cpu, freq)
+	file := cpufreqFile(cpu, freq)
 
 	return (ReadInt32(cpu, file) / 1000)
 }
 
 // ReadGovernor for give cpu as a string
 func ReadGovernor(cpu int) string {
-	file := fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/scaling_governor", cpu)
+	file := cpufreqFile(cpu, "scaling_governor")
 
 	return ReadString(file)
 }
@@ -203,7 +240,7 @@ func ReadCurFrequency(cpu int) int32 {
 func ReadFrequencies() []int32 {
 	var freqs []int32
 
-	str := ReadString(FreqFile)
+	str := ReadString(cpufreqFile(firstCPU(), "scaling_available_frequencies"))
 
 	// Split up the string of frequencies and convert to an array of int32 values
 	for _, f := range strings.Split(str, " ") {
@@ -223,10 +260,10 @@ func InfoPerCPU(cpu int) *Info {
 	pbf.MinFreq = ReadMinFrequency(cpu)
 	pbf.CurFreq = ReadCurFrequency(cpu)
 	pbf.Governor = ReadGovernor(cpu)
-	pbf.CStateNames = CStates()
+	for i := 0; i < NumCStates(cpu); i++ {
+		pbf.CStateNames = append(pbf.CStateNames, CStateName(cpu, i))
 
-	for i := range CStates() {
-		file := fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpuidle/state%d/disable", cpu, i)
+		file := cpuidleFile(cpu, i, "disable")
 
 		val := ReadInt32(cpu, file)
 		if val == 1 {
@@ -4,7 +4,13 @@
 package intelpbf
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"testing"
 )
@@ -17,3 +23,444 @@ func TestClose(t *testing.T) {
 	fmt.Printf("Close Intel-PBF\n")
 
 }
+
+func TestDecodePlatformInfo(t *testing.T) {
+
+	// Base ratio 0x14, efficiency ratio 0x0a and min ratio 0x08
+	p := DecodePlatformInfo(0x00080a0070081400)
+	if p.BaseMHz != 2000 || p.EfficiencyMHz != 1000 || p.MinMHz != 800 {
+		t.Errorf("DecodePlatformInfo() = %+v, want 2000/1000/800 MHz", p)
+	}
+}
+
+func TestDecodeTurboRatioLimit(t *testing.T) {
+
+	got := fmt.Sprint(DecodeTurboRatioLimit(0x1d1d1e1f20212224))
+	want := "[3600 3400 3300 3200 3100 3000 2900 2900]"
+	if got != want {
+		t.Errorf("DecodeTurboRatioLimit() = %s, want %s", got, want)
+	}
+
+	for active, want := range map[int]int32{0: 3600, 1: 3600, 3: 3300, 8: 2900, 28: 2900} {
+		if mhz := TurboLimitMHz(0x1d1d1e1f20212224, 0, active); mhz != want {
+			t.Errorf("TurboLimitMHz(%d active) = %d, want %d", active, mhz, want)
+		}
+	}
+
+	// Groups of 2, 4, 8, 12, 16, 20, 24 and 28 active cores
+	cores := uint64(0x1c1814100c080402)
+	for active, want := range map[int]int32{1: 3600, 2: 3600, 3: 3400, 8: 3300, 9: 3200, 28: 2900, 32: 2900} {
+		if mhz := TurboLimitMHz(0x1d1d1e1f20212224, cores, active); mhz != want {
+			t.Errorf("TurboLimitMHz(%d active, cores %x) = %d, want %d", active, cores, mhz, want)
+		}
+	}
+}
+
+func TestDecodePerfStatus(t *testing.T) {
+
+	if mhz := DecodePerfStatus(0x1c2800001f00); mhz != 3100 {
+		t.Errorf("DecodePerfStatus() = %d, want 3100", mhz)
+	}
+}
+
+func TestDecodeThermStatus(t *testing.T) {
+
+	// Reading valid, 1 degree resolution, 68 degrees below TjMax, thermal
+	// and power limit logs set
+	ts := DecodeThermStatus(IA32ThermStatus, 0x88440802)
+	want := ThermStatus{ThrottleLog: true, PowerLimitLog: true, DigitalReadout: 68, Valid: true}
+	if ts != want {
+		t.Errorf("DecodeThermStatus() = %+v, want %+v", ts, want)
+	}
+	if r := IA32ThermStatus.Get("Resolution", 0x88440802); r != 1 {
+		t.Errorf("Resolution = %d, want 1", r)
+	}
+
+	// The package register has no valid bit
+	ts = DecodeThermStatus(IA32PackageThermStatus, 0x00370001)
+	want = ThermStatus{Throttling: true, DigitalReadout: 55, Valid: true}
+	if ts != want {
+		t.Errorf("DecodeThermStatus() package = %+v, want %+v", ts, want)
+	}
+}
+
+func TestRegisterDecode(t *testing.T) {
+
+	fields := IA32APerf.Decode(0xffffffffffffffff)
+	if len(fields) != 1 || fields[0].Value != 0xffffffffffffffff {
+		t.Errorf("Decode() = %+v, want the full 64 bit count", fields)
+	}
+	if _, err := IA32APerf.Field("Ratio"); err == nil {
+		t.Errorf("Field() found a field not in the register")
+	}
+}
+
+func TestComputeEffFreq(t *testing.T) {
+
+	now := time.Now()
+	prev := FreqSample{APerf: 1000, MPerf: 2000, TSC: 5000, Time: now}
+
+	// One second at a 2 GHz TSC, half of the time in C0 at 3 GHz
+	cur := FreqSample{
+		APerf: prev.APerf + 1500000000,
+		MPerf: prev.MPerf + 1000000000,
+		TSC:   prev.TSC + 2000000000,
+		Time:  now.Add(time.Second),
+	}
+	f := ComputeEffFreq(prev, cur)
+	want := EffFreq{BusyMHz: 3000, AvgMHz: 1500, C0Percent: 50, Valid: true}
+	if f != want {
+		t.Errorf("ComputeEffFreq() = %+v, want %+v", f, want)
+	}
+
+	// The counters wrap
+	prev = FreqSample{APerf: ^uint64(0) - 99, MPerf: ^uint64(0) - 99, TSC: ^uint64(0) - 199, Time: now}
+	cur = FreqSample{APerf: 100, MPerf: 100, TSC: 200, Time: now.Add(time.Millisecond)}
+	f = ComputeEffFreq(prev, cur)
+	if f.C0Percent != 50 || f.AvgMHz != 0.2 {
+		t.Errorf("ComputeEffFreq() wrapped = %+v, want 50%% C0 and 0.2 MHz", f)
+	}
+
+	if f := ComputeEffFreq(cur, cur); f.Valid {
+		t.Errorf("ComputeEffFreq() of the same sample is valid")
+	}
+}
+
+func TestDecodeTemperatureTarget(t *testing.T) {
+
+	// TjMax 100 degrees with a TCC offset of 2
+	tjMax, offset := DecodeTemperatureTarget(0x02640a00)
+	if tjMax != 100 || offset != 2 {
+		t.Errorf("DecodeTemperatureTarget() = %d, %d, want 100, 2", tjMax, offset)
+	}
+}
+
+// writeTree writes the files of a fake file system under root, the file data
+// ends with a newline as in sysfs
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCoretemp(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "thermal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	cpu := "sys/devices/system/cpu/"
+	files := map[string]string{
+		"sys/class/hwmon/hwmon0/name":                        "acpitz",
+		"sys/class/hwmon/hwmon1/name":                        "coretemp",
+		"sys/class/hwmon/hwmon1/temp1_label":                 "Package id 0",
+		"sys/class/hwmon/hwmon1/temp1_input":                 "61000",
+		"sys/class/hwmon/hwmon1/temp1_crit":                  "100000",
+		"sys/class/hwmon/hwmon1/temp2_label":                 "Core 0",
+		"sys/class/hwmon/hwmon1/temp2_input":                 "55000",
+		"sys/class/hwmon/hwmon1/temp3_label":                 "Core 4",
+		"sys/class/hwmon/hwmon1/temp3_input":                 "59000",
+		cpu + "cpu0/topology/core_id":                        "0",
+		cpu + "cpu0/topology/physical_package_id":            "0",
+		cpu + "cpu1/topology/core_id":                        "4",
+		cpu + "cpu1/topology/physical_package_id":            "0",
+		cpu + "cpu1/thermal_throttle/core_throttle_count":    "3",
+		cpu + "cpu1/thermal_throttle/package_throttle_count": "0",
+		cpu + "cpu2/topology/core_id":                        "0",
+		cpu + "cpu2/topology/physical_package_id":            "1",
+	}
+	writeTree(t, root, files)
+
+	temps, err := NewThermal(root).Read([]int{0, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(temps) != 3 {
+		t.Fatalf("Read() returned %d temperatures, want 3", len(temps))
+	}
+
+	want := []struct {
+		coreC, pkgC, tjMax int
+		throttled          bool
+	}{
+		{55, 61, 100, false},
+		{59, 61, 100, true},
+		{-1, -1, -1, false}, // Package 1 has no coretemp device
+	}
+	for i, w := range want {
+		tp := temps[i]
+		if tp.Source != ThermalSourceCoretemp || tp.CoreC != w.coreC || tp.PkgC != w.pkgC ||
+			tp.TjMax != w.tjMax || tp.Throttled() != w.throttled {
+			t.Errorf("cpu %d: %+v, want %+v", i, tp, w)
+		}
+	}
+
+	if _, err := NewThermal(filepath.Join(root, "none")).Read([]int{0}); err == nil {
+		t.Errorf("Read() without coretemp did not fail")
+	}
+}
+
+// makeCPUFreq creates the cpufreq files of the CPUs with the base frequency
+// in kHz and points the package at them
+func makeCPUFreq(t *testing.T, base []int) string {
+
+	root, err := ioutil.TempDir("", "cpufreq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sysCPUDir = root
+
+	files := map[string]string{}
+	for cpu, khz := range base {
+		dir := fmt.Sprintf("cpu%d/cpufreq/", cpu)
+		files[dir+"base_frequency"] = fmt.Sprintf("%d", khz)
+		files[dir+"cpuinfo_min_freq"] = "800000"
+		files[dir+"cpuinfo_max_freq"] = "3900000"
+		files[dir+"scaling_min_freq"] = "800000"
+		files[dir+"scaling_max_freq"] = "3900000"
+	}
+	writeTree(t, root, files)
+
+	return root
+}
+
+func TestSSTBF(t *testing.T) {
+
+	defer func(dir string) { sysCPUDir = dir }(sysCPUDir)
+
+	root := makeCPUFreq(t, []int{2100000, 2700000, 2100000, 2700000})
+	defer os.RemoveAll(root)
+
+	sst, err := HighPriorityCores([]int{0, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sst.Enabled || fmt.Sprint(sst.HighPriority) != "[1 3]" || fmt.Sprint(sst.LowPriority) != "[0 2]" ||
+		sst.HighBaseMHz != 2700 || sst.LowBaseMHz != 2100 {
+		t.Errorf("HighPriorityCores() = %+v", sst)
+	}
+	if !sst.IsHighPriority(3) || sst.IsHighPriority(0) {
+		t.Errorf("IsHighPriority() is wrong for %+v", sst)
+	}
+
+	if err := sst.PinHighPriority(); err != nil {
+		t.Fatal(err)
+	}
+	if min, max := ReadMinFrequency(1), ReadMaxFrequency(1); min != 2700 || max != 2700 {
+		t.Errorf("cpu 1 pinned to %d-%d MHz, want 2700", min, max)
+	}
+	if min := ReadMinFrequency(0); min != 800 {
+		t.Errorf("cpu 0 min %d MHz was changed, want 800", min)
+	}
+
+	if err := ResetFrequencyRange(1); err != nil {
+		t.Fatal(err)
+	}
+	if min, max := ReadMinFrequency(1), ReadMaxFrequency(1); min != 800 || max != 3900 {
+		t.Errorf("ResetFrequencyRange() = %d-%d MHz, want 800-3900", min, max)
+	}
+
+	if err := SetFrequencyRange(1, 3000, 2000); err == nil {
+		t.Errorf("SetFrequencyRange() accepted min above max")
+	}
+
+	// All cores with the same base frequency
+	same := makeCPUFreq(t, []int{2300000, 2300000})
+	defer os.RemoveAll(same)
+	if sst, err := HighPriorityCores([]int{0, 1}); err != nil || sst.Enabled {
+		t.Errorf("HighPriorityCores() = %+v, %v, want not enabled", sst, err)
+	}
+}
+
+func TestCPUSettings(t *testing.T) {
+
+	defer func(dir string) { sysCPUDir = dir }(sysCPUDir)
+
+	root := makeCPUFreq(t, []int{2300000, 2300000})
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"cpu1/cpufreq/scaling_governor":            "powersave",
+		"cpu1/cpufreq/scaling_min_freq":            "800500",
+		"cpu1/cpufreq/scaling_max_freq":            "3900100",
+		"cpu1/cpufreq/scaling_available_governors": "performance powersave",
+		"cpu1/cpuidle/state0/name":                 "POLL",
+		"cpu1/cpuidle/state0/disable":              "0",
+		"cpu1/cpuidle/state1/name":                 "C1",
+		"cpu1/cpuidle/state1/disable":              "0",
+		"cpu1/cpuidle/state2/name":                 "C6",
+		"cpu1/cpuidle/state2/disable":              "0",
+	}
+	writeTree(t, root, files)
+
+	saved, err := ReadCPUSettings(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetGovernor(1, "ondemand"); err == nil {
+		t.Errorf("SetGovernor() accepted a governor not available")
+	}
+	if err := SetGovernor(1, "performance"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PinMinToMax(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := DisableDeepCStates(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := ReadCPUSettings(1)
+	want := CPUSettings{CPU: 1, Governor: "performance", MinKHz: 3900100, MaxKHz: 3900100, Disabled: []bool{false, false, true}}
+	if fmt.Sprint(s) != fmt.Sprint(want) {
+		t.Errorf("changed settings = %+v, want %+v", s, want)
+	}
+	if name := CStateName(1, 2); name != "C6" {
+		t.Errorf("CStateName() = %s, want C6", name)
+	}
+
+	if err := saved.Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := ReadCPUSettings(1); fmt.Sprint(s) != fmt.Sprint(saved) {
+		t.Errorf("restored settings = %+v, want %+v", s, saved)
+	}
+}
+
+func TestComputeResidency(t *testing.T) {
+
+	now := time.Now()
+	prev := CStateSample{Time: now, States: []CStateCounters{
+		{"POLL", 100, 10}, {"C1", 1000, 20}, {"C6", 5000, 5},
+	}}
+	cur := CStateSample{Time: now.Add(time.Second), States: []CStateCounters{
+		{"POLL", 100, 10}, {"C1", 101000, 70}, {"C6", 305000, 8},
+	}}
+
+	r := ComputeResidency(prev, cur)
+	if !r.Valid || r.IdlePercent != 40 || r.C0Percent != 60 {
+		t.Errorf("ComputeResidency() = %+v, want 40%% idle and 60%% C0", r)
+	}
+	want := []StateResidency{{"POLL", 0, 0}, {"C1", 10, 50}, {"C6", 30, 3}}
+	if fmt.Sprint(r.States) != fmt.Sprint(want) {
+		t.Errorf("ComputeResidency() states = %v, want %v", r.States, want)
+	}
+
+	if r := ComputeResidency(cur, cur); r.Valid {
+		t.Errorf("ComputeResidency() of the same sample is valid")
+	}
+}
+
+func TestReadCStateSample(t *testing.T) {
+
+	defer func(dir string) { sysCPUDir = dir }(sysCPUDir)
+
+	root := makeCPUFreq(t, []int{2300000})
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"cpu0/cpuidle/state0/name":  "POLL",
+		"cpu0/cpuidle/state0/time":  "12",
+		"cpu0/cpuidle/state0/usage": "3",
+		"cpu0/cpuidle/state1/name":  "C1",
+		"cpu0/cpuidle/state1/time":  "4500",
+		"cpu0/cpuidle/state1/usage": "17",
+	}
+	writeTree(t, root, files)
+
+	s, err := ReadCStateSample(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CStateCounters{{"POLL", 12, 3}, {"C1", 4500, 17}}
+	if fmt.Sprint(s.States) != fmt.Sprint(want) {
+		t.Errorf("ReadCStateSample() = %v, want %v", s.States, want)
+	}
+
+	rs := NewResidencySampler()
+	if err := rs.Sample([]int{0, 1}); err == nil {
+		t.Errorf("Sample() of a CPU without cpuidle did not fail")
+	}
+	if r := rs.Get(0); r.Valid {
+		t.Errorf("Get() after one sample is valid")
+	}
+}
+
+func TestMsrAccess(t *testing.T) {
+
+	status := "Name:\tpme\nCapInh:\t0000000000000000\nCapEff:\t0000000000020000\n"
+	if !hasCapability(status, capSysRawIO) {
+		t.Errorf("CAP_SYS_RAWIO not found in %q", status)
+	}
+	if hasCapability("CapEff:\t0000000000000400\n", capSysRawIO) || hasCapability("", capSysRawIO) {
+		t.Errorf("CAP_SYS_RAWIO found without the bit")
+	}
+
+	// Registers outside the allow list are rejected before the file is opened
+	if err := WriteMsr(0, MsrPlatformInfo.Addr, 0); err == nil {
+		t.Errorf("write to MSR_PLATFORM_INFO was allowed")
+	}
+
+	err := error(&MsrUnavailableError{Reason: "no msr module"})
+	if err.Error() != "MSR unavailable: no msr module" {
+		t.Errorf("unavailable error %q", err)
+	}
+}
+
+func TestReadMsr(t *testing.T) {
+
+	// A file stands in for the MSR file of CPU 0, the second register is
+	// at offset 8
+	f, err := ioutil.TempFile("", "msr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint64(b[8:], 0x1d1d1e1f20212224)
+	if _, err := f.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fd, err := syscall.Open(f.Name(), syscall.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msrLock.Lock()
+	msrFds[0] = MSRfd{fd: fd}
+	msrLock.Unlock()
+
+	if val, err := ReadMsr(0, 8); err != nil || val != 0x1d1d1e1f20212224 {
+		t.Errorf("ReadMsr() = %#x, %v", val, err)
+	}
+
+	// Reads while the files are closed, run with -race to check the lock. A
+	// read after the close opens the real file again when it is readable.
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			ReadMsr(0, 8)
+		}
+		close(done)
+	}()
+	CloseMsr()
+	<-done
+	CloseMsr()
+
+	msrLock.RLock()
+	defer msrLock.RUnlock()
+	if len(msrFds) != 0 {
+		t.Errorf("CloseMsr left %d files open", len(msrFds))
+	}
+}
@@ -4,28 +4,114 @@
 package intelpbf
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 )
 
 // A package to read the MSR values from the system
 
+// Reading the MSRs needs the msr module and CAP_SYS_RAWIO, both are checked
+// once and when either is missing all MSR reads fail with the same error so
+// the panels can show one clear state. The read-only file of each CPU is
+// opened on the first read and kept open until CloseMsr, the reads hold the
+// lock so CloseMsr can not close a file during a read. Writes open the file
+// for each write and are only allowed to the registers in msrWriteAllowed.
+
+// capSysRawIO is the CAP_SYS_RAWIO bit of the capability sets
+const capSysRawIO uint = 17
+
+// MsrUnavailableError is returned by all MSR reads when MSRs can not be read
+type MsrUnavailableError struct {
+	Reason string
+}
+
+func (e *MsrUnavailableError) Error() string {
+	return "MSR unavailable: " + e.Reason
+}
+
+// msrWriteAllowed are the registers WriteMsr can write, the thermal status
+// registers only to clear their log bits
+var msrWriteAllowed = map[int64]string{
+	0x199: "IA32_PERF_CTL",
+	0x19C: "IA32_THERM_STATUS",
+	0x1B1: "IA32_PACKAGE_THERM_STATUS",
+}
+
 // MSRfd is the file descriptor for MSR registers
 type MSRfd struct {
 	fd int
 }
 
+var (
+	msrOnce sync.Once
+	msrErr  error
+	msrLock sync.RWMutex
+	msrFds  = make(map[int]MSRfd)
+)
+
+// hasCapability returns true if the capability is in the CapEff set of the
+// /proc/<pid>/status data
+func hasCapability(status string, capability uint) bool {
+
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[0] != "CapEff:" {
+			continue
+		}
+		caps, err := strconv.ParseUint(fields[1], 16, 64)
+		if err != nil {
+			return false
+		}
+		return caps&(1<<capability) != 0
+	}
+	return false
+}
+
+// MsrAvailable checks once for the msr module and CAP_SYS_RAWIO, nil is
+// returned when the MSRs can be read
+func MsrAvailable() error {
+
+	msrOnce.Do(func() {
+		file := fmt.Sprintf(CPUMsrFile, firstCPU())
+		if !fileExists(file) {
+			msrErr = &MsrUnavailableError{Reason: fmt.Sprintf("%s does not exist, load the msr module", file)}
+			return
+		}
+		status, err := readFile("/proc/self/status")
+		if err == nil && !hasCapability(status, capSysRawIO) {
+			msrErr = &MsrUnavailableError{Reason: "CAP_SYS_RAWIO is required, run as root"}
+		}
+	})
+
+	return msrErr
+}
+
 // Open a MSR register
-// Using the FD open the requested CPU MSR file
+// Using the FD open the requested CPU MSR file read-only
 func Open(cpu int) (MSRfd, error) {
 
+	return openMsr(cpu, syscall.O_RDONLY)
+}
+
+// openMsr opens the MSR file of the CPU with the flags
+func openMsr(cpu int, flags int) (MSRfd, error) {
+
+	if err := MsrAvailable(); err != nil {
+		return MSRfd{}, err
+	}
+
 	file := fmt.Sprintf(CPUMsrFile, cpu)
 
-	fd, err := syscall.Open(file, syscall.O_RDWR, 777)
+	fd, err := syscall.Open(file, flags|syscall.O_CLOEXEC, 0)
 	if err != nil {
-		return MSRfd{}, err
+		return MSRfd{}, fmt.Errorf("open %s: %v", file, err)
 	}
 
 	return MSRfd{fd: fd}, nil
@@ -56,9 +142,9 @@ func (f MSRfd) ReadAt(msr int64) (uint64, error) {
 	return binary.LittleEndian.Uint64(b), nil
 }
 
-// WriteAt a give MSR register
+// writeAt a give MSR register
 // Writ the given uint64 value to a given MSR register
-func (f *MSRfd) WriteAt(msr int64, val uint64) error {
+func (f *MSRfd) writeAt(msr int64, val uint64) error {
 	b := make([]byte, 8)
 
 	// Convert the value to little endian not sure this required
@@ -74,36 +160,72 @@ func (f *MSRfd) WriteAt(msr int64, val uint64) error {
 	return nil
 }
 
-// ReadMsr register by opening, reading and closing the CPU file
-// Single routine to read an MSR for a CPU in one go function
-func ReadMsr(cpu int, msr int64) (uint64, error) {
+// msrFd returns the read-only file of the CPU, it is opened on the first
+// read. Called with msrLock held for writing.
+func msrFd(cpu int) (MSRfd, error) {
+
+	if f, ok := msrFds[cpu]; ok {
+		return f, nil
+	}
 
 	f, err := Open(cpu)
 	if err != nil {
-		return 0, err
+		return MSRfd{}, err
 	}
-	defer f.Close()
+	msrFds[cpu] = f
+
+	return f, nil
+}
+
+// ReadMsr register using the read-only file of the CPU kept open between reads
+func ReadMsr(cpu int, msr int64) (uint64, error) {
+
+	msrLock.RLock()
+	if f, ok := msrFds[cpu]; ok {
+		defer msrLock.RUnlock()
+		return f.ReadAt(msr)
+	}
+	msrLock.RUnlock()
 
-	var val uint64
+	// The first read of the CPU opens its file
+	msrLock.Lock()
+	defer msrLock.Unlock()
 
-	if val, err = f.ReadAt(msr); err != nil {
+	f, err := msrFd(cpu)
+	if err != nil {
 		return 0, err
 	}
-	return val, nil
+
+	return f.ReadAt(msr)
 }
 
-// WriteMsr register by opening, writing and closing the CPU file
-// Single routine to write a MSR in one go routine
+// CloseMsr closes the MSR files kept open by ReadMsr
+func CloseMsr() {
+	msrLock.Lock()
+	defer msrLock.Unlock()
+
+	for cpu, f := range msrFds {
+		f.Close()
+		delete(msrFds, cpu)
+	}
+}
+
+// WriteMsr register by opening, writing and closing the CPU file, only the
+// registers in the allow list can be written
 func WriteMsr(cpu int, msr int64, val uint64) error {
 
-	f, err := Open(cpu)
+	if _, ok := msrWriteAllowed[msr]; !ok {
+		return fmt.Errorf("cpu %d: write to MSR %#x is not allowed", cpu, msr)
+	}
+
+	f, err := openMsr(cpu, syscall.O_WRONLY)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	if err := f.WriteAt(msr, val); err != nil {
-		return err
+	if err := f.writeAt(msr, val); err != nil {
+		return fmt.Errorf("cpu %d: write MSR %s: %v", cpu, msrWriteAllowed[msr], err)
 	}
 
 	return nil
@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"fmt"
+)
+
+// Definitions of the MSR registers used by the panels, each register has the
+// named bit fields from the Intel SDM volume 4. A register value is decoded
+// with Register.Decode or the typed decode functions below.
+
+// Field of a register, the bits Lsb to Msb inclusive
+type Field struct {
+	Name string
+	Lsb  uint
+	Msb  uint
+}
+
+// Register is a MSR address and its fields
+type Register struct {
+	Name   string
+	Addr   int64
+	Fields []Field
+}
+
+// FieldValue is a decoded field of a register
+type FieldValue struct {
+	Name  string
+	Value uint64
+}
+
+// Get the value of the field from the register value
+func (f Field) Get(val uint64) uint64 {
+
+	width := f.Msb - f.Lsb + 1
+	if width >= 64 {
+		return val >> f.Lsb
+	}
+	return (val >> f.Lsb) & ((1 << width) - 1)
+}
+
+// Field returns the named field of the register
+func (r *Register) Field(name string) (Field, error) {
+
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return Field{}, fmt.Errorf("register %s has no field %s", r.Name, name)
+}
+
+// Get the value of the named field from the register value, zero if the
+// register has no such field
+func (r *Register) Get(name string, val uint64) uint64 {
+
+	f, err := r.Field(name)
+	if err != nil {
+		return 0
+	}
+	return f.Get(val)
+}
+
+// Decode all of the fields of the register value
+func (r *Register) Decode(val uint64) []FieldValue {
+
+	values := make([]FieldValue, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		values = append(values, FieldValue{Name: f.Name, Value: f.Get(val)})
+	}
+	return values
+}
+
+// Read the register of the CPU
+func (r *Register) Read(cpu int) (uint64, error) {
+
+	val, err := ReadMsr(cpu, r.Addr)
+	if err != nil {
+		return 0, fmt.Errorf("cpu %d %s: %v", cpu, r.Name, err)
+	}
+	return val, nil
+}
+
+// The bus clock of the ratios in MHz
+const busClockMHz uint64 = 100
+
+// MSR registers
+var (
+	// MsrPlatformInfo has the base (non-turbo) and min ratios of the package
+	MsrPlatformInfo = &Register{Name: "MSR_PLATFORM_INFO", Addr: 0xCE, Fields: []Field{
+		{"MaxNonTurboRatio", 8, 15},
+		{"ProgRatioLimitTurbo", 28, 28},
+		{"ProgTDPLimitTurbo", 29, 29},
+		{"MaxEfficiencyRatio", 40, 47},
+		{"MinOperatingRatio", 48, 55},
+	}}
+
+	// IA32TimeStampCounter is the TSC of the CPU
+	IA32TimeStampCounter = &Register{Name: "IA32_TIME_STAMP_COUNTER", Addr: 0x10, Fields: []Field{
+		{"Count", 0, 63},
+	}}
+
+	// IA32MPerf counts at the TSC rate while the CPU is in C0
+	IA32MPerf = &Register{Name: "IA32_MPERF", Addr: 0xE7, Fields: []Field{
+		{"Count", 0, 63},
+	}}
+
+	// IA32APerf counts at the actual frequency while the CPU is in C0
+	IA32APerf = &Register{Name: "IA32_APERF", Addr: 0xE8, Fields: []Field{
+		{"Count", 0, 63},
+	}}
+
+	// IA32PerfStatus has the current performance state ratio
+	IA32PerfStatus = &Register{Name: "IA32_PERF_STATUS", Addr: 0x198, Fields: []Field{
+		{"CurrentRatio", 8, 15},
+		{"CoreVoltage", 32, 47},
+	}}
+
+	// IA32ThermStatus is the thermal status of the core
+	IA32ThermStatus = &Register{Name: "IA32_THERM_STATUS", Addr: 0x19C, Fields: []Field{
+		{"ThermalStatus", 0, 0},
+		{"ThermalLog", 1, 1},
+		{"PROCHOT", 2, 2},
+		{"PROCHOTLog", 3, 3},
+		{"CriticalStatus", 4, 4},
+		{"CriticalLog", 5, 5},
+		{"Threshold1Status", 6, 6},
+		{"Threshold1Log", 7, 7},
+		{"Threshold2Status", 8, 8},
+		{"Threshold2Log", 9, 9},
+		{"PowerLimitStatus", 10, 10},
+		{"PowerLimitLog", 11, 11},
+		{"CurrentLimitStatus", 12, 12},
+		{"CurrentLimitLog", 13, 13},
+		{"CrossDomainStatus", 14, 14},
+		{"CrossDomainLog", 15, 15},
+		{"DigitalReadout", 16, 22},
+		{"Resolution", 27, 30},
+		{"ReadingValid", 31, 31},
+	}}
+
+	// IA32PackageThermStatus is the thermal status of the package
+	IA32PackageThermStatus = &Register{Name: "IA32_PACKAGE_THERM_STATUS", Addr: 0x1B1, Fields: []Field{
+		{"ThermalStatus", 0, 0},
+		{"ThermalLog", 1, 1},
+		{"PROCHOT", 2, 2},
+		{"PROCHOTLog", 3, 3},
+		{"CriticalStatus", 4, 4},
+		{"CriticalLog", 5, 5},
+		{"Threshold1Status", 6, 6},
+		{"Threshold1Log", 7, 7},
+		{"Threshold2Status", 8, 8},
+		{"Threshold2Log", 9, 9},
+		{"PowerLimitStatus", 10, 10},
+		{"PowerLimitLog", 11, 11},
+		{"DigitalReadout", 16, 22},
+	}}
+
+	// MsrTurboRatioLimit has the max turbo ratio for each group of active
+	// cores, the first group is 1 active core
+	MsrTurboRatioLimit = &Register{Name: "MSR_TURBO_RATIO_LIMIT", Addr: 0x1AD, Fields: []Field{
+		{"Group0", 0, 7},
+		{"Group1", 8, 15},
+		{"Group2", 16, 23},
+		{"Group3", 24, 31},
+		{"Group4", 32, 39},
+		{"Group5", 40, 47},
+		{"Group6", 48, 55},
+		{"Group7", 56, 63},
+	}}
+
+	// MsrTurboRatioLimitCores has the number of active cores of each group of
+	// MSR_TURBO_RATIO_LIMIT on the server parts (SKX and later)
+	MsrTurboRatioLimitCores = &Register{Name: "MSR_TURBO_RATIO_LIMIT_CORES", Addr: 0x1AE, Fields: []Field{
+		{"Group0", 0, 7},
+		{"Group1", 8, 15},
+		{"Group2", 16, 23},
+		{"Group3", 24, 31},
+		{"Group4", 32, 39},
+		{"Group5", 40, 47},
+		{"Group6", 48, 55},
+		{"Group7", 56, 63},
+	}}
+)
+
+// PlatformInfo decoded from MSR_PLATFORM_INFO, the frequencies in MHz
+type PlatformInfo struct {
+	BaseMHz       int32
+	EfficiencyMHz int32
+	MinMHz        int32
+}
+
+// ThermStatus decoded from IA32_THERM_STATUS or IA32_PACKAGE_THERM_STATUS
+type ThermStatus struct {
+	Throttling     bool   // Thermal status, the CPU is at or above TjMax
+	ThrottleLog    bool   // Thermal status was set since the log was cleared
+	PowerLimit     bool   // Power limit status, only in the core register
+	PowerLimitLog  bool   // Power limit notification log
+	DigitalReadout uint64 // Degrees C below TjMax
+	Valid          bool   // The digital readout is valid, always for the package
+}
+
+// DecodePlatformInfo decodes the MSR_PLATFORM_INFO value
+func DecodePlatformInfo(val uint64) PlatformInfo {
+
+	r := MsrPlatformInfo
+	return PlatformInfo{
+		BaseMHz:       int32(r.Get("MaxNonTurboRatio", val) * busClockMHz),
+		EfficiencyMHz: int32(r.Get("MaxEfficiencyRatio", val) * busClockMHz),
+		MinMHz:        int32(r.Get("MinOperatingRatio", val) * busClockMHz),
+	}
+}
+
+// DecodePerfStatus returns the current frequency in MHz of IA32_PERF_STATUS
+func DecodePerfStatus(val uint64) int32 {
+
+	return int32(IA32PerfStatus.Get("CurrentRatio", val) * busClockMHz)
+}
+
+// DecodeTurboRatioLimit returns the max turbo frequency in MHz of each group
+// of active cores from MSR_TURBO_RATIO_LIMIT
+func DecodeTurboRatioLimit(val uint64) []int32 {
+
+	r := MsrTurboRatioLimit
+	mhz := make([]int32, 0, len(r.Fields))
+	for _, f := range r.Fields {
+		mhz = append(mhz, int32(f.Get(val)*busClockMHz))
+	}
+	return mhz
+}
+
+// TurboLimitMHz returns the max turbo frequency in MHz of MSR_TURBO_RATIO_LIMIT
+// with the number of active cores. The cores value is MSR_TURBO_RATIO_LIMIT_CORES
+// with the core count of each group, the first group covering the active cores
+// is used. When cores is zero group n is n+1 active cores. The last group is
+// used when more cores are active than there are groups.
+func TurboLimitMHz(val, cores uint64, activeCores int) int32 {
+
+	mhz := DecodeTurboRatioLimit(val)
+
+	if cores != 0 {
+		for i, f := range MsrTurboRatioLimitCores.Fields {
+			if int(f.Get(cores)) >= activeCores {
+				return mhz[i]
+			}
+		}
+		return mhz[len(mhz)-1]
+	}
+
+	group := activeCores - 1
+	if group < 0 {
+		group = 0
+	}
+	if group >= len(mhz) {
+		group = len(mhz) - 1
+	}
+	return mhz[group]
+}
+
+// DecodeThermStatus decodes the core or package thermal status value
+func DecodeThermStatus(r *Register, val uint64) ThermStatus {
+
+	ts := ThermStatus{
+		Throttling:     r.Get("ThermalStatus", val) == 1,
+		ThrottleLog:    r.Get("ThermalLog", val) == 1,
+		PowerLimit:     r.Get("PowerLimitStatus", val) == 1,
+		PowerLimitLog:  r.Get("PowerLimitLog", val) == 1,
+		DigitalReadout: r.Get("DigitalReadout", val),
+		Valid:          true,
+	}
+	if _, err := r.Field("ReadingValid"); err == nil {
+		ts.Valid = r.Get("ReadingValid", val) == 1
+	}
+	return ts
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The C-state residency of a CPU is the difference of the cpuidle time and
+// usage counters of each state over an interval, the time not in an idle
+// state is C0. The package C-state residency counters are MSRs counting at
+// the TSC rate, they are read from one CPU of each package.
+
+// Package C-state residency MSRs
+var (
+	MsrPkgC2Residency = &Register{Name: "MSR_PKG_C2_RESIDENCY", Addr: 0x60D, Fields: []Field{{"Count", 0, 63}}}
+	MsrPkgC3Residency = &Register{Name: "MSR_PKG_C3_RESIDENCY", Addr: 0x3F8, Fields: []Field{{"Count", 0, 63}}}
+	MsrPkgC6Residency = &Register{Name: "MSR_PKG_C6_RESIDENCY", Addr: 0x3F9, Fields: []Field{{"Count", 0, 63}}}
+	MsrPkgC7Residency = &Register{Name: "MSR_PKG_C7_RESIDENCY", Addr: 0x3FA, Fields: []Field{{"Count", 0, 63}}}
+)
+
+// PkgCStates are the package C-states with a residency MSR
+var PkgCStates = []struct {
+	Name string
+	Reg  *Register
+}{
+	{"PC2", MsrPkgC2Residency},
+	{"PC3", MsrPkgC3Residency},
+	{"PC6", MsrPkgC6Residency},
+	{"PC7", MsrPkgC7Residency},
+}
+
+// CStateCounters of one cpuidle state
+type CStateCounters struct {
+	Name  string
+	Time  uint64 // Microseconds in the state
+	Usage uint64 // Number of times the state was entered
+}
+
+// CStateSample of the cpuidle counters of a CPU
+type CStateSample struct {
+	States []CStateCounters
+	Time   time.Time
+}
+
+// StateResidency of a C-state over an interval
+type StateResidency struct {
+	Name    string
+	Percent float64
+	Usage   uint64 // Number of times the state was entered in the interval
+}
+
+// Residency of a CPU over an interval
+type Residency struct {
+	C0Percent   float64
+	IdlePercent float64
+	States      []StateResidency
+	Valid       bool // False until two samples are taken
+}
+
+// ReadCStateSample reads the cpuidle counters of the CPU
+func ReadCStateSample(cpu int) (CStateSample, error) {
+
+	s := CStateSample{Time: time.Now()}
+
+	num := NumCStates(cpu)
+	if num == 0 {
+		return s, fmt.Errorf("cpu %d has no cpuidle states", cpu)
+	}
+	for state := 0; state < num; state++ {
+		c := CStateCounters{Name: CStateName(cpu, state)}
+		if v, err := readFile(cpuidleFile(cpu, state, "time")); err == nil {
+			c.Time, _ = strconv.ParseUint(v, 10, 64)
+		}
+		if v, err := readFile(cpuidleFile(cpu, state, "usage")); err == nil {
+			c.Usage, _ = strconv.ParseUint(v, 10, 64)
+		}
+		s.States = append(s.States, c)
+	}
+
+	return s, nil
+}
+
+// ComputeResidency returns the residency of each state between the samples
+func ComputeResidency(prev, cur CStateSample) Residency {
+
+	us := float64(cur.Time.Sub(prev.Time).Microseconds())
+	if us <= 0 || len(prev.States) != len(cur.States) {
+		return Residency{}
+	}
+
+	r := Residency{Valid: true}
+	for i, c := range cur.States {
+		p := prev.States[i]
+		sr := StateResidency{Name: c.Name}
+		if c.Time >= p.Time {
+			sr.Percent = float64(c.Time-p.Time) * 100.0 / us
+		}
+		if c.Usage >= p.Usage {
+			sr.Usage = c.Usage - p.Usage
+		}
+		if sr.Percent > 100.0 {
+			sr.Percent = 100.0
+		}
+		r.IdlePercent += sr.Percent
+		r.States = append(r.States, sr)
+	}
+	if r.IdlePercent > 100.0 {
+		r.IdlePercent = 100.0
+	}
+	r.C0Percent = 100.0 - r.IdlePercent
+
+	return r
+}
+
+// pkgSample of the package residency counters and the TSC
+type pkgSample struct {
+	counts []uint64
+	tsc    uint64
+}
+
+// ResidencySampler keeps the last sample of each CPU and package to compute
+// the residency of the next interval
+type ResidencySampler struct {
+	lock    sync.Mutex
+	prev    map[int]CStateSample
+	res     map[int]Residency
+	pkgPrev map[int]pkgSample
+	pkgRes  map[int][]StateResidency
+}
+
+// NewResidencySampler creates a sampler with no samples
+func NewResidencySampler() *ResidencySampler {
+
+	return &ResidencySampler{
+		prev:    make(map[int]CStateSample),
+		res:     make(map[int]Residency),
+		pkgPrev: make(map[int]pkgSample),
+		pkgRes:  make(map[int][]StateResidency),
+	}
+}
+
+// Sample the cpuidle counters of the CPUs, the first error is returned
+func (rs *ResidencySampler) Sample(cpus []int) error {
+
+	var first error
+
+	for _, cpu := range cpus {
+		cur, err := ReadCStateSample(cpu)
+
+		rs.lock.Lock()
+		if err != nil {
+			delete(rs.prev, cpu)
+			rs.res[cpu] = Residency{}
+			if first == nil {
+				first = err
+			}
+		} else {
+			if prev, ok := rs.prev[cpu]; ok {
+				rs.res[cpu] = ComputeResidency(prev, cur)
+			}
+			rs.prev[cpu] = cur
+		}
+		rs.lock.Unlock()
+	}
+
+	return first
+}
+
+// SamplePackages samples the package residency MSRs, the key of the map is
+// the package and the value the CPU used to read the MSRs of the package
+func (rs *ResidencySampler) SamplePackages(pkgCPUs map[int]int) error {
+
+	for pkg, cpu := range pkgCPUs {
+		cur := pkgSample{}
+
+		tsc, err := IA32TimeStampCounter.Read(cpu)
+		if err != nil {
+			return err
+		}
+		cur.tsc = tsc
+		for _, pc := range PkgCStates {
+			// Not all of the package states exist on all CPUs
+			v, _ := pc.Reg.Read(cpu)
+			cur.counts = append(cur.counts, v)
+		}
+
+		rs.lock.Lock()
+		if prev, ok := rs.pkgPrev[pkg]; ok && cur.tsc > prev.tsc {
+			res := []StateResidency{}
+			for i, pc := range PkgCStates {
+				pct := float64(cur.counts[i]-prev.counts[i]) * 100.0 / float64(cur.tsc-prev.tsc)
+				if pct > 100.0 || cur.counts[i] < prev.counts[i] {
+					pct = 0
+				}
+				res = append(res, StateResidency{Name: pc.Name, Percent: pct})
+			}
+			rs.pkgRes[pkg] = res
+		}
+		rs.pkgPrev[pkg] = cur
+		rs.lock.Unlock()
+	}
+
+	return nil
+}
+
+// Get the residency of the CPU for the last interval
+func (rs *ResidencySampler) Get(cpu int) Residency {
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	return rs.res[cpu]
+}
+
+// Package returns the package C-state residency of the last interval
+func (rs *ResidencySampler) Package(pkg int) []StateResidency {
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	return rs.pkgRes[pkg]
+}
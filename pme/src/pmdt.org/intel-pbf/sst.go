@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Intel Speed Select Base Frequency (SST-BF) gives a set of high priority
+// cores a higher base frequency than the other cores. When SST-BF is enabled
+// the intel_pstate driver reports the base frequency of each CPU in the
+// cpufreq base_frequency file, the CPUs with the highest base frequency are
+// the high priority cores. To guarantee the higher frequency the min and max
+// frequency of the high priority cores are set to their base frequency.
+
+// sysCPUDir is the sysfs directory of the CPUs
+var sysCPUDir = "/sys/devices/system/cpu"
+
+// SSTBF high and low priority cores
+type SSTBF struct {
+	Enabled      bool  // The CPUs have different base frequencies
+	HighPriority []int // CPUs with the high base frequency
+	LowPriority  []int
+	HighBaseMHz  int32
+	LowBaseMHz   int32
+}
+
+// cpufreqFile returns the cpufreq file of the CPU
+func cpufreqFile(cpu int, name string) string {
+	return filepath.Join(sysCPUDir, fmt.Sprintf("cpu%d", cpu), "cpufreq", name)
+}
+
+// readKHz reads a cpufreq file in kHz and returns MHz, -1 if not readable
+func readKHz(file string) int32 {
+
+	khz := readRawKHz(file)
+	if khz < 0 {
+		return -1
+	}
+	return int32(khz / 1000)
+}
+
+// readRawKHz reads a cpufreq file in kHz, -1 if not readable
+func readRawKHz(file string) int64 {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(dat)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// BaseFrequency returns the base frequency in MHz of the CPU or -1 if the
+// driver does not report it
+func BaseFrequency(cpu int) int32 {
+	return readKHz(cpufreqFile(cpu, "base_frequency"))
+}
+
+// HighPriorityCores finds the SST-BF high priority cores of the CPUs, SST-BF
+// is not enabled when all of the CPUs have the same base frequency.
+func HighPriorityCores(cpus []int) (SSTBF, error) {
+
+	sst := SSTBF{}
+
+	base := make(map[int]int32)
+	for _, cpu := range cpus {
+		mhz := BaseFrequency(cpu)
+		if mhz <= 0 {
+			return sst, fmt.Errorf("cpu %d has no cpufreq base_frequency, SST-BF needs the intel_pstate driver", cpu)
+		}
+		base[cpu] = mhz
+		if mhz > sst.HighBaseMHz {
+			sst.HighBaseMHz = mhz
+		}
+		if sst.LowBaseMHz == 0 || mhz < sst.LowBaseMHz {
+			sst.LowBaseMHz = mhz
+		}
+	}
+
+	if sst.HighBaseMHz == sst.LowBaseMHz {
+		return sst, nil
+	}
+	sst.Enabled = true
+
+	for _, cpu := range cpus {
+		if base[cpu] == sst.HighBaseMHz {
+			sst.HighPriority = append(sst.HighPriority, cpu)
+		} else {
+			sst.LowPriority = append(sst.LowPriority, cpu)
+		}
+	}
+	sort.Ints(sst.HighPriority)
+	sort.Ints(sst.LowPriority)
+
+	return sst, nil
+}
+
+// IsHighPriority returns true if the CPU is a high priority core
+func (sst *SSTBF) IsHighPriority(cpu int) bool {
+
+	for _, c := range sst.HighPriority {
+		if c == cpu {
+			return true
+		}
+	}
+	return false
+}
+
+// writeKHz writes the frequency in kHz to the cpufreq file
+func writeKHz(cpu int, name string, khz int64) error {
+
+	file := cpufreqFile(cpu, name)
+	if err := ioutil.WriteFile(file, []byte(strconv.FormatInt(khz, 10)), 0644); err != nil {
+		return fmt.Errorf("cpu %d: write %d kHz to %s: %v", cpu, khz, name, err)
+	}
+	return nil
+}
+
+// SetFrequencyRange sets the scaling min and max frequency in MHz of the CPU,
+// the files are written in the order that keeps min below max.
+func SetFrequencyRange(cpu int, minMHz, maxMHz int32) error {
+
+	if minMHz > maxMHz {
+		return fmt.Errorf("cpu %d: min frequency %d MHz is above max %d MHz", cpu, minMHz, maxMHz)
+	}
+	return setFrequencyRangeKHz(cpu, int64(minMHz)*1000, int64(maxMHz)*1000)
+}
+
+// setFrequencyRangeKHz sets the scaling min and max frequency in kHz of the
+// CPU, min is not above max
+func setFrequencyRangeKHz(cpu int, minKHz, maxKHz int64) error {
+
+	if curMax := readRawKHz(cpufreqFile(cpu, "scaling_max_freq")); curMax >= 0 && minKHz > curMax {
+		if err := writeKHz(cpu, "scaling_max_freq", maxKHz); err != nil {
+			return err
+		}
+		return writeKHz(cpu, "scaling_min_freq", minKHz)
+	}
+
+	if err := writeKHz(cpu, "scaling_min_freq", minKHz); err != nil {
+		return err
+	}
+	return writeKHz(cpu, "scaling_max_freq", maxKHz)
+}
+
+// PinHighPriority sets the min and max frequency of the high priority cores
+// to the high base frequency
+func (sst *SSTBF) PinHighPriority() error {
+
+	if !sst.Enabled {
+		return fmt.Errorf("SST-BF is not enabled, all cores have the same base frequency")
+	}
+	for _, cpu := range sst.HighPriority {
+		if err := SetFrequencyRange(cpu, sst.HighBaseMHz, sst.HighBaseMHz); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetFrequencyRange sets the min and max frequency of the CPU back to the
+// limits of the CPU
+func ResetFrequencyRange(cpu int) error {
+
+	minMHz := readKHz(cpufreqFile(cpu, "cpuinfo_min_freq"))
+	maxMHz := readKHz(cpufreqFile(cpu, "cpuinfo_max_freq"))
+	if minMHz < 0 || maxMHz < 0 {
+		return fmt.Errorf("cpu %d: cpuinfo min and max frequency not readable", cpu)
+	}
+	return SetFrequencyRange(cpu, minMHz, maxMHz)
+}
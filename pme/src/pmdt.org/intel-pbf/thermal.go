@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package intelpbf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The core and package temperatures are TjMax from MSR_TEMPERATURE_TARGET
+// minus the digital readout of the thermal status registers. Without the msr
+// module the temperatures come from the coretemp hwmon driver in sysfs and the
+// throttling from the thermal_throttle counters of each CPU.
+
+// Sources of the temperatures
+const (
+	ThermalSourceMSR      = "msr"
+	ThermalSourceCoretemp = "coretemp"
+)
+
+// MsrTemperatureTarget has the TjMax of the package
+var MsrTemperatureTarget = &Register{Name: "MSR_TEMPERATURE_TARGET", Addr: 0x1A2, Fields: []Field{
+	{"TjMax", 16, 23},
+	{"TCCOffset", 24, 29},
+}}
+
+// Temperature of a CPU and its package in degrees C
+type Temperature struct {
+	CPU     int
+	Core    int // core_id of the CPU
+	Package int
+	CoreC   int
+	PkgC    int
+	TjMax   int
+	Source  string
+
+	CoreStatus ThermStatus // Throttle status and log, only from the MSRs
+	PkgStatus  ThermStatus
+
+	CoreThrottles uint64 // Throttle events from sysfs thermal_throttle
+	PkgThrottles  uint64
+}
+
+// Thermal reads the temperatures from the MSRs or the sysfs root
+type Thermal struct {
+	root string
+}
+
+// NewThermal creates the thermal reader, root is the optional root of the
+// file system used to find sys.
+func NewThermal(root ...string) *Thermal {
+
+	t := &Thermal{root: "/"}
+	if len(root) > 0 && len(root[0]) > 0 {
+		t.root = root[0]
+	}
+	return t
+}
+
+// path returns the path of the file under the root
+func (t *Thermal) path(elem ...string) string {
+	return filepath.Join(append([]string{t.root}, elem...)...)
+}
+
+// readInt reads an integer sysfs file under the root, -1 if the file is
+// not readable
+func (t *Thermal) readInt(elem ...string) int {
+	return readIntFile(t.path(elem...))
+}
+
+func readIntFile(file string) int {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(dat)))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// Throttling returns true if the core or package is throttled now
+func (tp *Temperature) Throttling() bool {
+	return tp.CoreStatus.Throttling || tp.PkgStatus.Throttling ||
+		tp.CoreStatus.PowerLimit || tp.PkgStatus.PowerLimit
+}
+
+// Throttled returns true if the core or package was throttled since the logs
+// were cleared or has throttle events
+func (tp *Temperature) Throttled() bool {
+	return tp.CoreStatus.ThrottleLog || tp.PkgStatus.ThrottleLog ||
+		tp.CoreStatus.PowerLimitLog || tp.PkgStatus.PowerLimitLog ||
+		tp.CoreThrottles > 0 || tp.PkgThrottles > 0
+}
+
+// DecodeTemperatureTarget returns the TjMax and the TCC activation offset of
+// the MSR_TEMPERATURE_TARGET value
+func DecodeTemperatureTarget(val uint64) (int, int) {
+
+	r := MsrTemperatureTarget
+	return int(r.Get("TjMax", val)), int(r.Get("TCCOffset", val))
+}
+
+// Read the temperatures of the CPUs from the MSRs, the coretemp driver is
+// used when the MSRs are not readable or the root is not the system root
+func (t *Thermal) Read(cpus []int) ([]Temperature, error) {
+
+	err := fmt.Errorf("MSRs not read with root %s", t.root)
+	if t.root == "/" {
+		var temps []Temperature
+		if temps, err = t.readMSR(cpus); err == nil {
+			return temps, nil
+		}
+	}
+
+	temps, cerr := t.readCoretemp(cpus)
+	if cerr != nil {
+		return nil, fmt.Errorf("%v and %v", err, cerr)
+	}
+	return temps, nil
+}
+
+// topology sets the core and package of the CPU and the throttle counts
+func (t *Thermal) topology(tp *Temperature) {
+
+	cpu := fmt.Sprintf("cpu%d", tp.CPU)
+	tp.Core = t.readInt("sys", "devices", "system", "cpu", cpu, "topology", "core_id")
+	tp.Package = t.readInt("sys", "devices", "system", "cpu", cpu, "topology", "physical_package_id")
+
+	if n := t.readInt("sys", "devices", "system", "cpu", cpu, "thermal_throttle", "core_throttle_count"); n > 0 {
+		tp.CoreThrottles = uint64(n)
+	}
+	if n := t.readInt("sys", "devices", "system", "cpu", cpu, "thermal_throttle", "package_throttle_count"); n > 0 {
+		tp.PkgThrottles = uint64(n)
+	}
+}
+
+// readMSR reads the temperatures and the throttle status from the MSRs
+func (t *Thermal) readMSR(cpus []int) ([]Temperature, error) {
+
+	temps := []Temperature{}
+	for _, cpu := range cpus {
+		tp := Temperature{CPU: cpu, Source: ThermalSourceMSR}
+
+		val, err := MsrTemperatureTarget.Read(cpu)
+		if err != nil {
+			return nil, err
+		}
+		tp.TjMax, _ = DecodeTemperatureTarget(val)
+
+		if val, err = IA32ThermStatus.Read(cpu); err != nil {
+			return nil, err
+		}
+		tp.CoreStatus = DecodeThermStatus(IA32ThermStatus, val)
+
+		if val, err = IA32PackageThermStatus.Read(cpu); err != nil {
+			return nil, err
+		}
+		tp.PkgStatus = DecodeThermStatus(IA32PackageThermStatus, val)
+
+		tp.CoreC = tp.TjMax - int(tp.CoreStatus.DigitalReadout)
+		tp.PkgC = tp.TjMax - int(tp.PkgStatus.DigitalReadout)
+
+		t.topology(&tp)
+		temps = append(temps, tp)
+	}
+
+	return temps, nil
+}
+
+// coretemp temperatures of a package
+type coretemp struct {
+	pkgC  int
+	tjMax int
+	cores map[int]int // core_id to degrees C
+}
+
+// readHwmon reads the coretemp hwmon devices, the key is the package id
+func (t *Thermal) readHwmon() (map[int]*coretemp, error) {
+
+	dirs, _ := filepath.Glob(t.path("sys", "class", "hwmon", "hwmon*"))
+
+	pkgs := make(map[int]*coretemp)
+	for _, dir := range dirs {
+		if name, _ := ioutil.ReadFile(filepath.Join(dir, "name")); strings.TrimSpace(string(name)) != "coretemp" {
+			continue
+		}
+
+		ct := &coretemp{pkgC: -1, tjMax: -1, cores: make(map[int]int)}
+		pkg := -1
+
+		labels, _ := filepath.Glob(filepath.Join(dir, "temp*_label"))
+		for _, label := range labels {
+			dat, err := ioutil.ReadFile(label)
+			if err != nil {
+				continue
+			}
+			prefix := strings.TrimSuffix(filepath.Base(label), "_label")
+			milli := readIntFile(filepath.Join(dir, prefix+"_input"))
+			if milli < 0 {
+				continue
+			}
+
+			w := strings.Fields(string(dat))
+			switch {
+			case len(w) == 3 && w[0] == "Package" && w[1] == "id":
+				pkg, _ = strconv.Atoi(w[2])
+				ct.pkgC = milli / 1000
+				if crit := readIntFile(filepath.Join(dir, prefix+"_crit")); crit > 0 {
+					ct.tjMax = crit / 1000
+				}
+			case len(w) == 2 && w[0] == "Core":
+				if core, err := strconv.Atoi(w[1]); err == nil {
+					ct.cores[core] = milli / 1000
+				}
+			}
+		}
+		if pkg >= 0 {
+			pkgs[pkg] = ct
+		}
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("coretemp hwmon not found in %s", t.path("sys", "class", "hwmon"))
+	}
+	return pkgs, nil
+}
+
+// readCoretemp reads the temperatures from the coretemp driver and the
+// throttle counts from sysfs
+func (t *Thermal) readCoretemp(cpus []int) ([]Temperature, error) {
+
+	pkgs, err := t.readHwmon()
+	if err != nil {
+		return nil, err
+	}
+
+	temps := []Temperature{}
+	for _, cpu := range cpus {
+		tp := Temperature{CPU: cpu, Source: ThermalSourceCoretemp, CoreC: -1, PkgC: -1, TjMax: -1}
+		t.topology(&tp)
+
+		if ct, ok := pkgs[tp.Package]; ok {
+			tp.PkgC = ct.pkgC
+			tp.TjMax = ct.tjMax
+			if c, ok := ct.cores[tp.Core]; ok {
+				tp.CoreC = c
+			}
+		}
+		temps = append(temps, tp)
+	}
+
+	return temps, nil
+}
@@ -0,0 +1,471 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Identify the CPU from /proc/cpuinfo or the raw CPUID signature and map the
+// family/model/stepping to a microarchitecture and the set of features the
+// panels can expect to find on the system.
+
+// Feature bits a microarchitecture can support
+type Feature uint32
+
+// Features a panel can ask about
+const (
+	FeatureQPI    Feature = 1 << iota // QuickPath Interconnect between sockets
+	FeatureUPI                        // Ultra Path Interconnect between sockets
+	FeatureAVX2                       // AVX2 instructions
+	FeatureAVX512                     // AVX-512 Foundation instructions
+	FeaturePBF                        // Speed Select Base Frequency (SST-BF)
+	FeatureSST                        // Speed Select Core Power/Performance Profile
+	FeatureRDT                        // Resource Director Technology (CAT/CMT/MBM)
+	FeatureHybrid                     // Hybrid P-core/E-core part
+)
+
+// FeatureNames in string format
+var FeatureNames = map[Feature]string{
+	FeatureQPI:    "QPI",
+	FeatureUPI:    "UPI",
+	FeatureAVX2:   "AVX2",
+	FeatureAVX512: "AVX512",
+	FeaturePBF:    "SST-BF",
+	FeatureSST:    "SST",
+	FeatureRDT:    "RDT",
+	FeatureHybrid: "Hybrid",
+}
+
+// CPU Model IDs for Intel family 6 processors
+const (
+	NehalemEPModel        = 26
+	NehalemModel          = 30
+	AtomModel             = 28
+	Atom2Model            = 53
+	AtomCentertonModel    = 54
+	AtomBaytrailModel     = 55
+	AtomAvotonModel       = 77
+	AtomCherrytrailModel  = 76
+	AtomApolloLakeModel   = 92
+	AtomDenvertonModel    = 95
+	AtomGeminiLakeModel   = 122
+	AtomSnowRidgeModel    = 134
+	AtomElkhartLakeModel  = 150
+	AtomJasperLakeModel   = 156
+	AtomSierraForestModel = 175
+	AtomGrandRidgeModel   = 182
+	ClarkdaleModel        = 37
+	WestmereEPModel       = 44
+	NehalemEXModel        = 46
+	WestmereEXModel       = 47
+	SandyBridgeModel      = 42
+	JaketownModel         = 45
+	IvyBridgeModel        = 58
+	HaswellModel          = 60
+	HaswellULTModel       = 69
+	Haswell2Model         = 70
+	IvytownModel          = 62
+	HaswellXModel         = 63
+	BroadwellModel        = 61
+	BroadwellXeonE3Model  = 71
+	BDXDEModel            = 86
+	SKLUYModel            = 78
+	KBLModel              = 158
+	KBL1Model             = 142
+	BDXModel              = 79
+	KNLModel              = 87
+	KNMModel              = 133
+	SKLModel              = 94
+	SKXModel              = 85
+	CMLModel              = 165
+	CML1Model             = 166
+	ICLModel              = 126
+	ICL1Model             = 125
+	ICXModel              = 106
+	ICXDModel             = 108
+	TGLModel              = 140
+	TGL1Model             = 141
+	ADLModel              = 151
+	ADL1Model             = 154
+	RPLModel              = 183
+	RPL1Model             = 186
+	RPL2Model             = 191
+	SPRModel              = 143
+	EMRModel              = 207
+	GNRModel              = 173
+	GNRDModel             = 174
+)
+
+const (
+	intelFamily             = 6
+	intelExtendedFamilyBase = 15
+)
+
+// CPUModels is a list of known Intel CPU Ids
+var CPUModels = map[int]string{
+	NehalemEPModel:        "Nehalem EP",
+	NehalemModel:          "Nehalem",
+	AtomModel:             "Atom",
+	Atom2Model:            "Atom Cloverview",
+	AtomCentertonModel:    "Atom Centerton",
+	AtomBaytrailModel:     "Atom Baytrail",
+	AtomAvotonModel:       "Atom Avoton",
+	AtomCherrytrailModel:  "Atom Cherrytrail",
+	AtomApolloLakeModel:   "Atom Apollo Lake",
+	AtomDenvertonModel:    "Atom Denverton",
+	AtomGeminiLakeModel:   "Atom Gemini Lake",
+	AtomSnowRidgeModel:    "Atom Snow Ridge",
+	AtomElkhartLakeModel:  "Atom Elkhart Lake",
+	AtomJasperLakeModel:   "Atom Jasper Lake",
+	AtomSierraForestModel: "Sierra Forest",
+	AtomGrandRidgeModel:   "Grand Ridge",
+	ClarkdaleModel:        "Clarkdale",
+	WestmereEPModel:       "Westmere EP",
+	NehalemEXModel:        "Nehalem EX",
+	WestmereEXModel:       "Westmere EX",
+	SandyBridgeModel:      "Sandy Bridge",
+	JaketownModel:         "Sandy Bridge EP (Jaketown)",
+	IvyBridgeModel:        "Ivy Bridge",
+	HaswellModel:          "Haswell",
+	HaswellULTModel:       "Haswell ULT",
+	Haswell2Model:         "Haswell GT3e",
+	IvytownModel:          "Ivy Bridge EP (Ivytown)",
+	HaswellXModel:         "Haswell X",
+	BroadwellModel:        "Broadwell",
+	BroadwellXeonE3Model:  "Broadwell Xeon E3",
+	BDXDEModel:            "Broadwell DE",
+	SKLUYModel:            "Skylake UY",
+	KBLModel:              "Kaby Lake",
+	KBL1Model:             "Kaby Lake L",
+	BDXModel:              "Broadwell X (BDX)",
+	KNLModel:              "Knights Landing",
+	KNMModel:              "Knights Mill",
+	SKLModel:              "Skylake",
+	SKXModel:              "Skylake SP (SKX)",
+	CMLModel:              "Comet Lake",
+	CML1Model:             "Comet Lake L",
+	ICLModel:              "Ice Lake L",
+	ICL1Model:             "Ice Lake",
+	ICXModel:              "Ice Lake SP (ICX)",
+	ICXDModel:             "Ice Lake D",
+	TGLModel:              "Tiger Lake L",
+	TGL1Model:             "Tiger Lake",
+	ADLModel:              "Alder Lake",
+	ADL1Model:             "Alder Lake L",
+	RPLModel:              "Raptor Lake",
+	RPL1Model:             "Raptor Lake P",
+	RPL2Model:             "Raptor Lake S",
+	SPRModel:              "Sapphire Rapids",
+	EMRModel:              "Emerald Rapids",
+	GNRModel:              "Granite Rapids X",
+	GNRDModel:             "Granite Rapids D",
+}
+
+// Microarch describes the microarchitecture of a given family/model/stepping
+type Microarch struct {
+	Name     string  // Name of the microarchitecture
+	Server   bool    // true if the part is a multi-socket server part
+	Atom     bool    // true if the part is an Atom or E-core only part
+	Features Feature // Features the microarchitecture can support
+}
+
+// Entries with a stepping range to split models shared by several
+// microarchitectures, the first matching entry is used.
+type microarchEntry struct {
+	model    int
+	minStep  int
+	maxStep  int
+	microArc Microarch
+}
+
+const (
+	qpiServer    = FeatureQPI | FeatureRDT
+	upiServer    = FeatureUPI | FeatureAVX2 | FeatureAVX512 | FeatureRDT
+	sstServer    = upiServer | FeaturePBF | FeatureSST
+	clientAVX2   = FeatureAVX2
+	clientAVX512 = FeatureAVX2 | FeatureAVX512
+)
+
+var microarchTable = []microarchEntry{
+	{SKXModel, 0, 4, Microarch{"Skylake-SP", true, false, upiServer}},
+	{SKXModel, 5, 7, Microarch{"Cascade Lake-SP", true, false, sstServer}},
+	{SKXModel, 10, 11, Microarch{"Cooper Lake", true, false, sstServer}},
+	{SKXModel, -1, -1, Microarch{"Skylake-SP", true, false, upiServer}},
+	{ICXModel, -1, -1, Microarch{"Ice Lake-SP", true, false, sstServer}},
+	{ICXDModel, -1, -1, Microarch{"Ice Lake-D", false, false, upiServer &^ FeatureUPI}},
+	{SPRModel, -1, -1, Microarch{"Sapphire Rapids", true, false, sstServer}},
+	{EMRModel, -1, -1, Microarch{"Emerald Rapids", true, false, sstServer}},
+	{GNRModel, -1, -1, Microarch{"Granite Rapids", true, false, sstServer}},
+	{GNRDModel, -1, -1, Microarch{"Granite Rapids-D", false, false, sstServer &^ FeatureUPI}},
+	{AtomSierraForestModel, -1, -1, Microarch{"Sierra Forest", true, true, FeatureUPI | FeatureAVX2 | FeatureRDT | FeaturePBF | FeatureSST}},
+	{AtomGrandRidgeModel, -1, -1, Microarch{"Grand Ridge", false, true, FeatureAVX2 | FeatureRDT}},
+	{AtomSnowRidgeModel, -1, -1, Microarch{"Snow Ridge", false, true, FeatureRDT}},
+	{AtomDenvertonModel, -1, -1, Microarch{"Denverton", false, true, 0}},
+	{AtomElkhartLakeModel, -1, -1, Microarch{"Elkhart Lake", false, true, 0}},
+	{AtomJasperLakeModel, -1, -1, Microarch{"Jasper Lake", false, true, 0}},
+	{AtomGeminiLakeModel, -1, -1, Microarch{"Gemini Lake", false, true, 0}},
+	{AtomApolloLakeModel, -1, -1, Microarch{"Apollo Lake", false, true, 0}},
+	{AtomCherrytrailModel, -1, -1, Microarch{"Cherry Trail", false, true, 0}},
+	{AtomAvotonModel, -1, -1, Microarch{"Avoton", false, true, 0}},
+	{AtomBaytrailModel, -1, -1, Microarch{"Bay Trail", false, true, 0}},
+	{AtomCentertonModel, -1, -1, Microarch{"Centerton", false, true, 0}},
+	{Atom2Model, -1, -1, Microarch{"Cloverview", false, true, 0}},
+	{AtomModel, -1, -1, Microarch{"Bonnell", false, true, 0}},
+	{KNLModel, -1, -1, Microarch{"Knights Landing", false, false, FeatureAVX2 | FeatureAVX512}},
+	{KNMModel, -1, -1, Microarch{"Knights Mill", false, false, FeatureAVX2 | FeatureAVX512}},
+	{BDXModel, -1, -1, Microarch{"Broadwell-EP/EX", true, false, qpiServer | FeatureAVX2}},
+	{BDXDEModel, -1, -1, Microarch{"Broadwell-DE", false, false, FeatureAVX2 | FeatureRDT}},
+	{HaswellXModel, -1, -1, Microarch{"Haswell-EP/EX", true, false, qpiServer | FeatureAVX2}},
+	{IvytownModel, -1, -1, Microarch{"Ivy Bridge-EP/EX", true, false, qpiServer}},
+	{JaketownModel, -1, -1, Microarch{"Sandy Bridge-EP", true, false, qpiServer}},
+	{WestmereEXModel, -1, -1, Microarch{"Westmere-EX", true, false, FeatureQPI}},
+	{WestmereEPModel, -1, -1, Microarch{"Westmere-EP", true, false, FeatureQPI}},
+	{NehalemEXModel, -1, -1, Microarch{"Nehalem-EX", true, false, FeatureQPI}},
+	{NehalemEPModel, -1, -1, Microarch{"Nehalem-EP", true, false, FeatureQPI}},
+	{NehalemModel, -1, -1, Microarch{"Nehalem", false, false, 0}},
+	{ClarkdaleModel, -1, -1, Microarch{"Westmere", false, false, 0}},
+	{SandyBridgeModel, -1, -1, Microarch{"Sandy Bridge", false, false, 0}},
+	{IvyBridgeModel, -1, -1, Microarch{"Ivy Bridge", false, false, 0}},
+	{HaswellModel, -1, -1, Microarch{"Haswell", false, false, clientAVX2}},
+	{HaswellULTModel, -1, -1, Microarch{"Haswell", false, false, clientAVX2}},
+	{Haswell2Model, -1, -1, Microarch{"Haswell", false, false, clientAVX2}},
+	{BroadwellModel, -1, -1, Microarch{"Broadwell", false, false, clientAVX2}},
+	{BroadwellXeonE3Model, -1, -1, Microarch{"Broadwell", false, false, clientAVX2}},
+	{SKLUYModel, -1, -1, Microarch{"Skylake", false, false, clientAVX2}},
+	{SKLModel, -1, -1, Microarch{"Skylake", false, false, clientAVX2}},
+	{KBLModel, -1, -1, Microarch{"Kaby/Coffee Lake", false, false, clientAVX2}},
+	{KBL1Model, -1, -1, Microarch{"Kaby/Whiskey Lake", false, false, clientAVX2}},
+	{CMLModel, -1, -1, Microarch{"Comet Lake", false, false, clientAVX2}},
+	{CML1Model, -1, -1, Microarch{"Comet Lake", false, false, clientAVX2}},
+	{ICLModel, -1, -1, Microarch{"Ice Lake", false, false, clientAVX512}},
+	{ICL1Model, -1, -1, Microarch{"Ice Lake", false, false, clientAVX512}},
+	{TGLModel, -1, -1, Microarch{"Tiger Lake", false, false, clientAVX512}},
+	{TGL1Model, -1, -1, Microarch{"Tiger Lake", false, false, clientAVX512}},
+	{ADLModel, -1, -1, Microarch{"Alder Lake", false, false, clientAVX2 | FeatureHybrid}},
+	{ADL1Model, -1, -1, Microarch{"Alder Lake", false, false, clientAVX2 | FeatureHybrid}},
+	{RPLModel, -1, -1, Microarch{"Raptor Lake", false, false, clientAVX2 | FeatureHybrid}},
+	{RPL1Model, -1, -1, Microarch{"Raptor Lake", false, false, clientAVX2 | FeatureHybrid}},
+	{RPL2Model, -1, -1, Microarch{"Raptor Lake", false, false, clientAVX2 | FeatureHybrid}},
+}
+
+// CPUIdent holds the decoded identification of the CPU
+type CPUIdent struct {
+	Vendor    string          // Vendor ID string e.g. GenuineIntel
+	Family    int             // Display family value
+	Model     int             // Display model value
+	Stepping  int             // Stepping value
+	ModelName string          // Brand string from /proc/cpuinfo if known
+	Flags     map[string]bool // Flags from /proc/cpuinfo, nil when decoded from CPUID
+	Arch      Microarch       // Microarchitecture of the CPU
+}
+
+// List of constants
+const (
+	CPUInfoFile string = "/proc/cpuinfo"
+	IntelVendor string = "GenuineIntel"
+)
+
+// LookupMicroarch for the family, model and stepping values, a stepping of -1
+// matches the first entry for the model.
+func LookupMicroarch(family, model, stepping int) Microarch {
+
+	if family != intelFamily {
+		return Microarch{Name: fmt.Sprintf("Family %d", family)}
+	}
+
+	for _, e := range microarchTable {
+		if e.model != model {
+			continue
+		}
+		if e.minStep == -1 || stepping == -1 ||
+			(stepping >= e.minStep && stepping <= e.maxStep) {
+			return e.microArc
+		}
+	}
+
+	if name := CPUModel(model); len(name) > 0 {
+		return Microarch{Name: name}
+	}
+	return Microarch{Name: fmt.Sprintf("Unknown model %d", model)}
+}
+
+// DecodeSignature from the CPUID leaf 1 EAX value into the display family,
+// model and stepping values.
+func DecodeSignature(vendor string, eax uint32) *CPUIdent {
+
+	stepping := int(eax & 0xF)
+	model := int((eax >> 4) & 0xF)
+	family := int((eax >> 8) & 0xF)
+	extModel := int((eax >> 16) & 0xF)
+	extFamily := int((eax >> 20) & 0xFF)
+
+	if family == intelExtendedFamilyBase {
+		family += extFamily
+	}
+	if family == intelFamily || family >= intelExtendedFamilyBase {
+		model += extModel << 4
+	}
+
+	return newCPUIdent(vendor, family, model, stepping, "", nil)
+}
+
+func newCPUIdent(vendor string, family, model, stepping int, name string, flags map[string]bool) *CPUIdent {
+
+	c := &CPUIdent{
+		Vendor:    vendor,
+		Family:    family,
+		Model:     model,
+		Stepping:  stepping,
+		ModelName: name,
+		Flags:     flags,
+	}
+
+	if vendor == IntelVendor {
+		c.Arch = LookupMicroarch(family, model, stepping)
+	} else {
+		c.Arch = Microarch{Name: vendor}
+	}
+
+	// The flags from the kernel are more accurate then the table, as some SKUs
+	// or hypervisors disable features.
+	if flags != nil {
+		setFlag := func(f Feature, on bool) {
+			if on {
+				c.Arch.Features |= f
+			} else {
+				c.Arch.Features &^= f
+			}
+		}
+		setFlag(FeatureAVX2, flags["avx2"])
+		setFlag(FeatureAVX512, flags["avx512f"])
+		if flags["cqm_llc"] || flags["rdt_a"] {
+			c.Arch.Features |= FeatureRDT
+		}
+		if flags["hybrid_cpu"] {
+			c.Arch.Features |= FeatureHybrid
+		}
+	}
+
+	return c
+}
+
+// ParseCPUInfo from the reader in /proc/cpuinfo format, only the first
+// processor entry is used.
+func ParseCPUInfo(r io.Reader) (*CPUIdent, error) {
+
+	var vendor, name string
+	var flags map[string]bool
+	family, model, stepping := -1, -1, -1
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			if len(vendor) > 0 {
+				break // end of the first processor
+			}
+			continue
+		}
+		vals := strings.SplitN(line, ":", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(vals[0])
+		value := strings.TrimSpace(vals[1])
+
+		switch key {
+		case "vendor_id":
+			vendor = value
+		case "model name":
+			name = value
+		case "cpu family":
+			family, _ = strconv.Atoi(value)
+		case "model":
+			model, _ = strconv.Atoi(value)
+		case "stepping":
+			stepping, _ = strconv.Atoi(value)
+		case "flags":
+			flags = make(map[string]bool)
+			for _, f := range strings.Fields(value) {
+				flags[f] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(vendor) == 0 || family == -1 || model == -1 {
+		return nil, fmt.Errorf("cpuinfo is missing vendor, family or model")
+	}
+
+	return newCPUIdent(vendor, family, model, stepping, name, flags), nil
+}
+
+// ReadCPUInfo from the given file, normally /proc/cpuinfo
+func ReadCPUInfo(file string) (*CPUIdent, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseCPUInfo(f)
+}
+
+// Has returns true if the CPU can support the given features
+func (c *CPUIdent) Has(f Feature) bool {
+	if c == nil {
+		return false
+	}
+	return (c.Arch.Features & f) == f
+}
+
+// Interconnect name used between sockets, empty when not present
+func (c *CPUIdent) Interconnect() string {
+	switch {
+	case c.Has(FeatureUPI):
+		return "UPI"
+	case c.Has(FeatureQPI):
+		return "QPI"
+	}
+	return ""
+}
+
+// FeatureList returns the names of the supported features
+func (c *CPUIdent) FeatureList() []string {
+
+	list := []string{}
+	for f := FeatureQPI; f <= FeatureHybrid; f <<= 1 {
+		if c.Has(f) {
+			list = append(list, FeatureNames[f])
+		}
+	}
+	return list
+}
+
+// Signature of the CPU in family/model/stepping format
+func (c *CPUIdent) Signature() string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d/%d", c.Family, c.Model, c.Stepping)
+}
+
+// String of the microarchitecture and signature
+func (c *CPUIdent) String() string {
+	if c == nil {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%s (%s)", c.Arch.Name, c.Signature())
+}
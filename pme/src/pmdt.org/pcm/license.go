@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"sync"
+	"time"
+)
+
+// AVX frequency licenses limit the turbo frequency of a core running wide
+// vector instructions. Level 0 is scalar, SSE and light AVX2 code, level 1 is
+// heavy AVX2 and light AVX-512 code and level 2 is heavy AVX-512 code. The
+// time at each level is counted with the CORE_POWER.LVLn_TURBO_LICENSE events
+// when the CPU has them, otherwise the level is estimated from the drop of
+// the busy frequency of the core below the turbo limit of the number of
+// active cores. The turbo limit falls as more cores become active, that drop
+// is not a license change.
+
+// LicenseLevel of the AVX frequency license
+type LicenseLevel int
+
+// AVX frequency license levels
+const (
+	LicenseLevel0 LicenseLevel = iota
+	LicenseLevel1
+	LicenseLevel2
+	MaxLicenseLevels
+)
+
+// Source of the license residency
+const (
+	LicenseSourcePerf     string = "perf_event"
+	LicenseSourceEstimate string = "estimate"
+)
+
+// Frequency drops below the turbo limit of the active cores that estimate a
+// license level, a core must be busy for the drop to be counted.
+const (
+	licenseLevel1Drop float64 = 0.10
+	licenseLevel2Drop float64 = 0.20
+	licenseMinBusy    float64 = 50.0 // C0 percent
+)
+
+// LicenseNames of the levels
+var LicenseNames = [MaxLicenseLevels]string{
+	LicenseLevel0: "L0 SSE/AVX2 Light",
+	LicenseLevel1: "L1 AVX2 Heavy/AVX512 Light",
+	LicenseLevel2: "L2 AVX512 Heavy",
+}
+
+// licenseUmask is the unit mask of the CORE_POWER.LVLn_TURBO_LICENSE event,
+// the event select is licenseEvent
+var licenseUmask = [MaxLicenseLevels]uint64{
+	LicenseLevel0: 0x07,
+	LicenseLevel1: 0x18,
+	LicenseLevel2: 0x20,
+}
+
+const licenseEvent uint64 = 0x28
+
+// licenseModels are the CPU models with the CORE_POWER license events
+var licenseModels = map[int]bool{
+	SKXModel: true,
+	ICXModel: true,
+}
+
+// HasLicenseEvents returns true if the CPU counts the license levels
+func HasLicenseEvents(c *CPUIdent) bool {
+
+	return c != nil && c.Family == 6 && licenseModels[c.Model]
+}
+
+// licenseConfig returns the raw perf event config of the level
+func licenseConfig(level LicenseLevel) uint64 {
+	return licenseEvent | licenseUmask[level]<<8
+}
+
+// LicenseResidency of a core at each license level
+type LicenseResidency struct {
+	Percent [MaxLicenseLevels]float64 // Percent of the last interval
+	Seconds [MaxLicenseLevels]float64 // Total seconds since the start
+	Drops   uint64                    // Intervals the core was above level 0
+	Level   LicenseLevel              // Highest level of the last interval
+	Source  string
+	Valid   bool // False until two samples are taken
+}
+
+// add the counts of each level of an interval to the residency, the counts
+// are cycles for the perf events or one for the estimated level
+func (r *LicenseResidency) add(counts [MaxLicenseLevels]uint64, interval time.Duration) {
+
+	total := uint64(0)
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return
+	}
+
+	r.Valid = true
+	r.Level = LicenseLevel0
+	for l, c := range counts {
+		r.Percent[l] = float64(c) * 100.0 / float64(total)
+		r.Seconds[l] += interval.Seconds() * float64(c) / float64(total)
+		if c > 0 {
+			r.Level = LicenseLevel(l)
+		}
+	}
+	if r.Level > LicenseLevel0 {
+		r.Drops++
+	}
+}
+
+// EstimateLicense returns the license level of the busy frequency of a core
+// from the drop below the turbo limit of the active cores
+func EstimateLicense(busyMHz, turboMHz float64) LicenseLevel {
+
+	if turboMHz <= 0 || busyMHz >= turboMHz {
+		return LicenseLevel0
+	}
+
+	drop := (turboMHz - busyMHz) / turboMHz
+	switch {
+	case drop >= licenseLevel2Drop:
+		return LicenseLevel2
+	case drop >= licenseLevel1Drop:
+		return LicenseLevel1
+	}
+	return LicenseLevel0
+}
+
+// LicenseEstimator estimates the license levels from the busy frequency of
+// each core. A frequency drop from thermal or power limit throttling looks the
+// same as a license drop, the throttled intervals must not be added.
+type LicenseEstimator struct {
+	lock sync.Mutex
+	res  map[int]LicenseResidency
+}
+
+// NewLicenseEstimator creates an estimator with no samples
+func NewLicenseEstimator() *LicenseEstimator {
+
+	return &LicenseEstimator{
+		res: make(map[int]LicenseResidency),
+	}
+}
+
+// Add the busy frequency and C0 percent of the core for the interval, turboMHz
+// is the turbo limit of the number of active cores in the interval. An idle
+// core or an unknown turbo limit is not counted.
+func (e *LicenseEstimator) Add(cpu int, busyMHz, c0Percent, turboMHz float64, interval time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	r := e.res[cpu]
+	r.Source = LicenseSourceEstimate
+
+	if c0Percent < licenseMinBusy || busyMHz <= 0 || turboMHz <= 0 {
+		e.res[cpu] = r
+		return
+	}
+
+	counts := [MaxLicenseLevels]uint64{}
+	counts[EstimateLicense(busyMHz, turboMHz)] = 1
+	r.add(counts, interval)
+
+	e.res[cpu] = r
+}
+
+// License returns the estimated license residency of the core
+func (e *LicenseEstimator) License(cpu int) LicenseResidency {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.res[cpu]
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// perfTypeRaw is PERF_TYPE_RAW, the config is the event select and umask
+const perfTypeRaw uint32 = 4
+
+// LicenseCollector counts the cycles at each AVX license level of each CPU
+// with the CORE_POWER.LVLn_TURBO_LICENSE events
+type LicenseCollector struct {
+	lock sync.Mutex
+	cpus []int
+	fds  map[int][MaxLicenseLevels]int
+	prev map[int][MaxLicenseLevels]uint64
+	last time.Time
+	res  map[int]LicenseResidency
+}
+
+// NewLicenseCollector opens the license events on the CPUs, the CPU must have
+// the events, see HasLicenseEvents.
+func NewLicenseCollector(c *CPUIdent, cpus []int) (*LicenseCollector, error) {
+
+	if !HasLicenseEvents(c) {
+		return nil, fmt.Errorf("CPU %s has no CORE_POWER license events", c)
+	}
+
+	l := &LicenseCollector{
+		cpus: cpus,
+		fds:  make(map[int][MaxLicenseLevels]int),
+		prev: make(map[int][MaxLicenseLevels]uint64),
+		res:  make(map[int]LicenseResidency),
+	}
+
+	for _, cpu := range cpus {
+		fds := [MaxLicenseLevels]int{}
+
+		for level := LicenseLevel0; level < MaxLicenseLevels; level++ {
+			attr := perfEventAttr{
+				Type:       perfTypeRaw,
+				Size:       perfAttrSize,
+				Config:     licenseConfig(level),
+				ReadFormat: perfFormatTotalEnabled | perfFormatTotalRunning,
+			}
+			fd, err := perfEventOpen(&attr, cpu)
+			if err != nil {
+				// A CPU without all of the levels gives wrong percents
+				for _, f := range fds[:level] {
+					syscall.Close(f)
+				}
+				l.Close()
+				return nil, fmt.Errorf("perf_event_open license level %d on cpu %d: %v", level, cpu, err)
+			}
+			fds[level] = fd
+		}
+		l.fds[cpu] = fds
+	}
+
+	return l, nil
+}
+
+// Close all of the event file descriptors
+func (l *LicenseCollector) Close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for cpu, fds := range l.fds {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		delete(l.fds, cpu)
+	}
+}
+
+// Sample the counters and add the cycles at each level since the previous
+// sample to the residency of the CPUs
+func (l *LicenseCollector) Sample() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	interval := now.Sub(l.last)
+
+	for _, cpu := range l.cpus {
+		fds, ok := l.fds[cpu]
+		if !ok {
+			continue
+		}
+
+		cur := [MaxLicenseLevels]uint64{}
+		for level, fd := range fds {
+			cur[level] = readEvent(fd)
+		}
+
+		if prev, ok := l.prev[cpu]; ok && !l.last.IsZero() {
+			counts := [MaxLicenseLevels]uint64{}
+			for level := range cur {
+				if cur[level] >= prev[level] {
+					counts[level] = cur[level] - prev[level]
+				}
+			}
+			r := l.res[cpu]
+			r.Source = LicenseSourcePerf
+			r.add(counts, interval)
+			l.res[cpu] = r
+		}
+		l.prev[cpu] = cur
+	}
+	l.last = now
+}
+
+// License returns the license residency of the CPU
+func (l *LicenseCollector) License(cpu int) LicenseResidency {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.res[cpu]
+}
@@ -162,75 +162,3 @@ type HeaderData struct {
 type Header struct {
 	Data HeaderData `json:"/pcm/header"`
 }
-
-// CPU Model IDs
-const (
-	NehalemEPModel       = 26
-	NehalemModel         = 30
-	AtomModel            = 28
-	Atom2Model           = 53
-	AtomCentertonModel   = 54
-	AtomBaytrailModel    = 55
-	AtomAvotonModel      = 77
-	AtomCherrytrailModel = 76
-	AtomApolloLakeModel  = 92
-	AtomDenvertonModel   = 95
-	ClarkdaleModel       = 37
-	WestmereEPModel      = 44
-	NehalemEXModel       = 46
-	WestmereEXModel      = 47
-	SandyBridgeModel     = 42
-	JaketownModel        = 45
-	IvyBridgeModel       = 58
-	HaswellModel         = 60
-	HaswellULTModel      = 69
-	Haswell2MNodel       = 70
-	IvytownModel         = 62
-	HaswellxModel        = 63
-	BroadwellModel       = 61
-	BroadwellXeonE3Model = 71
-	BDXDEModel           = 86
-	SklUYMdel            = 78
-	KBLModel             = 158
-	KBL1Model            = 142
-	BDXModel             = 79
-	KNLModel             = 87
-	SKLModel             = 94
-	SKXModel             = 85
-)
-
-// CPUModels is a list of known Intel CPU Ids
-var CPUModels = map[int]string{
-	NehalemEPModel:       "Nehalem EP",
-	NehalemModel:         "Nehalem",
-	AtomModel:            "Atom",
-	Atom2Model:           "Atom2",
-	AtomCentertonModel:   "Atom Centerton",
-	AtomBaytrailModel:    "Atom Baytrail",
-	AtomAvotonModel:      "Atom Avoton",
-	AtomCherrytrailModel: "Atom Cherrytrail",
-	AtomApolloLakeModel:  "Atom Apollo Lake",
-	AtomDenvertonModel:   "Atom Denverton",
-	ClarkdaleModel:       "Clarkdale",
-	WestmereEPModel:      "Westmere EP",
-	NehalemEXModel:       "Nehalem EX",
-	WestmereEXModel:      "Westmere EX",
-	SandyBridgeModel:     "Sandy Bridge",
-	JaketownModel:        "Jaketown",
-	IvyBridgeModel:       "Ivy Bridge",
-	HaswellModel:         "Haswell",
-	HaswellULTModel:      "Haswell ULT",
-	Haswell2MNodel:       "Haswell 2",
-	IvytownModel:         "Ivytown",
-	HaswellxModel:        "Hasewell X",
-	BroadwellModel:       "Broadwell",
-	BroadwellXeonE3Model: "Broadwell Xeon E3",
-	BDXDEModel:           "BDX DE",
-	SklUYMdel:            "SKL UY",
-	KBLModel:             "KBL",
-	KBL1Model:            "KBL 1",
-	BDXModel:             "Broadwell",
-	KNLModel:             "KNL",
-	SKLModel:             "Skylake",
-	SKXModel:             "SKX",
-}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const cpuInfoSPR = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 143
+model name	: Intel(R) Xeon(R) Platinum 8480+
+stepping	: 8
+flags		: fpu vme de pse tsc msr avx2 avx512f rdt_a cqm_llc
+
+processor	: 1
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 85
+stepping	: 4
+`
+
+func TestParseCPUInfo(t *testing.T) {
+
+	c, err := ParseCPUInfo(strings.NewReader(cpuInfoSPR))
+	if err != nil {
+		t.Fatalf("ParseCPUInfo failed: %v", err)
+	}
+	if c.Family != 6 || c.Model != SPRModel || c.Stepping != 8 {
+		t.Errorf("signature %s, want 6/143/8", c.Signature())
+	}
+	if c.Arch.Name != "Sapphire Rapids" {
+		t.Errorf("microarch %q, want Sapphire Rapids", c.Arch.Name)
+	}
+	if c.Interconnect() != "UPI" || !c.Has(FeatureAVX512|FeatureRDT|FeaturePBF) {
+		t.Errorf("features %v missing UPI, AVX512, RDT or SST-BF", c.FeatureList())
+	}
+
+	if _, err := ParseCPUInfo(strings.NewReader("processor : 0\n")); err == nil {
+		t.Errorf("ParseCPUInfo should fail without vendor or model")
+	}
+}
+
+func TestCPUInfoFlagsOverride(t *testing.T) {
+
+	// Hypervisor hiding AVX-512 on an Ice Lake server
+	info := "vendor_id : GenuineIntel\ncpu family : 6\nmodel : 106\nstepping : 6\nflags : avx2\n"
+
+	c, err := ParseCPUInfo(strings.NewReader(info))
+	if err != nil {
+		t.Fatalf("ParseCPUInfo failed: %v", err)
+	}
+	if c.Has(FeatureAVX512) {
+		t.Errorf("AVX512 should be disabled by the cpuinfo flags")
+	}
+	if !c.Has(FeatureAVX2 | FeatureUPI) {
+		t.Errorf("features %v missing AVX2 or UPI", c.FeatureList())
+	}
+}
+
+func TestDecodeSignature(t *testing.T) {
+
+	tests := []struct {
+		eax      uint32
+		family   int
+		model    int
+		stepping int
+		name     string
+		intercon string
+	}{
+		{0x00050654, 6, SKXModel, 4, "Skylake-SP", "UPI"},
+		{0x00050657, 6, SKXModel, 7, "Cascade Lake-SP", "UPI"},
+		{0x0005065B, 6, SKXModel, 11, "Cooper Lake", "UPI"},
+		{0x000606A6, 6, ICXModel, 6, "Ice Lake-SP", "UPI"},
+		{0x000806F8, 6, SPRModel, 8, "Sapphire Rapids", "UPI"},
+		{0x00080665, 6, AtomSnowRidgeModel, 5, "Snow Ridge", ""},
+		{0x000406F1, 6, BDXModel, 1, "Broadwell-EP/EX", "QPI"},
+		{0x00050663, 6, BDXDEModel, 3, "Broadwell-DE", ""},
+		{0x00A00F11, 25, 1, 1, "Family 25", ""},
+	}
+
+	for _, tt := range tests {
+		c := DecodeSignature(IntelVendor, tt.eax)
+		if c.Family != tt.family || c.Model != tt.model || c.Stepping != tt.stepping {
+			t.Errorf("%#08x: got %s, want %d/%d/%d", tt.eax, c.Signature(),
+				tt.family, tt.model, tt.stepping)
+		}
+		if c.Arch.Name != tt.name {
+			t.Errorf("%#08x: got %q, want %q", tt.eax, c.Arch.Name, tt.name)
+		}
+		if c.Interconnect() != tt.intercon {
+			t.Errorf("%#08x: interconnect %q, want %q", tt.eax, c.Interconnect(), tt.intercon)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		data  CoreCounterData
+		bound Bound
+	}{
+		{"idle", CoreCounterData{}, BoundUnknown},
+		{"retiring", CoreCounterData{Cycles: 1e9, InstructionsRetired: 3e9,
+			InstructionsPerCycle: 3.0, Branches: 1e8, BranchMispredicts: 1e5}, BoundRetiring},
+		{"memory", CoreCounterData{Cycles: 1e9, InstructionsRetired: 3e8,
+			L2CacheMisses: 8e6, L3CacheMisses: 5e6}, BoundMemory},
+		{"badspec", CoreCounterData{Cycles: 1e9, InstructionsRetired: 8e8,
+			Branches: 2e8, BranchMispredicts: 25e6}, BoundBadSpeculation},
+		{"frontend", CoreCounterData{Cycles: 1e9, InstructionsRetired: 8e8,
+			Branches: 2e8, BranchMispredicts: 1e5}, BoundFrontend},
+	}
+
+	for _, tt := range tests {
+		td := Classify(&tt.data)
+		if td.Bound != tt.bound {
+			t.Errorf("%s: bound %v, want %v (%+v)", tt.name, td.Bound, tt.bound, td)
+		}
+		if tt.bound == BoundUnknown {
+			continue
+		}
+		sum := td.Retiring + td.Frontend + td.BadSpeculation + td.Memory
+		if sum < 0.999 || sum > 1.001 {
+			t.Errorf("%s: fractions add up to %f", tt.name, sum)
+		}
+		if len(td.Reason) == 0 {
+			t.Errorf("%s: missing reason", tt.name)
+		}
+	}
+}
+
+func TestPerfCoreData(t *testing.T) {
+
+	prev := PerfValues{}
+	prev[PerfCycles] = 1000
+	prev[PerfInstructions] = 500
+
+	cur := PerfValues{}
+	cur[PerfCycles] = 2e9 + 1000
+	cur[PerfInstructions] = 3e9 + 500
+	cur[PerfRefCycles] = 1e9
+	cur[PerfBranches] = 4e8
+	cur[PerfBranchMisses] = 2e6
+	cur[PerfLLCReferences] = 1e7
+	cur[PerfLLCMisses] = 25e5
+
+	c := PerfCoreData(3, 1, perfDelta(cur, prev))
+	if c.CoreID != 3 || c.SocketID != 1 {
+		t.Errorf("core/socket %d/%d", c.CoreID, c.SocketID)
+	}
+	if c.InstructionsPerCycle != 1.5 || c.RelativeFrequency != 2.0 {
+		t.Errorf("IPC %f, frequency %f", c.InstructionsPerCycle, c.RelativeFrequency)
+	}
+	if c.L3CacheHitRatio != 0.75 || c.BranchMispredicts != 2e6 {
+		t.Errorf("hit ratio %f, mispredicts %d", c.L3CacheHitRatio, c.BranchMispredicts)
+	}
+
+	// A counter going backwards counts as zero
+	if d := perfDelta(prev, cur); d[PerfCycles] != 0 {
+		t.Errorf("delta of reopened counter %d", d[PerfCycles])
+	}
+	if v := perfScale(100, 200, 50); v != 400 {
+		t.Errorf("perfScale multiplexed %d", v)
+	}
+	if v := perfScale(100, 200, 0); v != 0 {
+		t.Errorf("perfScale not running %d", v)
+	}
+}
+
+func TestLicenseResidency(t *testing.T) {
+
+	if licenseConfig(LicenseLevel2) != 0x2028 {
+		t.Errorf("level 2 config %#x, want 0x2028", licenseConfig(LicenseLevel2))
+	}
+	if !HasLicenseEvents(&CPUIdent{Family: 6, Model: SKXModel}) || HasLicenseEvents(&CPUIdent{Family: 6, Model: SPRModel}) {
+		t.Errorf("license events only on SKX and ICX")
+	}
+
+	r := LicenseResidency{}
+	r.add([MaxLicenseLevels]uint64{3e9, 1e9, 0}, 2*time.Second)
+	if !r.Valid || r.Percent[LicenseLevel0] != 75.0 || r.Seconds[LicenseLevel1] != 0.5 {
+		t.Errorf("residency %+v", r)
+	}
+	if r.Level != LicenseLevel1 || r.Drops != 1 {
+		t.Errorf("level %d drops %d, want 1 and 1", r.Level, r.Drops)
+	}
+
+	for _, tc := range []struct {
+		busy, max float64
+		want      LicenseLevel
+	}{
+		{3000, 3000, LicenseLevel0},
+		{2800, 3000, LicenseLevel0},
+		{2600, 3000, LicenseLevel1},
+		{2300, 3000, LicenseLevel2},
+		{2300, 0, LicenseLevel0},
+	} {
+		if got := EstimateLicense(tc.busy, tc.max); got != tc.want {
+			t.Errorf("EstimateLicense(%v, %v) = %d, want %d", tc.busy, tc.max, got, tc.want)
+		}
+	}
+
+	// Idle intervals and intervals without a turbo limit are not counted
+	e := NewLicenseEstimator()
+	e.Add(1, 3000, 100, 3000, time.Second)
+	e.Add(1, 1200, 10, 3000, time.Second)
+	e.Add(1, 2300, 90, 3000, time.Second)
+	e.Add(1, 2300, 90, 0, time.Second)
+	if r := e.License(1); r.Seconds[LicenseLevel0] != 1 || r.Seconds[LicenseLevel2] != 1 || r.Source != LicenseSourceEstimate {
+		t.Errorf("estimated residency %+v", r)
+	}
+
+	// The all-core turbo is lower than the single core turbo, the drop as the
+	// other cores become active is not a license change
+	e = NewLicenseEstimator()
+	e.Add(2, 3600, 100, 3600, time.Second)
+	e.Add(2, 2900, 100, 2900, time.Second)
+	e.Add(2, 2850, 100, 2900, time.Second)
+	if r := e.License(2); r.Seconds[LicenseLevel0] != 3 || r.Drops != 0 {
+		t.Errorf("all-core turbo residency %+v", r)
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+// Core counters collected with the Linux perf_event interface when the
+// pcm-info daemon is not running. Only the generic hardware events are used,
+// which gives the IPC, frequency, LLC and branch data of CoreCounterData. The
+// L2, RDT and memory bandwidth data require pcm-info.
+
+// PerfEvent is a generic hardware event counted for each CPU
+type PerfEvent int
+
+// Generic hardware events counted
+const (
+	PerfCycles PerfEvent = iota
+	PerfInstructions
+	PerfRefCycles
+	PerfBranches
+	PerfBranchMisses
+	PerfLLCReferences
+	PerfLLCMisses
+	PerfMaxEvents
+)
+
+// PerfEventNames as used by the perf tool
+var PerfEventNames = map[PerfEvent]string{
+	PerfCycles:        "cycles",
+	PerfInstructions:  "instructions",
+	PerfRefCycles:     "ref-cycles",
+	PerfBranches:      "branches",
+	PerfBranchMisses:  "branch-misses",
+	PerfLLCReferences: "LLC-references",
+	PerfLLCMisses:     "LLC-misses",
+}
+
+// PerfValues of the events for a CPU over a sample period
+type PerfValues [PerfMaxEvents]uint64
+
+// String name of the event
+func (e PerfEvent) String() string {
+	return PerfEventNames[e]
+}
+
+// PerfCoreData converts the event counts of a sample period into the core
+// counter data pcm-info provides.
+func PerfCoreData(cpu int, socket int64, v PerfValues) CoreCounterData {
+
+	c := CoreCounterData{
+		CoreID:              uint64(cpu),
+		SocketID:            socket,
+		Cycles:              v[PerfCycles],
+		InstructionsRetired: v[PerfInstructions],
+		L3CacheMisses:       v[PerfLLCMisses],
+		L3CacheReference:    v[PerfLLCReferences],
+		Branches:            v[PerfBranches],
+		BranchMispredicts:   v[PerfBranchMisses],
+	}
+
+	if c.Cycles > 0 {
+		c.InstructionsPerCycle = float64(c.InstructionsRetired) / float64(c.Cycles)
+	}
+	if v[PerfRefCycles] > 0 {
+		c.RelativeFrequency = float64(c.Cycles) / float64(v[PerfRefCycles])
+		c.ActiveRelativeFrequency = c.RelativeFrequency
+	}
+	if c.L3CacheReference > 0 && c.L3CacheReference >= c.L3CacheMisses {
+		c.L3CacheHitRatio = 1.0 - float64(c.L3CacheMisses)/float64(c.L3CacheReference)
+	}
+	if c.InstructionsRetired > 0 {
+		c.L3CacheMPI = float64(c.L3CacheMisses) / float64(c.InstructionsRetired)
+	}
+
+	return c
+}
+
+// perfDelta returns the counts between two samples, counters that went
+// backwards (reopened) give a zero count.
+func perfDelta(cur, prev PerfValues) PerfValues {
+
+	d := PerfValues{}
+	for i := range cur {
+		if cur[i] >= prev[i] {
+			d[i] = cur[i] - prev[i]
+		}
+	}
+	return d
+}
+
+// perfScale the count when the event was multiplexed with other events
+func perfScale(value, enabled, running uint64) uint64 {
+
+	if running == 0 {
+		return 0
+	}
+	if running >= enabled {
+		return value
+	}
+	return uint64(float64(value) * float64(enabled) / float64(running))
+}
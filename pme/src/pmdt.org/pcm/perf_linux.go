@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// perf_event_open(2) definitions not in the syscall package
+const (
+	perfTypeHardware       uint32  = 0
+	perfFormatTotalEnabled uint64  = 1 << 0
+	perfFormatTotalRunning uint64  = 1 << 1
+	perfFlagFdCloexec      uintptr = 1 << 3
+	perfAttrSize           uint32  = 72 // PERF_ATTR_SIZE_VER1
+	perfReadSize           int     = 24 // value, time_enabled, time_running
+	perfCPUTopologyFile            = "/sys/devices/system/cpu/cpu%d/topology/physical_package_id"
+)
+
+// perfConfig is the PERF_COUNT_HW_* value of each event
+var perfConfig = [PerfMaxEvents]uint64{
+	PerfCycles:        0,
+	PerfInstructions:  1,
+	PerfLLCReferences: 2,
+	PerfLLCMisses:     3,
+	PerfBranches:      4,
+	PerfBranchMisses:  5,
+	PerfRefCycles:     9,
+}
+
+// perfEventAttr is struct perf_event_attr up to config2
+type perfEventAttr struct {
+	Type       uint32
+	Size       uint32
+	Config     uint64
+	Sample     uint64
+	SampleType uint64
+	ReadFormat uint64
+	Bits       uint64
+	Wakeup     uint32
+	BpType     uint32
+	Config1    uint64
+	Config2    uint64
+}
+
+// PerfCollector counts the generic hardware events on each CPU
+type PerfCollector struct {
+	lock    sync.Mutex
+	cpus    []int
+	sockets map[int]int64
+	fds     map[int][PerfMaxEvents]int
+	prev    map[int]PerfValues
+	data    map[int]CoreCounterData
+}
+
+// perfEventOpen counts the event on the CPU for all processes
+func perfEventOpen(attr *perfEventAttr, cpu int) (int, error) {
+
+	pid, group := -1, -1
+
+	fd, _, errno := syscall.Syscall6(syscall.SYS_PERF_EVENT_OPEN,
+		uintptr(unsafe.Pointer(attr)), uintptr(pid), uintptr(cpu),
+		uintptr(group), perfFlagFdCloexec, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// perfSocket returns the socket id of the CPU or 0 if unknown
+func perfSocket(cpu int) int64 {
+
+	dat, err := ioutil.ReadFile(fmt.Sprintf(perfCPUTopologyFile, cpu))
+	if err != nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(dat)), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// NewPerfCollector opens the events on the CPUs, events not supported by the
+// CPU or hypervisor are skipped. Counting system wide needs CAP_PERFMON or
+// kernel.perf_event_paranoid <= 0.
+func NewPerfCollector(cpus []int) (*PerfCollector, error) {
+
+	p := &PerfCollector{
+		cpus:    cpus,
+		sockets: make(map[int]int64),
+		fds:     make(map[int][PerfMaxEvents]int),
+		prev:    make(map[int]PerfValues),
+		data:    make(map[int]CoreCounterData),
+	}
+
+	var lastErr error
+	opened := 0
+	for _, cpu := range cpus {
+		fds := [PerfMaxEvents]int{}
+
+		for e := PerfEvent(0); e < PerfMaxEvents; e++ {
+			attr := perfEventAttr{
+				Type:       perfTypeHardware,
+				Size:       perfAttrSize,
+				Config:     perfConfig[e],
+				ReadFormat: perfFormatTotalEnabled | perfFormatTotalRunning,
+			}
+			fd, err := perfEventOpen(&attr, cpu)
+			if err != nil {
+				lastErr = fmt.Errorf("perf_event_open %s on cpu %d: %v", e, cpu, err)
+			} else {
+				opened++
+			}
+			fds[e] = fd
+		}
+		p.fds[cpu] = fds
+		p.sockets[cpu] = perfSocket(cpu)
+	}
+
+	if opened == 0 {
+		p.Close()
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no CPUs to count")
+		}
+		return nil, lastErr
+	}
+
+	return p, nil
+}
+
+// Close all of the event file descriptors
+func (p *PerfCollector) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for cpu, fds := range p.fds {
+		for _, fd := range fds {
+			if fd >= 0 {
+				syscall.Close(fd)
+			}
+		}
+		delete(p.fds, cpu)
+	}
+}
+
+// readEvent returns the scaled count of the event
+func readEvent(fd int) uint64 {
+
+	if fd < 0 {
+		return 0
+	}
+
+	buf := make([]byte, perfReadSize)
+	if n, err := syscall.Read(fd, buf); err != nil || n != perfReadSize {
+		return 0
+	}
+
+	return perfScale(binary.LittleEndian.Uint64(buf[0:]),
+		binary.LittleEndian.Uint64(buf[8:]), binary.LittleEndian.Uint64(buf[16:]))
+}
+
+// Sample the counters and update the core data with the counts since the
+// previous sample.
+func (p *PerfCollector) Sample() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, cpu := range p.cpus {
+		fds, ok := p.fds[cpu]
+		if !ok {
+			continue
+		}
+
+		cur := PerfValues{}
+		for e, fd := range fds {
+			cur[e] = readEvent(fd)
+		}
+
+		if prev, ok := p.prev[cpu]; ok {
+			p.data[cpu] = PerfCoreData(cpu, p.sockets[cpu], perfDelta(cur, prev))
+		}
+		p.prev[cpu] = cur
+	}
+}
+
+// Core returns the core data of the last sample period
+func (p *PerfCollector) Core(cpu int) (CoreCounterData, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c, ok := p.data[cpu]
+	return c, ok
+}
+
+// NumSockets returns the number of sockets of the CPUs counted
+func (p *PerfCollector) NumSockets() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s := make(map[int64]bool)
+	for _, v := range p.sockets {
+		s[v] = true
+	}
+	return len(s)
+}
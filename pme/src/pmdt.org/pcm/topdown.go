@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package pcm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Derived top-down metrics from the core counters pcm-info provides. The real
+// top-down method needs the TOPDOWN.* events, here the level 1 categories are
+// estimated from IPC, cache misses and branch mispredicts to give a hint of
+// what is limiting a core.
+
+// Bound is the top-down category limiting a core
+type Bound int
+
+// Top-down level 1 categories
+const (
+	BoundUnknown Bound = iota
+	BoundRetiring
+	BoundFrontend
+	BoundBadSpeculation
+	BoundMemory
+)
+
+// BoundNames in string format
+var BoundNames = map[Bound]string{
+	BoundUnknown:        "Unknown",
+	BoundRetiring:       "Retiring",
+	BoundFrontend:       "Frontend",
+	BoundBadSpeculation: "BadSpec",
+	BoundMemory:         "Memory",
+}
+
+// Constants used by the heuristics, the latencies are in core cycles
+const (
+	PipelineWidth     float64 = 4.0   // Number of instructions retired per cycle at best
+	MispredictPenalty float64 = 20.0  // Cycles lost on each branch mispredict
+	L3HitLatency      float64 = 40.0  // Cycles for a L2 miss that hits in L3
+	MemoryLatency     float64 = 200.0 // Cycles for a L3 miss to memory
+	MemoryParallelism float64 = 2.0   // Outstanding misses overlapping each other
+	RetiringThreshold float64 = 0.5   // Above this the core is mostly retiring
+)
+
+// TopDown metrics for a core, the fractions add up to 1.0
+type TopDown struct {
+	Bound          Bound
+	Retiring       float64
+	Frontend       float64
+	BadSpeculation float64
+	Memory         float64
+	MispredictRate float64 // Branch mispredicts per branch
+	L3MissPKI      float64 // L3 misses per thousand instructions
+	Reason         string
+}
+
+// String name of the bound category
+func (b Bound) String() string {
+	return BoundNames[b]
+}
+
+func clampFraction(v float64) float64 {
+	if math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// Classify the core counter data into the top-down level 1 categories
+func Classify(c *CoreCounterData) TopDown {
+
+	td := TopDown{Bound: BoundUnknown}
+
+	if c == nil || c.Cycles == 0 || c.InstructionsRetired == 0 {
+		td.Reason = "core idle or counters not available"
+		return td
+	}
+	cycles := float64(c.Cycles)
+
+	if c.Branches > 0 {
+		td.MispredictRate = float64(c.BranchMispredicts) / float64(c.Branches)
+	}
+	td.L3MissPKI = float64(c.L3CacheMisses) * 1000.0 / float64(c.InstructionsRetired)
+
+	ipc := c.InstructionsPerCycle
+	if ipc == 0 {
+		ipc = float64(c.InstructionsRetired) / cycles
+	}
+	td.Retiring = clampFraction(ipc / PipelineWidth)
+	td.BadSpeculation = clampFraction(float64(c.BranchMispredicts) * MispredictPenalty / cycles)
+
+	l3Hits := float64(0)
+	if c.L2CacheMisses > c.L3CacheMisses {
+		l3Hits = float64(c.L2CacheMisses - c.L3CacheMisses)
+	}
+	stalls := (float64(c.L3CacheMisses)*MemoryLatency + l3Hits*L3HitLatency) / MemoryParallelism
+	td.Memory = clampFraction(stalls / cycles)
+
+	// Whatever is not explained by retiring, speculation or memory stalls is
+	// counted as the front end not delivering instructions.
+	used := td.Retiring + td.BadSpeculation + td.Memory
+	if used > 1.0 {
+		td.Retiring /= used
+		td.BadSpeculation /= used
+		td.Memory /= used
+	} else {
+		td.Frontend = 1.0 - used
+	}
+
+	switch {
+	case td.Retiring >= RetiringThreshold:
+		td.Bound = BoundRetiring
+	case td.Memory >= td.Frontend && td.Memory >= td.BadSpeculation:
+		td.Bound = BoundMemory
+	case td.BadSpeculation >= td.Frontend:
+		td.Bound = BoundBadSpeculation
+	default:
+		td.Bound = BoundFrontend
+	}
+	td.Reason = td.explain()
+
+	return td
+}
+
+// explain what is likely limiting a DPDK lcore in the bound category
+func (td *TopDown) explain() string {
+
+	switch td.Bound {
+	case BoundRetiring:
+		return "retiring efficiently, more throughput needs fewer instructions per packet (vector PMD, larger bursts)"
+	case BoundMemory:
+		return fmt.Sprintf("%.1f L3 misses per 1K instructions, check NUMA locality of mbufs/rings, prefetching and DDIO",
+			td.L3MissPKI)
+	case BoundBadSpeculation:
+		return fmt.Sprintf("%.1f%% branch mispredicts, data dependent branches in the packet path, try branchless code or likely/unlikely hints",
+			td.MispredictRate*100.0)
+	case BoundFrontend:
+		return "instruction fetch/decode stalls, check code footprint, i-cache misses and a busy-poll loop with too many code paths"
+	}
+	return "core idle or counters not available"
+}
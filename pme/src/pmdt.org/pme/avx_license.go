@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"time"
+
+	pbf "pmdt.org/intelpbf"
+	"pmdt.org/pcm"
+	tlog "pmdt.org/ttylog"
+)
+
+// The AVX license level of each CPU is counted with the perf license events
+// when the CPU has them, otherwise it is estimated once a second from the
+// effective frequency. The residency is kept from the start of the tool.
+
+const (
+	licenseTimerName string  = "AVXLicense"
+	licenseActiveC0  float64 = 5.0 // C0 percent of a core counted as active for turbo
+)
+
+// turboCoresModels have the core count of each turbo group in
+// MSR_TURBO_RATIO_LIMIT_CORES
+var turboCoresModels = map[int]bool{
+	pcm.SKXModel: true,
+	pcm.ICXModel: true,
+}
+
+var (
+	licenseCollector *pcm.LicenseCollector
+	licenseEstimator = pcm.NewLicenseEstimator()
+)
+
+// StartLicenseSampler opens the license events or falls back to the estimate.
+// The events are sampled on the last step, the estimate uses the effective
+// frequency of the last second on step 0.
+func StartLicenseSampler() {
+
+	cpus := OnlineCPUs()
+
+	if pcm.HasLicenseEvents(CPUIdent()) {
+		l, err := pcm.NewLicenseCollector(CPUIdent(), cpus)
+		if err != nil {
+			tlog.WarnPrintf("AVX license events not available, estimating: %v\n", err)
+		} else {
+			licenseCollector = l
+		}
+	}
+
+	perfmon.timers.Add(licenseTimerName, func(step int, ticks uint64) {
+		switch {
+		case step == 3 && licenseCollector != nil:
+			licenseCollector.Sample()
+		case step == 0 && licenseCollector == nil:
+			estimateLicenses(cpus)
+		}
+	})
+}
+
+// estimateLicenses from the effective frequency against the turbo limit of
+// the active cores of the package, a throttled CPU runs at a lower frequency
+// for a reason other than its license and is skipped
+func estimateLicenses(cpus []int) {
+
+	topo := Topology()
+
+	// The active cores of each package, a core is active when one of its
+	// threads is active
+	active := make(map[int]map[int]bool)
+	for _, cpu := range cpus {
+		f := EffFreq(cpu)
+		c, ok := topo.CPU(cpu)
+		if !ok || !f.Valid || f.C0Percent < licenseActiveC0 {
+			continue
+		}
+		if active[c.Package] == nil {
+			active[c.Package] = make(map[int]bool)
+		}
+		active[c.Package][c.Core] = true
+	}
+
+	// The turbo limit of each package, not counted if not readable
+	turbo := make(map[int]float64)
+	for pkg, cores := range active {
+		first := topo.FirstCPU(pkg)
+		val, err := pbf.MsrTurboRatioLimit.Read(first)
+		if err != nil {
+			continue
+		}
+		groups := uint64(0)
+		if turboCoresModels[CPUIdent().Model] {
+			if groups, err = pbf.MsrTurboRatioLimitCores.Read(first); err != nil {
+				continue
+			}
+		}
+		turbo[pkg] = float64(pbf.TurboLimitMHz(val, groups, len(cores)))
+	}
+
+	throttling := make(map[int]bool)
+	if temps, err := readTemperatures(); err == nil {
+		for _, tp := range temps {
+			throttling[tp.CPU] = tp.Throttling()
+		}
+	}
+
+	for _, cpu := range cpus {
+		f := EffFreq(cpu)
+		if !f.Valid || throttling[cpu] {
+			continue
+		}
+		licenseEstimator.Add(cpu, f.BusyMHz, f.C0Percent, turbo[CPUSocket(cpu)], time.Second)
+	}
+}
+
+// AVXLicense returns the license residency of the CPU
+func AVXLicense(cpu int) pcm.LicenseResidency {
+
+	if licenseCollector != nil {
+		return licenseCollector.License(cpu)
+	}
+	return licenseEstimator.License(cpu)
+}
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"pmdt.org/devbind"
+)
+
+// The devbind commands run without the panels to save and apply device
+// binding profiles, 'pme devbind apply <profile>' is called at boot by the
+// pme-devbind@.service systemd unit.
+
+// DevbindCommand groups the devbind sub commands
+type DevbindCommand struct{}
+
+// ProfileArgs is the profile name or file given to a command
+type ProfileArgs struct {
+	Profile string `positional-arg-name:"profile" description:"Profile name or TOML file"`
+}
+
+// ApplyCommand applies a binding profile
+type ApplyCommand struct {
+	DryRun bool        `short:"n" long:"dry-run" description:"Show the changes without applying them"`
+	Args   ProfileArgs `positional-args:"yes" required:"yes"`
+}
+
+// DiffCommand shows the changes a binding profile makes
+type DiffCommand struct {
+	Args ProfileArgs `positional-args:"yes" required:"yes"`
+}
+
+// SaveCommand saves the current bindings as a profile
+type SaveCommand struct {
+	Output string      `short:"o" long:"output" description:"Profile file, default is the profile directory"`
+	Args   ProfileArgs `positional-args:"yes" required:"yes"`
+}
+
+// ListCommand lists the saved profiles
+type ListCommand struct{}
+
+func init() {
+	parser.SubcommandsOptional = true
+
+	cmd, err := parser.AddCommand("devbind", "Device binding profiles",
+		"Save, show and apply device binding profiles without starting the panels", &DevbindCommand{})
+	if err != nil {
+		panic(err)
+	}
+	cmd.SubcommandsOptional = false
+
+	cmd.AddCommand("apply", "Apply a binding profile",
+		"Create the VFs and bind the devices of the profile, used at boot", &ApplyCommand{})
+	cmd.AddCommand("diff", "Show the changes of a binding profile",
+		"Show the changes applying the profile makes to the current bindings", &DiffCommand{})
+	cmd.AddCommand("save", "Save the current bindings",
+		"Save the VFs and the devices bound to DPDK drivers as a profile", &SaveCommand{})
+	cmd.AddCommand("list", "List the binding profiles",
+		"List the profiles in the profile directories", &ListCommand{})
+}
+
+// printPlan prints the changes and errors of a profile, returns an error
+// if any of the changes failed.
+func printPlan(p *devbind.Profile, changes []devbind.Change, errs []error) error {
+
+	if len(changes) == 0 {
+		fmt.Printf("  no changes\n")
+	}
+	for _, c := range changes {
+		fmt.Printf("  %s\n", c)
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "  error: %v\n", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("profile %s: %d errors", p.Name, len(errs))
+	}
+	return nil
+}
+
+// Execute the apply command
+func (c *ApplyCommand) Execute(args []string) error {
+
+	p, err := devbind.LoadProfile(c.Args.Profile)
+	if err != nil {
+		return err
+	}
+	db := devbind.New(options.Devices...)
+
+	if c.DryRun {
+		fmt.Printf("Profile %s changes:\n", p.Name)
+		changes, errs := db.Plan(p)
+		return printPlan(p, changes, errs)
+	}
+
+	fmt.Printf("Profile %s applied:\n", p.Name)
+	changes, errs := db.Apply(p)
+	return printPlan(p, changes, errs)
+}
+
+// Execute the diff command
+func (c *DiffCommand) Execute(args []string) error {
+
+	return (&ApplyCommand{DryRun: true, Args: c.Args}).Execute(args)
+}
+
+// Execute the save command
+func (c *SaveCommand) Execute(args []string) error {
+
+	db := devbind.New(options.Devices...)
+
+	file := c.Output
+	if len(file) == 0 {
+		file = devbind.ProfileFile(c.Args.Profile)
+	}
+
+	p := db.CurrentProfile(c.Args.Profile)
+	if err := p.Save(file); err != nil {
+		return err
+	}
+	fmt.Printf("Profile %s saved to %s with %d devices\n", p.Name, file, len(p.Devices))
+
+	return nil
+}
+
+// Execute the list command
+func (c *ListCommand) Execute(args []string) error {
+
+	for _, name := range devbind.ProfileNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"sort"
+	"sync"
+
+	pbf "pmdt.org/intelpbf"
+	tlog "pmdt.org/ttylog"
+)
+
+// The governor, frequency range and C-state settings of a CPU are saved the
+// first time the PBF panel changes them and restored when the tool exits.
+
+var (
+	cpuSettingsLock sync.Mutex
+	cpuSettings     = make(map[int]pbf.CPUSettings)
+)
+
+// saveCPUSettings saves the settings of the CPUs not saved yet
+func saveCPUSettings(cpus []int) {
+	cpuSettingsLock.Lock()
+	defer cpuSettingsLock.Unlock()
+
+	for _, cpu := range cpus {
+		if _, ok := cpuSettings[cpu]; ok {
+			continue
+		}
+		s, err := pbf.ReadCPUSettings(cpu)
+		if err != nil {
+			tlog.WarnPrintf("Unable to save CPU settings: %v\n", err)
+			continue
+		}
+		cpuSettings[cpu] = s
+	}
+}
+
+// savedCPUs returns the CPUs with saved settings
+func savedCPUs() []int {
+	cpuSettingsLock.Lock()
+	defer cpuSettingsLock.Unlock()
+
+	cpus := []int{}
+	for cpu := range cpuSettings {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+
+	return cpus
+}
+
+// RestoreCPUSettings restores the saved settings of the CPUs, the first
+// error is returned
+func RestoreCPUSettings() error {
+	cpuSettingsLock.Lock()
+	defer cpuSettingsLock.Unlock()
+
+	var first error
+	for cpu, s := range cpuSettings {
+		if err := s.Restore(); err != nil {
+			tlog.ErrorPrintf("Restore CPU %d settings: %v\n", cpu, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		delete(cpuSettings, cpu)
+	}
+	return first
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"pmdt.org/dpdk"
+)
+
+// Data the DPDK panel shares with the other panels about the selected DPDK
+// application, the other panels only read a copy of the data.
+
+// PortRate is the per second rate of a DPDK port
+type PortRate struct {
+	PortID  uint16
+	Slot    string  // PCI address of the port, empty if not a PCI device
+	RxBytes float64 // Bytes per second received, device writes to memory
+	TxBytes float64 // Bytes per second transmitted, device reads from memory
+	RxPkts  float64
+	TxPkts  float64
+}
+
+// DPDKAppState of the selected DPDK application
+type DPDKAppState struct {
+	Name   string
+	Pid    int
+	Params []string
+	LCores []int
+	Ports  []PortRate
+}
+
+// DPDKShared state protected by a lock
+type DPDKShared struct {
+	lock sync.Mutex
+	app  DPDKAppState
+}
+
+// Set the DPDK application state
+func (s *DPDKShared) Set(app DPDKAppState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.app = app
+}
+
+// Get a copy of the DPDK application state
+func (s *DPDKShared) Get() DPDKAppState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	app := s.app
+	app.LCores = append([]int{}, s.app.LCores...)
+	app.Ports = append([]PortRate{}, s.app.Ports...)
+
+	return app
+}
+
+// PortBySlot returns the port rate for the PCI slot
+func (app *DPDKAppState) PortBySlot(slot string) (PortRate, bool) {
+
+	for _, p := range app.Ports {
+		if len(p.Slot) > 0 && p.Slot == slot {
+			return p, true
+		}
+	}
+	return PortRate{}, false
+}
+
+// dpdkCmdLine parses the EAL parameters, the telemetry parameters do not
+// include the executable name.
+func dpdkCmdLine(name string, params []string) *dpdk.CmdLineData {
+
+	return dpdk.ParseCmdLine(strings.Join(append([]string{name}, params...), " "))
+}
+
+// PollingLCores returns the lcores of the application that poll, the EAL main
+// lcore does not poll the ports unless it is the only lcore
+func (app *DPDKAppState) PollingLCores() []int {
+
+	if len(app.LCores) <= 1 {
+		return app.LCores
+	}
+
+	main := dpdkCmdLine(app.Name, app.Params).MainLCore()
+	lcores := []int{}
+	for _, c := range app.LCores {
+		if c != main {
+			lcores = append(lcores, c)
+		}
+	}
+	return lcores
+}
+
+// CPUSocket returns the physical package id of the CPU or -1 if unknown
+func CPUSocket(cpu int) int {
+
+	c, _ := Topology().CPU(cpu)
+	return c.Package
+}
+
+// CPUNode returns the NUMA node of the CPU or -1 if unknown
+func CPUNode(cpu int) int {
+
+	c, _ := Topology().CPU(cpu)
+	return c.Node
+}
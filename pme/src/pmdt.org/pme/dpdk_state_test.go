@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPollingLCores(t *testing.T) {
+
+	tests := []struct {
+		params []string
+		want   []int
+	}{
+		{[]string{"-l", "2-4"}, []int{3, 4}},
+		{[]string{"-l", "2-4", "--main-lcore", "3"}, []int{2, 4}},
+		{[]string{"-l", "5"}, []int{5}},
+	}
+
+	for _, tt := range tests {
+		app := DPDKAppState{Name: "dpdk-testpmd", Params: tt.params}
+		app.LCores = dpdkCmdLine(app.Name, app.Params).LCores()
+		if got := app.PollingLCores(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PollingLCores(%v) = %v, want %v", tt.params, got, tt.want)
+		}
+	}
+}
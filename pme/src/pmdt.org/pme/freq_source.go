@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	pbf "pmdt.org/intelpbf"
+	tlog "pmdt.org/ttylog"
+)
+
+// The effective frequency of each CPU is sampled once a second from the
+// APERF, MPERF and TSC counters and shared by the AVX and PBF panels.
+
+const (
+	freqTimerName string = "FreqSampler"
+)
+
+var freqSampler = pbf.NewFreqSampler()
+
+// StartFreqSampler samples the counters on the last step so the panels have
+// the frequency of the last second on step 0. A CPU that can not be read,
+// like a CPU taken offline, has no frequency and the other CPUs are still
+// sampled. The warning is logged when the error changes.
+func StartFreqSampler() {
+
+	cpus := OnlineCPUs()
+
+	lastErr := ""
+	perfmon.timers.Add(freqTimerName, func(step int, ticks uint64) {
+		if step != 3 {
+			return
+		}
+		err := freqSampler.Sample(cpus)
+		if err == nil {
+			lastErr = ""
+			return
+		}
+		if err.Error() != lastErr {
+			tlog.WarnPrintf("Effective frequency not available: %v\n", err)
+			lastErr = err.Error()
+		}
+	})
+}
+
+// EffFreq returns the effective frequency of the CPU over the last second
+func EffFreq(cpu int) pbf.EffFreq {
+
+	return freqSampler.Get(cpu)
+}
@@ -24,6 +24,12 @@ replace pmdt.org/pinfo => ../pinfo
 
 replace pmdt.org/pcm => ../pcm
 
+replace pmdt.org/hugepages => ../hugepages
+
+replace pmdt.org/resctrl => ../resctrl
+
+replace pmdt.org/topology => ../topology
+
 go 1.18
 
 require (
@@ -36,10 +42,13 @@ require (
 	pmdt.org/dpdk v0.0.0-00010101000000-000000000000
 	pmdt.org/etimers v0.0.0-00010101000000-000000000000
 	pmdt.org/graphdata v0.0.0-00010101000000-000000000000
+	pmdt.org/hugepages v0.0.0-00010101000000-000000000000
 	pmdt.org/intelpbf v0.0.0-00010101000000-000000000000
 	pmdt.org/pcm v0.0.0-00010101000000-000000000000
 	pmdt.org/pinfo v0.0.0-00010101000000-000000000000
+	pmdt.org/resctrl v0.0.0-00010101000000-000000000000
 	pmdt.org/taborder v0.0.0-00010101000000-000000000000
+	pmdt.org/topology v0.0.0-00010101000000-000000000000
 	pmdt.org/ttylog v0.0.0-00010101000000-000000000000
 )
 
@@ -8,12 +8,19 @@ import (
 	"os"
 	"sync"
 
-	"github.com/shirou/gopsutil/cpu"
 	cz "pmdt.org/colorize"
+	pbf "pmdt.org/intelpbf"
+	"pmdt.org/pcm"
+	"pmdt.org/topology"
 	tlog "pmdt.org/ttylog"
 )
 
-var numCPUs int
+var (
+	cpuIdentOnce sync.Once
+	cpuIdent     *pcm.CPUIdent
+	cpuTopoOnce  sync.Once
+	cpuTopo      *topology.Topology
+)
 
 // PerfmonInfo returning the basic information string
 func PerfmonInfo(color bool) string {
@@ -29,20 +36,54 @@ func PerfmonInfo(color bool) string {
 		cz.SkyBlue("Copyright © 2019-2020 Intel Corporation"))
 }
 
-// NumCPUs is the number of CPUs in the system (logical cores)
-func NumCPUs() int {
-	var once sync.Once
+// Topology returns the CPU topology read at startup, the panels use it for
+// the list of online CPUs and their labels.
+func Topology() *topology.Topology {
 
-	once.Do(func() {
-		num, err := cpu.Counts(true)
+	cpuTopoOnce.Do(func() {
+		t, err := topology.New()
 		if err != nil {
-			tlog.FatalPrintf("Unable to get number of CPUs: %v", err)
+			tlog.FatalPrintf("Unable to read the CPU topology: %v", err)
 			os.Exit(1)
 		}
-		numCPUs = num
+		cpuTopo = t
+		pbf.SetTopology(t)
+	})
+
+	return cpuTopo
+}
+
+// NumCPUs is one more than the highest CPU id, the CPU ids are not always
+// contiguous or online so use OnlineCPUs for the list of CPUs. Data indexed
+// by the CPU id has NumCPUs entries.
+func NumCPUs() int {
+	return Topology().MaxID() + 1
+}
+
+// OnlineCPUs returns the ids of the online CPUs
+func OnlineCPUs() []int {
+	return Topology().Online()
+}
+
+// CPULabel returns the CPU id with its core type and isolation
+func CPULabel(cpu int) string {
+	return Topology().Label(cpu)
+}
+
+// CPUIdent returns the decoded CPU identification, panels use it to find out
+// which features (QPI/UPI, AVX-512, SST-BF, ...) they can expect.
+func CPUIdent() *pcm.CPUIdent {
+
+	cpuIdentOnce.Do(func() {
+		c, err := pcm.ReadCPUInfo(pcm.CPUInfoFile)
+		if err != nil {
+			tlog.ErrorPrintf("Unable to identify the CPU: %v\n", err)
+			c = &pcm.CPUIdent{Arch: pcm.Microarch{Name: "Unknown"}}
+		}
+		cpuIdent = c
 	})
 
-	return numCPUs
+	return cpuIdent
 }
 
 func sprintf(msg string, w ...interface{}) string {
@@ -96,3 +137,33 @@ func FormatUnits(v uint64, w ...interface{}) string {
 func BitRate(ioPkts, ioBytes uint64) float64 {
 	return float64(((ioPkts * PktOverheadSize) + ioBytes) * 8)
 }
+
+// cpuNames returns the labels of the online CPUs for a CPU select window
+func cpuNames() []interface{} {
+
+	names := make([]interface{}, 0)
+	for _, cpu := range OnlineCPUs() {
+		names = append(names, fmt.Sprintf("%4s", CPULabel(cpu)))
+	}
+	return names
+}
+
+// onlineCPU returns the CPU of the row of a CPU select window
+func onlineCPU(row int) int {
+
+	cpus := OnlineCPUs()
+	if row < 0 || row >= len(cpus) {
+		return cpus[0]
+	}
+	return cpus[row]
+}
+
+// msrUnavailable returns the reason the MSRs can not be read for the panels
+// to show, empty when the MSRs can be read
+func msrUnavailable() string {
+
+	if err := pbf.MsrAvailable(); err != nil {
+		return err.Error()
+	}
+	return ""
+}
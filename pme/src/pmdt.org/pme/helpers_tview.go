@@ -5,6 +5,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -136,3 +137,89 @@ func SetCell(table *tview.Table, row, col int, msg string, a ...interface{}) *tv
 
 	return tableCell
 }
+
+const (
+	confirmPage string = "confirm"
+)
+
+// Confirm asks the user to confirm an action in a modal dialog, the action
+// function is only called when the user selects Yes.
+func Confirm(msg string, action func()) {
+
+	showModal(msg, []string{"Yes", "No"}, func(label string) {
+		if label == "Yes" {
+			action()
+		}
+	})
+}
+
+// Choose asks the user to pick one of the choices in a modal dialog, the
+// action function is not called when the user selects Cancel.
+func Choose(msg string, choices []string, action func(choice string)) {
+
+	buttons := append(append([]string{}, choices...), "Cancel")
+
+	showModal(msg, buttons, func(label string) {
+		if label != "Cancel" && len(label) > 0 {
+			action(label)
+		}
+	})
+}
+
+// showModal displays the modal dialog on top of the current panel
+func showModal(msg string, buttons []string, done func(label string)) {
+
+	pages := perfmon.pages
+	if pages == nil {
+		return
+	}
+
+	// Return focus to the window that had it before the dialog was shown
+	focus := perfmon.app.GetFocus()
+
+	modal := tview.NewModal().
+		SetText(msg).
+		AddButtons(buttons).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			pages.RemovePage(confirmPage)
+			if focus != nil {
+				perfmon.app.SetFocus(focus)
+			}
+			done(buttonLabel)
+		})
+
+	pages.AddPage(confirmPage, modal, false, true)
+	perfmon.app.SetFocus(modal)
+}
+
+// InputValue displays a form to enter a value, the action is called with the
+// value when the user selects OK.
+func InputValue(title, label, initial string, action func(value string)) {
+
+	pages := perfmon.pages
+	if pages == nil {
+		return
+	}
+
+	focus := perfmon.app.GetFocus()
+
+	remove := func() {
+		pages.RemovePage(confirmPage)
+		if focus != nil {
+			perfmon.app.SetFocus(focus)
+		}
+	}
+
+	form := tview.NewForm().
+		AddInputField(label, initial, 0, nil, nil)
+	form.AddButton("OK", func() {
+		value := form.GetFormItem(0).(*tview.InputField).GetText()
+		remove()
+		action(strings.TrimSpace(value))
+	}).AddButton("Cancel", remove).
+		SetCancelFunc(remove)
+	form.SetBorder(true).SetTitle(TitleColor(title))
+
+	pages.AddPage(confirmPage, Center(60, 7, form), true, true)
+	perfmon.app.SetFocus(form)
+}
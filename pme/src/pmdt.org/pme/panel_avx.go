@@ -8,8 +8,10 @@ import (
 
 	"github.com/rivo/tview"
 	cz "pmdt.org/colorize"
+	"pmdt.org/dpdk"
 	"pmdt.org/graphdata"
 	pbf "pmdt.org/intelpbf"
+	"pmdt.org/pcm"
 	tab "pmdt.org/taborder"
 )
 
@@ -36,6 +38,8 @@ type PageAVX struct {
 	turbo1freqs      *graphdata.GraphInfo
 	turbo2freqs      *graphdata.GraphInfo
 	turbo3freqs      *graphdata.GraphInfo
+	temps            []pbf.Temperature // Temperatures of the last sample
+	tempErr          error             // Error reading the temperatures
 }
 
 const (
@@ -72,6 +76,7 @@ func setupAVX() *PageAVX {
 	}
 	pg.turbo3freqs.SetFieldWidth(5)
 
+	pg.selected = onlineCPU(0)
 	pg.selectionChanged = true
 
 	return pg
@@ -101,25 +106,19 @@ func AVXPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	// Select window setup and callback function when selection changes.
 	pg.selectCore = NewSelectWindow(table, "AVX", 0, func(row, col int) {
 
-		if row != pg.selected {
+		if cpu := onlineCPU(row); cpu != pg.selected {
 			pg.selectCore.UpdateItem(row, col)
 
 			pg.selectionChanged = true
 
-			pg.selected = row
+			pg.selected = cpu
 			pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selected)))
 		}
 	})
 
-	names := make([]interface{}, 0)
+	pg.selectCore.AddColumn(-1, cpuNames(), cz.SkyBlueColor)
 
-	for i := 0; i < NumCPUs(); i++ {
-		s := fmt.Sprintf("%4d", i)
-		names = append(names, s)
-	}
-	pg.selectCore.AddColumn(-1, names, cz.SkyBlueColor)
-
-	pg.avxStats = CreateTableView(flex1, "AVX Power Base Frequency (p)", tview.AlignLeft, 0, 2, true)
+	pg.avxStats = CreateTableView(flex1, "AVX License Levels (p)", tview.AlignLeft, 0, 2, true)
 	pg.avxStats.SetFixed(1, 0)
 	pg.avxStats.SetSeparator(tview.Borders.Vertical)
 
@@ -132,9 +131,14 @@ func AVXPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	pg.chart = CreateTextView(flex2, "CPU 0 (C)", tview.AlignLeft, 0, 1, true)
 	flex0.AddItem(flex2, 0, 1, true)
 
+	// Only show the AVX-512 turbo charts as valid if the CPU supports AVX-512
+	avx512 := ""
+	if !CPUIdent().Has(pcm.FeatureAVX512) {
+		avx512 = " - not supported"
+	}
 	pg.turbo1 = CreateTextView(flex3, "Turbo AVX2 Light (1)", tview.AlignLeft, 0, 1, true)
-	pg.turbo2 = CreateTextView(flex3, "Turbo AVX512 Light (2)", tview.AlignLeft, 0, 1, false)
-	pg.turbo3 = CreateTextView(flex3, "Turbo AVX512 Heavy (3)", tview.AlignLeft, 0, 1, false)
+	pg.turbo2 = CreateTextView(flex3, "Turbo AVX512 Light"+avx512+" (2)", tview.AlignLeft, 0, 1, false)
+	pg.turbo3 = CreateTextView(flex3, "Turbo AVX512 Heavy"+avx512+" (3)", tview.AlignLeft, 0, 1, false)
 	flex0.AddItem(flex3, 0, 2, true)
 
 	to.Add(pg.selectCore.table, 'c')
@@ -153,6 +157,9 @@ func AVXPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 		switch step {
 		case 0:
 			pg.collectChartData()
+			if pg.topFlex.HasFocus() {
+				pg.collectTemperatures()
+			}
 		case 1:
 			if pg.topFlex.HasFocus() {
 				perfmon.app.QueueUpdateDraw(func() {
@@ -177,7 +184,7 @@ func (pg *PageAVX) displayAVXPage() {
 		pg.selectionChanged = false
 		pg.avxStats.ScrollToBeginning()
 		pg.chart.ScrollToBeginning()
-		pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selectCore.ItemIndex())))
+		pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selected)))
 		pg.turbo1.ScrollToBeginning()
 		pg.turbo2.ScrollToBeginning()
 		pg.turbo3.ScrollToBeginning()
@@ -188,10 +195,8 @@ func (pg *PageAVX) displayAVXPage() {
 func (pg *PageAVX) collectChartData() {
 
 	for cpu, gd := range pg.freqs.Graphs() {
-		p := pbf.InfoPerCPU(cpu)
-
 		// Append the frequency data to the list for the graphing in a chart
-		gd.AddPoint(float64(p.CurFreq))
+		gd.AddPoint(chartFreq(cpu))
 	}
 
 	for cpu, gd := range pg.turbo1freqs.Graphs() {
@@ -217,32 +222,91 @@ func (pg *PageAVX) collectChartData() {
 
 }
 
-// Display the avxStats data in the table view
+// Read the temperatures of the CPUs, the thermal table shows the read error
+func (pg *PageAVX) collectTemperatures() {
+
+	temps, err := readTemperatures()
+
+	perfmon.app.QueueUpdate(func() {
+		pg.temps = temps
+		pg.tempErr = err
+	})
+}
+
+// levelColor returns the percent colored by the license level
+func levelColor(level pcm.LicenseLevel, pct float64) string {
+
+	switch {
+	case pct == 0:
+		return cz.SkyBlue(pct, 0, 1)
+	case level == pcm.LicenseLevel2:
+		return cz.Red(pct, 0, 1)
+	case level == pcm.LicenseLevel1:
+		return cz.Orange(pct, 0, 1)
+	}
+	return cz.LightGreen(pct, 0, 1)
+}
+
+// Display the time each CPU spent at each AVX license level, the lcores of a
+// DPDK application are shown in yellow
 func (pg *PageAVX) displayAVX(view *tview.Table) {
 
+	lcores := perfmon.dpdkApp.Get().LCores
+
 	// create the headers for each column
-	SetCell(pg.avxStats, 0, 0, cz.Orange("CPU", 4))
-	SetCell(pg.avxStats, 0, 1, cz.Orange("128BLight", 6))
-	SetCell(pg.avxStats, 0, 2, cz.Orange("128BHeavy", 6))
-	SetCell(pg.avxStats, 0, 3, cz.Orange("256BLight", 6))
-	SetCell(pg.avxStats, 0, 4, cz.Orange("256BHeavy", 6))
-	SetCell(pg.avxStats, 0, 3, cz.Orange("512BLight", 6))
-	SetCell(pg.avxStats, 0, 4, cz.Orange("512BHeavy", 6))
-
-	// For the number of CPUs display the data one CPU per line
-	for i := 0; i < NumCPUs(); i++ {
-		//p := pbf.AVXInfoPerCPU(i)
-
-		SetCell(pg.avxStats, i+1, 0, cz.LightGreen(i))
-		/*
-			SetCell(pg.avxStats, i+1, 1, cz.SkyBlue(p.128BLight))
-			SetCell(pg.avxStats, i+1, 2, cz.SkyBlue(p.128BHeavy))
-			SetCell(pg.avxStats, i+1, 3, cz.LightGreen(p.256BLight))
-			SetCell(pg.avxStats, i+1, 4, cz.CornSilk(p.256BHeavy))
-			SetCell(pg.avxStats, i+1, 3, cz.LightGreen(p.512BLight))
-			SetCell(pg.avxStats, i+1, 4, cz.CornSilk(p.512BHeavy))
-		*/
+	SetCell(view, 0, 0, cz.Orange("CPU", 4))
+	SetCell(view, 0, 1, cz.Orange("Level", 5))
+	col := 2
+	for l := pcm.LicenseLevel0; l < pcm.MaxLicenseLevels; l++ {
+		SetCell(view, 0, col, cz.Orange(pcm.LicenseNames[l]+" %"))
+		SetCell(view, 0, col+int(pcm.MaxLicenseLevels), cz.Orange(fmt.Sprintf("L%d Secs", l)))
+		col++
+	}
+	SetCell(view, 0, 2+2*int(pcm.MaxLicenseLevels), cz.Orange("Drops"))
 
+	source := ""
+
+	// For the online CPUs display the data one CPU per line
+	for n, i := range OnlineCPUs() {
+		r := AVXLicense(i)
+		row := n + 1
+
+		if dpdk.IsLCoreUsed(i, lcores) {
+			SetCell(view, row, 0, cz.Yellow(CPULabel(i)+" lcore"))
+		} else {
+			SetCell(view, row, 0, cz.LightGreen(CPULabel(i)))
+		}
+		if !r.Valid {
+			for col := 1; col <= 2+2*int(pcm.MaxLicenseLevels); col++ {
+				SetCell(view, row, col, cz.SkyBlue("-"))
+			}
+			continue
+		}
+		source = r.Source
+
+		level := fmt.Sprintf("L%d", r.Level)
+		switch r.Level {
+		case pcm.LicenseLevel2:
+			level = cz.Red(level)
+		case pcm.LicenseLevel1:
+			level = cz.Orange(level)
+		default:
+			level = cz.LightGreen(level)
+		}
+		SetCell(view, row, 1, level)
+		for l := pcm.LicenseLevel0; l < pcm.MaxLicenseLevels; l++ {
+			SetCell(view, row, 2+int(l), levelColor(l, r.Percent[l]))
+			SetCell(view, row, 2+int(pcm.MaxLicenseLevels)+int(l), cz.CornSilk(r.Seconds[l], 0, 0))
+		}
+		drops := cz.LightGreen(r.Drops)
+		if r.Drops > 0 {
+			drops = cz.Orange(r.Drops)
+		}
+		SetCell(view, row, 2+2*int(pcm.MaxLicenseLevels), drops)
+	}
+
+	if source != "" {
+		view.SetTitle(TitleColor(fmt.Sprintf("AVX License Levels, %s (p)", source)))
 	}
 }
 
@@ -253,23 +317,45 @@ func (pg *PageAVX) displayAVXTherm(view *tview.Table) {
 	SetCell(pg.avxThermal, 0, 0, cz.Orange("CPU", 4))
 	SetCell(pg.avxThermal, 0, 1, cz.Orange("Busy Core Mhz", 6))
 	SetCell(pg.avxThermal, 0, 2, cz.Orange("Avg Core Mhz", 6))
-	SetCell(pg.avxThermal, 0, 3, cz.Orange("Core Temp", 6))
-	SetCell(pg.avxThermal, 0, 4, cz.Orange("Pkg Temp", 10))
-
-	//avx.mPerf = ReadMPerf(cpu)
-	//avx.aPerf = ReadAPerf(cpu)
-	//avx.thermStatus = ReadThermStatus(cpu)
-	//avx.pkgThermStatus = ReadPkgThermStatus(cpu)
-
-	// For the number of CPUs display the data one CPU per line
-	for i := 0; i < NumCPUs(); i++ {
-		p := pbf.AVXInfoPerCPU(i)
-
-		SetCell(pg.avxThermal, i+1, 0, cz.LightGreen(i))
-		SetCell(pg.avxThermal, i+1, 1, cz.SkyBlue(p.MPerf))
-		SetCell(pg.avxThermal, i+1, 2, cz.SkyBlue(p.APerf))
-		SetCell(pg.avxThermal, i+1, 3, cz.LightGreen(p.ThermStatus))
-		SetCell(pg.avxThermal, i+1, 4, cz.CornSilk(p.PkgThermStatus))
+	SetCell(pg.avxThermal, 0, 3, cz.Orange("C0 %", 6))
+	SetCell(pg.avxThermal, 0, 4, cz.Orange("Core Temp", 6))
+	SetCell(pg.avxThermal, 0, 5, cz.Orange("Pkg Temp", 10))
+
+	title := "AVX Thermal & Busy Freq"
+	if msg := msrUnavailable(); msg != "" {
+		title += " - " + msg
+	} else if pg.tempErr != nil {
+		title += " - " + pg.tempErr.Error()
+	}
+	view.SetTitle(TitleColor(title + " (t)"))
+
+	temps := make(map[int]pbf.Temperature)
+	for _, t := range pg.temps {
+		temps[t.CPU] = t
+	}
+
+	// For the online CPUs display the data one CPU per line
+	for n, i := range OnlineCPUs() {
+		f := EffFreq(i)
+		row := n + 1
+
+		SetCell(pg.avxThermal, row, 0, cz.LightGreen(CPULabel(i)))
+		if f.Valid {
+			SetCell(pg.avxThermal, row, 1, cz.SkyBlue(f.BusyMHz, 0, 0))
+			SetCell(pg.avxThermal, row, 2, cz.SkyBlue(f.AvgMHz, 0, 0))
+			SetCell(pg.avxThermal, row, 3, cz.SkyBlue(f.C0Percent, 0, 1))
+		} else {
+			for col := 1; col <= 3; col++ {
+				SetCell(pg.avxThermal, row, col, cz.SkyBlue("-"))
+			}
+		}
+		if t, ok := temps[i]; ok {
+			SetCell(pg.avxThermal, row, 4, tempColor(t.CoreC, t.TjMax))
+			SetCell(pg.avxThermal, row, 5, tempColor(t.PkgC, t.TjMax))
+		} else {
+			SetCell(pg.avxThermal, row, 4, cz.SkyBlue("-"))
+			SetCell(pg.avxThermal, row, 5, cz.SkyBlue("-"))
+		}
 
 	}
 }
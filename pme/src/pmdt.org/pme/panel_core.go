@@ -27,6 +27,7 @@ type PageCore struct {
 	CoreSystem       *tview.Table
 	Core             *tview.Table
 	CoreCharts       [2]*tview.TextView
+	topDown          *tview.Table
 	chart            *tview.Table
 	selected         int
 	selectionChanged bool
@@ -34,6 +35,8 @@ type PageCore struct {
 	system pcm.System
 	header pcm.Header
 	valid  bool
+	source string // Source of the core counters
+	cores  []pcm.CoreCounterData
 
 	charts                 *graphdata.GraphInfo
 	ipc                    *graphdata.GraphInfo
@@ -53,7 +56,7 @@ func init() {
 // setupCore - setup and init the main page
 func setupCore() *PageCore {
 
-	pg := &PageCore{pcmRunning: false}
+	pg := &PageCore{pcmRunning: false, selected: onlineCPU(0)}
 
 	// create "graph" for each core
 	pg.charts = graphdata.NewGraph(NumCPUs() * 2)
@@ -90,29 +93,27 @@ func CorePanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	// Select window setup and callback function when selection changes.
 	pg.selectCore = NewSelectWindow(table, "CoreCounters", 0, func(row, col int) {
 
-		if row != pg.selected {
+		if cpu := onlineCPU(row); cpu != pg.selected {
 			pg.selectCore.UpdateItem(row, col)
 
 			pg.selectionChanged = true
 
-			pg.selected = row
+			pg.selected = cpu
 			// pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (c)", pg.selected)))
 		}
 	})
 
-	names := make([]interface{}, 0)
-
-	for i := 0; i < NumCPUs(); i++ {
-		s := fmt.Sprintf("%4d", i)
-		names = append(names, s)
-	}
-	pg.selectCore.AddColumn(-1, names, cz.SkyBlueColor)
+	pg.selectCore.AddColumn(-1, cpuNames(), cz.SkyBlueColor)
 
 	pg.CoreCharts[0] = CreateTextView(flex2, "IPC Chart (2)", tview.AlignLeft, 0, 1, true)
 	pg.CoreCharts[1] = CreateTextView(flex2, "Cycles Chart (3)", tview.AlignLeft, 0, 1, true)
 
 	flex1.AddItem(flex2, 0, 2, true)
 
+	// Top-down classification of each core with a hint of what is limiting it
+	pg.topDown = CreateTableView(flex1, "Top-Down (5)", tview.AlignLeft, 0, 3, true)
+	pg.topDown.SetSeparator(tview.Borders.Vertical)
+
 	flex0.AddItem(flex1, 0, 2, true)
 
 	// Core range selection window to display counters
@@ -154,6 +155,7 @@ func CorePanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	to.Add(pg.CoreCharts[1], '3')
 	//to.Add(pg.selectCoreRange.table, 'r')
 	to.Add(pg.Core, '4')
+	to.Add(pg.topDown, '5')
 
 	to.SetInputDone()
 
@@ -183,6 +185,7 @@ func (pg *PageCore) displayCorePage(step int, ticks uint64) {
 		pg.collectData()
 		pg.displayCoreSystem(pg.CoreSystem)
 		pg.displayCore(pg.Core)
+		pg.displayTopDown(pg.topDown)
 		//pg.displayCharts()
 		pg.displayCharts(pg.CoreCharts[0], 0, 0)
 		pg.displayCharts(pg.CoreCharts[1], 1, 1)
@@ -191,17 +194,22 @@ func (pg *PageCore) displayCorePage(step int, ticks uint64) {
 
 func (pg *PageCore) staticCoreData() {
 
-	if pg.valid == false {
-		if err := perfmon.pinfoPCM.Unmarshal(nil, "/pcm/system", &pg.system); err != nil {
+	// Read the data again when pcm-info is started or stopped
+	if pg.valid == false || pg.source != PCMSource() {
+		if err := PCMSystem(&pg.system); err != nil {
 			tlog.ErrorPrintf("Unable to get PCM system information\n")
 			return
 		}
 
-		if err := perfmon.pinfoPCM.Unmarshal(nil, "/pcm/header", &pg.header); err != nil {
-			tlog.ErrorPrintf("Unable to get PCM header information\n")
-			return
+		pg.header = pcm.Header{}
+		if pcmConnected() {
+			if err := perfmon.pinfoPCM.Unmarshal(nil, "/pcm/header", &pg.header); err != nil {
+				tlog.ErrorPrintf("Unable to get PCM header information\n")
+				return
+			}
 		}
 
+		pg.source = PCMSource()
 		pg.valid = true
 	}
 }
@@ -221,7 +229,7 @@ func (pg *PagePBF) collectChartData() {
 func (pg *PageCore) collectData() {
 
 	core := pcm.CoreCounters{}
-	if err := perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", pg.selected), &core); err != nil {
+	if err := PCMCore(pg.selected, &core); err != nil {
 		tlog.ErrorPrintf("Unable to get PCM system information\n")
 		return
 	}
@@ -255,11 +263,12 @@ func (pg *PageCore) displayCoreSystem(view *tview.Table) {
 
 	SetCell(view, 0, 0, fmt.Sprintf("%s %s", cz.Wheat("PCM Version", 12), cz.SkyBlue(hdr.Version)), tview.AlignLeft)
 	SetCell(view, 0, 1, fmt.Sprintf("%s %sms", cz.Wheat("PollRate", 12), cz.SkyBlue(hdr.PollMs)), tview.AlignLeft)
-	SetCell(view, 0, 2, fmt.Sprintf("%s %s", cz.Wheat("CPU Model", 12), cz.SkyBlue(pcm.CPUModel(int(sys.CPUModel)))), tview.AlignLeft)
+	SetCell(view, 0, 2, fmt.Sprintf("%s %s", cz.Wheat("CPU Model", 12), cz.SkyBlue(CPUIdent())), tview.AlignLeft)
+	SetCell(view, 0, 3, fmt.Sprintf("%s %s", cz.Wheat("Counters", 12), cz.SkyBlue(pg.source)), tview.AlignLeft)
 
 	SetCell(view, 1, 0, fmt.Sprintf("%s %s", cz.Wheat("NumCores", 12), cz.SkyBlue(sys.NumOfCores)), tview.AlignLeft)
 	SetCell(view, 1, 1, fmt.Sprintf("%s %s", cz.Wheat("Online", 12), cz.SkyBlue(sys.NumOfOnlineCores)), tview.AlignLeft)
-	SetCell(view, 1, 2, fmt.Sprintf("%s %s", cz.Wheat("CoreLinks", 12), cz.SkyBlue(sys.NumOfQPILinksPerSocket)), tview.AlignLeft)
+	SetCell(view, 1, 2, fmt.Sprintf("%s %s", cz.Wheat(CPUIdent().Interconnect()+"Links", 12), cz.SkyBlue(sys.NumOfQPILinksPerSocket)), tview.AlignLeft)
 	SetCell(view, 1, 3, fmt.Sprintf("%s %s", cz.Wheat("NumSockets", 12), cz.SkyBlue(sys.NumOfSockets)), tview.AlignLeft)
 	SetCell(view, 1, 4, fmt.Sprintf("%s %s", cz.Wheat("Online", 12), cz.SkyBlue(sys.NumOfOnlineSockets)), tview.AlignLeft)
 
@@ -271,8 +280,11 @@ func (pg *PageCore) displayCoreSystem(view *tview.Table) {
 
 func (pg *PageCore) displayCore(view *tview.Table) {
 
-	p := perfmon.pinfoPCM.ConnectionList()
-	if len(p) == 0 {
+	// The top-down rows are cleared when there are no counters
+	pg.cores = pg.cores[:0]
+
+	// The counters come from pcm-info or the perf_event fallback
+	if PCMSource() == "none" {
 		return
 	}
 
@@ -294,12 +306,13 @@ func (pg *PageCore) displayCore(view *tview.Table) {
 	for i, j := 0, row; i < num; i++ {
 
 		data := pcm.CoreCounters{}
-		if err := perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", i), &data); err != nil {
+		if err := PCMCore(i, &data); err != nil {
 			tlog.ErrorPrintf("Unable to get PCM system information\n")
 			return
 		}
 
 		core := data.Data
+		pg.cores = append(pg.cores, core)
 
 		SetCell(view, j+0, col, cz.Orange(fmt.Sprintf("%d/%d", core.CoreID, core.SocketID)))
 
@@ -336,6 +349,49 @@ func (pg *PageCore) displayCore(view *tview.Table) {
 	}
 }
 
+// boundColor returns the colorized name of the top-down bound category
+func boundColor(b pcm.Bound) string {
+
+	switch b {
+	case pcm.BoundRetiring:
+		return cz.LightGreen(b.String(), -9)
+	case pcm.BoundFrontend:
+		return cz.Yellow(b.String(), -9)
+	case pcm.BoundBadSpeculation:
+		return cz.Orange(b.String(), -9)
+	case pcm.BoundMemory:
+		return cz.Red(b.String(), -9)
+	}
+	return cz.Wheat(b.String(), -9)
+}
+
+// Display the top-down classification of each core collected by displayCore
+func (pg *PageCore) displayTopDown(view *tview.Table) {
+
+	for i, t := range []string{"Core/Socket", "Bound", "Retire%", "FrontEnd%", "BadSpec%", "Memory%", "Likely limited by"} {
+		SetCell(view, 0, i, cz.Wheat(t), tview.AlignLeft)
+	}
+
+	for i := range pg.cores {
+		core := &pg.cores[i]
+		td := pcm.Classify(core)
+		row := i + 1
+
+		SetCell(view, row, 0, cz.Orange(fmt.Sprintf("%d/%d", core.CoreID, core.SocketID)), tview.AlignLeft)
+		SetCell(view, row, 1, boundColor(td.Bound), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(td.Retiring*100.0, 7, 1))
+		SetCell(view, row, 3, cz.SkyBlue(td.Frontend*100.0, 9, 1))
+		SetCell(view, row, 4, cz.SkyBlue(td.BadSpeculation*100.0, 8, 1))
+		SetCell(view, row, 5, cz.SkyBlue(td.Memory*100.0, 7, 1))
+		SetCell(view, row, 6, cz.CornSilk(td.Reason), tview.AlignLeft)
+	}
+
+	row := len(pg.cores) + 1
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
 func (pg *PageCore) displayCharts(view *tview.TextView, start, end int) {
 
 	view.SetText(pg.charts.MakeChart(view, start, end))
@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"pmdt.org/dpdk"
+	pbf "pmdt.org/intelpbf"
+
+	cz "pmdt.org/colorize"
+	tab "pmdt.org/taborder"
+	tlog "pmdt.org/ttylog"
+)
+
+// Display the C-state residency of each CPU as a heatmap of the idle time
+// and a table of the residency of each state, with the package C-state
+// residency from the MSRs. The lcores of a DPDK application poll and should
+// never be idle, any idle time on a polling lcore is shown in red. The EAL
+// main lcore is not flagged when the application has other lcores.
+
+// PageCStates - Data for the C-States panel
+type PageCStates struct {
+	tabOrder *tab.Tab
+	topFlex  *tview.Flex
+	heatmap  *tview.Table
+	cpus     *tview.Table
+	packages *tview.Table
+	note     *tview.TextView
+
+	sampler *pbf.ResidencySampler
+	pkgCPUs map[int]int // Package to the CPU used to read its MSRs
+	pkgErr  error
+	err     error
+}
+
+const (
+	cstatesPanelName string = "C-States"
+	heatmapColumns   int    = 16
+)
+
+// Setup and create the C-States page structure
+func setupCStates() *PageCStates {
+
+	pg := &PageCStates{}
+
+	pg.sampler = pbf.NewResidencySampler()
+
+	pg.pkgCPUs = make(map[int]int)
+	for _, pkg := range Topology().Packages() {
+		pg.pkgCPUs[pkg] = Topology().FirstCPU(pkg)
+	}
+
+	return pg
+}
+
+// CStatesPanelSetup setup the C-States panel
+func CStatesPanelSetup(nextSlide func()) (pageName string, content tview.Primitive) {
+
+	pg := setupCStates()
+
+	to := tab.New(cstatesPanelName, perfmon.app)
+	pg.tabOrder = to
+
+	flex0 := tview.NewFlex().SetDirection(tview.FlexRow)
+	flex1 := tview.NewFlex().SetDirection(tview.FlexColumn)
+
+	TitleBox(flex0)
+	pg.topFlex = flex0
+
+	rows := (len(OnlineCPUs())+heatmapColumns-1)/heatmapColumns + 2
+	pg.heatmap = CreateTableView(flex0, "Idle % Heatmap (h)", tview.AlignLeft, rows, 0, true)
+
+	pg.cpus = CreateTableView(flex1, "C-State Residency % per CPU (r)", tview.AlignLeft, 0, 3, true)
+	pg.cpus.SetFixed(1, 0)
+	pg.cpus.SetSeparator(tview.Borders.Vertical)
+	pg.packages = CreateTableView(flex1, "Package C-States % (p)", tview.AlignLeft, 0, 1, true)
+	pg.packages.SetSeparator(tview.Borders.Vertical)
+	flex0.AddItem(flex1, 0, 1, true)
+
+	pg.note = CreateTextView(flex0, "Note", tview.AlignLeft, 4, 0, false)
+
+	to.Add(pg.heatmap, 'h')
+	to.Add(pg.cpus, 'r')
+	to.Add(pg.packages, 'p')
+
+	to.SetInputDone()
+
+	perfmon.timers.Add(cstatesPanelName, func(step int, ticks uint64) {
+		switch step {
+		case 0:
+			if pg.topFlex.HasFocus() {
+				pg.collectData()
+			}
+		case 1:
+			if pg.topFlex.HasFocus() {
+				perfmon.app.QueueUpdateDraw(func() {
+					pg.displayCStatesPage()
+				})
+			}
+		}
+	})
+
+	return cstatesPanelName, pg.topFlex
+}
+
+// Sample the cpuidle counters and the package residency MSRs
+func (pg *PageCStates) collectData() {
+
+	err := pg.sampler.Sample(OnlineCPUs())
+	if err != nil {
+		tlog.WarnPrintf("C-States: %v\n", err)
+	}
+	pkgErr := pg.sampler.SamplePackages(pg.pkgCPUs)
+
+	perfmon.app.QueueUpdate(func() {
+		pg.err = err
+		pg.pkgErr = pkgErr
+	})
+}
+
+// Display the C-States panel windows
+func (pg *PageCStates) displayCStatesPage() {
+
+	app := perfmon.dpdkApp.Get()
+	polling := app.PollingLCores()
+
+	pg.displayHeatmap(pg.heatmap, app.LCores, polling)
+	pg.displayCPUs(pg.cpus, app.LCores, polling)
+	pg.displayPackages(pg.packages)
+	pg.displayNote(polling)
+}
+
+// idleBackground returns the heatmap color of the idle percent
+func idleBackground(idle float64) tcell.Color {
+
+	switch {
+	case idle < 25.0:
+		return tcell.ColorDarkBlue
+	case idle < 50.0:
+		return tcell.ColorTeal
+	case idle < 75.0:
+		return tcell.ColorDarkGreen
+	}
+	return tcell.ColorGreen
+}
+
+// lcoreIdle returns true if the lcore has idle time, 0.1% is allowed for the
+// rounding of the counters
+func lcoreIdle(r pbf.Residency) bool {
+	return r.Valid && r.IdlePercent >= 0.1
+}
+
+// Display the idle percent of the CPUs as a grid colored by the idle time
+func (pg *PageCStates) displayHeatmap(view *tview.Table, lcores, polling []int) {
+
+	row := 0
+	for n, cpu := range OnlineCPUs() {
+		row = n / heatmapColumns
+		col := n % heatmapColumns
+		r := pg.sampler.Get(cpu)
+
+		text := fmt.Sprintf("%3d:  -  ", cpu)
+		if r.Valid {
+			text = fmt.Sprintf("%3d:%5.1f", cpu, r.IdlePercent)
+		}
+		bg := idleBackground(r.IdlePercent)
+		if dpdk.IsLCoreUsed(cpu, lcores) {
+			text += "L"
+			if dpdk.IsLCoreUsed(cpu, polling) && lcoreIdle(r) {
+				bg = tcell.ColorRed
+			} else {
+				bg = tcell.ColorBlack
+			}
+		}
+		if !r.Valid {
+			bg = tcell.ColorBlack
+		}
+
+		SetCell(view, row, col, text, tview.AlignLeft).
+			SetTextColor(tcell.ColorWhite).
+			SetBackgroundColor(bg)
+	}
+	row++
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the residency of each state of the CPUs
+func (pg *PageCStates) displayCPUs(view *tview.Table, lcores, polling []int) {
+
+	row := 0
+	SetCell(view, row, 0, cz.Orange("CPU"), tview.AlignLeft)
+	SetCell(view, row, 1, cz.Orange("C0 %"), tview.AlignLeft)
+	SetCell(view, row, 2, cz.Orange("Idle %"), tview.AlignLeft)
+	for i, r := range pg.sampler.Get(onlineCPU(0)).States {
+		SetCell(view, row, 3+i, cz.Orange(r.Name+" % (n)"), tview.AlignLeft)
+	}
+	row++
+
+	for _, cpu := range OnlineCPUs() {
+		r := pg.sampler.Get(cpu)
+
+		name := cz.LightGreen(CPULabel(cpu))
+		idle := cz.SkyBlue(r.IdlePercent, 0, 1)
+		if dpdk.IsLCoreUsed(cpu, lcores) {
+			name = cz.Yellow(CPULabel(cpu) + " lcore")
+			if dpdk.IsLCoreUsed(cpu, polling) && lcoreIdle(r) {
+				idle = cz.Red(r.IdlePercent, 0, 1)
+			}
+		}
+
+		SetCell(view, row, 0, name, tview.AlignLeft)
+		if !r.Valid {
+			SetCell(view, row, 1, cz.SkyBlue("-"), tview.AlignLeft)
+			SetCell(view, row, 2, cz.SkyBlue("-"), tview.AlignLeft)
+			row++
+			continue
+		}
+		SetCell(view, row, 1, cz.LightGreen(r.C0Percent, 0, 1), tview.AlignLeft)
+		SetCell(view, row, 2, idle, tview.AlignLeft)
+		for i, s := range r.States {
+			SetCell(view, row, 3+i, fmt.Sprintf("%s (%s)", cz.SkyBlue(s.Percent, 0, 1), cz.Wheat(s.Usage)),
+				tview.AlignLeft)
+		}
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the package C-state residency
+func (pg *PageCStates) displayPackages(view *tview.Table) {
+
+	row := 0
+	SetCell(view, row, 0, cz.Orange("Package"), tview.AlignLeft)
+	for i, pc := range pbf.PkgCStates {
+		SetCell(view, row, 1+i, cz.Orange(pc.Name), tview.AlignLeft)
+	}
+	row++
+
+	pkgs := []int{}
+	for pkg := range pg.pkgCPUs {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Ints(pkgs)
+
+	for _, pkg := range pkgs {
+		SetCell(view, row, 0, cz.LightGreen(pkg), tview.AlignLeft)
+		for i, r := range pg.sampler.Package(pkg) {
+			SetCell(view, row, 1+i, cz.SkyBlue(r.Percent, 0, 1), tview.AlignLeft)
+		}
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the polling lcores with idle time and the errors
+func (pg *PageCStates) displayNote(polling []int) {
+
+	str := ""
+	if pg.err != nil {
+		str += cz.Red(pg.err.Error()) + "\n"
+	}
+	if msg := msrUnavailable(); msg != "" {
+		str += cz.Orange("Package C-states are read from the MSRs, "+msg) + "\n"
+	} else if pg.pkgErr != nil {
+		str += cz.Orange(pg.pkgErr.Error()) + "\n"
+	}
+
+	idle := []int{}
+	for _, c := range polling {
+		if lcoreIdle(pg.sampler.Get(c)) {
+			idle = append(idle, c)
+		}
+	}
+	if len(idle) > 0 {
+		str += cz.Red(fmt.Sprintf("DPDK lcores %s have idle time, a poll mode lcore should never be idle", cpuList(idle))) + "\n"
+	}
+	str += cz.Wheat("The heatmap shows the idle % of each CPU for the last second, lcores are marked L and are red when a polling lcore is idle")
+
+	pg.note.SetText(str)
+}
@@ -5,9 +5,12 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	cz "pmdt.org/colorize"
 	"pmdt.org/devbind"
@@ -45,7 +48,13 @@ type DevBindPanel struct {
 	tabOrder *tab.Tab
 	devbind  *devbind.BindInfo
 	topFlex  *tview.Flex
+	note     *tview.TextView
 	tables   []TableData
+	filter   *devbind.Selector // Only show the devices matching the filter
+
+	accel     *tview.Table          // DSA and IAA devices and their WQs
+	idxd      []*devbind.IdxdDevice // Devices shown in the accel table
+	idxdState string                // State of the idxd devices to find changes
 
 	tInfos map[string]*TableInfo
 }
@@ -59,7 +68,7 @@ func setupDevBind() *DevBindPanel {
 
 	pg := &DevBindPanel{}
 
-	pg.devbind = devbind.New()
+	pg.devbind = perfmon.devbind
 
 	db := pg.devbind
 
@@ -149,14 +158,65 @@ func DevBindPanelSetup(nextSlide func()) (pageName string, content tview.Primiti
 	for _, td := range pg.tables {
 		s := fmt.Sprintf("%s Devices (%c)", td.name, td.key)
 
-		ti[td.name].view = CreateTableView(flex, s, td.align, td.fixedSize, td.proportion, td.focus)
+		info := ti[td.name]
+		info.view = CreateTableView(flex, s, td.align, td.fixedSize, td.proportion, td.focus)
+
+		// Selecting a device with Enter binds or unbinds the device
+		info.view.SetSelectable(true, false)
+		info.view.SetSelectedFunc(func(row, col int) {
+			pg.bindAction(info, row-1)
+		})
 
 		// Add the single key and define the tab order.
-		to.Add(ti[td.name].view, td.key)
+		to.Add(info.view, td.key)
+	}
+
+	// The DSA and IAA work queues, Enter on a device configures its WQs
+	pg.accel = CreateTableView(flex, "Accelerator Work Queues (w)", tview.AlignLeft, 0, 1, true)
+	pg.accel.SetSelectable(true, false)
+	pg.accel.SetSelectedFunc(func(row, col int) {
+		pg.wqAction(row - 1)
+	})
+	to.Add(pg.accel, 'w')
+
+	pg.note = CreateTextView(flex, "Note", tview.AlignLeft, 4, 1, false)
+	pg.displayNote("Select a device and press Enter to bind it to a DPDK driver or back to its kernel driver, " +
+		"'v' sets the number of VFs of a PF, 'a' and 'l' set the MAC and VLAN of a VF, 'f' filters the devices\n" +
+		pg.devbind.IOMMU().String())
+	if errs := pg.devbind.LoadErrors(); len(errs) > 0 {
+		pg.displayNote(fmt.Sprintf("%d device file errors, the first: %v", len(errs), errs[0]))
 	}
 
 	to.SetInputDone()
 
+	// The SR-IOV keys are handled after the tab order keys of each table
+	for _, td := range pg.tables {
+		info := ti[td.name]
+		capture := info.view.GetInputCapture()
+
+		info.view.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+			if capture != nil {
+				if ev = capture(ev); ev == nil {
+					return nil
+				}
+			}
+			row, _ := info.view.GetSelection()
+			switch ev.Rune() {
+			case 'v':
+				pg.vfAction(info, row-1)
+			case 'a':
+				pg.vfMacAction(info, row-1)
+			case 'l':
+				pg.vfVlanAction(info, row-1)
+			case 'f':
+				pg.filterAction()
+			default:
+				return ev
+			}
+			return nil
+		})
+	}
+
 	top.AddItem(flex, 0, 1, true)
 
 	pg.topFlex = top
@@ -165,9 +225,21 @@ func DevBindPanelSetup(nextSlide func()) (pageName string, content tview.Primiti
 	perfmon.timers.Add(devbindPanelName, func(step int, ticks uint64) {
 		switch step {
 		case 0:
+			// The lists are set on the UI goroutine, the actions bind and
+			// refresh the devices there
+			lists := make(map[*TableInfo][]*devbind.DeviceClass)
 			for _, t := range pg.tInfos {
-				pg.collectData(t)
+				lists[t] = pg.collectData(t)
 			}
+			perfmon.app.QueueUpdate(func() {
+				for t, list := range lists {
+					pg.setDevices(t, list)
+				}
+			})
+			devs := pg.devbind.IdxdDevices()
+			perfmon.app.QueueUpdate(func() {
+				pg.setIdxd(devs)
+			})
 		case 2:
 			if pg.topFlex.HasFocus() {
 				perfmon.app.QueueUpdateDraw(func() {
@@ -188,10 +260,12 @@ func (pg *DevBindPanel) displayDevBindPanel(step int) {
 			pg.displayView(ti)
 		}
 	}
+	pg.displayIdxd()
 }
 
-// Collect the data to be displayed in the different device windows
-func (pg *DevBindPanel) collectData(ti *TableInfo) {
+// Collect the data to be displayed in the different device windows, the
+// devices are copies so the list can be handed to the UI goroutine
+func (pg *DevBindPanel) collectData(ti *TableInfo) []*devbind.DeviceClass {
 
 	deviceList := make([]*devbind.DeviceClass, 0)
 
@@ -206,8 +280,22 @@ func (pg *DevBindPanel) collectData(ti *TableInfo) {
 	sort.Slice(deviceList, func(i, j int) bool {
 		return deviceList[j].Slot > deviceList[i].Slot
 	})
+	return deviceList
+}
+
+// setDevices filters the device list and sets the changed flag to force an
+// update of the window. The filter is changed on the UI goroutine so it is
+// only used here.
+func (pg *DevBindPanel) setDevices(ti *TableInfo, devs []*devbind.DeviceClass) {
+
+	deviceList := make([]*devbind.DeviceClass, 0, len(devs))
+	for _, d := range devs {
+		if pg.filter == nil || pg.filter.Match(d) {
+			deviceList = append(deviceList, d)
+		}
+	}
+	deviceList = nestVFs(deviceList)
 
-	// Set the device list and set the changed flag to force update of window
 	ti.devlist = deviceList
 	if ti.length != len(deviceList) {
 		ti.changed = true
@@ -229,18 +317,25 @@ func (pg *DevBindPanel) displayView(ti *TableInfo) {
 	SetCell(view, 0, 5, cz.CornSilk("Driver"), tview.AlignLeft)
 	SetCell(view, 0, 6, cz.CornSilk("Active"), tview.AlignLeft)
 	SetCell(view, 0, 7, cz.CornSilk("Numa"), tview.AlignLeft)
+	SetCell(view, 0, 8, cz.CornSilk("VFIO Readiness"), tview.AlignLeft)
 
 	// Add each device information to the table based on the devlist
 	row := 1
 	for _, d := range ti.devlist {
 		col := 0
 
-		SetCell(view, row, col, cz.DeepPink(d.Slot), tview.AlignLeft)
+		slot := cz.DeepPink(d.Slot)
+		if d.IsVF() {
+			slot = fmt.Sprintf("  %s", cz.LightCoral(d.Slot))
+		} else if d.IsPF() {
+			slot = fmt.Sprintf("%s %s", slot, cz.Wheat(fmt.Sprintf("(%d/%d VFs)", d.NumVFs, d.TotalVFs)))
+		}
+		SetCell(view, row, col, slot, tview.AlignLeft, true)
 		col++
 
 		s := fmt.Sprintf("[%s:%s]",
 			cz.SkyBlue(d.Vendor.ID), cz.SkyBlue(d.Device.ID))
-		SetCell(view, row, col, s, tview.AlignLeft)
+		SetCell(view, row, col, s, tview.AlignLeft, true)
 		col++
 
 		str := d.Vendor.Str
@@ -248,7 +343,7 @@ func (pg *DevBindPanel) displayView(ti *TableInfo) {
 		if idx != -1 {
 			str = str[:idx-1]
 		}
-		SetCell(view, row, col, cz.SkyBlue(str), tview.AlignLeft)
+		SetCell(view, row, col, cz.SkyBlue(str), tview.AlignLeft, true)
 		col++
 
 		str = d.SDevice.Str
@@ -256,22 +351,22 @@ func (pg *DevBindPanel) displayView(ti *TableInfo) {
 		if idx != -1 {
 			str = str[:idx-1]
 		}
-		SetCell(view, row, col, cz.LightGreen(str), tview.AlignLeft)
+		SetCell(view, row, col, cz.LightGreen(str), tview.AlignLeft, true)
 		col++
 
 		str = d.Interface
-		SetCell(view, row, col, cz.ColorWithName("Tomato", str), tview.AlignLeft)
+		SetCell(view, row, col, cz.ColorWithName("Tomato", str), tview.AlignLeft, true)
 		col++
 
 		str = d.Driver
-		SetCell(view, row, col, cz.LightYellow(str), tview.AlignLeft)
+		SetCell(view, row, col, cz.LightYellow(str), tview.AlignLeft, true)
 		col++
 
 		str = ""
 		if d.Active {
 			str = cz.Orange("*Active*")
 		}
-		SetCell(view, row, col, str, tview.AlignLeft)
+		SetCell(view, row, col, str, tview.AlignLeft, true)
 		col++
 
 		str = d.NumaNode
@@ -279,11 +374,393 @@ func (pg *DevBindPanel) displayView(ti *TableInfo) {
 		if idx != -1 {
 			str = str[:idx-1]
 		}
-		SetCell(view, row, col, cz.MistyRose(str), tview.AlignLeft)
+		SetCell(view, row, col, cz.MistyRose(str), tview.AlignLeft, true)
+		col++
+
+		if r := pg.devbind.VfioReadiness(d.Slot); r.Ready {
+			str = cz.LightGreen(r.Verdict)
+		} else {
+			str = cz.Orange(r.Verdict)
+		}
+		SetCell(view, row, col, str, tview.AlignLeft, true)
 		col++
 
 		row++
 	}
 
+	// Remove the rows of devices no longer present, e.g. removed VFs
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+
 	ti.view.ScrollToBeginning()
 }
+
+// nestVFs orders the sorted device list to place the VFs after their PF, VFs
+// without a PF in the list stay in slot order.
+func nestVFs(devs []*devbind.DeviceClass) []*devbind.DeviceClass {
+
+	present := make(map[string]bool)
+	for _, d := range devs {
+		present[d.Slot] = true
+	}
+
+	vfs := make(map[string][]*devbind.DeviceClass)
+	for _, d := range devs {
+		if d.IsVF() && present[d.PhysFn] {
+			vfs[d.PhysFn] = append(vfs[d.PhysFn], d)
+		}
+	}
+
+	list := make([]*devbind.DeviceClass, 0, len(devs))
+	for _, d := range devs {
+		if d.IsVF() && present[d.PhysFn] {
+			continue
+		}
+		list = append(list, d)
+
+		v := vfs[d.Slot]
+		sort.Slice(v, func(i, j int) bool {
+			return v[i].VFIndex < v[j].VFIndex
+		})
+		list = append(list, v...)
+	}
+	return list
+}
+
+func (pg *DevBindPanel) displayNote(msg string) {
+
+	pg.note.SetText(cz.Wheat(msg))
+}
+
+// bindAction moves the selected device between its kernel driver and a DPDK
+// driver after the user confirms the change.
+func (pg *DevBindPanel) bindAction(ti *TableInfo, idx int) {
+
+	if idx < 0 || idx >= len(ti.devlist) {
+		return
+	}
+	d := ti.devlist[idx]
+
+	if d.Active {
+		pg.displayNote(fmt.Sprintf("Device %s is active, interface %s has a route and can not be changed",
+			d.Slot, d.Interface))
+		return
+	}
+
+	done := func(driver string, err error) {
+		// The selected device is a copy, the bound driver is in the device list
+		current := ""
+		if dev, ok := pg.devbind.Device(d.Slot); ok {
+			current = dev.Driver
+		}
+
+		switch {
+		case err != nil:
+			pg.actionDone("", err)
+		case len(driver) == 0:
+			pg.actionDone(fmt.Sprintf("Device %s unbound", d.Slot), nil)
+		case current != driver:
+			pg.actionDone(fmt.Sprintf("Device %s did not bind to %s, driver is %q", d.Slot, driver, current), nil)
+		default:
+			pg.actionDone(fmt.Sprintf("Device %s bound to %s", d.Slot, driver), nil)
+		}
+	}
+
+	if !devbind.IsUioModule(d.Driver) {
+		msg := fmt.Sprintf("Bind device %s (%s) to a DPDK driver?", d.Slot, d.Driver)
+		if r := pg.devbind.VfioReadiness(d.Slot); !r.Ready {
+			msg += fmt.Sprintf("\n\nvfio-pci is not ready: %s", r.Verdict)
+		}
+
+		Choose(msg, devbind.UioModules, func(driver string) {
+			done(driver, pg.devbind.Bind(d.Slot, driver))
+		})
+		return
+	}
+
+	kernel := d.KernelDriver()
+	if len(kernel) == 0 {
+		Confirm(fmt.Sprintf("Unbind device %s from %s?\n\nNo kernel driver is known for the device.",
+			d.Slot, d.Driver), func() {
+			done("", pg.devbind.Unbind(d.Slot))
+		})
+		return
+	}
+
+	Confirm(fmt.Sprintf("Bind device %s from %s back to kernel driver %s?", d.Slot, d.Driver, kernel),
+		func() {
+			done(kernel, pg.devbind.Bind(d.Slot, kernel))
+		})
+}
+
+// actionDone displays the result of an action and redraws the windows
+func (pg *DevBindPanel) actionDone(msg string, err error) {
+
+	if err != nil {
+		tlog.ErrorPrintf("DevBind: %v\n", err)
+		pg.displayNote(fmt.Sprintf("Failed: %v", err))
+	} else {
+		pg.displayNote(msg)
+	}
+
+	for _, t := range pg.tInfos {
+		pg.setDevices(t, pg.collectData(t))
+		t.changed = true
+	}
+	pg.displayDevBindPanel(0)
+}
+
+// selectedDevice returns the device of the row or nil
+func (ti *TableInfo) selectedDevice(idx int) *devbind.DeviceClass {
+
+	if idx < 0 || idx >= len(ti.devlist) {
+		return nil
+	}
+	return ti.devlist[idx]
+}
+
+// vfAction creates or removes the VFs of the selected PF
+func (pg *DevBindPanel) vfAction(ti *TableInfo, idx int) {
+
+	d := ti.selectedDevice(idx)
+	if d == nil {
+		return
+	}
+	if !d.IsPF() {
+		pg.displayNote(fmt.Sprintf("Device %s does not support SR-IOV VFs", d.Slot))
+		return
+	}
+
+	// A QAT PF on its kernel driver gets all of its VFs for DPDK
+	if strings.HasPrefix(d.Driver, "qat_") && d.NumVFs == 0 {
+		Confirm(fmt.Sprintf("Enable the %d QAT VFs of %s?", d.TotalVFs, d.Slot), func() {
+			pg.actionDone(fmt.Sprintf("Device %s has %d VFs", d.Slot, d.TotalVFs),
+				pg.devbind.EnableQATVFs(d.Slot))
+		})
+		return
+	}
+
+	label := fmt.Sprintf("VFs (0-%d)", d.TotalVFs)
+	InputValue(fmt.Sprintf("SR-IOV %s", d.Slot), label, strconv.Itoa(d.NumVFs), func(value string) {
+		num, err := strconv.Atoi(value)
+		if err != nil || num < 0 || num > d.TotalVFs {
+			pg.displayNote(fmt.Sprintf("Invalid number of VFs %q", value))
+			return
+		}
+		msg := fmt.Sprintf("Set the number of VFs on %s from %d to %d?", d.Slot, d.NumVFs, num)
+		if d.NumVFs != 0 {
+			msg += "\n\nThe current VFs are removed first."
+		}
+		Confirm(msg, func() {
+			pg.actionDone(fmt.Sprintf("Device %s has %d VFs", d.Slot, num),
+				pg.devbind.SetNumVFs(d.Slot, num))
+		})
+	})
+}
+
+// vfMacAction sets the MAC address of the selected VF
+func (pg *DevBindPanel) vfMacAction(ti *TableInfo, idx int) {
+
+	d := ti.selectedDevice(idx)
+	if d == nil {
+		return
+	}
+	if !d.IsVF() {
+		pg.displayNote(fmt.Sprintf("Device %s is not a VF", d.Slot))
+		return
+	}
+
+	InputValue(fmt.Sprintf("VF %d of %s", d.VFIndex, d.PhysFn), "MAC address", "", func(value string) {
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			pg.displayNote(fmt.Sprintf("Invalid MAC address %q", value))
+			return
+		}
+		Confirm(fmt.Sprintf("Set the MAC address of VF %s to %s?", d.Slot, mac), func() {
+			pg.actionDone(fmt.Sprintf("VF %s MAC address set to %s", d.Slot, mac),
+				pg.devbind.SetVFMac(d.Slot, mac))
+		})
+	})
+}
+
+// vfVlanAction sets the VLAN and optional priority, VLAN[:QoS], of the
+// selected VF
+func (pg *DevBindPanel) vfVlanAction(ti *TableInfo, idx int) {
+
+	d := ti.selectedDevice(idx)
+	if d == nil {
+		return
+	}
+	if !d.IsVF() {
+		pg.displayNote(fmt.Sprintf("Device %s is not a VF", d.Slot))
+		return
+	}
+
+	InputValue(fmt.Sprintf("VF %d of %s", d.VFIndex, d.PhysFn), "VLAN[:QoS]", "0", func(value string) {
+		var vlan, qos int
+		var err error
+
+		w := strings.SplitN(value, ":", 2)
+		if vlan, err = strconv.Atoi(w[0]); err == nil && len(w) > 1 {
+			qos, err = strconv.Atoi(w[1])
+		}
+		if err != nil {
+			pg.displayNote(fmt.Sprintf("Invalid VLAN %q", value))
+			return
+		}
+		Confirm(fmt.Sprintf("Set VF %s to VLAN %d priority %d?", d.Slot, vlan, qos), func() {
+			pg.actionDone(fmt.Sprintf("VF %s VLAN set to %d priority %d", d.Slot, vlan, qos),
+				pg.devbind.SetVFVlan(d.Slot, vlan, qos))
+		})
+	})
+}
+
+// filterAction sets the selector used to filter the devices, an empty
+// selector shows all devices.
+func (pg *DevBindPanel) filterAction() {
+
+	current := ""
+	if pg.filter != nil {
+		current = pg.filter.String()
+	}
+
+	InputValue("Filter devices, e.g. vendor=8086 driver=vfio-pci", "Selector", current, func(value string) {
+		sel, err := devbind.ParseSelector(value)
+		if err != nil {
+			pg.displayNote(fmt.Sprintf("Invalid filter: %v", err))
+			return
+		}
+
+		msg := fmt.Sprintf("Filter: %s", sel)
+		if sel.Empty() {
+			sel = nil
+			msg = "Filter cleared, showing all devices"
+		}
+		pg.filter = sel
+		pg.actionDone(msg, nil)
+	})
+}
+
+// idxdRow is a device or WQ row of the accelerator table
+type idxdRow struct {
+	dev *devbind.IdxdDevice
+	wq  *devbind.IdxdWQ
+}
+
+// idxdRows returns the rows of the accelerator table, each device is
+// followed by its configured WQs.
+func (pg *DevBindPanel) idxdRows() []idxdRow {
+
+	rows := []idxdRow{}
+	for _, d := range pg.idxd {
+		rows = append(rows, idxdRow{dev: d})
+		for i := range d.WQs {
+			if wq := &d.WQs[i]; wq.Size > 0 || wq.State == "enabled" {
+				rows = append(rows, idxdRow{dev: d, wq: wq})
+			}
+		}
+	}
+	return rows
+}
+
+// setIdxd sets the idxd devices of the accelerator table when their state
+// changed, called on the UI goroutine
+func (pg *DevBindPanel) setIdxd(devs []*devbind.IdxdDevice) {
+
+	state := ""
+	for _, d := range devs {
+		state += fmt.Sprintf("%+v", *d)
+	}
+	if state != pg.idxdState {
+		pg.idxd = devs
+		pg.idxdState = state
+	}
+}
+
+// displayIdxd shows the DSA and IAA devices and their WQs
+func (pg *DevBindPanel) displayIdxd() {
+
+	view := pg.accel
+	view.SetTitle(TitleColor(fmt.Sprintf("Accelerator Work Queues (w) %d devices", len(pg.idxd))))
+
+	titles := []string{"Device", "Slot", "State", "Numa", "Groups", "Engines", "WQs", "WQ Size",
+		"Mode", "Type", "Name"}
+	for i, t := range titles {
+		SetCell(view, 0, i, cz.CornSilk(t), tview.AlignLeft)
+	}
+
+	row := 1
+	for _, r := range pg.idxdRows() {
+		d := r.dev
+
+		state := func(s string) string {
+			if s == "enabled" {
+				return cz.LightGreen(s)
+			}
+			return cz.Orange(s)
+		}
+
+		if r.wq == nil {
+			cells := []string{
+				cz.DeepPink(d.Name), cz.SkyBlue(d.Slot), state(d.State), cz.MistyRose(d.NumaNode),
+				cz.Wheat(d.MaxGroups), cz.Wheat(len(d.Engines)), cz.Wheat(d.MaxWQs), cz.Wheat(d.MaxWQSize),
+				"", "", "",
+			}
+			for i, c := range cells {
+				SetCell(view, row, i, c, tview.AlignLeft, true)
+			}
+		} else {
+			wq := r.wq
+			cells := []string{
+				"  " + cz.LightCoral(wq.Name), "", state(wq.State), "",
+				cz.Wheat(wq.Group), "", "", cz.Wheat(wq.Size),
+				cz.LightYellow(wq.Mode), cz.LightYellow(wq.Type), cz.SkyBlue(wq.WQName),
+			}
+			for i, c := range cells {
+				SetCell(view, row, i, c, tview.AlignLeft, true)
+			}
+		}
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// wqAction configures the WQs of the selected DSA or IAA device
+func (pg *DevBindPanel) wqAction(idx int) {
+
+	rows := pg.idxdRows()
+	if idx < 0 || idx >= len(rows) {
+		return
+	}
+	d := rows[idx].dev
+
+	label := fmt.Sprintf("WQs[:mode] (1-%d)", d.MaxWQs)
+	InputValue(fmt.Sprintf("Configure %s WQs for DPDK", d.Name), label, "1:dedicated", func(value string) {
+		w := strings.SplitN(value, ":", 2)
+
+		cfg := devbind.WQConfig{Device: d.Name}
+		num, err := strconv.Atoi(w[0])
+		if err != nil {
+			pg.displayNote(fmt.Sprintf("Invalid number of WQs %q", value))
+			return
+		}
+		cfg.NumWQs = num
+		if len(w) > 1 {
+			cfg.Mode = w[1]
+		}
+
+		msg := fmt.Sprintf("Configure %d user WQs on %s?", cfg.NumWQs, d.Name)
+		if d.State == "enabled" {
+			msg += fmt.Sprintf("\n\n%s is disabled while the WQs are changed.", d.Name)
+		}
+		Confirm(msg, func() {
+			err := pg.devbind.ConfigureWQs(cfg)
+			pg.setIdxd(pg.devbind.IdxdDevices())
+			pg.actionDone(fmt.Sprintf("%s configured with %d WQs", d.Name, cfg.NumWQs), err)
+		})
+	})
+}
@@ -14,6 +14,7 @@ import (
 
 	"pmdt.org/dpdk"
 	"pmdt.org/graphdata"
+	"pmdt.org/hugepages"
 	pcm "pmdt.org/pcm"
 	"pmdt.org/pinfo"
 
@@ -44,16 +45,30 @@ type DPDKPanel struct {
 	dpdkInfo *tview.TextView
 	dpdkNet  *tview.Table
 	dpdkBusy *tview.TextView //Table
+	numaView *tview.TextView
 	totalRX  *tview.TextView
 	totalTX  *tview.TextView
 
 	pinfoDPDK *pinfo.ProcessInfo
-	infoDPDK  dpdk.Information
+	infoDPDK  dpdk.Information // Snapshot of the stats displayed
+
+	// The selected application is recorded by the UI for the timer
+	selectLock sync.Mutex
+	selectName string
+
+	// The stats are collected on the timer and handed to the display as a
+	// snapshot, only the timer uses these
+	stats      dpdk.Information
+	statsRates map[uint16]*PortRate
+	statsSeen  map[uint16]bool // Ports with previous stats
+	statsApp   string          // Name and pid of the application of the stats
 
 	system    pcm.System
 	data      *rxtxData
+	rates     map[uint16]*PortRate
 	dpdkCores []uint16
 	percent   []float64
+	findings  []dpdk.NumaFinding
 }
 
 // Setup the DPDK Panel data structure
@@ -62,6 +77,9 @@ func setupDPDKPanel() *DPDKPanel {
 	pg := &DPDKPanel{}
 
 	pg.data = &rxtxData{}
+	pg.rates = make(map[uint16]*PortRate)
+	pg.statsRates = make(map[uint16]*PortRate)
+	pg.statsSeen = make(map[uint16]bool)
 
 	//pg.appCoreMap = make(map[uint16][]uint16)
 
@@ -121,6 +139,7 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 
 	pg.selectApp = NewSelectWindow(table, "DPDK", 0, func(row, col int) {
 		pg.selectApp.UpdateItem(row, col)
+		pg.setSelected()
 
 		for _, gd := range pg.data.rxPoints.Graphs() {
 			gd.Reset()
@@ -129,6 +148,11 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 			gd.Reset()
 		}
 
+		// The displayed stats belong to the previous application, the
+		// collector starts over when it sees the new application
+		pg.rates = make(map[uint16]*PortRate)
+		pg.infoDPDK = dpdk.Information{}
+
 		clearScrollText(pg.dpdkInfo, pg.displayDPDKInfo, true)
 		clearScrollTable(pg.dpdkNet, pg.displayDPDKNet, true)
 	})
@@ -166,6 +190,7 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 			}
 		}
 		pg.selectApp.UpdateItem(row, -1)
+		pg.setSelected()
 	})
 
 	flex1.AddItem(flex2, 0, 1, true)
@@ -173,6 +198,7 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	pg.dpdkInfo = CreateTextView(flex2, "DPDK Info (2)", tview.AlignLeft, 0, 2, true)
 	pg.dpdkNet = CreateTableView(flex2, "DPDK Network Stats (3)", tview.AlignLeft, 0, 4, false)
 	pg.dpdkBusy = CreateTextView(flex2, "DPDK Core Busy Stats (b)", tview.AlignLeft, 0, 4, false)
+	pg.numaView = CreateTextView(flex2, "NUMA Audit (n)", tview.AlignLeft, 0, 2, false)
 	pg.dpdkNet.SetFixed(2, 0)
 	pg.dpdkNet.SetSeparator(tview.Borders.Vertical)
 	flex2.AddItem(flex3, 0, 3, false)
@@ -184,6 +210,7 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	to.Add(pg.dpdkInfo, '2')
 	to.Add(pg.dpdkNet, '3')
 	to.Add(pg.dpdkBusy, 'b')
+	to.Add(pg.numaView, 'n')
 
 	to.SetInputDone()
 
@@ -193,7 +220,7 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 		num := int(pg.system.Data.NumOfCores)
 		for i := 0; i < num; i++ {
 			data := pcm.CoreCounters{}
-			if err := perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", i), &data); err != nil {
+			if err := PCMCore(i, &data); err != nil {
 				tlog.ErrorPrintf("Unable to get PCM system information\n")
 				return
 			}
@@ -203,7 +230,12 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	*/
 
 	// Time callback routine to dispaly or process data for the windows.
+	// The port stats are collected even when the panel does not have focus as
+	// other panels use the port rates of the selected application.
 	perfmon.timers.Add(dpdkPanelName, func(step int, ticks uint64) {
+		if step == 0 {
+			pg.collectStats()
+		}
 		if pg.topFlex.HasFocus() {
 			perfmon.app.QueueUpdateDraw(func() {
 				pg.displayDPDKPanel(step, ticks)
@@ -214,17 +246,36 @@ func DPDKPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	return dpdkPanelName, pg.topFlex
 }
 
-// selectedConnection returns the DPDK app name that is selected
+// setSelected records the name of the selected DPDK app, called by the UI
+// when the selection changes
+func (pg *DPDKPanel) setSelected() {
+
+	name := ""
+	if v, ok := pg.selectApp.ItemValue().(string); ok {
+		name = v
+	}
+	tlog.DebugPrintf("Value: %v\n", name) // name of DPDK App
+
+	pg.selectLock.Lock()
+	defer pg.selectLock.Unlock()
+
+	pg.selectName = name
+}
+
+// selectedConnection returns the connection of the selected DPDK app, the
+// timer only uses the name recorded by the UI
 func (pg *DPDKPanel) selectedConnection() (*pinfo.ConnInfo, error) {
 
-	tlog.DebugPrintf("Value: %v\n", pg.selectApp.ItemValue()) // name of DPDK App
-	selectedName := pg.selectApp.ItemValue()
-	if selectedName == nil {
+	pg.selectLock.Lock()
+	selectedName := pg.selectName
+	pg.selectLock.Unlock()
+
+	if len(selectedName) == 0 {
 		return nil, fmt.Errorf("I am not selected")
 	}
 
 	// Find the current selected application if any are available
-	a := pg.pinfoDPDK.ConnectionByProcessName(selectedName.(string))
+	a := pg.pinfoDPDK.ConnectionByProcessName(selectedName)
 	if a == nil {
 		return nil, fmt.Errorf("failed to get connection pointer")
 	}
@@ -236,22 +287,20 @@ func (pg *DPDKPanel) displayDPDKPanel(step int, ticks uint64) {
 
 	switch step {
 	case 0:
-		pg.collectStats()
 		pg.collectBusyData()
 
 	case 1:
-		num := NumCPUs()
-		percent := make([]float64, 0)
-		//tlog.WarnPrintf("CASE 1: %d", num)
-		for i := 0; i < num; i++ {
+		// The percent is indexed by the CPU id, a CPU without counters is zero
+		percent := make([]float64, NumCPUs())
+		for _, i := range OnlineCPUs() {
 			data := pcm.CoreCounters{}
-			if err := perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", i), &data); err != nil {
-				tlog.ErrorPrintf("Unable to get PCM system information\n")
-				return
+			if err := PCMCore(i, &data); err != nil {
+				tlog.ErrorPrintf("Unable to get PCM core %d information: %v\n", i, err)
+				continue
 			}
 			core := data.Data
 			ratio := float64(core.BranchMispredicts) / float64(core.Branches)
-			percent = append(percent, ratio)
+			percent[i] = ratio
 			tlog.WarnPrintf("percent's: %f\n", percent[i])
 		}
 		pg.percent = percent
@@ -261,6 +310,7 @@ func (pg *DPDKPanel) displayDPDKPanel(step int, ticks uint64) {
 		pg.displayDPDKInfo(pg.dpdkInfo)
 		pg.displayDPDKNet(pg.dpdkNet)
 		pg.displayDPDKBusy(pg.dpdkBusy)
+		pg.displayNumaAudit(pg.numaView)
 		pg.displayChart(pg.totalRX, true)
 		pg.displayChart(pg.totalTX, false)
 	}
@@ -268,41 +318,66 @@ func (pg *DPDKPanel) displayDPDKPanel(step int, ticks uint64) {
 
 func (pg *DPDKPanel) getFixedData(a *pinfo.ConnInfo) {
 
-	pg.infoDPDK.Version = pg.pinfoDPDK.Version(a)
-	tlog.DebugPrintf("EAL Version: %s\n", pg.infoDPDK.Version)
+	pg.stats.Version = pg.pinfoDPDK.Version(a)
+	tlog.DebugPrintf("EAL Version: %s\n", pg.stats.Version)
 
-	if err := pg.pinfoDPDK.Unmarshal(a, "/eal/params", &pg.infoDPDK.Params); err != nil {
+	// Read into new values so the snapshot of the display does not share the
+	// slices with the next collection
+	params := dpdk.EALParams{}
+	if err := pg.pinfoDPDK.Unmarshal(a, "/eal/params", &params); err != nil {
 		tlog.ErrorPrintf("Unable to get EAL Parameters: %v\n", err)
 		return
 	}
-	tlog.DebugPrintf("EAL Parameters: %v\n", pg.infoDPDK.Params.Params)
+	pg.stats.Params = params
+	tlog.DebugPrintf("EAL Parameters: %v\n", pg.stats.Params.Params)
 
-	if err := pg.pinfoDPDK.Unmarshal(a, "/eal/app_params", &pg.infoDPDK.AppParams); err != nil {
+	appParams := dpdk.AppParams{}
+	if err := pg.pinfoDPDK.Unmarshal(a, "/eal/app_params", &appParams); err != nil {
 		tlog.ErrorPrintf("Unable to get EAL Application Parameters: %v\n", err)
 		return
 	}
-	tlog.DebugPrintf("EAL Application Parameters: %v\n", pg.infoDPDK.AppParams.Params)
+	pg.stats.AppParams = appParams
+	tlog.DebugPrintf("EAL Application Parameters: %v\n", pg.stats.AppParams.Params)
 
-	if err := pg.pinfoDPDK.Unmarshal(a, "/", &pg.infoDPDK.Cmds); err != nil {
+	cmds := dpdk.CmdList{}
+	if err := pg.pinfoDPDK.Unmarshal(a, "/", &cmds); err != nil {
 		tlog.ErrorPrintf("Unable to get EAL Commands: %v\n", err)
 		return
 	}
-	tlog.DebugPrintf("EAL Commands: %v\n", pg.infoDPDK.Cmds)
+	pg.stats.Cmds = cmds
+	tlog.DebugPrintf("EAL Commands: %v\n", pg.stats.Cmds)
 
-	if err := pg.pinfoDPDK.Unmarshal(a, "/ethdev/list", &pg.infoDPDK.PidList); err != nil {
+	pidList := dpdk.EthdevPidList{}
+	if err := pg.pinfoDPDK.Unmarshal(a, "/ethdev/list", &pidList); err != nil {
 		tlog.ErrorPrintf("Unable to get Ethdev List information: %v\n", err)
 		return
 	}
-	tlog.DebugPrintf("EthdevList: %v\n", pg.infoDPDK.PidList)
+	pg.stats.PidList = pidList
+	tlog.DebugPrintf("EthdevList: %v\n", pg.stats.PidList)
+
+	// The port information does not change, only get it for new ports
+	if pg.stats.PortInfo == nil {
+		pg.stats.PortInfo = make(map[uint16]dpdk.EthdevPortInfo)
+	}
+	for _, pid := range pg.stats.PidList.Pids {
+		if _, ok := pg.stats.PortInfo[pid]; ok {
+			continue
+		}
+		info := dpdk.EthdevInfo{}
+		if err := pg.pinfoDPDK.Unmarshal(a, fmt.Sprintf("/ethdev/info,%d", pid), &info); err != nil {
+			tlog.DebugPrintf("Unable to get Ethdev Info for Port %d: %v\n", pid, err)
+		}
+		pg.stats.PortInfo[pid] = info.Info
+	}
 }
 
 func (pg *DPDKPanel) getEthdevStats(a *pinfo.ConnInfo) {
 
 	// Clear the previous stats
-	pg.infoDPDK.EthdevStats = nil
+	pg.stats.EthdevStats = nil
 
 	// Output the basic data for the stats and information of a port
-	for _, pid := range pg.infoDPDK.PidList.Pids {
+	for _, pid := range pg.stats.PidList.Pids {
 
 		eth := dpdk.EthdevStats{}
 		cmd := fmt.Sprintf("/ethdev/stats,%d", pid)
@@ -311,33 +386,50 @@ func (pg *DPDKPanel) getEthdevStats(a *pinfo.ConnInfo) {
 			continue
 		}
 		eth.Stats.PortID = pid
-		pg.infoDPDK.EthdevStats = append(pg.infoDPDK.EthdevStats, &eth)
+		pg.stats.EthdevStats = append(pg.stats.EthdevStats, &eth)
 		tlog.DebugPrintf("/ethdev/stats,%d: %+v\n", pid, eth)
 
+		// Calculate the per second rates, the stats are collected every second
+		prev := &pg.stats.PrevStats[pid].Stats
+		stats := &eth.Stats
+		rate, ok := pg.statsRates[pid]
+		if !ok {
+			rate = &PortRate{PortID: pid}
+			pg.statsRates[pid] = rate
+		}
+		if pg.statsSeen[pid] && stats.InBytes >= prev.InBytes && stats.OutBytes >= prev.OutBytes {
+			rate.RxBytes = float64(stats.InBytes - prev.InBytes)
+			rate.TxBytes = float64(stats.OutBytes - prev.OutBytes)
+			rate.RxPkts = float64(stats.InPackets - prev.InPackets)
+			rate.TxPkts = float64(stats.OutPackets - prev.OutPackets)
+		}
+		rate.Slot = pg.stats.PortInfo[pid].Name
+
 		// Update the previous stats
-		pg.infoDPDK.PrevStats[eth.Stats.PortID].Stats = eth.Stats
+		pg.stats.PrevStats[pid].Stats = eth.Stats
+		pg.statsSeen[pid] = true
 
-		tlog.DebugPrintf("Prev: %+v\n", pg.infoDPDK.PrevStats[eth.Stats.PortID])
+		tlog.DebugPrintf("Prev: %+v\n", pg.stats.PrevStats[eth.Stats.PortID])
 	}
 }
 
 // collectBusyData collect the cores branch and missed branches stats
 func (pg *DPDKPanel) collectBusyData() {
 
-	num := NumCPUs()
-	percent := make([]float64, 0)
+	// The percent is indexed by the CPU id, a CPU without counters is zero
+	percent := make([]float64, NumCPUs())
 
-	tlog.WarnPrintf("NUM: %d", num)
-	for i := 0; i < num; i++ {
+	tlog.WarnPrintf("NUM: %d", len(percent))
+	for _, i := range OnlineCPUs() {
 		data := pcm.CoreCounters{}
-		if err := perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", i), &data); err != nil {
-			tlog.ErrorPrintf("Unable to get PCM system information\n")
-			return
+		if err := PCMCore(i, &data); err != nil {
+			tlog.ErrorPrintf("Unable to get PCM core %d information: %v\n", i, err)
+			continue
 		}
 		core := data.Data
 		ratio := float64(core.BranchMispredicts) / float64(core.Branches)
 		ratio = ratio * 100.0
-		percent = append(percent, ratio)
+		percent[i] = ratio
 		tlog.WarnPrintf("percent's: %f\n", percent[i])
 	}
 	pg.percent = percent
@@ -348,10 +440,118 @@ func (pg *DPDKPanel) collectStats() {
 	a, err := pg.selectedConnection()
 	if err != nil {
 		tlog.DebugPrintf("No connection selected %s\n", err)
+		perfmon.dpdkApp.Set(DPDKAppState{})
+		perfmon.app.QueueUpdate(func() {
+			pg.findings = nil
+		})
 		return
 	}
+
+	// Start over when another application is selected or it restarted
+	if key := fmt.Sprintf("%s/%d", a.ProcessName, a.Pid); key != pg.statsApp {
+		pg.stats = dpdk.Information{}
+		pg.statsRates = make(map[uint16]*PortRate)
+		pg.statsSeen = make(map[uint16]bool)
+		pg.statsApp = key
+	}
 	pg.getFixedData(a)
 	pg.getEthdevStats(a)
+
+	// Copy the stats and rates for the display, the timer keeps updating its
+	// own maps on the next collection
+	info := pg.stats
+	info.PortInfo = make(map[uint16]dpdk.EthdevPortInfo)
+	for pid, p := range pg.stats.PortInfo {
+		info.PortInfo[pid] = p
+	}
+	rates := make(map[uint16]*PortRate)
+	for pid, r := range pg.statsRates {
+		rate := *r
+		rates[pid] = &rate
+	}
+
+	// Share the application state with the other panels
+	app := DPDKAppState{Name: a.ProcessName, Pid: int(a.Pid), Params: info.Params.Params}
+	app.LCores = dpdkCmdLine(a.ProcessName, app.Params).LCores()
+	for _, eth := range info.EthdevStats {
+		if r, ok := rates[eth.Stats.PortID]; ok {
+			app.Ports = append(app.Ports, *r)
+		}
+	}
+	perfmon.dpdkApp.Set(app)
+
+	findings := pg.numaAudit(&app)
+	perfmon.app.QueueUpdate(func() {
+		pg.infoDPDK = info
+		pg.rates = rates
+		pg.findings = findings
+	})
+}
+
+// numaAudit checks the NUMA locality of the lcores, ports and memory of the
+// application
+func (pg *DPDKPanel) numaAudit(app *DPDKAppState) []dpdk.NumaFinding {
+
+	cmdLine := dpdkCmdLine(app.Name, app.Params)
+
+	cfg := dpdk.NumaConfig{LCores: app.LCores, LCoreNode: make(map[int]int)}
+	for _, c := range app.LCores {
+		cfg.LCoreNode[c] = CPUNode(c)
+	}
+
+	for _, p := range app.Ports {
+		port := dpdk.NumaPort{ID: p.PortID, Slot: p.Slot, Node: -1}
+		if db := perfmon.devbind; db != nil {
+			if d, ok := db.Device(p.Slot); ok && len(d.NumaNode) > 0 {
+				port.Node = deviceNode(d)
+			}
+		}
+		cfg.Ports = append(cfg.Ports, port)
+	}
+
+	mem, err := cmdLine.SocketMem()
+	if err != nil {
+		tlog.WarnPrintf("%s: %v\n", app.Name, err)
+	}
+	cfg.SocketMem = mem
+
+	// The hugepages of all page sizes on each node
+	if pools, err := hugepages.New().Pools(); err == nil {
+		cfg.HugepagesMB = make(map[int]uint64)
+		for _, p := range pools {
+			cfg.HugepagesMB[p.Node] += p.Total * p.SizeKB / 1024
+		}
+	}
+
+	return dpdk.NumaAudit(cfg)
+}
+
+// displayNumaAudit displays the NUMA findings of the application, the most
+// severe first
+func (pg *DPDKPanel) displayNumaAudit(view *tview.TextView) {
+
+	if app := perfmon.dpdkApp.Get(); len(app.Name) == 0 {
+		view.SetText(cz.Wheat("No DPDK application selected"))
+		return
+	}
+	if len(pg.findings) == 0 {
+		view.SetText(cz.LightGreen("No NUMA locality problems found"))
+		return
+	}
+
+	str := ""
+	for i, f := range pg.findings {
+		sev := cz.SkyBlue(f.Severity, -8)
+		switch f.Severity {
+		case dpdk.Critical:
+			sev = cz.Red(f.Severity, -8)
+		case dpdk.Warning:
+			sev = cz.Orange(f.Severity, -8)
+		}
+		str += fmt.Sprintf("%2d %s %s\n", i+1, sev, cz.Wheat(f.Message))
+	}
+
+	view.SetText(str)
 }
 
 // displayDPDKInfo display the basic DPDK application information
@@ -432,26 +632,17 @@ func (pg *DPDKPanel) displayDPDKNet(view *tview.Table) {
 		row, _ = setCell(row, col, cz.DeepPink(stats.OutErrors), false)
 		row, _ = setCell(row, col, cz.DeepPink(stats.RxNomBuf), false)
 
-		prevStats := &pg.infoDPDK.PrevStats[eth.Stats.PortID].Stats
-
-		bytesIn := stats.InBytes - prevStats.InBytes
-		bytesOut := stats.OutBytes - prevStats.OutBytes
-
-		pktsIn := stats.InPackets - prevStats.InPackets
-		pktsOut := stats.OutPackets - prevStats.OutPackets
-
-		mbpsRx += BitRate(pktsIn, bytesIn)
-		mbpsTx += BitRate(pktsOut, bytesOut)
-
-		tlog.DebugPrintf("%d: Bytes in/out %d/%d, Pkts in/out %d/%d, Mbps in/out %.2f/%.2f\n",
-			eth.Stats.PortID, bytesIn, bytesOut, pktsIn, pktsOut, mbpsRx, mbpsTx)
-
-		pg.infoDPDK.PrevStats[eth.Stats.PortID] = *eth
+		// The rates are calculated when the stats are collected
+		rate, ok := pg.rates[eth.Stats.PortID]
+		if !ok {
+			continue
+		}
 
-		// Update the previous stats
-		pg.infoDPDK.PrevStats[eth.Stats.PortID].Stats = eth.Stats
+		mbpsRx += BitRate(uint64(rate.RxPkts), uint64(rate.RxBytes))
+		mbpsTx += BitRate(uint64(rate.TxPkts), uint64(rate.TxBytes))
 
-		tlog.DebugPrintf("Prev: %+v\n\n", pg.infoDPDK.PrevStats[eth.Stats.PortID])
+		tlog.DebugPrintf("%d: Bytes in/out %.0f/%.0f, Pkts in/out %.0f/%.0f, Mbps in/out %.2f/%.2f\n",
+			eth.Stats.PortID, rate.RxBytes, rate.TxBytes, rate.RxPkts, rate.TxPkts, mbpsRx, mbpsTx)
 	}
 	tlog.DebugPrintf("\n")
 
@@ -660,6 +851,9 @@ func (pg *DPDKPanel) displayBusy(percent []float64, start, end uint16, view *tvi
 		tlog.WarnPrintf("Core Busy Percentages not set\n")
 		return
 	}
+	if int(end) >= len(percent) {
+		end = uint16(len(percent) - 1)
+	}
 	_, _, width, _ := view.GetInnerRect()
 	width -= 25
 	if width <= 0 {
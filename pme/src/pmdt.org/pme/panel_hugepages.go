@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+	"pmdt.org/hugepages"
+
+	cz "pmdt.org/colorize"
+	tab "pmdt.org/taborder"
+	tlog "pmdt.org/ttylog"
+)
+
+// Display the hugepage pools of each NUMA node and page size, the hugetlbfs
+// mounts and the DPDK processes holding hugepages by file prefix. The pools
+// can be resized from the panel.
+
+// PageHugepages - Data for the Hugepages panel
+type PageHugepages struct {
+	tabOrder *tab.Tab
+	topFlex  *tview.Flex
+	pools    *tview.Table
+	mounts   *tview.Table
+	holders  *tview.Table
+	note     *tview.TextView
+
+	huge       *hugepages.Hugepages
+	poolData   []hugepages.Pool
+	mountData  []hugepages.Mount
+	holderData []hugepages.Holder
+	err        error
+}
+
+const (
+	hugepagesPanelName string = "Hugepages"
+)
+
+// Setup and create the Hugepages page structure
+func setupHugepages() *PageHugepages {
+
+	pg := &PageHugepages{}
+
+	pg.huge = hugepages.New()
+
+	return pg
+}
+
+// HugepagesPanelSetup setup the Hugepages panel
+func HugepagesPanelSetup(nextSlide func()) (pageName string, content tview.Primitive) {
+
+	pg := setupHugepages()
+
+	to := tab.New(hugepagesPanelName, perfmon.app)
+	pg.tabOrder = to
+
+	flex0 := tview.NewFlex().SetDirection(tview.FlexRow)
+	flex1 := tview.NewFlex().SetDirection(tview.FlexColumn)
+
+	TitleBox(flex0)
+	pg.topFlex = flex0
+
+	pg.pools = CreateTableView(flex0, "Hugepage Pools per NUMA Node - Enter to resize (p)",
+		tview.AlignLeft, 0, 2, true)
+	pg.pools.SetSeparator(tview.Borders.Vertical)
+	pg.pools.SetSelectable(true, false)
+	pg.pools.SetSelectedFunc(func(row, col int) {
+		pg.resizePool(row - 1)
+	})
+
+	pg.mounts = CreateTableView(flex1, "hugetlbfs Mounts (m)", tview.AlignLeft, 0, 1, true)
+	pg.mounts.SetSeparator(tview.Borders.Vertical)
+	pg.holders = CreateTableView(flex1, "Hugepage Holders by File Prefix (h)", tview.AlignLeft, 0, 1, true)
+	pg.holders.SetSeparator(tview.Borders.Vertical)
+	flex0.AddItem(flex1, 0, 2, true)
+
+	pg.note = CreateTextView(flex0, "Note", tview.AlignLeft, 4, 1, false)
+
+	to.Add(pg.pools, 'p')
+	to.Add(pg.mounts, 'm')
+	to.Add(pg.holders, 'h')
+
+	to.SetInputDone()
+
+	pg.displayNote("Select a pool and press Enter to change the number of hugepages on the node.\n" +
+		"Files without a process are left by DPDK applications that exited and still hold pages.")
+
+	perfmon.timers.Add(hugepagesPanelName, func(step int, ticks uint64) {
+		switch step {
+		case 0:
+			if pg.topFlex.HasFocus() {
+				pg.collectData()
+			}
+		case 1:
+			if pg.topFlex.HasFocus() {
+				perfmon.app.QueueUpdateDraw(func() {
+					pg.displayHugepagesPage()
+				})
+			}
+		}
+	})
+
+	return hugepagesPanelName, pg.topFlex
+}
+
+// Read the pools, mounts and holders of the hugepages
+func (pg *PageHugepages) collectData() {
+
+	pools, err := pg.huge.Pools()
+	if err != nil {
+		tlog.WarnPrintf("Hugepages: %v\n", err)
+	}
+	mounts, _ := pg.huge.Mounts()
+	holders, _ := pg.huge.Holders()
+
+	perfmon.app.QueueUpdate(func() {
+		pg.err = err
+		pg.poolData = pools
+		pg.mountData = mounts
+		pg.holderData = holders
+	})
+}
+
+// Display the Hugepages panel windows
+func (pg *PageHugepages) displayHugepagesPage() {
+
+	pg.displayPools(pg.pools)
+	pg.displayMounts(pg.mounts)
+	pg.displayHolders(pg.holders)
+}
+
+func (pg *PageHugepages) displayNote(msg string) {
+
+	pg.note.SetText(cz.Wheat(msg))
+}
+
+// Display the hugepage pools of each node and page size
+func (pg *PageHugepages) displayPools(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"Node", "Page Size", "Total", "Free", "Used", "Surplus", "Used MiB", "Used %"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	if pg.err != nil {
+		SetCell(view, row, 0, cz.Red(pg.err.Error()), tview.AlignLeft)
+		row++
+	}
+
+	for _, p := range pg.poolData {
+		used := p.Total - p.Free
+		percent := 0.0
+		if p.Total > 0 {
+			percent = float64(used) * 100.0 / float64(p.Total)
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(p.Node), tview.AlignLeft, true)
+		SetCell(view, row, 1, cz.SkyBlue(hugepages.FormatSize(p.SizeKB)), tview.AlignLeft, true)
+		SetCell(view, row, 2, cz.SkyBlue(p.Total), tview.AlignLeft, true)
+		SetCell(view, row, 3, cz.SkyBlue(p.Free), tview.AlignLeft, true)
+		SetCell(view, row, 4, cz.Orange(used), tview.AlignLeft, true)
+		SetCell(view, row, 5, cz.SkyBlue(p.Surplus), tview.AlignLeft, true)
+		SetCell(view, row, 6, cz.Wheat(used*p.SizeKB/1024), tview.AlignLeft, true)
+		SetCell(view, row, 7, cz.Wheat(percent, 0, 1), tview.AlignLeft, true)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the hugetlbfs mounts
+func (pg *PageHugepages) displayMounts(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"Mount", "Page Size", "Files", "Prefixes", "Options"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for _, m := range pg.mountData {
+		SetCell(view, row, 0, cz.LightGreen(m.Path), tview.AlignLeft)
+		SetCell(view, row, 1, cz.SkyBlue(hugepages.FormatSize(m.SizeKB)), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(m.Files), tview.AlignLeft)
+		SetCell(view, row, 3, cz.Wheat(strings.Join(m.Prefixes, ",")), tview.AlignLeft)
+		SetCell(view, row, 4, cz.Wheat(m.Options), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the processes and file prefixes holding hugepages
+func (pg *PageHugepages) displayHolders(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"Prefix", "PID", "Command", "Mount", "Files", "MiB"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for _, h := range pg.holderData {
+		pid, comm := cz.SkyBlue(h.PID), cz.SkyBlue(h.Comm)
+		if h.PID == 0 {
+			pid, comm = cz.Red("-"), cz.Red("no process")
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(h.Prefix), tview.AlignLeft)
+		SetCell(view, row, 1, pid, tview.AlignLeft)
+		SetCell(view, row, 2, comm, tview.AlignLeft)
+		SetCell(view, row, 3, cz.Wheat(h.Mount), tview.AlignLeft)
+		SetCell(view, row, 4, cz.SkyBlue(h.Files), tview.AlignLeft)
+		SetCell(view, row, 5, cz.SkyBlue(h.Bytes/(1024*1024)), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// resizePool changes the number of hugepages of the selected pool after the
+// user confirms the change.
+func (pg *PageHugepages) resizePool(idx int) {
+
+	if idx < 0 || idx >= len(pg.poolData) {
+		return
+	}
+	p := pg.poolData[idx]
+	size := hugepages.FormatSize(p.SizeKB)
+
+	title := fmt.Sprintf("Node %d %s hugepages", p.Node, size)
+	InputValue(title, "Pages", strconv.FormatUint(p.Total, 10), func(value string) {
+		pages, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			pg.displayNote(fmt.Sprintf("Invalid number of pages %q", value))
+			return
+		}
+
+		msg := fmt.Sprintf("Change node %d %s hugepages from %d to %d?", p.Node, size, p.Total, pages)
+		if used := p.Total - p.Free; pages < used {
+			msg += fmt.Sprintf("\n\n%d pages are in use, the pool shrinks as they are freed.", used)
+		}
+		Confirm(msg, func() {
+			if err := pg.huge.SetPages(p.Node, p.SizeKB, pages); err != nil {
+				tlog.ErrorPrintf("Hugepages: %v\n", err)
+				pg.displayNote(fmt.Sprintf("Failed: %v", err))
+			} else {
+				pg.displayNote(fmt.Sprintf("Node %d has %d %s hugepages", p.Node, pages, size))
+			}
+			go func() {
+				pg.collectData()
+				perfmon.app.QueueUpdateDraw(pg.displayHugepagesPage)
+			}()
+		})
+	})
+}
@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+	"pmdt.org/graphdata"
+	"pmdt.org/topology"
+
+	cz "pmdt.org/colorize"
+	tab "pmdt.org/taborder"
+	tlog "pmdt.org/ttylog"
+)
+
+// Audit the kernel noise on the lcores of the selected DPDK application. The
+// kernel isolation parameters of each lcore are checked, the interrupts each
+// lcore takes are counted every second and the other tasks allowed to run on
+// the lcores are listed. The per-CPU kernel threads bound to an lcore are
+// shown apart as they can not be moved. The audit restarts when another application is
+// selected.
+
+// PageNoise - Data for the Noise panel
+type PageNoise struct {
+	tabOrder *tab.Tab
+	topFlex  *tview.Flex
+	lcores   *tview.Table
+	tasks    *tview.Table
+	chart    *tview.TextView
+	note     *tview.TextView
+
+	noise  *topology.Noise
+	audit  *topology.Audit
+	pid    int   // Pid of the audited application
+	cpus   []int // Lcores of the audited application
+	irqs   *graphdata.GraphInfo
+	result []topology.CPUNoise
+	others []topology.Task
+	err    error
+}
+
+const (
+	noisePanelName string = "Noise"
+	maxNoisePoints int    = 120
+	maxNoiseCharts int    = 4
+)
+
+// Setup and create the Noise page structure
+func setupNoise() *PageNoise {
+
+	pg := &PageNoise{}
+
+	pg.noise = topology.NewNoise()
+	pg.irqs = graphdata.NewGraph(0)
+
+	return pg
+}
+
+// NoisePanelSetup setup the Noise panel
+func NoisePanelSetup(nextSlide func()) (pageName string, content tview.Primitive) {
+
+	pg := setupNoise()
+
+	to := tab.New(noisePanelName, perfmon.app)
+	pg.tabOrder = to
+
+	flex0 := tview.NewFlex().SetDirection(tview.FlexRow)
+	flex1 := tview.NewFlex().SetDirection(tview.FlexColumn)
+
+	TitleBox(flex0)
+	pg.topFlex = flex0
+
+	pg.lcores = CreateTableView(flex0, "Lcore Noise (l)", tview.AlignLeft, 0, 2, true)
+	pg.lcores.SetFixed(1, 0)
+	pg.lcores.SetSeparator(tview.Borders.Vertical)
+
+	pg.tasks = CreateTableView(flex1, "Other Tasks allowed on the Lcores (t)", tview.AlignLeft, 0, 1, true)
+	pg.tasks.SetFixed(1, 0)
+	pg.tasks.SetSeparator(tview.Borders.Vertical)
+	pg.chart = CreateTextView(flex1, "IRQs/s per Lcore (c)", tview.AlignLeft, 0, 1, true)
+	flex0.AddItem(flex1, 0, 3, true)
+
+	pg.note = CreateTextView(flex0, "Note", tview.AlignLeft, 6, 0, false)
+
+	to.Add(pg.lcores, 'l')
+	to.Add(pg.tasks, 't')
+	to.Add(pg.chart, 'c')
+
+	to.SetInputDone()
+
+	perfmon.timers.Add(noisePanelName, func(step int, ticks uint64) {
+		switch step {
+		case 0:
+			if pg.topFlex.HasFocus() {
+				pg.collectData()
+			}
+		case 1:
+			if pg.topFlex.HasFocus() {
+				perfmon.app.QueueUpdateDraw(func() {
+					pg.displayNoisePage()
+				})
+			}
+		}
+	})
+
+	return noisePanelName, pg.topFlex
+}
+
+// sameCPUs returns true if both lists have the same CPUs in the same order
+func sameCPUs(a, b []int) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Sample the noise of the lcores, a new audit is started when the
+// application or its lcores change
+func (pg *PageNoise) collectData() {
+
+	app := perfmon.dpdkApp.Get()
+	if len(app.LCores) == 0 {
+		perfmon.app.QueueUpdate(func() {
+			pg.result, pg.others, pg.err = nil, nil, nil
+		})
+		return
+	}
+
+	if pg.audit == nil || app.Pid != pg.pid || !sameCPUs(app.LCores, pg.cpus) {
+		audit, err := topology.NewAudit(pg.noise)
+		if err != nil {
+			tlog.WarnPrintf("Noise: %v\n", err)
+			perfmon.app.QueueUpdate(func() {
+				pg.err = err
+			})
+			return
+		}
+		irqs := graphdata.NewGraph(len(app.LCores))
+		for i, gd := range irqs.Graphs() {
+			gd.SetMaxPoints(maxNoisePoints)
+			gd.SetName(fmt.Sprintf("Lcore %d IRQs/s", app.LCores[i]))
+		}
+		irqs.SetFieldWidth(7)
+
+		pg.audit, pg.pid, pg.cpus = audit, app.Pid, app.LCores
+		perfmon.app.QueueUpdate(func() {
+			pg.irqs = irqs
+		})
+	}
+
+	err := pg.audit.Sample(pg.cpus, pg.pid)
+	if err != nil {
+		tlog.WarnPrintf("Noise: %v\n", err)
+	}
+	result := pg.audit.CPUs(pg.cpus)
+	others := pg.audit.Tasks()
+
+	// The graphs are in the order of the lcores of the application
+	points := make([]float64, len(pg.cpus))
+	for i, c := range pg.cpus {
+		for _, cn := range result {
+			if cn.CPU == c {
+				points[i] = cn.IRQRate
+			}
+		}
+	}
+
+	perfmon.app.QueueUpdate(func() {
+		pg.result, pg.others, pg.err = result, others, err
+
+		for i, gd := range pg.irqs.Graphs() {
+			if i < len(points) {
+				gd.AddPoint(points[i])
+			}
+		}
+	})
+}
+
+// Display the Noise panel windows
+func (pg *PageNoise) displayNoisePage() {
+
+	pg.displayLcores(pg.lcores)
+	pg.displayTasks(pg.tasks)
+	pg.displayChart(pg.chart)
+	pg.displayNote()
+}
+
+// flagStr returns the kernel parameter state of an lcore, an lcore without
+// the parameter is shown in red
+func flagStr(set bool) string {
+
+	if set {
+		return cz.LightGreen("yes")
+	}
+	return cz.Red("no")
+}
+
+// Display the kernel parameters, interrupts and tasks of each lcore
+func (pg *PageNoise) displayLcores(view *tview.Table) {
+
+	row := 0
+	for col, name := range []string{"CPU", "isolcpus", "nohz_full", "rcu_nocbs", "IRQs/s",
+		"IRQ Total", "Noisy Secs", "Top IRQ", "Tasks", "Kthreads", "Bound Kthreads"} {
+		SetCell(view, row, col, cz.Orange(name), tview.AlignLeft)
+	}
+	row++
+
+	for _, cn := range pg.result {
+		irqs := cz.LightGreen(cn.IRQRate, 0, 1)
+		if cn.IRQs > 0 {
+			irqs = cz.Red(cn.IRQRate, 0, 1)
+		}
+		tasks := cz.LightGreen(cn.Tasks)
+		if cn.Tasks > 0 {
+			tasks = cz.Red(cn.Tasks)
+		}
+
+		SetCell(view, row, 0, cz.Yellow(CPULabel(cn.CPU)), tview.AlignLeft)
+		SetCell(view, row, 1, flagStr(cn.Isolated), tview.AlignLeft)
+		SetCell(view, row, 2, flagStr(cn.NoHzFull), tview.AlignLeft)
+		SetCell(view, row, 3, flagStr(cn.RcuNoCbs), tview.AlignLeft)
+		SetCell(view, row, 4, irqs, tview.AlignLeft)
+		SetCell(view, row, 5, cz.SkyBlue(cn.IRQTotal), tview.AlignLeft)
+		SetCell(view, row, 6, cz.SkyBlue(cn.Intervals), tview.AlignLeft)
+		SetCell(view, row, 7, cz.Wheat(cn.TopIRQ), tview.AlignLeft)
+		SetCell(view, row, 8, tasks, tview.AlignLeft)
+		SetCell(view, row, 9, cz.SkyBlue(cn.Kernel), tview.AlignLeft)
+		SetCell(view, row, 10, cz.SkyBlue(cn.Bound), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the tasks other than the application allowed on the lcores
+func (pg *PageNoise) displayTasks(view *tview.Table) {
+
+	row := 0
+	for col, name := range []string{"PID", "TID", "Name", "Type", "Lcores"} {
+		SetCell(view, row, col, cz.Orange(name), tview.AlignLeft)
+	}
+	row++
+
+	for _, t := range pg.others {
+		kind := cz.Red("user")
+		switch {
+		case t.Bound:
+			kind = cz.Wheat("bound")
+		case t.Kernel:
+			kind = cz.SkyBlue("kernel")
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(t.PID), tview.AlignLeft)
+		SetCell(view, row, 1, cz.LightGreen(t.TID), tview.AlignLeft)
+		SetCell(view, row, 2, cz.Wheat(t.Name), tview.AlignLeft)
+		SetCell(view, row, 3, kind, tview.AlignLeft)
+		SetCell(view, row, 4, cz.Yellow(cpuList(t.CPUs)), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the interrupts per second of the first lcores over time
+func (pg *PageNoise) displayChart(view *tview.TextView) {
+
+	n := pg.irqs.NumGraphs()
+	if n == 0 {
+		view.SetText("")
+		return
+	}
+	if n > maxNoiseCharts {
+		n = maxNoiseCharts
+	}
+	view.SetText(pg.irqs.MakeChart(view, 0, n-1))
+}
+
+// Display the lcores missing the isolation parameters and the errors
+func (pg *PageNoise) displayNote() {
+
+	str := ""
+	if pg.err != nil {
+		str += cz.Red(pg.err.Error()) + "\n"
+	}
+	if len(pg.result) == 0 {
+		str += cz.Orange("Select a DPDK application on the DPDK panel to audit its lcores") + "\n"
+		pg.note.SetText(str)
+		return
+	}
+
+	missing := []int{}
+	user := 0
+	for _, cn := range pg.result {
+		if !cn.Isolated || !cn.NoHzFull || !cn.RcuNoCbs {
+			missing = append(missing, cn.CPU)
+		}
+		user += cn.Tasks
+	}
+	if len(missing) > 0 {
+		str += cz.Red(fmt.Sprintf("Lcores %s are missing from isolcpus, nohz_full or rcu_nocbs", cpuList(missing))) + "\n"
+	}
+	if user > 0 {
+		str += cz.Red("Other user tasks can be scheduled on the lcores, set their affinity away from the lcores") + "\n"
+	}
+	str += cz.Wheat("Noisy Secs is the number of seconds an lcore took interrupts, the chart shows the first lcores.\n")
+	str += cz.Wheat("Bound Kthreads are per-CPU kernel threads like ksoftirqd, they can not be moved")
+
+	pg.note.SetText(str)
+}
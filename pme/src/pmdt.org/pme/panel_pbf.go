@@ -5,17 +5,26 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	cz "pmdt.org/colorize"
+	"pmdt.org/dpdk"
 	"pmdt.org/graphdata"
 	pbf "pmdt.org/intelpbf"
+	"pmdt.org/pcm"
 	tab "pmdt.org/taborder"
+	"pmdt.org/topology"
+	tlog "pmdt.org/ttylog"
 )
 
 // Create and display the PBF or Power Base Frequency information.
 // Older system like Ubuntu do not have the kernel modules loaded or avaiable.
 // Ubuntu 18.04 does have the files in the /sys directory.
+//
+// The SST-BF high priority cores are marked and can be pinned to their base
+// frequency, the DPDK lcores can be pinned to the base frequency of their core.
 
 // PagePBF - Data for Power Base Frequency
 type PagePBF struct {
@@ -25,9 +34,13 @@ type PagePBF struct {
 	selectCore       *SelectWindow
 	pbf              *tview.Table
 	chart            *tview.TextView
+	note             *tview.TextView
 	selected         int
 	selectionChanged bool
 	freqs            *graphdata.GraphInfo
+	sst              pbf.SSTBF
+	sstErr           error
+	actionErr        error
 }
 
 const (
@@ -46,8 +59,11 @@ func setupPBF() *PagePBF {
 	}
 	pg.freqs.SetFieldWidth(5)
 
+	pg.selected = onlineCPU(0)
 	pg.selectionChanged = true
 
+	pg.sst, pg.sstErr = pbf.HighPriorityCores(OnlineCPUs())
+
 	return pg
 }
 
@@ -74,25 +90,23 @@ func PBFPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	// Select window setup and callback function when selection changes.
 	pg.selectCore = NewSelectWindow(table, "PBF", 0, func(row, col int) {
 
-		if row != pg.selected {
+		if cpu := onlineCPU(row); cpu != pg.selected {
 			pg.selectCore.UpdateItem(row, col)
 
 			pg.selectionChanged = true
 
-			pg.selected = row
+			pg.selected = cpu
 			pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selected)))
 		}
 	})
 
-	names := make([]interface{}, 0)
+	pg.selectCore.AddColumn(-1, cpuNames(), cz.SkyBlueColor)
 
-	for i := 0; i < NumCPUs(); i++ {
-		s := fmt.Sprintf("%4d", i)
-		names = append(names, s)
+	title := "Power Base Frequency (p)"
+	if !CPUIdent().Has(pcm.FeaturePBF) {
+		title = "Power Base Frequency - SST-BF not supported (p)"
 	}
-	pg.selectCore.AddColumn(-1, names, cz.SkyBlueColor)
-
-	pg.pbf = CreateTableView(flex1, "Power Base Frequency (p)", tview.AlignLeft, 0, 2, true)
+	pg.pbf = CreateTableView(flex1, title, tview.AlignLeft, 0, 2, true)
 	pg.pbf.SetFixed(1, 0)
 	pg.pbf.SetSeparator(tview.Borders.Vertical)
 
@@ -102,12 +116,43 @@ func PBFPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 
 	flex0.AddItem(flex2, 0, 1, true)
 
+	pg.note = CreateTextView(flex0, "Note", tview.AlignLeft, 7, 1, false)
+
 	to.Add(pg.selectCore.table, 'c')
 	to.Add(pg.pbf, 'p')
 	to.Add(pg.chart, 'C')
 
 	to.SetInputDone()
 
+	// The SST-BF keys are handled after the tab order keys of the table
+	capture := pg.pbf.GetInputCapture()
+	pg.pbf.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+		if capture != nil {
+			if ev = capture(ev); ev == nil {
+				return nil
+			}
+		}
+		switch ev.Rune() {
+		case 'h':
+			pg.pinHighPriority()
+		case 'l':
+			pg.pinLCores()
+		case 'r':
+			pg.resetFrequencies()
+		case 'g':
+			pg.governorAction()
+		case 'd':
+			pg.cstateAction()
+		case 'm':
+			pg.pinMinAction()
+		case 'o':
+			pg.restoreAction()
+		default:
+			return ev
+		}
+		return nil
+	})
+
 	// Create timer and callback function to display and process PBF data
 	perfmon.timers.Add(pbfPanelName, func(step int, ticks uint64) {
 		// up to 4 cases, done every second
@@ -132,12 +177,13 @@ func (pg *PagePBF) displayPBFPage() {
 
 	pg.displayPBF(pg.pbf)
 	pg.displayFreqChart()
+	pg.displayNote()
 
 	if pg.selectionChanged {
 		pg.selectionChanged = false
 		pg.pbf.ScrollToBeginning()
 		pg.chart.ScrollToBeginning()
-		pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selectCore.ItemIndex())))
+		pg.chart.SetTitle(TitleColor(fmt.Sprintf("CPU %d (C)", pg.selected)))
 	}
 }
 
@@ -145,11 +191,19 @@ func (pg *PagePBF) displayPBFPage() {
 func (pg *PagePBF) collectChartData() {
 
 	for cpu, gd := range pg.freqs.Graphs() {
-		p := pbf.InfoPerCPU(cpu)
-
 		// Append the frequency data to the list for the graphing in a chart
-		gd.AddPoint(float64(p.CurFreq))
+		gd.AddPoint(chartFreq(cpu))
+	}
+}
+
+// chartFreq returns the effective busy frequency of the CPU or the cpufreq
+// current frequency when the MSRs are not readable
+func chartFreq(cpu int) float64 {
+
+	if f := EffFreq(cpu); f.Valid {
+		return f.BusyMHz
 	}
+	return float64(pbf.InfoPerCPU(cpu).CurFreq)
 }
 
 // Display the PBF data in the table view
@@ -161,26 +215,47 @@ func (pg *PagePBF) displayPBF(view *tview.Table) {
 	SetCell(pg.pbf, 0, 2, cz.Orange("Min", 6))
 	SetCell(pg.pbf, 0, 3, cz.Orange("Curr", 6))
 	SetCell(pg.pbf, 0, 4, cz.Orange("Governor", 10))
+	SetCell(pg.pbf, 0, 5, cz.Orange("SST-BF", 6))
+	SetCell(pg.pbf, 0, 6, cz.Orange("DPDK", 6))
 
 	// Display the CState names as columns
-	p := pbf.InfoPerCPU(0)
+	p := pbf.InfoPerCPU(onlineCPU(0))
 	for j, v := range p.CStateNames {
-		SetCell(pg.pbf, 0, 5+j, cz.Orange(v, 6))
+		SetCell(pg.pbf, 0, 7+j, cz.Orange(v, 6))
 	}
 
-	// For the number of CPUs display the data one CPU per line
-	for i := 0; i < NumCPUs(); i++ {
+	lcores := perfmon.dpdkApp.Get().LCores
+
+	// For the online CPUs display the data one CPU per line
+	for n, i := range OnlineCPUs() {
 		p := pbf.InfoPerCPU(i)
+		row := n + 1
+
+		SetCell(pg.pbf, row, 0, cz.LightGreen(CPULabel(i)))
+		SetCell(pg.pbf, row, 1, cz.SkyBlue(p.MaxFreq))
+		SetCell(pg.pbf, row, 2, cz.SkyBlue(p.MinFreq))
+		SetCell(pg.pbf, row, 3, cz.LightGreen(p.CurFreq))
+		SetCell(pg.pbf, row, 4, cz.CornSilk(p.Governor))
+
+		switch {
+		case !pg.sst.Enabled:
+			SetCell(pg.pbf, row, 5, cz.SkyBlue("-"))
+		case pg.sst.IsHighPriority(i):
+			SetCell(pg.pbf, row, 0, cz.Red(CPULabel(i)))
+			SetCell(pg.pbf, row, 5, cz.Red("High"))
+		default:
+			SetCell(pg.pbf, row, 5, cz.SkyBlue("Low"))
+		}
 
-		SetCell(pg.pbf, i+1, 0, cz.LightGreen(i))
-		SetCell(pg.pbf, i+1, 1, cz.SkyBlue(p.MaxFreq))
-		SetCell(pg.pbf, i+1, 2, cz.SkyBlue(p.MinFreq))
-		SetCell(pg.pbf, i+1, 3, cz.LightGreen(p.CurFreq))
-		SetCell(pg.pbf, i+1, 4, cz.CornSilk(p.Governor))
+		if dpdk.IsLCoreUsed(i, lcores) {
+			SetCell(pg.pbf, row, 6, cz.Yellow("lcore"))
+		} else {
+			SetCell(pg.pbf, row, 6, cz.SkyBlue("-"))
+		}
 
 		// Output the CStates per CPU per line
 		for j, v := range p.CStates {
-			SetCell(pg.pbf, i+1, 5+j, cz.LightGreen(v, 6))
+			SetCell(pg.pbf, row, 7+j, cz.LightGreen(v, 6))
 		}
 	}
 }
@@ -190,3 +265,214 @@ func (pg *PagePBF) displayFreqChart() {
 
 	pg.chart.SetText(pg.freqs.MakeChart(pg.chart, pg.selected, pg.selected))
 }
+
+// cpuList returns the CPUs as a DPDK -l list
+func cpuList(cpus []int) string {
+	return topology.FormatCPUList(cpus)
+}
+
+// Display the SST-BF cores, the DPDK lcores not on high priority cores and
+// the result of the last action
+func (pg *PagePBF) displayNote() {
+
+	str := ""
+	switch {
+	case pg.sstErr != nil:
+		str += cz.Red(pg.sstErr.Error()) + "\n"
+	case !pg.sst.Enabled:
+		str += cz.Wheat(fmt.Sprintf("SST-BF is not enabled, all cores have a base frequency of %d MHz\n",
+			pg.sst.HighBaseMHz))
+	default:
+		str += fmt.Sprintf("%s %s at %s MHz, the other cores at %s MHz\n",
+			cz.Wheat("SST-BF high priority cores"), cz.Red(cpuList(pg.sst.HighPriority)),
+			cz.Red(pg.sst.HighBaseMHz), cz.SkyBlue(pg.sst.LowBaseMHz))
+
+		app := perfmon.dpdkApp.Get()
+		low := []int{}
+		for _, c := range app.LCores {
+			if !pg.sst.IsHighPriority(c) {
+				low = append(low, c)
+			}
+		}
+		if len(low) > 0 {
+			str += cz.Orange(fmt.Sprintf("%s lcores %s are on low priority cores, restart it with -l using the high priority cores\n",
+				app.Name, cpuList(low)))
+		}
+	}
+
+	if pg.actionErr != nil {
+		str += cz.Red(pg.actionErr.Error()) + "\n"
+	}
+	str += cz.Wheat("'h' pins the high priority cores to their base frequency, 'l' pins the DPDK lcores, 'r' resets the frequency range\n")
+	str += cz.Wheat("'g' sets the governor, 'd' disables deep C-states, 'm' pins the min to the max frequency of a CPU list, 'o' restores the original settings")
+
+	pg.note.SetText(str)
+}
+
+// setFrequencies runs the frequency change of each CPU after the user
+// confirms, the first error is shown in the note
+func (pg *PagePBF) setFrequencies(msg string, cpus []int, set func(cpu int) error) {
+
+	if len(cpus) == 0 {
+		return
+	}
+	Confirm(msg, func() {
+		pg.applyAll(cpus, set)
+	})
+}
+
+// applyAll saves the settings of the CPUs and applies the change to each
+// CPU, the first error is shown in the note
+func (pg *PagePBF) applyAll(cpus []int, set func(cpu int) error) {
+
+	saveCPUSettings(cpus)
+
+	pg.actionErr = nil
+	for _, cpu := range cpus {
+		if err := set(cpu); err != nil {
+			tlog.ErrorPrintf("PBF: %v\n", err)
+			pg.actionErr = err
+			break
+		}
+	}
+	pg.displayPBFPage()
+}
+
+// pinHighPriority pins the SST-BF high priority cores to their base frequency
+func (pg *PagePBF) pinHighPriority() {
+
+	if !pg.sst.Enabled {
+		return
+	}
+	mhz := pg.sst.HighBaseMHz
+	msg := fmt.Sprintf("Set the min and max frequency of the high priority cores %s to %d MHz?",
+		cpuList(pg.sst.HighPriority), mhz)
+
+	pg.setFrequencies(msg, pg.sst.HighPriority, func(cpu int) error {
+		return pbf.SetFrequencyRange(cpu, mhz, mhz)
+	})
+}
+
+// pinLCores pins the DPDK lcores to the base frequency of their core
+func (pg *PagePBF) pinLCores() {
+
+	app := perfmon.dpdkApp.Get()
+	if len(app.LCores) == 0 || pg.sstErr != nil {
+		return
+	}
+	msg := fmt.Sprintf("Set the min and max frequency of the %s lcores %s to their base frequency?",
+		app.Name, cpuList(app.LCores))
+
+	pg.setFrequencies(msg, app.LCores, func(cpu int) error {
+		mhz := pbf.BaseFrequency(cpu)
+		return pbf.SetFrequencyRange(cpu, mhz, mhz)
+	})
+}
+
+// resetFrequencies sets the frequency range of all CPUs to the CPU limits
+func (pg *PagePBF) resetFrequencies() {
+
+	pg.setFrequencies("Reset the min and max frequency of all CPUs to the CPU limits?",
+		OnlineCPUs(), pbf.ResetFrequencyRange)
+}
+
+// defaultCPUs returns the DPDK lcores or the selected CPU as a CPU list
+func (pg *PagePBF) defaultCPUs() string {
+
+	if lcores := perfmon.dpdkApp.Get().LCores; len(lcores) > 0 {
+		return cpuList(lcores)
+	}
+	return strconv.Itoa(pg.selected)
+}
+
+// askCPUs asks for the list of CPUs to change, the default is the DPDK
+// lcores or the selected CPU
+func (pg *PagePBF) askCPUs(title string, action func(cpus []int)) {
+
+	InputValue(title, "CPUs", pg.defaultCPUs(), func(value string) {
+		cpus, err := topology.ParseCPUList(value)
+		if err == nil && len(cpus) == 0 {
+			err = fmt.Errorf("no CPUs in %q", value)
+		}
+		for _, c := range cpus {
+			if err == nil && !Topology().IsOnline(c) {
+				err = fmt.Errorf("CPU %d is not online", c)
+			}
+		}
+		if err != nil {
+			pg.actionErr = err
+			pg.displayNote()
+			return
+		}
+		action(cpus)
+	})
+}
+
+// governorAction sets the governor of a list of CPUs
+func (pg *PagePBF) governorAction() {
+
+	pg.askCPUs("Set the governor of the CPUs", func(cpus []int) {
+		govs := pbf.AvailableGovernors(cpus[0])
+		if len(govs) == 0 {
+			return
+		}
+		msg := fmt.Sprintf("Governor of CPUs %s", cpuList(cpus))
+		Choose(msg, govs, func(gov string) {
+			pg.applyAll(cpus, func(cpu int) error {
+				return pbf.SetGovernor(cpu, gov)
+			})
+		})
+	})
+}
+
+// cstateAction disables the deep C-states of a list of CPUs
+func (pg *PagePBF) cstateAction() {
+
+	pg.askCPUs("Disable the deep C-states of the CPUs", func(cpus []int) {
+		num := pbf.NumCStates(cpus[0])
+		if num == 0 {
+			return
+		}
+
+		// Each choice disables the state and the deeper states
+		choices := []string{}
+		from := make(map[string]int)
+		for state := 1; state < num; state++ {
+			name := pbf.CStateName(cpus[0], state) + " and deeper"
+			choices = append(choices, name)
+			from[name] = state
+		}
+		choices = append(choices, "Enable all")
+		from["Enable all"] = num
+
+		msg := fmt.Sprintf("C-states to disable on CPUs %s", cpuList(cpus))
+		Choose(msg, choices, func(choice string) {
+			pg.applyAll(cpus, func(cpu int) error {
+				return pbf.DisableDeepCStates(cpu, from[choice])
+			})
+		})
+	})
+}
+
+// pinMinAction sets the min frequency to the max frequency of a CPU list
+func (pg *PagePBF) pinMinAction() {
+
+	pg.askCPUs("Pin the min frequency to the max", func(cpus []int) {
+		msg := fmt.Sprintf("Set the min frequency of CPUs %s to their max frequency?", cpuList(cpus))
+		pg.setFrequencies(msg, cpus, pbf.PinMinToMax)
+	})
+}
+
+// restoreAction restores the settings saved before the first change
+func (pg *PagePBF) restoreAction() {
+
+	cpus := savedCPUs()
+	if len(cpus) == 0 {
+		return
+	}
+	msg := fmt.Sprintf("Restore the original governor, frequency and C-state settings of CPUs %s?", cpuList(cpus))
+	Confirm(msg, func() {
+		pg.actionErr = RestoreCPUSettings()
+		pg.displayPBFPage()
+	})
+}
@@ -7,9 +7,11 @@ import (
 	"bufio"
 	"fmt"
 	"os/exec"
+	"sort"
 	"sync"
 
 	"github.com/rivo/tview"
+	"pmdt.org/devbind"
 	"pmdt.org/graphdata"
 	"pmdt.org/pcm"
 
@@ -29,6 +31,7 @@ type PagePCI struct {
 	topFlex    *tview.Flex
 	title      *tview.Box
 	pci        *tview.Table
+	devices    *tview.Table
 	legend     [2]*tview.TextView
 	mmio       *tview.TextView
 	note       *tview.TextView
@@ -37,6 +40,8 @@ type PagePCI struct {
 	charts     *graphdata.GraphInfo
 	pciRedraw  bool
 	once       sync.Once
+	header     pcm.Header
+	valid      bool
 }
 
 const (
@@ -83,6 +88,10 @@ func PCIPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	pg.pciCharts[0] = CreateTextView(flex3, "PCI Charts (1)", tview.AlignLeft, 0, 1, true)
 	pg.pciCharts[1] = CreateTextView(flex3, "PCI Charts (2)", tview.AlignLeft, 0, 1, true)
 
+	// Estimated share of the socket PCIe bandwidth for each device
+	pg.devices = CreateTableView(flex1, "Device Attribution (d)", tview.AlignLeft, 0, 1, true)
+	pg.devices.SetSeparator(tview.Borders.Vertical)
+
 	flex1.AddItem(flex3, 0, 2, true)
 	pg.legend[0] = CreateTextView(flex1c, "Legend", tview.AlignLeft, 0, 1, true)
 	pg.legend[1] = CreateTextView(flex1c, "Legend", tview.AlignLeft, 0, 1, true)
@@ -97,6 +106,7 @@ func PCIPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	flex0.AddItem(flex1, 0, 2, true)
 
 	to.Add(pg.pci, 'p')
+	to.Add(pg.devices, 'd')
 
 	// pg.note does not have a focus key
 	to.Add(pg.pciCharts[0], '1')
@@ -170,6 +180,7 @@ func (pg *PagePCI) displayPCIPage(step int, ticks uint64) {
 	case 0: // Display the data that was gathered every second
 		pg.collectChartData()
 		pg.displayPCI(pg.pci)
+		pg.displayDevices(pg.devices)
 		pg.displayCharts(pg.pciCharts[0], 0, 0)
 		pg.displayCharts(pg.pciCharts[1], 1, 1)
 	}
@@ -277,6 +288,102 @@ func (pg *PagePCI) displayPCI(view *tview.Table) {
 	}
 }
 
+// pciDevices returns the network devices and any device used by a DPDK port
+func (pg *PagePCI) pciDevices(app *DPDKAppState) []*devbind.DeviceClass {
+
+	db := perfmon.devbind
+	if db == nil {
+		return nil
+	}
+
+	found := db.FindDevicesByDeviceClass("Network", db.Groups[devbind.NetworkGroup])
+	if found == nil {
+		found = make(map[string]*devbind.DeviceClass)
+	}
+	for _, p := range app.Ports {
+		if d, ok := db.Device(p.Slot); ok {
+			found[p.Slot] = d
+		}
+	}
+
+	devs := make([]*devbind.DeviceClass, 0, len(found))
+	for _, d := range found {
+		devs = append(devs, d)
+	}
+	sort.Slice(devs, func(i, j int) bool {
+		return devs[i].Slot < devs[j].Slot
+	})
+
+	return devs
+}
+
+// Display the estimated PCIe bandwidth of each device
+func (pg *PagePCI) displayDevices(view *tview.Table) {
+
+	if !pg.valid {
+		if err := perfmon.pinfoPCM.Unmarshal(nil, "/pcm/header", &pg.header); err != nil {
+			tlog.ErrorPrintf("Unable to get PCM header information\n")
+			return
+		}
+		pg.valid = true
+	}
+
+	ps := pcm.PCIeSampleData{}
+	if err := perfmon.pinfoPCM.Unmarshal(nil, "/pcm/pcie", &ps); err != nil {
+		tlog.ErrorPrintf("Error on command: %s\n", err)
+		return
+	}
+
+	app := perfmon.dpdkApp.Get()
+	shares, others := attributePCIe(&ps, pg.header.Data.PollMs, pg.pciDevices(&app), &app, Topology())
+
+	view.Clear()
+
+	row := 0
+	for i, s := range []string{"Slot", "Interface", "Socket", "Port",
+		"Rd MB/s", "Rd %", "Wr MB/s", "Wr %", "Note"} {
+		SetCell(view, row, i, cz.Orange(s, 9), tview.AlignRight)
+	}
+	row++
+
+	if len(shares) == 0 {
+		SetCell(view, row, 0, cz.Wheat("No network devices found"), tview.AlignLeft)
+		return
+	}
+
+	for _, d := range shares {
+		port := "-"
+		if d.PortID >= 0 {
+			port = fmt.Sprintf("%d", d.PortID)
+		}
+		note := cz.Wheat(d.Note)
+		if d.CrossSocket {
+			note = cz.Red("Cross-Socket: " + d.Note)
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(d.Slot), tview.AlignLeft)
+		SetCell(view, row, 1, cz.SkyBlue(d.Interface), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(d.Socket), tview.AlignRight)
+		SetCell(view, row, 3, cz.SkyBlue(port), tview.AlignRight)
+		SetCell(view, row, 4, cz.SkyBlue(d.ReadBW/1e6, 0, 1), tview.AlignRight)
+		SetCell(view, row, 5, cz.SkyBlue(d.ReadShare*100.0, 0, 1), tview.AlignRight)
+		SetCell(view, row, 6, cz.SkyBlue(d.WriteBW/1e6, 0, 1), tview.AlignRight)
+		SetCell(view, row, 7, cz.SkyBlue(d.WriteShare*100.0, 0, 1), tview.AlignRight)
+		SetCell(view, row, 8, note, tview.AlignLeft)
+		row++
+	}
+
+	// Bandwidth of the socket not accounted for by a DPDK port
+	for _, o := range others {
+		SetCell(view, row, 0, cz.Orange("Other"), tview.AlignLeft)
+		SetCell(view, row, 1, cz.Wheat("unattributed"), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(o.Socket), tview.AlignRight)
+		SetCell(view, row, 4, cz.SkyBlue(o.ReadBW/1e6, 0, 1), tview.AlignRight)
+		SetCell(view, row, 6, cz.SkyBlue(o.WriteBW/1e6, 0, 1), tview.AlignRight)
+		row++
+	}
+}
+
 // Create and display charts of the PCIe data
 func (pg *PagePCI) displayCharts(view *tview.TextView, start, end int) {
 	view.SetText(pg.charts.MakeChart(view, start, end))
@@ -69,16 +69,20 @@ func QPIPanelSetup(nextSlide func()) (pageName string, content tview.Primitive)
 	TitleBox(flex0)
 	pg.topFlex = flex0
 
-	pg.qpi = CreateTableView(flex1, "QPI (1)", tview.AlignLeft, 0, 1, true)
+	// Sockets are connected by QPI on older servers and UPI on Skylake-SP and
+	// later, use the name the CPU supports in the window titles.
+	link := pg.linkName()
+
+	pg.qpi = CreateTableView(flex1, link+" (1)", tview.AlignLeft, 0, 1, true)
 	pg.qpi.SetSeparator(tview.Borders.Vertical)
-	pg.qpiTotals = CreateTableView(flex1, "QPI Totals (2)", tview.AlignLeft, 0, 1, true)
+	pg.qpiTotals = CreateTableView(flex1, link+" Totals (2)", tview.AlignLeft, 0, 1, true)
 	pg.qpiTotals.SetFixed(0, 0)
 	pg.qpiTotals.SetSeparator(tview.Borders.Vertical)
 
 	flex0.AddItem(flex1, 0, 1, true)
 
-	pg.qpiCharts[0] = CreateTextView(flex2, "QPI Charts (3)", tview.AlignLeft, 0, 1, true)
-	pg.qpiCharts[1] = CreateTextView(flex2, "QPI Charts (4)", tview.AlignLeft, 0, 1, true)
+	pg.qpiCharts[0] = CreateTextView(flex2, link+" Charts (3)", tview.AlignLeft, 0, 1, true)
+	pg.qpiCharts[1] = CreateTextView(flex2, link+" Charts (4)", tview.AlignLeft, 0, 1, true)
 
 	flex0.AddItem(flex2, 0, 2, true)
 
@@ -119,6 +123,15 @@ func (pg *PageQPI) displayQPIPage(step int, ticks uint64) {
 	}
 }
 
+// linkName returns the socket interconnect name for the CPU
+func (pg *PageQPI) linkName() string {
+
+	if link := CPUIdent().Interconnect(); len(link) > 0 {
+		return link
+	}
+	return "QPI"
+}
+
 func (pg *PageQPI) staticQPIData() {
 
 	if pg.valid {
@@ -162,14 +175,18 @@ func (pg *PageQPI) displayQPI(view *tview.Table) {
 
 	SetCell(view, 0, 0, fmt.Sprintf("%s: %s", cz.Wheat("PCM Version"), cz.SkyBlue(hdr.Version)), tview.AlignLeft)
 	SetCell(view, 0, 1, fmt.Sprintf("%s: %sms", cz.Wheat("PollRate"), cz.SkyBlue(hdr.PollMs)), tview.AlignLeft)
-	SetCell(view, 0, 2, fmt.Sprintf("%s: %s", cz.Wheat("CPU Model "), cz.SkyBlue(pcm.CPUModel(int(sys.CPUModel)))), tview.AlignLeft)
+	SetCell(view, 0, 2, fmt.Sprintf("%s: %s", cz.Wheat("CPU Model "), cz.SkyBlue(CPUIdent())), tview.AlignLeft)
 
 	SetCell(view, 1, 0, fmt.Sprintf("%s: %s", cz.Wheat("NumCores   "), cz.SkyBlue(sys.NumOfCores)), tview.AlignLeft)
 	SetCell(view, 1, 1, fmt.Sprintf("%s: %s", cz.Wheat("Online  "), cz.SkyBlue(sys.NumOfOnlineCores)), tview.AlignLeft)
-	SetCell(view, 1, 2, fmt.Sprintf("%s: %s", cz.Wheat("QPILinks  "), cz.SkyBlue(sys.NumOfQPILinksPerSocket)), tview.AlignLeft)
+	SetCell(view, 1, 2, fmt.Sprintf("%s: %s", cz.Wheat(fmt.Sprintf("%-10s", pg.linkName()+"Links")), cz.SkyBlue(sys.NumOfQPILinksPerSocket)), tview.AlignLeft)
 	SetCell(view, 2, 0, fmt.Sprintf("%s: %s", cz.Wheat("NumSockets "), cz.SkyBlue(sys.NumOfSockets)), tview.AlignLeft)
 	SetCell(view, 2, 1, fmt.Sprintf("%s: %s", cz.Wheat("Online  "), cz.SkyBlue(sys.NumOfOnlineSockets)), tview.AlignLeft)
 
+	if len(CPUIdent().Interconnect()) == 0 {
+		SetCell(view, 3, 0, cz.Orange("CPU has no socket interconnect links"), tview.AlignLeft)
+	}
+
 	if pg.qpiRedraw {
 		pg.qpiRedraw = false
 		view.ScrollToBeginning()
@@ -202,13 +219,13 @@ func (pg *PageQPI) displayQPITotals(view *tview.Table) {
 		return
 	}
 
-	for i, s := range []string{"Incoming QPI", "LinkID", "Bytes", "Utilization", "Total"} {
+	for i, s := range []string{"Incoming " + pg.linkName(), "LinkID", "Bytes", "Utilization", "Total"} {
 		SetCell(view, 0, i, cz.Orange(s), tview.AlignRight)
 	}
 
 	row := pg.fillQPITable(view, 1, qpi.Incoming)
 
-	SetCell(view, row, 0, cz.Orange("Outgoing QPI"))
+	SetCell(view, row, 0, cz.Orange("Outgoing "+pg.linkName()))
 	row++
 
 	pg.fillQPITable(view, row, qpi.Outgoing)
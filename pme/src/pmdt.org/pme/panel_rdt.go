@@ -0,0 +1,383 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+	"pmdt.org/pcm"
+	"pmdt.org/resctrl"
+
+	cz "pmdt.org/colorize"
+	tab "pmdt.org/taborder"
+	tlog "pmdt.org/ttylog"
+)
+
+// Display the Intel RDT classes of service from the resctrl file system with
+// the cache occupancy and memory bandwidth of each group. The PCM per core
+// RDT counters are displayed for the cores in each class of service.
+
+// PageRDT - Data for the RDT panel
+type PageRDT struct {
+	tabOrder *tab.Tab
+	topFlex  *tview.Flex
+	info     *tview.TextView
+	groups   *tview.Table
+	monitors *tview.Table
+	cores    *tview.Table
+	note     *tview.TextView
+
+	rdt      *resctrl.Resctrl
+	rdtInfo  *resctrl.Info
+	err      error
+	clos     []*resctrl.Group
+	prev     map[string]resctrl.MonData // Previous MBM counters by group/domain
+	prevTime time.Time
+	rates    map[string]mbmRate
+	system   pcm.System
+	valid    bool
+}
+
+// mbmRate of a group on a domain in bytes per second
+type mbmRate struct {
+	total float64
+	local float64
+}
+
+const (
+	rdtPanelName string = "RDT"
+)
+
+// Setup and create the RDT page structure
+func setupRDT() *PageRDT {
+
+	pg := &PageRDT{}
+
+	pg.prev = make(map[string]resctrl.MonData)
+	pg.rates = make(map[string]mbmRate)
+
+	if pg.rdt, pg.err = resctrl.New(); pg.err == nil {
+		pg.rdtInfo, pg.err = pg.rdt.Info()
+	}
+	if pg.err != nil {
+		tlog.WarnPrintf("RDT: %v\n", pg.err)
+	}
+
+	return pg
+}
+
+// RDTPanelSetup setup the RDT panel
+func RDTPanelSetup(nextSlide func()) (pageName string, content tview.Primitive) {
+
+	pg := setupRDT()
+
+	to := tab.New(rdtPanelName, perfmon.app)
+	pg.tabOrder = to
+
+	flex0 := tview.NewFlex().SetDirection(tview.FlexRow)
+	flex1 := tview.NewFlex().SetDirection(tview.FlexColumn)
+	flex2 := tview.NewFlex().SetDirection(tview.FlexColumn)
+
+	TitleBox(flex0)
+	pg.topFlex = flex0
+
+	pg.info = CreateTextView(flex1, "RDT Info (i)", tview.AlignLeft, 0, 1, true)
+	pg.note = CreateTextView(flex1, "Note", tview.AlignLeft, 0, 2, false)
+	flex0.AddItem(flex1, 6, 1, true)
+
+	pg.groups = CreateTableView(flex0, "Classes of Service - Enter to assign DPDK lcores (g)",
+		tview.AlignLeft, 0, 2, true)
+	pg.groups.SetSeparator(tview.Borders.Vertical)
+	pg.groups.SetSelectable(true, false)
+	pg.groups.SetSelectedFunc(func(row, col int) {
+		pg.assignLCores(row - 1)
+	})
+
+	pg.monitors = CreateTableView(flex2, "Monitoring CMT/MBM (m)", tview.AlignLeft, 0, 1, true)
+	pg.monitors.SetSeparator(tview.Borders.Vertical)
+	pg.cores = CreateTableView(flex2, "Core RDT (c)", tview.AlignLeft, 0, 1, true)
+	pg.cores.SetSeparator(tview.Borders.Vertical)
+	flex0.AddItem(flex2, 0, 3, true)
+
+	to.Add(pg.info, 'i')
+	to.Add(pg.groups, 'g')
+	to.Add(pg.monitors, 'm')
+	to.Add(pg.cores, 'c')
+
+	to.SetInputDone()
+
+	pg.displayNote("Select a class of service and press Enter to assign the lcores\n" +
+		"of the DPDK application selected on the DPDK panel.")
+
+	perfmon.timers.Add(rdtPanelName, func(step int, ticks uint64) {
+		switch step {
+		case 0:
+			// MBM counters are collected every second to keep the rates valid
+			pg.collectData()
+		case 1:
+			if pg.topFlex.HasFocus() {
+				perfmon.app.QueueUpdateDraw(func() {
+					pg.displayRDTPage()
+				})
+			}
+		}
+	})
+
+	return rdtPanelName, pg.topFlex
+}
+
+// Read the resource groups and compute the MBM rates
+func (pg *PageRDT) collectData() {
+
+	if pg.rdt == nil {
+		return
+	}
+
+	groups, err := pg.rdt.Groups()
+	if err != nil {
+		tlog.ErrorPrintf("RDT groups: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	secs := now.Sub(pg.prevTime).Seconds()
+
+	rates := make(map[string]mbmRate)
+	for _, g := range groups {
+		for _, m := range g.Monitors {
+			key := fmt.Sprintf("%s/%d", g.Name, m.Domain)
+
+			// Counters can wrap or be reset when a group is recreated
+			if p, ok := pg.prev[key]; ok && secs > 0 &&
+				m.MBMTotalBytes >= p.MBMTotalBytes && m.MBMLocalBytes >= p.MBMLocalBytes {
+				rates[key] = mbmRate{
+					total: float64(m.MBMTotalBytes-p.MBMTotalBytes) / secs,
+					local: float64(m.MBMLocalBytes-p.MBMLocalBytes) / secs,
+				}
+			}
+			pg.prev[key] = m
+		}
+	}
+	pg.prevTime = now
+
+	perfmon.app.QueueUpdate(func() {
+		pg.clos = groups
+		pg.rates = rates
+	})
+}
+
+// Display the RDT panel windows
+func (pg *PageRDT) displayRDTPage() {
+
+	pg.displayInfo(pg.info)
+	pg.displayGroups(pg.groups)
+	pg.displayMonitors(pg.monitors)
+	pg.displayCores(pg.cores)
+}
+
+func (pg *PageRDT) displayNote(msg string) {
+
+	pg.note.SetText(cz.Wheat(msg))
+}
+
+// Display the RDT resources supported
+func (pg *PageRDT) displayInfo(view *tview.TextView) {
+
+	if pg.err != nil {
+		view.SetText(fmt.Sprintf("%s\n  %s\n", cz.Red("RDT not available"),
+			cz.Wheat(pg.err.Error())))
+		return
+	}
+	info := pg.rdtInfo
+
+	str := ""
+	if info.L3Supported {
+		str += fmt.Sprintf("%s %s %s %s\n",
+			cz.Wheat("L3 CAT     CLOS:"), cz.SkyBlue(info.L3NumClosids, 3),
+			cz.Wheat("Mask:"), cz.SkyBlue(info.L3CbmMask))
+	} else {
+		str += fmt.Sprintf("%s %s\n", cz.Wheat("L3 CAT    "), cz.Red("not supported"))
+	}
+	if info.MBSupported {
+		str += fmt.Sprintf("%s %s\n", cz.Wheat("MBA        CLOS:"), cz.SkyBlue(info.MBNumClosids, 3))
+	}
+	if info.MonSupported {
+		str += fmt.Sprintf("%s %s %s %v\n",
+			cz.Wheat("Monitoring RMIDs:"), cz.SkyBlue(info.NumRmids, 3),
+			cz.Wheat("Events:"), cz.SkyBlue(info.MonFeatures))
+	} else {
+		str += fmt.Sprintf("%s %s\n", cz.Wheat("Monitoring"), cz.Red("not supported"))
+	}
+
+	view.SetText(str)
+}
+
+// Display the classes of service and the CPUs assigned to each
+func (pg *PageRDT) displayGroups(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"CLOS", "Mode", "L3 Mask", "Ways", "MB %", "CPUs"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for _, g := range pg.clos {
+		mask, ways, mb := "", "", ""
+		for i, d := range g.Domains("L3") {
+			if i > 0 {
+				mask += ";"
+				ways += ";"
+			}
+			mask += g.L3Mask(d)
+			ways += fmt.Sprintf("%d", resctrl.CBMBits(g.L3Mask(d)))
+		}
+		for i, d := range g.Domains("MB") {
+			if i > 0 {
+				mb += ";"
+			}
+			mb += g.Schemata["MB"][d]
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(g.Name), tview.AlignLeft, true)
+		SetCell(view, row, 1, cz.SkyBlue(g.Mode), tview.AlignLeft, true)
+		SetCell(view, row, 2, cz.SkyBlue(mask), tview.AlignLeft, true)
+		SetCell(view, row, 3, cz.SkyBlue(ways), tview.AlignLeft, true)
+		SetCell(view, row, 4, cz.SkyBlue(mb), tview.AlignLeft, true)
+		SetCell(view, row, 5, cz.SkyBlue(cpuList(g.CPUs)), tview.AlignLeft, true)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the cache occupancy and memory bandwidth of each group
+func (pg *PageRDT) displayMonitors(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"CLOS", "Socket", "L3 Occupancy", "MBM Total", "MBM Local"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for _, g := range pg.clos {
+		for _, m := range g.Monitors {
+			r := pg.rates[fmt.Sprintf("%s/%d", g.Name, m.Domain)]
+
+			SetCell(view, row, 0, cz.LightGreen(g.Name), tview.AlignLeft)
+			SetCell(view, row, 1, cz.SkyBlue(m.Domain))
+			SetCell(view, row, 2, cz.SkyBlue(FormatBytes(m.LLCOccupancy)))
+			SetCell(view, row, 3, cz.SkyBlue(FormatBytes(uint64(r.total))+"/s"))
+			SetCell(view, row, 4, cz.SkyBlue(FormatBytes(uint64(r.local))+"/s"))
+			row++
+		}
+	}
+	if row == 1 {
+		SetCell(view, row, 0, cz.Wheat("No monitoring data"), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// closOfCPU returns the name of the class of service the CPU is assigned to
+func (pg *PageRDT) closOfCPU(cpu int) string {
+
+	for _, g := range pg.clos {
+		if g.HasCPU(cpu) {
+			return g.Name
+		}
+	}
+	return ""
+}
+
+// Display the PCM RDT counters of each core
+func (pg *PageRDT) displayCores(view *tview.Table) {
+
+	if !pg.valid {
+		if err := PCMSystem(&pg.system); err != nil {
+			tlog.ErrorPrintf("Unable to get PCM system information\n")
+			return
+		}
+		pg.valid = true
+	}
+
+	lcores := make(map[int]bool)
+	for _, c := range perfmon.dpdkApp.Get().LCores {
+		lcores[c] = true
+	}
+
+	row := 0
+	for i, s := range []string{"Core", "CLOS", "L3 Occ KB", "Local MB/s", "Remote MB/s", "DPDK"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for i := 0; i < int(pg.system.Data.NumOfCores); i++ {
+		data := pcm.CoreCounters{}
+		if err := PCMCore(i, &data); err != nil {
+			tlog.ErrorPrintf("Unable to get PCM core information\n")
+			return
+		}
+		core := data.Data
+
+		occ, local, remote := "disabled", "disabled", "disabled"
+		if core.L3CacheOccupancyAvailable {
+			occ = fmt.Sprintf("%d", core.L3CacheOccupancy)
+		}
+		if core.LocalMemoryBWAvailable {
+			local = fmt.Sprintf("%d", core.LocalMemoryBW)
+		}
+		if core.RemoteMemoryBWAvailable {
+			remote = fmt.Sprintf("%d", core.RemoteMemoryBW)
+		}
+		lcore := ""
+		if lcores[i] {
+			lcore = "lcore"
+		}
+
+		SetCell(view, row, 0, cz.Orange(fmt.Sprintf("%d/%d", core.CoreID, core.SocketID)), tview.AlignLeft)
+		SetCell(view, row, 1, cz.LightGreen(pg.closOfCPU(i)), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(occ))
+		SetCell(view, row, 3, cz.SkyBlue(local))
+		SetCell(view, row, 4, cz.SkyBlue(remote))
+		SetCell(view, row, 5, cz.Yellow(lcore), tview.AlignLeft)
+		row++
+	}
+}
+
+// assignLCores of the selected DPDK application to the class of service
+func (pg *PageRDT) assignLCores(idx int) {
+
+	if pg.rdt == nil || idx < 0 || idx >= len(pg.clos) {
+		return
+	}
+	g := pg.clos[idx]
+
+	app := perfmon.dpdkApp.Get()
+	if len(app.LCores) == 0 {
+		pg.displayNote("No DPDK application selected, select one on the DPDK panel first.")
+		return
+	}
+	cpus := cpuList(app.LCores)
+
+	msg := fmt.Sprintf("Assign the lcores %s of DPDK application %s to CLOS %s?\n\n"+
+		"The CPUs are removed from the class of service they are in now.",
+		cpus, app.Name, g.Name)
+
+	Confirm(msg, func() {
+		if err := pg.rdt.AssignCPUs(g.Name, app.LCores); err != nil {
+			tlog.ErrorPrintf("RDT: %v\n", err)
+			pg.displayNote(fmt.Sprintf("Assign failed: %v", err))
+			return
+		}
+		tlog.InfoPrintf("RDT: assigned CPUs %s to %s\n", cpus, g.Name)
+		pg.displayNote(fmt.Sprintf("Assigned lcores %s to CLOS %s", cpus, g.Name))
+	})
+}
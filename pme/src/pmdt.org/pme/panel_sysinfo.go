@@ -6,7 +6,7 @@ package main
 import (
 	"fmt"
 	"math"
-	"strconv"
+	"sort"
 	"strings"
 
 	"github.com/rivo/tview"
@@ -15,8 +15,10 @@ import (
 	"github.com/shirou/gopsutil/mem"
 	"github.com/shirou/gopsutil/net"
 	cz "pmdt.org/colorize"
+	"pmdt.org/hugepages"
 	pbf "pmdt.org/intelpbf"
 	tab "pmdt.org/taborder"
+	"pmdt.org/topology"
 	tlog "pmdt.org/ttylog"
 )
 
@@ -83,8 +85,14 @@ func setupSysInfo() *PageSysInfo {
 	pg.Cores = []uint16{}
 	pg.Sockets = []uint16{}
 
-	for lcore, c := range info {
-		core, _ := strconv.Atoi(c.CoreID)
+	// Build the layout from the topology, the CPU ids are not always the
+	// order of /proc/cpuinfo and offline CPUs have no core or socket
+	maxThreads := 1
+	for _, c := range Topology().CPUs() {
+		if !c.Online || c.Core < 0 || c.Package < 0 {
+			continue
+		}
+		core, socket := c.Core, c.Package
 
 		// If the core is found in the list of cores then append that core to
 		// a list for cores
@@ -94,7 +102,6 @@ func setupSysInfo() *PageSysInfo {
 
 		// If the socket id is found in the list of sockets then append that socket to
 		// a list for sockets
-		socket, _ := strconv.Atoi(c.PhysicalID)
 		if !uint16InSlice(uint16(socket), pg.Sockets) {
 			pg.Sockets = append(pg.Sockets, uint16(socket))
 		}
@@ -106,18 +113,23 @@ func setupSysInfo() *PageSysInfo {
 		if !ok {
 			pg.CoreMap[key] = []uint16{}
 		}
-		pg.CoreMap[key] = append(pg.CoreMap[key], uint16(lcore))
+		pg.CoreMap[key] = append(pg.CoreMap[key], uint16(c.ID))
+		if len(pg.CoreMap[key]) > maxThreads {
+			maxThreads = len(pg.CoreMap[key])
+		}
 	}
+	sort.Slice(pg.Cores, func(i, j int) bool { return pg.Cores[i] < pg.Cores[j] })
+	sort.Slice(pg.Sockets, func(i, j int) bool { return pg.Sockets[i] < pg.Sockets[j] })
 
-	// Calculate the cores, sockets and logical cores in the system
-	numLogical, _ := cpu.Counts(true)
-	numPhysical, _ := cpu.Counts(false)
-	pg.Printf("numLogical %d, numPhysical %d\n", numLogical, numPhysical)
-
+	// Calculate the cores, sockets and logical cores in the system, hybrid
+	// CPUs have cores with and without hyper-threads
 	pg.numSockets = int16(len(pg.Sockets))
-	pg.numLogical = int16(numLogical)
-	pg.numPhysical = (int16(numPhysical) / pg.numSockets)
-	pg.numHyperThreads = (pg.numLogical / (pg.numPhysical * pg.numSockets))
+	pg.numLogical = int16(len(OnlineCPUs()))
+	if pg.numSockets > 0 {
+		pg.numPhysical = int16(len(pg.CoreMap)) / pg.numSockets
+	}
+	pg.numHyperThreads = int16(maxThreads)
+	pg.Printf("numLogical %d, numPhysical %d\n", pg.numLogical, pg.numPhysical)
 
 	return pg
 }
@@ -254,12 +266,15 @@ func (pg *PageSysInfo) displayMem(view *tview.TextView) {
 	str += fmt.Sprintf("         Free: %s MiB\n", cz.Green(v.Free/MegaBytes, 6))
 	str += fmt.Sprintf("         Used: %s Percent\n\n", cz.Orange(v.UsedPercent, 6, 1))
 
-	//	for i := 0; i < int(pg.numSockets); i++ {
-	//		v, _ := mem.VirtualMemoryPerSocket(i)
-	//		str += fmt.Sprintf("%s:\n", cz.MediumSpringGreen(fmt.Sprintf("NUMA Node %d Hugepage Info", i)))
-	//		str += fmt.Sprintf("   Free/Total: %s/%s pages\n", cz.LightBlue(v.HugePagesFree, 6), cz.LightBlue(v.HugePagesTotal, 6))
-	//		str += fmt.Sprintf("      Surplus: %s pages\n\n", cz.LightBlue(v.HugePagesSurp, 6))
-	//	}
+	// The hugepages of each NUMA node and page size, see the Hugepages panel
+	if pools, err := hugepages.New().Pools(); err == nil {
+		for _, p := range pools {
+			str += fmt.Sprintf("%s:\n", cz.MediumSpringGreen(fmt.Sprintf("NUMA Node %d %s Hugepages", p.Node,
+				hugepages.FormatSize(p.SizeKB))))
+			str += fmt.Sprintf("   Free/Total: %s/%s pages\n", cz.LightBlue(p.Free, 6), cz.LightBlue(p.Total, 6))
+			str += fmt.Sprintf("      Surplus: %s pages\n\n", cz.LightBlue(p.Surplus, 6))
+		}
+	}
 
 	str += fmt.Sprintf("%s:\n", cz.MediumSpringGreen("Total Hugepage Info"))
 	str += fmt.Sprintf("   Free/Total: %s/%s pages\n", cz.LightBlue(v.HugePagesFree, 6), cz.LightBlue(v.HugePagesTotal, 6))
@@ -288,10 +303,14 @@ func (pg *PageSysInfo) displayCPU(view *tview.TextView) {
 	v := pg.info
 	str += fmt.Sprintf("Vendor         : %s", cz.GoldenRod(v[0].VendorID, -14))
 	str += fmt.Sprintf(" %s\n", cz.MediumSpringGreen(v[0].ModelName))
+	str += fmt.Sprintf("Microarch      : %s ", cz.GoldenRod(CPUIdent().Arch.Name))
+	str += fmt.Sprintf("Family/Model/Stepping : %s ", cz.LightBlue(CPUIdent().Signature()))
+	str += fmt.Sprintf("Features : %s\n", cz.SkyBlue(CPUIdent().FeatureList()))
 	str += fmt.Sprintf("Cores Logical  : %s ", cz.LightBlue(pg.numLogical, -6))
 	str += fmt.Sprintf("Physical : %s ", cz.LightBlue(pg.numPhysical, -6))
 	str += fmt.Sprintf("Hyper-Thread : %s ", cz.MediumSpringGreen(pg.numHyperThreads, -6))
 	str += fmt.Sprintf("Sockets : %s\n", cz.Orange(pg.numSockets))
+	str += pg.topologyStr()
 
 	str += fmt.Sprintf("P-State driver : [%s]   ", cz.SkyBlue(pbf.Driver))
 	str += fmt.Sprintf("CPU Base Frequency: %s MHz\n", cz.Red(pbf.FreqP1))
@@ -315,6 +334,43 @@ func (pg *PageSysInfo) displayCPU(view *tview.TextView) {
 	view.ScrollToBeginning()
 }
 
+// topologyStr returns the online, offline, isolated and nohz_full CPUs
+func (pg *PageSysInfo) topologyStr() string {
+
+	t := Topology()
+
+	offline := []int{}
+	pCores, eCores := []int{}, []int{}
+	for _, c := range t.CPUs() {
+		if !c.Online {
+			offline = append(offline, c.ID)
+		}
+		switch c.Type {
+		case topology.CorePerformance:
+			pCores = append(pCores, c.ID)
+		case topology.CoreEfficient:
+			eCores = append(eCores, c.ID)
+		}
+	}
+
+	list := func(cpus []int) string {
+		if len(cpus) == 0 {
+			return cz.SkyBlue("-")
+		}
+		return cz.SkyBlue(topology.FormatCPUList(cpus))
+	}
+
+	str := fmt.Sprintf("Online CPUs    : %s ", list(t.Online()))
+	str += fmt.Sprintf("Offline : %s ", list(offline))
+	str += fmt.Sprintf("Isolated : %s ", list(t.Isolated()))
+	str += fmt.Sprintf("nohz_full : %s\n", list(t.NoHzFull()))
+	if t.Hybrid() {
+		str += fmt.Sprintf("P-cores        : %s ", list(pCores))
+		str += fmt.Sprintf("E-cores : %s\n", list(eCores))
+	}
+	return str
+}
+
 // Build up a string for displaying the CPU layout window
 func buildStr(a []uint16, width int) string {
 
@@ -360,7 +416,7 @@ func (pg *PageSysInfo) displayLayout(view *tview.Table) {
 		view.SetCell(int(row), int(col), tableCell)
 
 		pg.Printf("cid %d\n", cid)
-		for sid := int16(0); sid < pg.numSockets; sid++ {
+		for _, sid := range pg.Sockets {
 			pg.Printf("  sid %d\n", sid)
 			key := uint16(sid<<uint16(8)) | cid
 			v, ok := pg.CoreMap[key]
@@ -408,8 +464,9 @@ func (pg *PageSysInfo) displayLoad(percent []float64, start, end int16, view *tv
 
 	str += fmt.Sprintf("%s\n", cz.Orange("Core Percent          Load Meter"))
 
-	for i := start; i < end; i++ {
-		str += pg.drawMeter(i, percent[i], width)
+	// The percents are in the order of the online CPUs
+	for i := start; i < end && int(i) < len(percent); i++ {
+		str += pg.drawMeter(int16(onlineCPU(int(i))), percent[i], width)
 	}
 
 	view.SetText(str)
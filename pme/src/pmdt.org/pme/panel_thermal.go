@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rivo/tview"
+	pbf "pmdt.org/intelpbf"
+
+	cz "pmdt.org/colorize"
+	tab "pmdt.org/taborder"
+	tlog "pmdt.org/ttylog"
+)
+
+// Display the core and package temperatures and the thermal and power limit
+// throttling of each CPU. The cores throttling now are shown in red and the
+// cores throttled since the logs were cleared in orange.
+
+// PageThermal - Data for the Thermal panel
+type PageThermal struct {
+	tabOrder *tab.Tab
+	topFlex  *tview.Flex
+	cores    *tview.Table
+	packages *tview.Table
+	note     *tview.TextView
+
+	temps []pbf.Temperature
+	err   error
+}
+
+const (
+	thermalPanelName string = "Thermal"
+)
+
+// thermal reads the temperatures for the Thermal and AVX panels
+var thermal = pbf.NewThermal()
+
+// ThermalPanelSetup setup the Thermal panel
+func ThermalPanelSetup(nextSlide func()) (pageName string, content tview.Primitive) {
+
+	pg := &PageThermal{}
+
+	to := tab.New(thermalPanelName, perfmon.app)
+	pg.tabOrder = to
+
+	flex0 := tview.NewFlex().SetDirection(tview.FlexRow)
+
+	TitleBox(flex0)
+	pg.topFlex = flex0
+
+	pg.packages = CreateTableView(flex0, "Packages (p)", tview.AlignLeft, 6, 1, true)
+	pg.packages.SetSeparator(tview.Borders.Vertical)
+
+	pg.cores = CreateTableView(flex0, "Core Temperatures and Throttling (t)", tview.AlignLeft, 0, 4, true)
+	pg.cores.SetFixed(1, 0)
+	pg.cores.SetSeparator(tview.Borders.Vertical)
+
+	pg.note = CreateTextView(flex0, "Note", tview.AlignLeft, 3, 1, false)
+
+	to.Add(pg.packages, 'p')
+	to.Add(pg.cores, 't')
+
+	to.SetInputDone()
+
+	perfmon.timers.Add(thermalPanelName, func(step int, ticks uint64) {
+		switch step {
+		case 0:
+			if pg.topFlex.HasFocus() {
+				pg.collectData()
+			}
+		case 1:
+			if pg.topFlex.HasFocus() {
+				perfmon.app.QueueUpdateDraw(func() {
+					pg.displayThermalPage()
+				})
+			}
+		}
+	})
+
+	return thermalPanelName, pg.topFlex
+}
+
+// readTemperatures of all of the CPUs
+func readTemperatures() ([]pbf.Temperature, error) {
+
+	return thermal.Read(OnlineCPUs())
+}
+
+// Read the temperatures of the CPUs
+func (pg *PageThermal) collectData() {
+
+	temps, err := readTemperatures()
+	if err != nil {
+		tlog.WarnPrintf("Thermal: %v\n", err)
+	}
+
+	perfmon.app.QueueUpdate(func() {
+		pg.temps = temps
+		pg.err = err
+	})
+}
+
+// Display the Thermal panel windows
+func (pg *PageThermal) displayThermalPage() {
+
+	pg.displayPackages(pg.packages)
+	pg.displayCores(pg.cores)
+	pg.displayNote()
+}
+
+// tempColorFunc returns the color of the temperature by the margin to TjMax
+func tempColorFunc(c, tjMax int) func(a interface{}, w ...interface{}) string {
+
+	switch {
+	case tjMax > 0 && tjMax-c <= 10:
+		return cz.Red
+	case tjMax > 0 && tjMax-c <= 20:
+		return cz.Orange
+	}
+	return cz.LightGreen
+}
+
+// tempColor returns the temperature colored by the margin to TjMax
+func tempColor(c, tjMax int) string {
+
+	if c < 0 {
+		return cz.SkyBlue("-")
+	}
+	return tempColorFunc(c, tjMax)(c)
+}
+
+// flag returns Yes in the color or a dash
+func flag(set bool, color func(a interface{}, w ...interface{}) string) string {
+
+	if set {
+		return color("Yes")
+	}
+	return cz.SkyBlue("-")
+}
+
+func (pg *PageThermal) displayNote() {
+
+	if pg.err != nil {
+		pg.note.SetText(cz.Red(pg.err.Error()))
+		return
+	}
+	source := ""
+	if len(pg.temps) > 0 {
+		source = pg.temps[0].Source
+	}
+
+	str := fmt.Sprintf("Source: %s, ", cz.LightGreen(source))
+	if source == pbf.ThermalSourceCoretemp {
+		str += cz.Wheat("throttling is from the thermal_throttle counts, ")
+		if msg := msrUnavailable(); msg != "" {
+			str += cz.Orange(msg)
+		}
+		str += "\n"
+	} else {
+		str += cz.Wheat("the temperature is TjMax minus the digital readout of the thermal status MSRs.\n")
+	}
+	str += cz.Wheat("Red rows are throttling now, orange rows were throttled since the logs were cleared.")
+
+	pg.note.SetText(str)
+}
+
+// Display the hottest core and the throttling of each package
+func (pg *PageThermal) displayPackages(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"Package", "Pkg °C", "Max Core °C", "TjMax", "Throttling CPUs", "Throttled CPUs"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	type pkgInfo struct {
+		pkgC, maxC, tjMax     int
+		throttling, throttled int
+	}
+	pkgs := make(map[int]*pkgInfo)
+	for _, tp := range pg.temps {
+		p, ok := pkgs[tp.Package]
+		if !ok {
+			p = &pkgInfo{pkgC: tp.PkgC, maxC: -1, tjMax: tp.TjMax}
+			pkgs[tp.Package] = p
+		}
+		if tp.CoreC > p.maxC {
+			p.maxC = tp.CoreC
+		}
+		if tp.Throttling() {
+			p.throttling++
+		}
+		if tp.Throttled() {
+			p.throttled++
+		}
+	}
+
+	ids := []int{}
+	for id := range pkgs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		p := pkgs[id]
+
+		throttling := cz.LightGreen(p.throttling)
+		if p.throttling > 0 {
+			throttling = cz.Red(p.throttling)
+		}
+		throttled := cz.LightGreen(p.throttled)
+		if p.throttled > 0 {
+			throttled = cz.Orange(p.throttled)
+		}
+
+		SetCell(view, row, 0, cz.LightGreen(id), tview.AlignLeft)
+		SetCell(view, row, 1, tempColor(p.pkgC, p.tjMax), tview.AlignLeft)
+		SetCell(view, row, 2, tempColor(p.maxC, p.tjMax), tview.AlignLeft)
+		SetCell(view, row, 3, cz.SkyBlue(p.tjMax), tview.AlignLeft)
+		SetCell(view, row, 4, throttling, tview.AlignLeft)
+		SetCell(view, row, 5, throttled, tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
+
+// Display the temperature and throttling of each CPU
+func (pg *PageThermal) displayCores(view *tview.Table) {
+
+	row := 0
+	for i, s := range []string{"CPU", "Pkg", "Core", "Core °C", "Pkg °C", "TjMax", "Margin",
+		"Thermal", "Thermal Log", "Power Limit", "PL Log", "Core Events", "Pkg Events"} {
+		SetCell(view, row, i, cz.Orange(s), tview.AlignLeft)
+	}
+	row++
+
+	for _, tp := range pg.temps {
+		cpu := cz.LightGreen(tp.CPU)
+		switch {
+		case tp.Throttling():
+			cpu = cz.Red(tp.CPU)
+		case tp.Throttled():
+			cpu = cz.Orange(tp.CPU)
+		}
+
+		// The margin has the color of the core temperature
+		margin := cz.SkyBlue("-")
+		if tp.TjMax > 0 && tp.CoreC >= 0 {
+			margin = tempColorFunc(tp.CoreC, tp.TjMax)(tp.TjMax - tp.CoreC)
+		}
+
+		SetCell(view, row, 0, cpu, tview.AlignLeft)
+		SetCell(view, row, 1, cz.SkyBlue(tp.Package), tview.AlignLeft)
+		SetCell(view, row, 2, cz.SkyBlue(tp.Core), tview.AlignLeft)
+		SetCell(view, row, 3, tempColor(tp.CoreC, tp.TjMax), tview.AlignLeft)
+		SetCell(view, row, 4, tempColor(tp.PkgC, tp.TjMax), tview.AlignLeft)
+		SetCell(view, row, 5, cz.SkyBlue(tp.TjMax), tview.AlignLeft)
+		SetCell(view, row, 6, margin, tview.AlignLeft)
+		SetCell(view, row, 7, flag(tp.CoreStatus.Throttling || tp.PkgStatus.Throttling, cz.Red), tview.AlignLeft)
+		SetCell(view, row, 8, flag(tp.CoreStatus.ThrottleLog || tp.PkgStatus.ThrottleLog, cz.Orange), tview.AlignLeft)
+		SetCell(view, row, 9, flag(tp.CoreStatus.PowerLimit || tp.PkgStatus.PowerLimit, cz.Red), tview.AlignLeft)
+		SetCell(view, row, 10, flag(tp.CoreStatus.PowerLimitLog || tp.PkgStatus.PowerLimitLog, cz.Orange), tview.AlignLeft)
+		SetCell(view, row, 11, cz.SkyBlue(tp.CoreThrottles), tview.AlignLeft)
+		SetCell(view, row, 12, cz.SkyBlue(tp.PkgThrottles), tview.AlignLeft)
+		row++
+	}
+
+	for view.GetRowCount() > row {
+		view.RemoveRow(row)
+	}
+}
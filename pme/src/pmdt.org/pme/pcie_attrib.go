@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"pmdt.org/devbind"
+	"pmdt.org/pcm"
+	"pmdt.org/topology"
+)
+
+// Estimate the PCIe bandwidth used by each device. PCM only gives the PCIe
+// read/write bandwidth per socket, so the socket bandwidth is split between
+// the devices on the socket using the DPDK port byte rates. A port transmit
+// is a device read from memory and a port receive is a device write.
+
+// DeviceShare is the estimated PCIe bandwidth of a device
+type DeviceShare struct {
+	Slot        string
+	Interface   string
+	Socket      int
+	PortID      int     // DPDK port id or -1 if not used by the DPDK app
+	ReadBW      float64 // Estimated PCIe read bytes per second
+	WriteBW     float64 // Estimated PCIe write bytes per second
+	ReadShare   float64 // Fraction of the socket PCIe read bandwidth
+	WriteShare  float64 // Fraction of the socket PCIe write bandwidth
+	CrossSocket bool    // Traffic of the port crosses the socket boundary
+	Note        string
+}
+
+// SocketOther is the socket bandwidth not attributed to a DPDK port
+type SocketOther struct {
+	Socket  int
+	ReadBW  float64
+	WriteBW float64
+}
+
+const (
+	// crossSocketFactor of port traffic over the socket PCIe bandwidth
+	// before the traffic is considered to be seen on another socket.
+	crossSocketFactor float64 = 1.5
+)
+
+// deviceNode returns the NUMA node of the device or -1 if it reports none
+func deviceNode(d *devbind.DeviceClass) int {
+
+	n, err := strconv.Atoi(d.NumaNode)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// deviceSocket returns the socket of the device, with sub-NUMA clustering a
+// socket has more than one node. Devices reporting no NUMA node are on socket
+// 0 of a single socket system.
+func deviceSocket(d *devbind.DeviceClass, topo *topology.Topology) int {
+
+	if s := topo.NodePackage(deviceNode(d)); s >= 0 {
+		return s
+	}
+	return 0
+}
+
+// attributePCIe bandwidth of the socket to the devices on the socket
+func attributePCIe(ps *pcm.PCIeSampleData, pollMs uint32, devs []*devbind.DeviceClass,
+	app *DPDKAppState, topo *topology.Topology) ([]DeviceShare, []SocketOther) {
+
+	scale := 1.0
+	if pollMs > 0 {
+		scale = 1000.0 / float64(pollMs)
+	}
+
+	// Sockets the DPDK application lcores are running on
+	lcoreSockets := make(map[int]bool)
+	for _, c := range app.LCores {
+		if cpu, ok := topo.CPU(c); ok && cpu.Package >= 0 {
+			lcoreSockets[cpu.Package] = true
+		}
+	}
+
+	// All the bandwidth of a socket without devices is other bandwidth
+	bySocket := make(map[int][]*devbind.DeviceClass)
+	for name := range ps.Sockets {
+		if s, err := strconv.Atoi(name); err == nil {
+			bySocket[s] = nil
+		}
+	}
+	for _, d := range devs {
+		s := deviceSocket(d, topo)
+		bySocket[s] = append(bySocket[s], d)
+	}
+
+	shares := []DeviceShare{}
+	others := []SocketOther{}
+
+	for socket, list := range bySocket {
+		sd := ps.Sockets[fmt.Sprintf("%d", socket)]
+		socketRd := float64(sd.Total.ReadBandWidth) * scale
+		socketWr := float64(sd.Total.WriteBandWidth) * scale
+
+		// Sum the DPDK port traffic on the socket
+		var sumTx, sumRx float64
+		for _, d := range list {
+			if p, ok := app.PortBySlot(d.Slot); ok {
+				sumTx += p.TxBytes
+				sumRx += p.RxBytes
+			}
+		}
+		rdBase := socketRd
+		if sumTx > rdBase {
+			rdBase = sumTx
+		}
+		wrBase := socketWr
+		if sumRx > wrBase {
+			wrBase = sumRx
+		}
+
+		other := SocketOther{Socket: socket, ReadBW: socketRd, WriteBW: socketWr}
+
+		for _, d := range list {
+			ds := DeviceShare{Slot: d.Slot, Interface: d.Interface, Socket: socket, PortID: -1}
+
+			p, ok := app.PortBySlot(d.Slot)
+			if !ok {
+				ds.Note = "no DPDK port"
+				shares = append(shares, ds)
+				continue
+			}
+			ds.PortID = int(p.PortID)
+
+			if rdBase > 0 {
+				ds.ReadShare = p.TxBytes / rdBase
+				ds.ReadBW = ds.ReadShare * socketRd
+			}
+			if wrBase > 0 {
+				ds.WriteShare = p.RxBytes / wrBase
+				ds.WriteBW = ds.WriteShare * socketWr
+			}
+			other.ReadBW -= ds.ReadBW
+			other.WriteBW -= ds.WriteBW
+
+			switch {
+			case len(lcoreSockets) > 0 && !lcoreSockets[socket]:
+				ds.CrossSocket = true
+				ds.Note = fmt.Sprintf("lcores not on socket %d", socket)
+			case (socketRd+socketWr) > 0 &&
+				(p.TxBytes+p.RxBytes) > crossSocketFactor*(socketRd+socketWr):
+				ds.CrossSocket = true
+				ds.Note = "traffic not seen on local socket"
+			}
+			shares = append(shares, ds)
+		}
+		others = append(others, other)
+	}
+
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].Slot < shares[j].Slot
+	})
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Socket < others[j].Socket
+	})
+
+	return shares, others
+}
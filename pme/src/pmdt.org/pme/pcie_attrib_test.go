@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"pmdt.org/devbind"
+	"pmdt.org/pcm"
+	"pmdt.org/topology"
+)
+
+// writeTree writes the files of a fake file system under root, the file data
+// ends with a newline as in sysfs
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// makeTopology creates a fake two socket system with sub-NUMA clustering,
+// CPUs 0-1 are nodes 0-1 of socket 0 and CPUs 2-3 nodes 2-3 of socket 1.
+func makeTopology(t *testing.T) (*topology.Topology, string) {
+
+	root, err := ioutil.TempDir("", "pcie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sys := "sys/devices/system/cpu/"
+	files := map[string]string{
+		sys + "present": "0-3",
+		sys + "online":  "0-3",
+	}
+	for cpu := 0; cpu < 4; cpu++ {
+		dir := fmt.Sprintf("%scpu%d/", sys, cpu)
+		files[dir+"topology/physical_package_id"] = fmt.Sprintf("%d", cpu/2)
+		files[dir+"topology/core_id"] = fmt.Sprintf("%d", cpu%2)
+		files[dir+fmt.Sprintf("node%d/cpumap", cpu)] = ""
+	}
+	writeTree(t, root, files)
+
+	topo, err := topology.New(root)
+	if err != nil {
+		os.RemoveAll(root)
+		t.Fatal(err)
+	}
+	return topo, root
+}
+
+// device returns a network device on the NUMA node
+func device(slot, node string) *devbind.DeviceClass {
+	return &devbind.DeviceClass{Slot: slot, Interface: "eth-" + slot, NumaNode: node}
+}
+
+// socketBW returns the PCIe sample of a socket with the read and write bandwidth
+func socketBW(rd, wr uint64) pcm.SampleData {
+
+	sd := pcm.SampleData{}
+	sd.Total.ReadBandWidth = rd
+	sd.Total.WriteBandWidth = wr
+	return sd
+}
+
+func TestAttributePCIe(t *testing.T) {
+
+	topo, root := makeTopology(t)
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name   string
+		pollMs uint32
+		ps     pcm.PCIeSampleData
+		devs   []*devbind.DeviceClass
+		app    DPDKAppState
+		shares []DeviceShare
+		others []SocketOther
+	}{
+		{
+			name:   "devices sharing a socket",
+			pollMs: 1000,
+			ps: pcm.PCIeSampleData{Sockets: map[string]pcm.SampleData{
+				"0": socketBW(800, 800),
+				"1": socketBW(0, 0),
+			}},
+			// Nodes 0 and 1 are both on socket 0
+			devs: []*devbind.DeviceClass{device("0000:18:00.0", "0"), device("0000:3b:00.0", "1")},
+			app: DPDKAppState{LCores: []int{0, 1}, Ports: []PortRate{
+				{PortID: 0, Slot: "0000:18:00.0", TxBytes: 300, RxBytes: 200},
+				{PortID: 1, Slot: "0000:3b:00.0", TxBytes: 100, RxBytes: 200},
+			}},
+			shares: []DeviceShare{
+				{Slot: "0000:18:00.0", Interface: "eth-0000:18:00.0", Socket: 0, PortID: 0,
+					ReadBW: 300, WriteBW: 200, ReadShare: 0.375, WriteShare: 0.25},
+				{Slot: "0000:3b:00.0", Interface: "eth-0000:3b:00.0", Socket: 0, PortID: 1,
+					ReadBW: 100, WriteBW: 200, ReadShare: 0.125, WriteShare: 0.25},
+			},
+			others: []SocketOther{{Socket: 0, ReadBW: 400, WriteBW: 400}, {Socket: 1}},
+		},
+		{
+			name:   "bandwidth with no devices on the socket",
+			pollMs: 500,
+			ps: pcm.PCIeSampleData{Sockets: map[string]pcm.SampleData{
+				"0": socketBW(100, 50),
+				"1": socketBW(20, 10),
+			}},
+			// Node 2 is on socket 1, socket 0 has no devices
+			devs: []*devbind.DeviceClass{device("0000:af:00.0", "2")},
+			app:  DPDKAppState{LCores: []int{0}},
+			shares: []DeviceShare{
+				{Slot: "0000:af:00.0", Interface: "eth-0000:af:00.0", Socket: 1, PortID: -1,
+					Note: "no DPDK port"},
+			},
+			others: []SocketOther{{Socket: 0, ReadBW: 200, WriteBW: 100}, {Socket: 1, ReadBW: 40, WriteBW: 20}},
+		},
+		{
+			name:   "no devices",
+			pollMs: 1000,
+			ps: pcm.PCIeSampleData{Sockets: map[string]pcm.SampleData{
+				"0": socketBW(100, 50),
+			}},
+			shares: []DeviceShare{},
+			others: []SocketOther{{Socket: 0, ReadBW: 100, WriteBW: 50}},
+		},
+	}
+
+	for _, tt := range tests {
+		shares, others := attributePCIe(&tt.ps, tt.pollMs, tt.devs, &tt.app, topo)
+		if !reflect.DeepEqual(shares, tt.shares) {
+			t.Errorf("%s: shares\n%+v\nwant\n%+v", tt.name, shares, tt.shares)
+		}
+		if !reflect.DeepEqual(others, tt.others) {
+			t.Errorf("%s: others %+v, want %+v", tt.name, others, tt.others)
+		}
+	}
+}
+
+func TestDeviceSocket(t *testing.T) {
+
+	topo, root := makeTopology(t)
+	defer os.RemoveAll(root)
+
+	for node, want := range map[string]int{"0": 0, "1": 0, "2": 1, "3": 1, "-1": 0, "": 0} {
+		if got := deviceSocket(device("0000:18:00.0", node), topo); got != want {
+			t.Errorf("node %q socket %d, want %d", node, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"pmdt.org/pcm"
+	tlog "pmdt.org/ttylog"
+)
+
+// The core counters come from the pcm-info daemon when it is running, if not
+// the counters are collected with perf_event so the panels still have the
+// IPC, frequency, LLC and branch data.
+
+const (
+	perfTimerName string = "PerfEvent"
+)
+
+// The collector is opened on the timer and read by the panels on the UI
+// goroutine, perfLock protects perfOpened and perfCollector
+var (
+	perfLock      sync.Mutex
+	perfOpened    bool
+	perfCollector *pcm.PerfCollector
+)
+
+// pcmConnected returns true if the pcm-info daemon is connected
+func pcmConnected() bool {
+
+	return perfmon.pinfoPCM != nil && len(perfmon.pinfoPCM.ConnectionList()) > 0
+}
+
+// PCMSource returns the name of the source of the core counters
+func PCMSource() string {
+
+	if pcmConnected() {
+		return "pcm-info"
+	}
+
+	perfLock.Lock()
+	defer perfLock.Unlock()
+
+	if perfCollector != nil {
+		return "perf_event"
+	}
+	return "none"
+}
+
+// openPerfCollector opens the perf_event counters the first time they are needed
+func openPerfCollector() *pcm.PerfCollector {
+
+	perfLock.Lock()
+	defer perfLock.Unlock()
+
+	if perfOpened {
+		return perfCollector
+	}
+	perfOpened = true
+
+	p, err := pcm.NewPerfCollector(OnlineCPUs())
+	if err != nil {
+		tlog.WarnPrintf("perf_event fallback not available: %v\n", err)
+		return nil
+	}
+	perfCollector = p
+
+	return perfCollector
+}
+
+// StartPerfFallback samples the perf_event counters every second while the
+// pcm-info daemon is not connected. The sample is taken on the last step so
+// the panels have the new data on step 0.
+func StartPerfFallback() {
+
+	perfmon.timers.Add(perfTimerName, func(step int, ticks uint64) {
+		if step != 3 || pcmConnected() {
+			return
+		}
+		if p := openPerfCollector(); p != nil {
+			p.Sample()
+		}
+	})
+}
+
+// PCMSystem gets the system data from pcm-info or the perf_event counters
+func PCMSystem(sys *pcm.System) error {
+
+	if pcmConnected() {
+		return perfmon.pinfoPCM.Unmarshal(nil, "/pcm/system", sys)
+	}
+
+	p := openPerfCollector()
+	if p == nil {
+		return fmt.Errorf("pcm-info not running and perf_event not available")
+	}
+
+	// The panels loop over the core ids, which are not always contiguous
+	sys.Data = pcm.SystemData{
+		NumOfCores:         uint64(NumCPUs()),
+		NumOfOnlineCores:   uint64(len(OnlineCPUs())),
+		NumOfSockets:       uint64(p.NumSockets()),
+		NumOfOnlineSockets: uint64(p.NumSockets()),
+		CPUModel:           uint64(CPUIdent().Model),
+	}
+
+	return nil
+}
+
+// PCMCore gets the core counters from pcm-info or the perf_event counters
+func PCMCore(core int, data *pcm.CoreCounters) error {
+
+	if pcmConnected() {
+		return perfmon.pinfoPCM.Unmarshal(nil, fmt.Sprintf("/pcm/core,%d", core), data)
+	}
+
+	p := openPerfCollector()
+	if p == nil {
+		return fmt.Errorf("pcm-info not running and perf_event not available")
+	}
+
+	// No data until the second sample is taken
+	data.Data, _ = p.Core(core)
+
+	return nil
+}
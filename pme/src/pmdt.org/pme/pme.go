@@ -17,7 +17,9 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"pmdt.org/devbind"
 	"pmdt.org/etimers"
+	pbf "pmdt.org/intelpbf"
 	"pmdt.org/pinfo"
 )
 
@@ -43,8 +45,11 @@ type PerfMonitor struct {
 	app     *tview.Application // Application or top level application
 	timers  *etimers.EventTimers
 	panels  []PanelInfo
+	pages   *tview.Pages
 
 	pinfoPCM *pinfo.ProcessInfo
+	devbind  *devbind.BindInfo // Device binding information shared by panels
+	dpdkApp  DPDKShared        // Selected DPDK application state
 }
 
 // Options command line options
@@ -54,6 +59,8 @@ type Options struct {
 	WaitTime    uint   `short:"W" long:"wait-time" description:"N seconds before startup" default:"15"`
 	ShowVersion bool   `short:"V" long:"version" description:"Print out version and exit"`
 	Verbose     bool   `short:"v" long:"Verbose output for debugging"`
+
+	Devices []string `long:"devices" description:"Device TOML file merged with the device catalog, may be repeated"`
 }
 
 // Global to the main package for the tool
@@ -104,10 +111,17 @@ func main() {
 
 	_, err := parser.Parse()
 	if err != nil {
-		fmt.Printf("*** invalid arguments %v\n", err)
+		if parser.Active == nil {
+			fmt.Printf("*** invalid arguments %v\n", err)
+		}
 		os.Exit(1)
 	}
 
+	// A command like devbind has run and the panels are not started
+	if parser.Active != nil {
+		return
+	}
+
 	if len(options.Ptty) > 0 {
 		err = tlog.Open(options.Ptty)
 		if err != nil {
@@ -128,6 +142,17 @@ func main() {
 	perfmon.timers = etimers.New(time.Second/4, 4)
 	perfmon.timers.Start()
 
+	perfmon.devbind = devbind.New(options.Devices...)
+
+	// Collect the core counters with perf_event when pcm-info is not running
+	StartPerfFallback()
+
+	// Sample the APERF/MPERF effective frequency of each CPU
+	StartFreqSampler()
+
+	// Count or estimate the AVX license level of each CPU
+	StartLicenseSampler()
+
 	panels := []Panels{
 		ProcessPanelSetup,
 		SysInfoPanelSetup,
@@ -138,6 +163,11 @@ func main() {
 		QPIPanelSetup,
 		PBFPanelSetup,
 		AVXPanelSetup,
+		RDTPanelSetup,
+		HugepagesPanelSetup,
+		ThermalPanelSetup,
+		CStatesPanelSetup,
+		NoisePanelSetup,
 	}
 
 	// The bottom row has some info on where we are.
@@ -150,6 +180,7 @@ func main() {
 	info.Highlight(strconv.Itoa(currentPanel))
 
 	pages := tview.NewPages()
+	perfmon.pages = pages
 
 	previousPanel := func() {
 		currentPanel = (currentPanel - 1 + len(panels)) % len(panels)
@@ -201,6 +232,10 @@ func main() {
 
 	// Shortcuts to navigate the panels.
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Keys belong to the confirmation dialog while it is displayed
+		if pages.HasPage(confirmPage) {
+			return event
+		}
 		if event.Key() == tcell.KeyCtrlN {
 			nextPanel()
 		} else if event.Key() == tcell.KeyCtrlP {
@@ -255,6 +290,10 @@ func main() {
 		panic(err)
 	}
 
+	// Put back the CPU settings changed in the PBF panel
+	RestoreCPUSettings()
+	pbf.CloseMsr()
+
 	tlog.Log(mainLog, "===== Done =====\n")
 }
 
@@ -271,6 +310,8 @@ func setupSignals(signals ...os.Signal) {
 		time.Sleep(time.Second)
 
 		app.Stop()
+		RestoreCPUSettings()
+		pbf.CloseMsr()
 		os.Exit(1)
 	}()
 }
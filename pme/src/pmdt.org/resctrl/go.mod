@@ -0,0 +1,7 @@
+module pmdt.org/resctrl
+
+replace pmdt.org/topology => ../topology
+
+go 1.14
+
+require pmdt.org/topology v0.0.0-00010101000000-000000000000
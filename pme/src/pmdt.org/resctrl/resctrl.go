@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package resctrl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pmdt.org/topology"
+)
+
+// Access the Linux resctrl file system to read the Intel RDT classes of
+// service (CLOS), the cache allocation masks (CAT), the cache occupancy (CMT)
+// and memory bandwidth (MBM) monitoring data.
+
+// DefaultRoot of the resctrl file system
+const DefaultRoot = "/sys/fs/resctrl"
+
+// DefaultGroup is the name used for the root resource group
+const DefaultGroup = "default"
+
+// Resctrl file system information
+type Resctrl struct {
+	root string
+}
+
+// Info about the RDT resources supported by the system
+type Info struct {
+	L3CbmMask      string   // Valid L3 cache bit mask
+	L3NumClosids   int      // Number of classes of service for L3
+	L3MinCbmBits   int      // Minimum number of bits in a L3 mask
+	MBNumClosids   int      // Number of classes of service for memory bandwidth
+	NumRmids       int      // Number of monitoring ids
+	MonFeatures    []string // Monitoring events supported
+	L3Supported    bool
+	MBSupported    bool
+	MonSupported   bool
+	MonL3Supported bool
+}
+
+// MonData for a resource group on a cache domain (socket)
+type MonData struct {
+	Domain        int
+	LLCOccupancy  uint64 // Bytes of L3 cache occupied
+	MBMTotalBytes uint64 // Total memory bandwidth counter in bytes
+	MBMLocalBytes uint64 // Local memory bandwidth counter in bytes
+}
+
+// Group is a resctrl resource group or class of service
+type Group struct {
+	Name     string
+	Path     string
+	Mode     string
+	CPUs     []int
+	Schemata map[string]map[int]string // Resource -> domain -> mask/value
+	Monitors []MonData
+}
+
+// New resctrl object, root is the optional mount point of the file system
+func New(root ...string) (*Resctrl, error) {
+
+	r := &Resctrl{root: DefaultRoot}
+	if len(root) > 0 && len(root[0]) > 0 {
+		r.root = root[0]
+	}
+
+	if _, err := os.Stat(filepath.Join(r.root, "info")); err != nil {
+		return nil, fmt.Errorf("resctrl not mounted at %s: %v", r.root, err)
+	}
+
+	return r, nil
+}
+
+// Root of the resctrl file system
+func (r *Resctrl) Root() string {
+	return r.root
+}
+
+func readString(file string) (string, error) {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(dat)), nil
+}
+
+func readInt(file string) (int, error) {
+
+	s, err := readString(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+func readUint64(file string) (uint64, error) {
+
+	s, err := readString(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// Info returns the RDT resources supported by the system
+func (r *Resctrl) Info() (*Info, error) {
+
+	info := &Info{}
+	dir := filepath.Join(r.root, "info")
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	if s, err := readString(filepath.Join(dir, "L3", "cbm_mask")); err == nil {
+		info.L3Supported = true
+		info.L3CbmMask = s
+		info.L3NumClosids, _ = readInt(filepath.Join(dir, "L3", "num_closids"))
+		info.L3MinCbmBits, _ = readInt(filepath.Join(dir, "L3", "min_cbm_bits"))
+	}
+
+	if n, err := readInt(filepath.Join(dir, "MB", "num_closids")); err == nil {
+		info.MBSupported = true
+		info.MBNumClosids = n
+	}
+
+	if n, err := readInt(filepath.Join(dir, "L3_MON", "num_rmids")); err == nil {
+		info.MonSupported = true
+		info.NumRmids = n
+		if s, err := readString(filepath.Join(dir, "L3_MON", "mon_features")); err == nil {
+			info.MonFeatures = strings.Fields(s)
+		}
+		info.MonL3Supported = len(info.MonFeatures) > 0
+	}
+
+	return info, nil
+}
+
+// Groups returns the default group and all of the resource groups
+func (r *Resctrl) Groups() ([]*Group, error) {
+
+	groups := []*Group{}
+
+	g, err := r.readGroup(DefaultGroup, r.root)
+	if err != nil {
+		return nil, err
+	}
+	groups = append(groups, g)
+
+	entries, err := ioutil.ReadDir(r.root)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		switch e.Name() {
+		case "info", "mon_groups", "mon_data":
+			continue
+		}
+		if !e.IsDir() {
+			continue
+		}
+		g, err := r.readGroup(e.Name(), filepath.Join(r.root, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// Group returns the resource group by name
+func (r *Resctrl) Group(name string) (*Group, error) {
+
+	return r.readGroup(name, r.groupPath(name))
+}
+
+func (r *Resctrl) groupPath(name string) string {
+
+	if name == DefaultGroup || len(name) == 0 {
+		return r.root
+	}
+	return filepath.Join(r.root, name)
+}
+
+func (r *Resctrl) readGroup(name, path string) (*Group, error) {
+
+	g := &Group{Name: name, Path: path}
+
+	s, err := readString(filepath.Join(path, "cpus_list"))
+	if err != nil {
+		return nil, err
+	}
+	if g.CPUs, err = topology.ParseCPUList(s); err != nil {
+		return nil, fmt.Errorf("group %s: %v", name, err)
+	}
+
+	if s, err := readString(filepath.Join(path, "schemata")); err == nil {
+		g.Schemata = ParseSchemata(s)
+	}
+	g.Mode, _ = readString(filepath.Join(path, "mode"))
+
+	g.Monitors = readMonData(filepath.Join(path, "mon_data"))
+
+	return g, nil
+}
+
+// readMonData of a group, the directories are named mon_L3_XX by domain
+func readMonData(dir string) []MonData {
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	mons := []MonData{}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "mon_L3_") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(e.Name(), "mon_L3_"))
+		if err != nil {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+
+		m := MonData{Domain: id}
+		m.LLCOccupancy, _ = readUint64(filepath.Join(p, "llc_occupancy"))
+		m.MBMTotalBytes, _ = readUint64(filepath.Join(p, "mbm_total_bytes"))
+		m.MBMLocalBytes, _ = readUint64(filepath.Join(p, "mbm_local_bytes"))
+		mons = append(mons, m)
+	}
+	sort.Slice(mons, func(i, j int) bool {
+		return mons[i].Domain < mons[j].Domain
+	})
+
+	return mons
+}
+
+// AssignCPUs to the resource group, the CPUs are added to the CPUs already in
+// the group and the kernel removes them from the group they were in.
+func (r *Resctrl) AssignCPUs(name string, cpus []int) error {
+
+	g, err := r.Group(name)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[int]bool)
+	for _, c := range g.CPUs {
+		set[c] = true
+	}
+	for _, c := range cpus {
+		if c < 0 {
+			return fmt.Errorf("invalid cpu %d", c)
+		}
+		set[c] = true
+	}
+	list := make([]int, 0, len(set))
+	for c := range set {
+		list = append(list, c)
+	}
+
+	file := filepath.Join(g.Path, "cpus_list")
+	if err := ioutil.WriteFile(file, []byte(topology.FormatCPUList(list)+"\n"), 0644); err != nil {
+		return fmt.Errorf("assign cpus to %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// L3Mask returns the L3 cache mask of the group for the domain
+func (g *Group) L3Mask(domain int) string {
+
+	if l3, ok := g.Schemata["L3"]; ok {
+		return l3[domain]
+	}
+	return ""
+}
+
+// Domains returns the sorted domain ids of the resource in the schemata, the
+// ids are not always dense.
+func (g *Group) Domains(resource string) []int {
+
+	domains := []int{}
+	for d := range g.Schemata[resource] {
+		domains = append(domains, d)
+	}
+	sort.Ints(domains)
+
+	return domains
+}
+
+// Occupancy returns the total L3 occupancy in bytes over all domains
+func (g *Group) Occupancy() uint64 {
+
+	total := uint64(0)
+	for _, m := range g.Monitors {
+		total += m.LLCOccupancy
+	}
+	return total
+}
+
+// HasCPU returns true if the CPU is assigned to the group
+func (g *Group) HasCPU(cpu int) bool {
+
+	for _, c := range g.CPUs {
+		if c == cpu {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSchemata file data into resource -> domain -> value, e.g.
+//
+//	L3:0=7ff;1=7ff
+//	MB:0=100;1=100
+func ParseSchemata(s string) map[string]map[int]string {
+
+	schemata := make(map[string]map[int]string)
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+		res := strings.TrimSpace(line[:i])
+		domains := make(map[int]string)
+
+		for _, d := range strings.Split(line[i+1:], ";") {
+			kv := strings.SplitN(d, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			id, err := strconv.Atoi(strings.TrimSpace(kv[0]))
+			if err != nil {
+				continue
+			}
+			domains[id] = strings.TrimSpace(kv[1])
+		}
+		schemata[res] = domains
+	}
+
+	return schemata
+}
+
+// CBMBits returns the number of cache ways set in the hex cache bit mask
+func CBMBits(mask string) int {
+
+	v, err := strconv.ParseUint(strings.TrimPrefix(mask, "0x"), 16, 64)
+	if err != nil {
+		return 0
+	}
+	return bits.OnesCount64(v)
+}
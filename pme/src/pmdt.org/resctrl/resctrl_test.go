@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package resctrl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeTree creates a fake resctrl file system
+func makeTree(t *testing.T) string {
+
+	root, err := ioutil.TempDir("", "resctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"info/L3/cbm_mask":                        "7ff",
+		"info/L3/num_closids":                     "16",
+		"info/L3/min_cbm_bits":                    "1",
+		"info/L3_MON/num_rmids":                   "224",
+		"info/L3_MON/mon_features":                "llc_occupancy\nmbm_total_bytes\nmbm_local_bytes",
+		"cpus_list":                               "0-3,6-7",
+		"schemata":                                "L3:0=7ff;1=7ff\nMB:0=100;1=100",
+		"mode":                                    "shareable",
+		"mon_data/mon_L3_00/llc_occupancy":        "1048576",
+		"mon_data/mon_L3_00/mbm_total_bytes":      "5000",
+		"mon_data/mon_L3_00/mbm_local_bytes":      "4000",
+		"mon_data/mon_L3_01/llc_occupancy":        "2048",
+		"dpdk/cpus_list":                          "4-5",
+		"dpdk/schemata":                           "L3:0=600;1=7ff\nMB:0=100;1=100",
+		"dpdk/mode":                               "exclusive",
+		"dpdk/mon_data/mon_L3_00/llc_occupancy":   "524288",
+		"dpdk/mon_data/mon_L3_00/mbm_total_bytes": "100",
+		"dpdk/mon_data/mon_L3_00/mbm_local_bytes": "90",
+		"dpdk/mon_groups/.keep":                   "",
+		"mon_groups/.keep":                        "",
+	}
+	writeTree(t, root, files)
+
+	return root
+}
+
+// writeTree writes the files of a fake file system under root, the file data
+// ends with a newline as in sysfs
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSchemata(t *testing.T) {
+
+	s := ParseSchemata("L3:0=7ff;1=0f0\nMB:0=100;1=50\n")
+
+	if s["L3"][1] != "0f0" || s["MB"][1] != "50" {
+		t.Errorf("ParseSchemata = %v", s)
+	}
+	g := Group{Schemata: ParseSchemata("L3:2=7ff;0=0f0\n")}
+	if d := g.Domains("L3"); !reflect.DeepEqual(d, []int{0, 2}) {
+		t.Errorf("Domains(L3) = %v", d)
+	}
+	if d := g.Domains("MB"); len(d) != 0 {
+		t.Errorf("Domains(MB) = %v", d)
+	}
+	if n := CBMBits("0f0"); n != 4 {
+		t.Errorf("CBMBits(0f0) = %d", n)
+	}
+}
+
+func TestGroups(t *testing.T) {
+
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	if _, err := New(filepath.Join(root, "missing")); err == nil {
+		t.Errorf("New on a missing mount should fail")
+	}
+
+	r, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := r.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.L3Supported || info.L3NumClosids != 16 || info.L3CbmMask != "7ff" {
+		t.Errorf("L3 info = %+v", info)
+	}
+	if !info.MonL3Supported || len(info.MonFeatures) != 3 || info.MBSupported {
+		t.Errorf("monitor info = %+v", info)
+	}
+
+	groups, err := r.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Groups = %d, want 2", len(groups))
+	}
+
+	def := groups[0]
+	if def.Name != DefaultGroup || def.Occupancy() != 1048576+2048 || len(def.Monitors) != 2 {
+		t.Errorf("default group = %+v", def)
+	}
+
+	g := groups[1]
+	if g.Name != "dpdk" || g.Mode != "exclusive" || g.L3Mask(0) != "600" || !g.HasCPU(5) {
+		t.Errorf("dpdk group = %+v", g)
+	}
+	if g.Monitors[0].MBMLocalBytes != 90 {
+		t.Errorf("dpdk monitor = %+v", g.Monitors[0])
+	}
+
+	if err := r.AssignCPUs("dpdk", []int{8, 9, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if g, err = r.Group("dpdk"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.CPUs, []int{4, 5, 8, 9}) {
+		t.Errorf("AssignCPUs = %v", g.CPUs)
+	}
+	if err := r.AssignCPUs("missing", []int{1}); err == nil {
+		t.Errorf("AssignCPUs to a missing group should fail")
+	}
+}
@@ -0,0 +1,3 @@
+module pmdt.org/topology
+
+go 1.14
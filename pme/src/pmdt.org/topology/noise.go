@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit the kernel noise on a set of CPUs, the lcores of a DPDK application.
+// A poll mode lcore should run only its own thread, the kernel parameters
+// isolcpus, nohz_full and rcu_nocbs keep the scheduler, the timer tick and
+// the RCU callbacks away from it. The interrupts each CPU takes are counted
+// from /proc/interrupts and the other tasks allowed to run on the CPUs are
+// found from the Cpus_allowed_list of /proc/<pid>/task/<tid>/status. The
+// per-CPU kernel threads like ksoftirqd and migration are bound to one CPU,
+// they can not be moved and are counted apart from the other kernel threads.
+
+// KernelParams are the CPU isolation parameters of the kernel command line
+type KernelParams struct {
+	Isolated []int // isolcpus
+	NoHzFull []int // nohz_full
+	RcuNoCbs []int // rcu_nocbs
+}
+
+// Interrupts are the interrupt counts of each CPU since boot
+type Interrupts struct {
+	PerCPU map[int]uint64            // Total of all interrupts of the CPU
+	PerIRQ map[string]map[int]uint64 // Counts of each IRQ per CPU
+}
+
+// Task allowed to run on some of the audited CPUs
+type Task struct {
+	PID    int // Thread group id of the process
+	TID    int
+	Name   string
+	Kernel bool  // Kernel thread
+	Bound  bool  // Kernel thread bound to a single CPU
+	CPUs   []int // Audited CPUs the task is allowed to run on
+}
+
+// Noise reads the kernel noise sources from procfs
+type Noise struct {
+	root string
+}
+
+// NewNoise creates a noise reader, root is the optional root of the file
+// system used to find proc.
+func NewNoise(root ...string) *Noise {
+
+	n := &Noise{root: "/"}
+	if len(root) > 0 && len(root[0]) > 0 {
+		n.root = root[0]
+	}
+	return n
+}
+
+// path returns the path of the file under the root
+func (n *Noise) path(elem ...string) string {
+	return filepath.Join(append([]string{n.root}, elem...)...)
+}
+
+// KernelParams reads the isolation parameters from the kernel command line
+func (n *Noise) KernelParams() (KernelParams, error) {
+
+	return cmdlineLists(n.path("proc", "cmdline"))
+}
+
+// Interrupts reads the interrupt counts of each CPU, the columns of the
+// header are the online CPUs which are not always 0 to N-1
+func (n *Noise) Interrupts() (Interrupts, error) {
+
+	irqs := Interrupts{PerCPU: make(map[int]uint64), PerIRQ: make(map[string]map[int]uint64)}
+
+	f, err := os.Open(n.path("proc", "interrupts"))
+	if err != nil {
+		return irqs, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	cpus := []int{}
+	if scanner.Scan() {
+		for _, col := range strings.Fields(scanner.Text()) {
+			id, err := strconv.Atoi(strings.TrimPrefix(col, "CPU"))
+			if err != nil {
+				return irqs, fmt.Errorf("invalid interrupts header column %q", col)
+			}
+			cpus = append(cpus, id)
+		}
+	}
+	if len(cpus) == 0 {
+		return irqs, fmt.Errorf("no CPUs in %s", n.path("proc", "interrupts"))
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			continue
+		}
+		irq := strings.TrimSuffix(fields[0], ":")
+
+		counts := make(map[int]uint64)
+		n := 0
+		for i, id := range cpus {
+			if i+1 >= len(fields) {
+				break
+			}
+			v, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				break
+			}
+			counts[id] = v
+			n++
+		}
+
+		// Lines like ERR and MIS have a single count and no CPU columns, the
+		// count is not of the first CPU
+		if n < len(cpus) {
+			continue
+		}
+		for id, v := range counts {
+			irqs.PerCPU[id] += v
+		}
+
+		// Name the IRQ by the label after the counts, the chip and device of
+		// a numbered IRQ or the description of LOC, RES and the others
+		if label := fields[n+1:]; len(label) > 0 {
+			irq += " " + strings.Join(label, " ")
+		}
+		irqs.PerIRQ[irq] = counts
+	}
+
+	return irqs, scanner.Err()
+}
+
+// readStatus reads the fields of a status file
+func readStatus(file string) (map[string]string, error) {
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(dat), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	return fields, nil
+}
+
+// Tasks returns the threads allowed to run on any of the CPUs, the threads of
+// the process with the exclude pid are not returned. A task allowed on all
+// CPUs is reported as it can be scheduled on the CPUs when they are not
+// isolated.
+func (n *Noise) Tasks(cpus []int, exclude int) ([]Task, error) {
+
+	audited := toSet(cpus)
+
+	dirs, err := filepath.Glob(n.path("proc", "[0-9]*", "task", "[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := []Task{}
+	for _, dir := range dirs {
+		status, err := readStatus(filepath.Join(dir, "status"))
+		if err != nil {
+			// The task exited
+			continue
+		}
+		pid, _ := strconv.Atoi(status["Tgid"])
+		if pid == exclude {
+			continue
+		}
+		allowed, err := ParseCPUList(status["Cpus_allowed_list"])
+		if err != nil {
+			continue
+		}
+
+		t := Task{PID: pid, Name: status["Name"]}
+		t.TID, _ = strconv.Atoi(status["Pid"])
+		for _, c := range allowed {
+			if audited[c] {
+				t.CPUs = append(t.CPUs, c)
+			}
+		}
+		if len(t.CPUs) == 0 {
+			continue
+		}
+
+		// Older kernels have no Kthread field, kernel threads are children
+		// of kthreadd
+		if k, ok := status["Kthread"]; ok {
+			t.Kernel = k == "1"
+		} else {
+			t.Kernel = status["PPid"] == "2" || pid == 2
+		}
+		t.Bound = t.Kernel && len(allowed) == 1
+
+		tasks = append(tasks, t)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].PID != tasks[j].PID {
+			return tasks[i].PID < tasks[j].PID
+		}
+		return tasks[i].TID < tasks[j].TID
+	})
+
+	return tasks, nil
+}
+
+// CPUNoise of an audited CPU
+type CPUNoise struct {
+	CPU       int
+	Isolated  bool
+	NoHzFull  bool
+	RcuNoCbs  bool
+	IRQs      uint64  // Interrupts in the last interval
+	IRQRate   float64 // Interrupts per second in the last interval
+	IRQTotal  uint64  // Interrupts since the audit started
+	TopIRQ    string  // IRQ with the most interrupts in the last interval
+	Tasks     int     // Other user tasks allowed on the CPU
+	Kernel    int     // Kernel threads allowed on the CPU and others
+	Bound     int     // Per-CPU kernel threads bound to the CPU
+	Intervals int     // Intervals with interrupts
+}
+
+// Audit keeps the interrupt counts of the previous sample to count the
+// interference of each CPU over time
+type Audit struct {
+	noise    *Noise
+	params   KernelParams
+	prev     Interrupts
+	prevTime time.Time // Time of the previous sample
+	cpus     map[int]*CPUNoise
+	tasks    []Task
+	now      func() time.Time // Replaced in the tests
+}
+
+// NewAudit creates an audit of the noise, the kernel parameters are read once
+func NewAudit(n *Noise) (*Audit, error) {
+
+	params, err := n.KernelParams()
+	if err != nil {
+		return nil, err
+	}
+	return &Audit{noise: n, params: params, cpus: make(map[int]*CPUNoise), now: time.Now}, nil
+}
+
+// Params returns the kernel isolation parameters
+func (a *Audit) Params() KernelParams {
+	return a.params
+}
+
+// Sample the interrupts and the tasks of the CPUs, exclude is the pid of the
+// process that owns the CPUs. The first sample has no interrupt counts, the
+// rate is the interrupts over the time since the previous sample.
+func (a *Audit) Sample(cpus []int, exclude int) error {
+
+	irqs, err := a.noise.Interrupts()
+	if err != nil {
+		return err
+	}
+	now := a.now()
+	elapsed := now.Sub(a.prevTime).Seconds()
+	tasks, err := a.noise.Tasks(cpus, exclude)
+	if err != nil {
+		return err
+	}
+
+	isol, nohz, rcu := toSet(a.params.Isolated), toSet(a.params.NoHzFull), toSet(a.params.RcuNoCbs)
+
+	for _, c := range cpus {
+		cn, ok := a.cpus[c]
+		if !ok {
+			cn = &CPUNoise{CPU: c, Isolated: isol[c], NoHzFull: nohz[c], RcuNoCbs: rcu[c]}
+			a.cpus[c] = cn
+		}
+
+		cn.IRQs, cn.IRQRate, cn.TopIRQ = 0, 0, ""
+		if a.prev.PerCPU != nil {
+			if cur, prev := irqs.PerCPU[c], a.prev.PerCPU[c]; cur >= prev {
+				cn.IRQs = cur - prev
+			}
+			top := uint64(0)
+			for irq, counts := range irqs.PerIRQ {
+				prev := a.prev.PerIRQ[irq][c]
+				if d := counts[c] - prev; counts[c] >= prev && d > top {
+					top, cn.TopIRQ = d, irq
+				}
+			}
+		}
+		if cn.IRQs > 0 && elapsed > 0 {
+			cn.IRQRate = float64(cn.IRQs) / elapsed
+		}
+		cn.IRQTotal += cn.IRQs
+
+		cn.Tasks, cn.Kernel, cn.Bound = 0, 0, 0
+		for _, t := range tasks {
+			for _, tc := range t.CPUs {
+				if tc != c {
+					continue
+				}
+				switch {
+				case t.Bound:
+					cn.Bound++
+				case t.Kernel:
+					cn.Kernel++
+				default:
+					cn.Tasks++
+				}
+			}
+		}
+		if cn.IRQs > 0 {
+			cn.Intervals++
+		}
+	}
+
+	a.prev = irqs
+	a.prevTime = now
+	a.tasks = tasks
+
+	return nil
+}
+
+// CPUs returns the noise of the audited CPUs sorted by CPU
+func (a *Audit) CPUs(cpus []int) []CPUNoise {
+
+	list := []CPUNoise{}
+	for _, c := range cpus {
+		if cn, ok := a.cpus[c]; ok {
+			list = append(list, *cn)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CPU < list[j].CPU })
+
+	return list
+}
+
+// Tasks returns the tasks of the last sample
+func (a *Audit) Tasks() []Task {
+	return a.tasks
+}
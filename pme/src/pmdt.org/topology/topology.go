@@ -0,0 +1,406 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+// Package topology - CPU topology from sysfs
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Read the CPUs of the system from /sys/devices/system/cpu. The CPU ids are
+// not always 0 to N-1 and not all CPUs are online, the topology files of an
+// offline CPU do not exist so its core and package are -1. Hybrid CPUs list
+// the performance and efficient cores in the cpus file of the cpu_core and
+// cpu_atom PMUs. The isolated and nohz_full CPUs are read from sysfs and from
+// the kernel command line when sysfs does not have them.
+
+// CoreType of a hybrid CPU
+type CoreType int
+
+// Core types, all cores of a CPU that is not hybrid have the type CoreAny
+const (
+	CoreAny CoreType = iota
+	CorePerformance
+	CoreEfficient
+)
+
+// CPU in the topology
+type CPU struct {
+	ID       int
+	Online   bool
+	Core     int // core_id, -1 when offline
+	Package  int
+	Die      int
+	Cluster  int
+	Node     int // NUMA node, -1 if unknown
+	Type     CoreType
+	Siblings []int // Hyperthreads of the core including the CPU
+	Isolated bool  // In the isolcpus list
+	NoHzFull bool  // In the nohz_full list
+}
+
+// Topology of the CPUs of the system
+type Topology struct {
+	root     string
+	cpus     []CPU // Sorted by ID
+	index    map[int]int
+	hybrid   bool
+	isolated []int
+	nohzFull []int
+}
+
+// String of the core type
+func (t CoreType) String() string {
+
+	switch t {
+	case CorePerformance:
+		return "P-core"
+	case CoreEfficient:
+		return "E-core"
+	}
+	return "core"
+}
+
+// ParseCPUList parses a CPU list like 1-3,8 as used by the kernel and DPDK
+func ParseCPUList(list string) ([]int, error) {
+
+	found := make(map[int]bool)
+	for _, item := range strings.Split(strings.TrimSpace(list), ",") {
+		if len(item) == 0 {
+			continue
+		}
+		r := strings.SplitN(item, "-", 2)
+		lo, err := strconv.Atoi(r[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		hi := lo
+		if len(r) == 2 {
+			if hi, err = strconv.Atoi(r[1]); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid CPU range %q", item)
+			}
+		}
+		for c := lo; c <= hi; c++ {
+			found[c] = true
+		}
+	}
+
+	cpus := []int{}
+	for c := range found {
+		cpus = append(cpus, c)
+	}
+	sort.Ints(cpus)
+
+	return cpus, nil
+}
+
+// FormatCPUList formats the CPUs as a kernel CPU list like 1-3,8
+func FormatCPUList(cpus []int) string {
+
+	sorted := append([]int{}, cpus...)
+	sort.Ints(sorted)
+
+	items := []string{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		if sorted[i] == sorted[j] {
+			items = append(items, strconv.Itoa(sorted[i]))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ",")
+}
+
+// New reads the topology, root is the optional root of the file system used
+// to find sys and proc.
+func New(root ...string) (*Topology, error) {
+
+	t := &Topology{root: "/", index: make(map[int]int)}
+	if len(root) > 0 && len(root[0]) > 0 {
+		t.root = root[0]
+	}
+
+	present, err := t.readList("sys", "devices", "system", "cpu", "present")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the present CPUs: %v", err)
+	}
+	online, err := t.readList("sys", "devices", "system", "cpu", "online")
+	if err != nil {
+		online = present
+	}
+	onlineSet := toSet(online)
+
+	t.isolated, _ = t.readList("sys", "devices", "system", "cpu", "isolated")
+	t.nohzFull, _ = t.readList("sys", "devices", "system", "cpu", "nohz_full")
+	if len(t.isolated) == 0 || len(t.nohzFull) == 0 {
+		p, _ := cmdlineLists(t.path("proc", "cmdline"))
+		if len(t.isolated) == 0 {
+			t.isolated = p.Isolated
+		}
+		if len(t.nohzFull) == 0 {
+			t.nohzFull = p.NoHzFull
+		}
+	}
+	isolSet, nohzSet := toSet(t.isolated), toSet(t.nohzFull)
+
+	pCores, _ := t.readList("sys", "devices", "cpu_core", "cpus")
+	eCores, _ := t.readList("sys", "devices", "cpu_atom", "cpus")
+	t.hybrid = len(pCores) > 0 && len(eCores) > 0
+	pSet, eSet := toSet(pCores), toSet(eCores)
+
+	for _, id := range present {
+		c := CPU{ID: id, Online: onlineSet[id], Isolated: isolSet[id], NoHzFull: nohzSet[id]}
+
+		c.Core = t.readInt(id, "topology", "core_id")
+		c.Package = t.readInt(id, "topology", "physical_package_id")
+		c.Die = t.readInt(id, "topology", "die_id")
+		c.Cluster = t.readInt(id, "topology", "cluster_id")
+		c.Node = t.node(id)
+		c.Siblings, _ = t.readList(t.cpuPath(id, "topology", "thread_siblings_list")...)
+
+		switch {
+		case pSet[id]:
+			c.Type = CorePerformance
+		case eSet[id]:
+			c.Type = CoreEfficient
+		}
+
+		t.index[id] = len(t.cpus)
+		t.cpus = append(t.cpus, c)
+	}
+
+	if len(t.cpus) == 0 {
+		return nil, fmt.Errorf("no CPUs found in %s", t.path("sys", "devices", "system", "cpu"))
+	}
+
+	return t, nil
+}
+
+// path returns the path of the file under the root
+func (t *Topology) path(elem ...string) string {
+	return filepath.Join(append([]string{t.root}, elem...)...)
+}
+
+// cpuPath returns the elements of the path of a file of the CPU
+func (t *Topology) cpuPath(id int, elem ...string) []string {
+	return append([]string{"sys", "devices", "system", "cpu", fmt.Sprintf("cpu%d", id)}, elem...)
+}
+
+// readList reads a file with a CPU list
+func (t *Topology) readList(elem ...string) ([]int, error) {
+
+	dat, err := ioutil.ReadFile(t.path(elem...))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(string(dat))
+}
+
+// readInt reads a topology file of the CPU, -1 if it does not exist
+func (t *Topology) readInt(id int, elem ...string) int {
+
+	dat, err := ioutil.ReadFile(t.path(t.cpuPath(id, elem...)...))
+	if err != nil {
+		return -1
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(dat)))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// node returns the NUMA node of the CPU from its nodeN link, -1 if unknown
+func (t *Topology) node(id int) int {
+
+	dirs, _ := filepath.Glob(t.path(t.cpuPath(id, "node*")...))
+	for _, dir := range dirs {
+		if v, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node")); err == nil {
+			return v
+		}
+	}
+	return -1
+}
+
+// cmdlineLists returns the isolcpus, nohz_full and rcu_nocbs lists of the
+// kernel command line file, the isolcpus list can have flags before it like
+// domain,managed_irq,2-5
+func cmdlineLists(file string) (KernelParams, error) {
+
+	p := KernelParams{}
+
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		return p, err
+	}
+	for _, arg := range strings.Fields(string(dat)) {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "isolcpus":
+			p.Isolated = flaggedList(kv[1])
+		case "nohz_full":
+			p.NoHzFull, _ = ParseCPUList(kv[1])
+		case "rcu_nocbs":
+			p.RcuNoCbs, _ = ParseCPUList(kv[1])
+		}
+	}
+	return p, nil
+}
+
+// flaggedList parses a CPU list with leading flags, the flags are skipped
+func flaggedList(val string) []int {
+
+	items := []string{}
+	for _, item := range strings.Split(val, ",") {
+		if len(item) > 0 && item[0] >= '0' && item[0] <= '9' {
+			items = append(items, item)
+		}
+	}
+	cpus, _ := ParseCPUList(strings.Join(items, ","))
+	return cpus
+}
+
+// toSet of the CPU list
+func toSet(cpus []int) map[int]bool {
+
+	s := make(map[int]bool)
+	for _, c := range cpus {
+		s[c] = true
+	}
+	return s
+}
+
+// CPUs returns all present CPUs sorted by ID
+func (t *Topology) CPUs() []CPU {
+	return t.cpus
+}
+
+// CPU returns the CPU with the ID
+func (t *Topology) CPU(id int) (CPU, bool) {
+
+	i, ok := t.index[id]
+	if !ok {
+		return CPU{ID: id, Core: -1, Package: -1, Die: -1, Cluster: -1, Node: -1}, false
+	}
+	return t.cpus[i], true
+}
+
+// Online returns the IDs of the online CPUs
+func (t *Topology) Online() []int {
+
+	ids := []int{}
+	for _, c := range t.cpus {
+		if c.Online {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// IsOnline returns true if the CPU is present and online
+func (t *Topology) IsOnline(id int) bool {
+
+	c, ok := t.CPU(id)
+	return ok && c.Online
+}
+
+// MaxID returns the highest CPU ID
+func (t *Topology) MaxID() int {
+	return t.cpus[len(t.cpus)-1].ID
+}
+
+// Hybrid returns true if the CPU has performance and efficient cores
+func (t *Topology) Hybrid() bool {
+	return t.hybrid
+}
+
+// Isolated returns the isolcpus CPUs
+func (t *Topology) Isolated() []int {
+	return t.isolated
+}
+
+// NoHzFull returns the nohz_full CPUs
+func (t *Topology) NoHzFull() []int {
+	return t.nohzFull
+}
+
+// Packages returns the packages of the online CPUs
+func (t *Topology) Packages() []int {
+
+	found := make(map[int]bool)
+	for _, c := range t.cpus {
+		if c.Online && c.Package >= 0 {
+			found[c.Package] = true
+		}
+	}
+
+	pkgs := []int{}
+	for p := range found {
+		pkgs = append(pkgs, p)
+	}
+	sort.Ints(pkgs)
+
+	return pkgs
+}
+
+// FirstCPU returns the lowest online CPU of the package, -1 if none
+func (t *Topology) FirstCPU(pkg int) int {
+
+	for _, c := range t.cpus {
+		if c.Online && c.Package == pkg {
+			return c.ID
+		}
+	}
+	return -1
+}
+
+// NodePackage returns the package of the CPUs of the NUMA node, -1 if the
+// node has no CPUs. A package has more than one node with sub-NUMA clustering.
+func (t *Topology) NodePackage(node int) int {
+
+	for _, c := range t.cpus {
+		if c.Node == node && c.Package >= 0 {
+			return c.Package
+		}
+	}
+	return -1
+}
+
+// Label of the CPU with the core type of hybrid CPUs and the offline,
+// isolated and nohz_full state, e.g. "5 P-core iso"
+func (t *Topology) Label(id int) string {
+
+	c, ok := t.CPU(id)
+	if !ok {
+		return strconv.Itoa(id)
+	}
+
+	label := strconv.Itoa(id)
+	if t.hybrid {
+		label += " " + c.Type.String()
+	}
+	if !c.Online {
+		return label + " off"
+	}
+	if c.Isolated {
+		label += " iso"
+	}
+	if c.NoHzFull {
+		label += " nohz"
+	}
+	return label
+}
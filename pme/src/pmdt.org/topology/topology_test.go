@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: BSD-3-Clause
+// Copyright(c) 2019-2020 Intel Corporation
+
+package topology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeTree writes the files of a fake file system under root, the file data
+// ends with a newline as in sysfs
+func writeTree(t *testing.T, root string, files map[string]string) {
+
+	for name, data := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// makeTree creates a fake root with a hybrid CPU of CPUs 0-3 and 8, CPU 3 is
+// offline, CPUs 0-1 are a P-core and 2-3 and 8 are E-cores. CPU 2 is isolated
+// on the command line and 8 in sysfs.
+func makeTree(t *testing.T) string {
+
+	root, err := ioutil.TempDir("", "topology")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sys := "sys/devices/system/cpu/"
+	files := map[string]string{
+		sys + "present":             "0-3,8",
+		sys + "online":              "0-2,8",
+		sys + "isolated":            "8",
+		"sys/devices/cpu_core/cpus": "0-1",
+		"sys/devices/cpu_atom/cpus": "2-3,8",
+		"proc/cmdline":              "BOOT_IMAGE=/vmlinuz isolcpus=domain,managed_irq,2 nohz_full=2,8 quiet",
+	}
+	for _, cpu := range []struct {
+		name, core, siblings string
+	}{
+		{"cpu0", "0", "0-1"},
+		{"cpu1", "0", "0-1"},
+		{"cpu2", "8", "2"},
+		{"cpu8", "9", "8"},
+	} {
+		files[sys+cpu.name+"/topology/core_id"] = cpu.core
+		files[sys+cpu.name+"/topology/physical_package_id"] = "0"
+		files[sys+cpu.name+"/topology/die_id"] = "0"
+		files[sys+cpu.name+"/topology/cluster_id"] = cpu.core
+		files[sys+cpu.name+"/topology/thread_siblings_list"] = cpu.siblings
+		files[sys+cpu.name+"/node0/cpumap"] = ""
+	}
+	writeTree(t, root, files)
+
+	return root
+}
+
+func TestTopology(t *testing.T) {
+
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+
+	topo, err := New(root)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if got := topo.Online(); !reflect.DeepEqual(got, []int{0, 1, 2, 8}) {
+		t.Errorf("online %v", got)
+	}
+	if topo.MaxID() != 8 || !topo.Hybrid() || topo.IsOnline(3) {
+		t.Errorf("max %d, hybrid %v, cpu 3 online", topo.MaxID(), topo.Hybrid())
+	}
+
+	c, ok := topo.CPU(1)
+	if !ok || c.Core != 0 || c.Package != 0 || c.Node != 0 || c.Type != CorePerformance ||
+		!reflect.DeepEqual(c.Siblings, []int{0, 1}) {
+		t.Errorf("cpu 1 %+v", c)
+	}
+	if c, _ := topo.CPU(3); c.Online || c.Core != -1 || c.Type != CoreEfficient {
+		t.Errorf("offline cpu 3 %+v", c)
+	}
+
+	// sysfs has the isolated CPUs, the command line has nohz_full
+	if !reflect.DeepEqual(topo.Isolated(), []int{8}) || !reflect.DeepEqual(topo.NoHzFull(), []int{2, 8}) {
+		t.Errorf("isolated %v, nohz_full %v", topo.Isolated(), topo.NoHzFull())
+	}
+
+	for id, want := range map[int]string{0: "0 P-core", 3: "3 E-core off", 8: "8 E-core iso nohz", 5: "5"} {
+		if got := topo.Label(id); got != want {
+			t.Errorf("label of %d %q, want %q", id, got, want)
+		}
+	}
+	if !reflect.DeepEqual(topo.Packages(), []int{0}) || topo.FirstCPU(0) != 0 || topo.FirstCPU(1) != -1 {
+		t.Errorf("packages %v", topo.Packages())
+	}
+	if topo.NodePackage(0) != 0 || topo.NodePackage(1) != -1 {
+		t.Errorf("node 0 package %d, node 1 package %d", topo.NodePackage(0), topo.NodePackage(1))
+	}
+}
+
+func TestCPUList(t *testing.T) {
+
+	tests := []struct {
+		list string
+		cpus []int
+		str  string // Formatted list
+	}{
+		{"", []int{}, ""},
+		{"3", []int{3}, "3"},
+		{"0-3,8,10-11", []int{0, 1, 2, 3, 8, 10, 11}, "0-3,8,10-11"},
+		{"0-2,8,4-5\n", []int{0, 1, 2, 4, 5, 8}, "0-2,4-5,8"},
+		{"8,1-3,2", []int{1, 2, 3, 8}, "1-3,8"},
+	}
+	for _, tt := range tests {
+		cpus, err := ParseCPUList(tt.list)
+		if err != nil || !reflect.DeepEqual(cpus, tt.cpus) {
+			t.Errorf("ParseCPUList(%q) = %v, %v, want %v", tt.list, cpus, err, tt.cpus)
+		}
+		if s := FormatCPUList(cpus); s != tt.str {
+			t.Errorf("FormatCPUList(%v) = %q, want %q", cpus, s, tt.str)
+		}
+	}
+	for _, list := range []string{"a", "3-1", "1-x"} {
+		if _, err := ParseCPUList(list); err == nil {
+			t.Errorf("ParseCPUList(%q) did not fail", list)
+		}
+	}
+	if s := FormatCPUList([]int{5, 1, 2, 2, 3, 7, 7}); s != "1-3,5,7" {
+		t.Errorf("FormatCPUList unsorted = %q", s)
+	}
+	if cpus := flaggedList("domain,managed_irq,2-3,6"); !reflect.DeepEqual(cpus, []int{2, 3, 6}) {
+		t.Errorf("flaggedList %v", cpus)
+	}
+}
+
+func TestNoise(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "noise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	status := "Name:\t%s\nTgid:\t%d\nPid:\t%d\nPPid:\t%d\nKthread:\t%d\nCpus_allowed_list:\t%s"
+	writeTree(t, root, map[string]string{
+		"proc/cmdline": "isolcpus=managed_irq,2-3 nohz_full=2-3 rcu_nocbs=3",
+		"proc/interrupts": "           CPU0       CPU2       CPU3\n" +
+			"  0:         10          0          0   IO-APIC   2-edge      timer\n" +
+			"LOC:        100         50          5   Local timer interrupts\n" +
+			"ERR:          7",
+		"proc/1/task/1/status":     fmt.Sprintf(status, "init", 1, 1, 0, 0, "0-3"),
+		"proc/20/task/20/status":   fmt.Sprintf(status, "ksoftirqd/2", 20, 20, 2, 1, "2"),
+		"proc/30/task/30/status":   fmt.Sprintf(status, "kworker/u8:1", 30, 30, 2, 1, "0-3"),
+		"proc/300/task/300/status": fmt.Sprintf(status, "dpdk-app", 300, 300, 1, 0, "0-3"),
+		"proc/300/task/301/status": fmt.Sprintf(status, "lcore-2", 300, 301, 1, 0, "2"),
+		"proc/400/task/400/status": fmt.Sprintf(status, "sshd", 400, 400, 1, 0, "0"),
+	})
+
+	n := NewNoise(root)
+
+	irqs, err := n.Interrupts()
+	if err != nil {
+		t.Fatalf("Interrupts failed: %v", err)
+	}
+	if irqs.PerCPU[0] != 110 || irqs.PerCPU[2] != 50 || irqs.PerCPU[3] != 5 {
+		t.Errorf("interrupts per CPU %v", irqs.PerCPU)
+	}
+	if irqs.PerIRQ["0 IO-APIC 2-edge timer"][0] != 10 || irqs.PerIRQ["LOC Local timer interrupts"][2] != 50 {
+		t.Errorf("interrupts per IRQ %v", irqs.PerIRQ)
+	}
+	// The ERR count is not of CPU 0
+	if _, ok := irqs.PerIRQ["ERR"]; ok {
+		t.Errorf("ERR interrupts %v", irqs.PerIRQ)
+	}
+
+	tasks, err := n.Tasks([]int{2, 3}, 300)
+	if err != nil || len(tasks) != 3 {
+		t.Fatalf("Tasks %v %v", tasks, err)
+	}
+	if tasks[0].Name != "init" || tasks[0].Kernel || !reflect.DeepEqual(tasks[0].CPUs, []int{2, 3}) {
+		t.Errorf("task %+v", tasks[0])
+	}
+	if tasks[1].Name != "ksoftirqd/2" || !tasks[1].Kernel || !tasks[1].Bound {
+		t.Errorf("task %+v", tasks[1])
+	}
+	if tasks[2].Name != "kworker/u8:1" || !tasks[2].Kernel || tasks[2].Bound {
+		t.Errorf("task %+v", tasks[2])
+	}
+
+	a, err := NewAudit(n)
+	if err != nil {
+		t.Fatalf("NewAudit failed: %v", err)
+	}
+	if p := a.Params(); !reflect.DeepEqual(p.Isolated, []int{2, 3}) || !reflect.DeepEqual(p.RcuNoCbs, []int{3}) {
+		t.Errorf("params %+v", p)
+	}
+	// The second sample is two seconds after the first
+	start := time.Now()
+	a.now = func() time.Time { return start }
+	if err := a.Sample([]int{2, 3}, 300); err != nil {
+		t.Fatalf("Sample failed: %v", err)
+	}
+	a.now = func() time.Time { return start.Add(2 * time.Second) }
+
+	writeTree(t, root, map[string]string{
+		"proc/interrupts": "           CPU0       CPU2       CPU3\n" +
+			"  0:         10          4          0   IO-APIC   2-edge      timer\n" +
+			"LOC:        100         60          5   Local timer interrupts",
+	})
+	if err := a.Sample([]int{2, 3}, 300); err != nil {
+		t.Fatalf("Sample failed: %v", err)
+	}
+
+	cpus := a.CPUs([]int{3, 2})
+	if len(cpus) != 2 {
+		t.Fatalf("CPUs %v", cpus)
+	}
+	c2, c3 := cpus[0], cpus[1]
+	if c2.CPU != 2 || c2.IRQs != 14 || c2.IRQRate != 7 || c2.IRQTotal != 14 || c2.TopIRQ != "LOC Local timer interrupts" ||
+		c2.Tasks != 1 || c2.Kernel != 1 || c2.Bound != 1 || c2.Intervals != 1 || !c2.NoHzFull || c2.RcuNoCbs {
+		t.Errorf("cpu 2 %+v", c2)
+	}
+	if c3.IRQs != 0 || c3.IRQRate != 0 || c3.TopIRQ != "" || c3.Tasks != 1 || c3.Kernel != 1 || c3.Bound != 0 ||
+		c3.Intervals != 0 || !c3.RcuNoCbs {
+		t.Errorf("cpu 3 %+v", c3)
+	}
+}